@@ -4,8 +4,6 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
 	"database/sql"
 
 	"trackr/internal/platform/config"
@@ -86,25 +84,8 @@ func migrateTenant(db *sql.DB, direction string) error {
 }
 
 func runMigrations(db *sql.DB, dir string, direction string) error {
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		return fmt.Errorf("failed to read migration directory: %w", err)
-	}
-
-	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".sql" {
-			// A very simple migration runner that runs all SQL files.
-			// In production, we should track applied migrations in a table.
-			content, err := os.ReadFile(filepath.Join(dir, file.Name()))
-			if err != nil {
-				return fmt.Errorf("failed to read migration file %s: %w", file.Name(), err)
-			}
-
-			log.Printf("Applying migration: %s", file.Name())
-			if _, err := db.Exec(string(content)); err != nil {
-				return fmt.Errorf("failed to execute migration %s: %w", file.Name(), err)
-			}
-		}
+	if direction != "up" {
+		return fmt.Errorf("unsupported direction %q: only up migrations are supported", direction)
 	}
-	return nil
+	return database.RunMigrations(db, dir)
 }
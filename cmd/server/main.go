@@ -1,18 +1,29 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
-	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"trackr/internal/api"
 	"trackr/internal/api/handlers"
 	"trackr/internal/api/middleware"
+	"trackr/internal/engine/analytics"
+	"trackr/internal/engine/fraud"
+	"trackr/internal/engine/links"
+	"trackr/internal/engine/redirect"
+	"trackr/internal/engine/webhooks"
+	"trackr/internal/pkg/logger"
 	"trackr/internal/platform/auth"
 	"trackr/internal/platform/config"
 	"trackr/internal/platform/database"
 	"trackr/internal/platform/repositories"
-	"trackr/internal/pkg/logger"
+	"trackr/internal/workers"
 )
 
 func main() {
@@ -21,6 +32,9 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Closed on shutdown to stop the background reloaders and flush pending clicks
+	stop := make(chan struct{})
+
 	logger.Init(cfg.Logging)
 
 	// Database Connections
@@ -40,55 +54,148 @@ func main() {
 	orgRepo := repositories.NewOrganizationRepository(globalDB)
 	userRepo := repositories.NewUserRepository(globalDB)
 	inviteRepo := repositories.NewInviteRepository(globalDB)
+	domainRepo := repositories.NewDomainRepository(globalDB)
 
 	// Services
 	tokenSvc := auth.NewTokenService(cfg.JWT)
 
 	// Handlers
-	authHandler := handlers.NewAuthHandler(userRepo, orgRepo, inviteRepo, tokenSvc)
-	orgHandler := handlers.NewOrgHandler(orgRepo, userRepo, tokenSvc)
+	authHandler := handlers.NewAuthHandler(userRepo, orgRepo, inviteRepo, tokenSvc).WithTenantDBs(tenantDBPool)
+	orgHandler := handlers.NewOrgHandler(orgRepo, userRepo, domainRepo, tokenSvc)
 	inviteHandler := handlers.NewInviteHandler(inviteRepo)
 	userHandler := handlers.NewUserHandler()
 
 	// New Handlers
-	linkHandler := handlers.NewLinkHandler() // Dependencies resolved via context in handler
-	analyticsHandler := handlers.NewAnalyticsHandler() // Dependencies resolved via context
+	// Shared between redirects and link management so edits invalidate cached redirects
+	linkCache := redirect.NewLinkCache(cfg.Cache.LinkTTL)
+
+	// Platform-wide destination screening; org rules are layered on per request
+	platformScreener := workers.NewPlatformScreener(cfg, stop)
+
+	synonyms, err := links.LoadSynonyms(cfg.ShortCodes.SynonymsPath)
+	if err != nil {
+		log.Printf("Short-code synonyms not loaded: %v", err)
+	}
+
+	linkHandler := handlers.NewLinkHandler(linkCache, platformScreener, synonyms, links.NewLogoStore(cfg.QR.LogoDir)) // Dependencies resolved via context in handler
+	linkHandler.WithShortDomains(cfg.Domains.ShortDomain, domainRepo)
+	analyticsHandler := handlers.NewAnalyticsHandler(cfg.Cache.AnalyticsTTL) // Dependencies resolved via context
+
+	// Live click stream, fed by the redirect handler's click logger
+	clickStream := redirect.NewClickStream()
+	streamHandler := handlers.NewStreamHandler(clickStream, cfg.Domains.AppDomain)
+
+	// Visitor IDs are keyed hashes, so unique counts never need raw IPs
+	if cfg.Analytics.VisitorSecret == "" {
+		log.Printf("analytics.visitor_secret is empty; visitor IDs are only as private as the inputs")
+	}
+	fingerprints := analytics.NewFingerprinter(cfg.Analytics.VisitorSecret)
 
 	// Correctly initialize RedirectHandler with dependencies
-	redirectHandler := handlers.NewRedirectHandler(globalDB, tenantDBPool, cfg.Domains.ShortDomain)
+	redirectHandler := handlers.NewRedirectHandler(globalDB, tenantDBPool, linkCache, clickStream, fingerprints, cfg.Domains.ShortDomain)
+
+	// Clicks are scored for fraud as they are logged
+	datacenters, err := fraud.NewDatacenterRanges(cfg.Fraud.DatacenterRangesPath)
+	if err != nil {
+		log.Printf("Datacenter ranges not loaded: %v", err)
+	}
+	go datacenters.Watch(cfg.Fraud.ReloadInterval, stop)
+	redirectHandler.WithFraudScorer(fraud.NewScorer(datacenters))
 
-	webhookHandler := handlers.NewWebhookHandler()
+	// Behind the reverse proxy every connection comes from the proxy itself
+	clientIPs, err := redirect.NewClientIPResolver(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid server.trusted_proxies: %v", err)
+	}
+	redirectHandler.WithClientIPResolver(clientIPs)
+
+	// Logged clicks are queued for click.created webhooks in batches
+	clickBatcher := webhooks.NewClickBatcher(cfg.Webhooks.ClickBatchSize, cfg.Webhooks.ClickBatchInterval)
+	clicksFlushed := make(chan struct{})
+	go func() {
+		clickBatcher.Run(stop)
+		close(clicksFlushed)
+	}()
+	redirectHandler.ClickLogger.WithClickEvents(clickBatcher)
+
+	// Background exports write to local disk and are fetched through signed URLs
+	exportStore := analytics.NewExportStore(cfg.Exports.Dir, cfg.Exports.SigningSecret, cfg.Exports.TTL, cfg.Exports.Concurrency)
+	go exportStore.Watch(time.Hour, stop)
+	exportHandler := handlers.NewExportHandler(exportStore, cfg.Exports.MaxSyncRows, "https://"+cfg.Domains.APIDomain)
+
+	reportHandler := handlers.NewReportHandler("https://" + cfg.Domains.AppDomain)
+	conversionHandler := handlers.NewConversionHandler(cfg.Conversions.AttributionWindow)
+	anomalyHandler := handlers.NewAnomalyHandler()
+
+	// Redeliveries and test events are sent from the API; queued events are
+	// sent (and retried) by the worker
+	webhookTimeout := cfg.Webhooks.Timeout
+	if webhookTimeout <= 0 {
+		webhookTimeout = 10 * time.Second
+	}
+	secretGracePeriod := cfg.Webhooks.SecretGracePeriod
+	if secretGracePeriod <= 0 {
+		secretGracePeriod = 24 * time.Hour
+	}
+	webhookHandler := handlers.NewWebhookHandler(webhooks.NewDeliverer(&http.Client{Timeout: webhookTimeout}, webhooks.RetryPolicy{}, 1), secretGracePeriod)
+	screeningHandler := handlers.NewScreeningHandler()
 	apiKeyHandler := handlers.NewAPIKeyHandler(globalDBWrapper)
 	healthHandler := handlers.NewHealthHandler(globalDBWrapper)
 	metricsHandler := handlers.NewMetricsHandler()
 	auditHandler := handlers.NewAuditHandler(globalDBWrapper)
 
 	// Middleware
-	authMiddleware := middleware.NewAuthMiddleware(tokenSvc)
+	authMiddleware := middleware.NewAuthMiddleware(tokenSvc).WithAPIKeys(repositories.NewAPIKeyRepository(globalDB))
 	tenantMiddleware := middleware.NewTenantMiddleware(orgRepo, tenantDBPool)
 
 	// Router
 	deps := &api.Dependencies{
-		AuthHandler:      authHandler,
-		OrgHandler:       orgHandler,
-		InviteHandler:    inviteHandler,
-		UserHandler:      userHandler,
-		LinkHandler:      linkHandler,
-		AnalyticsHandler: analyticsHandler,
-		RedirectHandler:  redirectHandler,
-		WebhookHandler:   webhookHandler,
-		APIKeyHandler:    apiKeyHandler,
-		HealthHandler:    healthHandler,
-		MetricsHandler:   metricsHandler,
-		AuditHandler:     auditHandler,
-		AuthMiddleware:   authMiddleware,
-		TenantMiddleware: tenantMiddleware,
+		AuthHandler:       authHandler,
+		OrgHandler:        orgHandler,
+		InviteHandler:     inviteHandler,
+		UserHandler:       userHandler,
+		LinkHandler:       linkHandler,
+		AnalyticsHandler:  analyticsHandler,
+		RedirectHandler:   redirectHandler,
+		WebhookHandler:    webhookHandler,
+		ScreeningHandler:  screeningHandler,
+		StreamHandler:     streamHandler,
+		ExportHandler:     exportHandler,
+		ReportHandler:     reportHandler,
+		ConversionHandler: conversionHandler,
+		AnomalyHandler:    anomalyHandler,
+		APIKeyHandler:     apiKeyHandler,
+		HealthHandler:     healthHandler,
+		MetricsHandler:    metricsHandler,
+		AuditHandler:      auditHandler,
+		AuthMiddleware:    authMiddleware,
+		TenantMiddleware:  tenantMiddleware,
 	}
 	router := api.NewRouter(deps)
 
-	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-	log.Printf("Server starting on %s", addr)
-	if err := http.ListenAndServe(addr, router); err != nil {
+	server := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
+		Handler: router,
+	}
+
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-shutdown
+		log.Printf("Shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Server shutdown: %v", err)
+		}
+	}()
+
+	log.Printf("Server starting on %s", server.Addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server failed: %v", err)
 	}
+
+	// Requests have drained; queue the clicks still waiting for a full batch
+	close(stop)
+	<-clicksFlushed
 }
@@ -1,32 +1,77 @@
 package main
 
 import (
+	"database/sql"
 	"log"
+	"net/http"
 	"time"
+
+	"trackr/internal/engine/linkhealth"
+	"trackr/internal/engine/links"
+	"trackr/internal/engine/webhooks"
+	"trackr/internal/pkg/mailer"
+	"trackr/internal/pkg/netguard"
+	"trackr/internal/platform/config"
+	"trackr/internal/platform/database"
 	"trackr/internal/workers"
 )
 
 func main() {
 	log.Println("Starting Trackr Background Workers...")
 
-	// Start daily stats aggregator
-	go runDailyStatsWorker()
+	cfg, err := config.Load("configs/config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	globalDB, err := database.NewGlobalDB(cfg.Database.Global)
+	if err != nil {
+		log.Fatalf("Failed to connect to global DB: %v", err)
+	}
+	defer globalDB.Close()
+
+	tenantDBPool := database.NewTenantDBPool(cfg.Database.Tenant)
+	defer tenantDBPool.CloseAll()
 
-	// Start webhook retry worker
-	go runWebhookRetryWorker()
+	platformScreener := workers.NewPlatformScreener(cfg, make(chan struct{}))
+
+	// Start rollup aggregator (daily, hourly and per-dimension stats)
+	go runDailyStatsWorker(globalDB, tenantDBPool, cfg.Aggregation)
+
+	// Start webhook delivery worker (first attempts and retries)
+	go runWebhookWorker(globalDB, tenantDBPool, cfg.Webhooks)
 
 	// Start link expiry worker
-	go runLinkExpiryWorker()
+	go runLinkExpiryWorker(globalDB, tenantDBPool)
+
+	// Start scheduled link change worker
+	go runScheduledChangesWorker(globalDB, tenantDBPool, platformScreener)
+
+	// Start destination health checker
+	go runLinkHealthWorker(globalDB, tenantDBPool, cfg.LinkHealth)
+
+	// Start destination re-screening
+	go runRescreenWorker(globalDB, tenantDBPool, platformScreener, cfg.Screening.RescreenInterval)
+
+	// Start scheduled email reports
+	go runReportsWorker(globalDB, tenantDBPool, cfg)
+
+	// Start traffic anomaly alerts
+	go runAnomalyWorker(globalDB, tenantDBPool, cfg)
 
 	// Keep process alive
 	select {}
 }
 
-func runDailyStatsWorker() {
+func runDailyStatsWorker(globalDB *sql.DB, pool *database.TenantDBPool, cfg config.AggregationConfig) {
+	// Catch up once at startup; checkpoints make this cheap when nothing is missing
+	if err := workers.AggregateDailyStats(globalDB, pool, cfg); err != nil {
+		log.Printf("Error aggregating stats: %v", err)
+	}
+
 	// Run at 01:00 UTC daily
 	for {
 		now := time.Now().UTC()
-		// Calculate time until next run (stub: 1 hour for demo, or real calc)
 		next := time.Date(now.Year(), now.Month(), now.Day()+1, 1, 0, 0, 0, time.UTC)
 		duration := next.Sub(now)
 
@@ -37,27 +82,164 @@ func runDailyStatsWorker() {
 		log.Printf("Daily stats worker sleeping for %v", duration)
 		time.Sleep(duration)
 
-		log.Println("Running daily stats aggregation...")
-		if err := workers.AggregateDailyStats(); err != nil {
+		log.Println("Running rollup aggregation...")
+		if err := workers.AggregateDailyStats(globalDB, pool, cfg); err != nil {
 			log.Printf("Error aggregating stats: %v", err)
 		}
 	}
 }
 
-func runWebhookRetryWorker() {
-	ticker := time.NewTicker(5 * time.Minute)
+func runWebhookWorker(globalDB *sql.DB, pool *database.TenantDBPool, cfg config.WebhooksConfig) {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	policy := webhooks.RetryPolicy{
+		MaxAttempts:  cfg.RetryAttempts + 1,
+		Backoff:      cfg.RetryBackoff,
+		BaseDelay:    cfg.RetryDelay,
+		MaxDelay:     cfg.MaxRetryDelay,
+		DisableAfter: cfg.DisableAfter,
+	}
+	deliverer := webhooks.NewDeliverer(&http.Client{Timeout: timeout}, policy, cfg.WorkerCount)
+
+	interval := cfg.PollInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	retention := cfg.LogRetention
+	if retention <= 0 {
+		retention = 30 * 24 * time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := workers.DeliverWebhooks(globalDB, pool, deliverer, cfg); err != nil {
+				log.Printf("Error delivering webhooks: %v", err)
+			}
+		case <-prune.C:
+			if err := workers.PruneWebhookDeliveries(globalDB, pool, retention); err != nil {
+				log.Printf("Error pruning webhook deliveries: %v", err)
+			}
+		}
+	}
+}
+
+func runLinkExpiryWorker(globalDB *sql.DB, pool *database.TenantDBPool) {
+	// Expiry times are second-granular; a minute late is close enough
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := workers.ExpireLinks(globalDB, pool); err != nil {
+			log.Printf("Error expiring links: %v", err)
+		}
+	}
+}
+
+func runScheduledChangesWorker(globalDB *sql.DB, pool *database.TenantDBPool, screener links.Screener) {
+	// Scheduled changes are minute-granular; check every minute
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := workers.ApplyScheduledChanges(globalDB, pool, screener); err != nil {
+			log.Printf("Error applying scheduled changes: %v", err)
+		}
+	}
+}
+
+func runLinkHealthWorker(globalDB *sql.DB, pool *database.TenantDBPool, cfg config.LinkHealthConfig) {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = 6 * time.Hour
+	}
+
+	checker := linkhealth.NewChecker(&http.Client{Timeout: cfg.Timeout, Transport: netguard.NewTransport(cfg.Timeout)}, cfg.PerHostConcurrency)
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		workers.RetryFailedWebhooks()
+		if err := workers.CheckLinkHealth(globalDB, pool, checker, cfg); err != nil {
+			log.Printf("Error checking link health: %v", err)
+		}
 	}
 }
 
-func runLinkExpiryWorker() {
-	ticker := time.NewTicker(1 * time.Hour)
+func runRescreenWorker(globalDB *sql.DB, pool *database.TenantDBPool, screener links.Screener, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		workers.ExpireLinks()
+		if err := workers.RescreenLinks(globalDB, pool, screener); err != nil {
+			log.Printf("Error re-screening links: %v", err)
+		}
+	}
+}
+
+func runReportsWorker(globalDB *sql.DB, pool *database.TenantDBPool, cfg *config.Config) {
+	sender := newMailSender(cfg)
+	if sender == nil {
+		log.Printf("Scheduled reports disabled: email provider %q is not supported", cfg.Email.Provider)
+		return
+	}
+	appURL := "https://" + cfg.Domains.AppDomain
+
+	interval := cfg.Reports.Interval
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := workers.SendScheduledReports(globalDB, pool, sender, appURL, cfg.Reports); err != nil {
+			log.Printf("Error sending scheduled reports: %v", err)
+		}
+	}
+}
+
+func runAnomalyWorker(globalDB *sql.DB, pool *database.TenantDBPool, cfg *config.Config) {
+	// Without email, alerts still reach webhooks
+	sender := newMailSender(cfg)
+	if sender == nil {
+		log.Printf("Anomaly alert emails disabled: email provider %q is not supported", cfg.Email.Provider)
+	}
+	appURL := "https://" + cfg.Domains.AppDomain
+
+	interval := cfg.Anomalies.Interval
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := workers.DetectAnomalies(globalDB, pool, sender, appURL, cfg.Anomalies); err != nil {
+			log.Printf("Error detecting traffic anomalies: %v", err)
+		}
+	}
+}
+
+// newMailSender returns nil unless an SMTP email provider is configured.
+func newMailSender(cfg *config.Config) mailer.Sender {
+	if cfg.Email.Provider != "smtp" {
+		return nil
 	}
+	smtp := cfg.Email.SMTP
+	return mailer.NewSMTPSender(smtp.Host, smtp.Port, smtp.Username, smtp.Password, smtp.FromAddress, smtp.FromName)
 }
@@ -12,10 +12,15 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
-type AnalyticsHandler struct{}
+type AnalyticsHandler struct {
+	overviews *analytics.OverviewCache
+}
 
-func NewAnalyticsHandler() *AnalyticsHandler {
-	return &AnalyticsHandler{}
+func NewAnalyticsHandler(overviewTTL time.Duration) *AnalyticsHandler {
+	if overviewTTL <= 0 {
+		overviewTTL = time.Minute
+	}
+	return &AnalyticsHandler{overviews: analytics.NewOverviewCache(overviewTTL)}
 }
 
 func (h *AnalyticsHandler) GetLinkAnalytics(w http.ResponseWriter, r *http.Request) {
@@ -75,11 +80,12 @@ func (h *AnalyticsHandler) GetLinkClicks(w http.ResponseWriter, r *http.Request)
 	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
 	if limit < 1 || limit > 100 { limit = 50 }
 	offset := (page - 1) * limit
+	validOnly, _ := strconv.ParseBool(r.URL.Query().Get("valid_only"))
 
 	repo := analytics.NewRepository(tenantCtx.DB)
 	service := analytics.NewService(repo)
 
-	clicks, err := service.GetClickHistory(linkID, start, end, limit, offset)
+	clicks, err := service.GetClickHistory(linkID, start, end, limit, offset, validOnly)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -89,7 +95,165 @@ func (h *AnalyticsHandler) GetLinkClicks(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(clicks)
 }
 
+// GetUniqueVisitors estimates a link's distinct visitors between start_date and
+// end_date (YYYY-MM-DD, UTC, inclusive; default the last 30 days).
+func (h *AnalyticsHandler) GetUniqueVisitors(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	params := r.Context().Value("params").(httprouter.Params)
+	linkID := params.ByName("link_id")
+
+	req := analytics.OverviewRequest{
+		StartDate: r.URL.Query().Get("start_date"),
+		EndDate:   r.URL.Query().Get("end_date"),
+	}
+	now := time.Now()
+	if err := req.Validate(now); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := analytics.NewRepository(tenantCtx.DB)
+	service := analytics.NewService(repo)
+
+	uniques, err := service.UniqueVisitors(linkID, req.StartDate, req.EndDate, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(uniques)
+}
+
+// GetQRScans reports QR scans per variant separately from regular clicks.
+// Defaults to the last 30 days; start_ts and end_ts are unix milliseconds.
+// valid_only=true leaves out clicks scored as fraud.
+func (h *AnalyticsHandler) GetQRScans(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	params := r.Context().Value("params").(httprouter.Params)
+	linkID := params.ByName("link_id")
+
+	now := time.Now()
+	start := now.AddDate(0, 0, -30).UnixMilli()
+	end := now.UnixMilli()
+
+	if v, err := strconv.ParseInt(r.URL.Query().Get("start_ts"), 10, 64); err == nil {
+		start = v
+	}
+	if v, err := strconv.ParseInt(r.URL.Query().Get("end_ts"), 10, 64); err == nil {
+		end = v
+	}
+	validOnly, _ := strconv.ParseBool(r.URL.Query().Get("valid_only"))
+
+	repo := analytics.NewRepository(tenantCtx.DB)
+	service := analytics.NewService(repo)
+
+	breakdown, err := service.GetQRBreakdown(linkID, start, end, validOnly)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(breakdown)
+}
+
+// Query runs an ad-hoc analytics query from the JSON body: dimensions,
+// filters, metrics and optional time buckets in a caller-chosen timezone.
+func (h *AnalyticsHandler) Query(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+
+	var query analytics.Query
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	if err := query.Validate(now); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := analytics.NewRepository(tenantCtx.DB)
+	service := analytics.NewService(repo)
+
+	result, err := service.Query(&query, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetOverview summarizes the whole organization. Query params: start_date and
+// end_date (YYYY-MM-DD, UTC, default the last 30 days) and granularity (hour,
+// day, week, month). valid_only=true leaves out clicks scored as fraud.
+// Results are cached briefly per organization, range and filter.
 func (h *AnalyticsHandler) GetOverview(w http.ResponseWriter, r *http.Request) {
-	// Not implemented for this phase (Org-wide overview)
-	w.WriteHeader(http.StatusNotImplemented)
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+
+	req := analytics.OverviewRequest{
+		StartDate:   r.URL.Query().Get("start_date"),
+		EndDate:     r.URL.Query().Get("end_date"),
+		Granularity: r.URL.Query().Get("granularity"),
+	}
+	req.ValidOnly, _ = strconv.ParseBool(r.URL.Query().Get("valid_only"))
+	now := time.Now()
+	if err := req.Validate(now); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cacheKey := tenantCtx.OrgID + ":" + req.StartDate + ":" + req.EndDate + ":" + req.Granularity + ":" + strconv.FormatBool(req.ValidOnly)
+	overview, found := h.overviews.Get(cacheKey)
+	if !found {
+		repo := analytics.NewRepository(tenantCtx.DB)
+		service := analytics.NewService(repo)
+
+		var err error
+		overview, err = service.GetOrgOverview(req, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.overviews.Set(cacheKey, overview)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, max-age=60")
+	json.NewEncoder(w).Encode(overview)
+}
+
+// GetConversions reports conversion rate and revenue for clicks made between
+// start_date and end_date (YYYY-MM-DD, UTC, default the last 30 days), grouped
+// by group_by (link, campaign or variant) and optionally limited to one event.
+// valid_only=true leaves out clicks scored as fraud.
+func (h *AnalyticsHandler) GetConversions(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+
+	req := analytics.ConversionRequest{
+		GroupBy:   r.URL.Query().Get("group_by"),
+		StartDate: r.URL.Query().Get("start_date"),
+		EndDate:   r.URL.Query().Get("end_date"),
+		Event:     r.URL.Query().Get("event"),
+	}
+	req.ValidOnly, _ = strconv.ParseBool(r.URL.Query().Get("valid_only"))
+	now := time.Now()
+	if err := req.Validate(now); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	service := analytics.NewService(analytics.NewRepository(tenantCtx.DB))
+	breakdown, err := service.GetConversionBreakdown(req, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(breakdown)
 }
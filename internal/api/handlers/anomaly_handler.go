@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	apiContext "trackr/internal/api/context"
+	"trackr/internal/api/middleware"
+	"trackr/internal/engine/anomalies"
+	"trackr/internal/platform/auth"
+)
+
+type AnomalyHandler struct{}
+
+func NewAnomalyHandler() *AnomalyHandler {
+	return &AnomalyHandler{}
+}
+
+// List returns recent traffic anomaly alerts, newest first. Query params:
+// link_id and limit (default 50, at most 500).
+func (h *AnomalyHandler) List(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	alerts, err := anomalies.NewRepository(tenantCtx.DB).ListAlerts(r.URL.Query().Get("link_id"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+}
+
+func (h *AnomalyHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+
+	settings, err := anomalies.NewRepository(tenantCtx.DB).GetSettings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateSettings replaces the org's alert thresholds. Fields left out of the
+// body keep their current values.
+func (h *AnomalyHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+	claims := r.Context().Value(apiContext.Claims).(*auth.Claims)
+
+	repo := anomalies.NewRepository(tenantCtx.DB)
+	settings, err := repo.GetSettings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(settings); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := settings.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	settings.UpdatedBy = claims.UserID
+
+	if err := repo.SaveSettings(settings); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
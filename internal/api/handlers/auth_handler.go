@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"time"
 	"crypto/tls"
@@ -9,9 +10,12 @@ import (
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 
+	apiContext "trackr/internal/api/context"
+	"trackr/internal/engine/webhooks"
 	"trackr/internal/pkg/errors"
 	"trackr/internal/pkg/validator"
 	"trackr/internal/platform/auth"
+	"trackr/internal/platform/database"
 	"trackr/internal/platform/models"
 	"trackr/internal/platform/repositories"
 )
@@ -21,6 +25,7 @@ type AuthHandler struct {
 	orgRepo    *repositories.OrganizationRepository
 	inviteRepo *repositories.InviteRepository
 	tokenSvc   *auth.TokenService
+	tenants    *database.TenantDBPool // Tenant DBs for member.joined webhooks; may be nil
 }
 
 func NewAuthHandler(userRepo *repositories.UserRepository, orgRepo *repositories.OrganizationRepository, inviteRepo *repositories.InviteRepository, tokenSvc *auth.TokenService) *AuthHandler {
@@ -32,6 +37,12 @@ func NewAuthHandler(userRepo *repositories.UserRepository, orgRepo *repositories
 	}
 }
 
+// WithTenantDBs lets signups raise member.joined in the organization's webhooks.
+func (h *AuthHandler) WithTenantDBs(pool *database.TenantDBPool) *AuthHandler {
+	h.tenants = pool
+	return h
+}
+
 type SignupRequest struct {
 	InviteCode string `json:"invite_code"`
 	Email      string `json:"email"`
@@ -131,6 +142,7 @@ func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
 	org, err := h.orgRepo.GetByID(user.OrganizationID)
 	if err == nil {
 		user.Organization = org
+		h.emitMemberJoined(org, user, invite.ID)
 	}
 
 	// Generate tokens
@@ -155,6 +167,27 @@ func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// emitMemberJoined queues member.joined in the organization's tenant DB, where
+// its webhooks live.
+func (h *AuthHandler) emitMemberJoined(org *models.Organization, user *models.User, inviteID string) {
+	if h.tenants == nil {
+		return
+	}
+	db, err := h.tenants.Get(org.ID, org.DBFilePath)
+	if err != nil {
+		log.Printf("Signup: no tenant DB for member.joined in %s: %v", org.ID, err)
+		return
+	}
+	webhooks.NewDispatcher(repositories.NewWebhookRepository(db)).ForOrg(org.ID).Emit(webhooks.EventMemberJoined, map[string]interface{}{
+		"user_id":   user.ID,
+		"email":     user.Email,
+		"full_name": user.FullName,
+		"role":      user.Role,
+		"invite_id": inviteID,
+		"joined_at": user.CreatedAt,
+	})
+}
+
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -312,6 +345,30 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+type StreamTokenResponse struct {
+	Token     string `json:"token"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+// StreamToken issues a short-lived token for opening a click stream from a
+// browser, passed as ?access_token= or a "bearer.<token>" WebSocket
+// subprotocol.
+func (h *AuthHandler) StreamToken(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(apiContext.Claims).(*auth.Claims)
+
+	token, err := h.tokenSvc.GenerateStreamToken(claims)
+	if err != nil {
+		errors.WriteError(w, http.StatusInternalServerError, errors.ErrCodeInternal, "Failed to generate token", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StreamTokenResponse{
+		Token:     token,
+		ExpiresIn: int(auth.StreamTokenTTL.Seconds()),
+	})
+}
+
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
     w.Write([]byte("Logout Endpoint"))
 }
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	apiContext "trackr/internal/api/context"
+	"trackr/internal/api/middleware"
+	"trackr/internal/engine/analytics"
+)
+
+// transparentGIF is a 1x1 transparent GIF served by the conversion pixel.
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+type ConversionHandler struct {
+	attributionWindow time.Duration // Conversions for older clicks are rejected
+}
+
+func NewConversionHandler(attributionWindow time.Duration) *ConversionHandler {
+	if attributionWindow <= 0 {
+		attributionWindow = 30 * 24 * time.Hour
+	}
+	return &ConversionHandler{attributionWindow: attributionWindow}
+}
+
+// Record stores a conversion reported by the destination site's server. A
+// repeated external_id for the same click and event answers 200 instead of 201
+// and is not counted again.
+func (h *ConversionHandler) Record(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+
+	var req struct {
+		ClickID    string  `json:"click_id"`
+		Event      string  `json:"event"`
+		Value      float64 `json:"value"`
+		Currency   string  `json:"currency"`
+		ExternalID string  `json:"external_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	conv := &analytics.Conversion{
+		ClickID:    req.ClickID,
+		Event:      req.Event,
+		Value:      req.Value,
+		Currency:   req.Currency,
+		ExternalID: req.ExternalID,
+	}
+	recorded, ok := h.record(w, tenantCtx, conv)
+	if !ok {
+		return
+	}
+
+	status := http.StatusCreated
+	if !recorded {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(conv)
+}
+
+// Pixel is Record for pages that can only load an image: the conversion comes
+// from the click_id, event, value, currency and external_id query params and
+// the API key from key. Keys embedded in pages should only carry the
+// conversions:write scope.
+func (h *ConversionHandler) Pixel(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+	query := r.URL.Query()
+
+	conv := &analytics.Conversion{
+		ClickID:    query.Get("click_id"),
+		Event:      query.Get("event"),
+		Currency:   query.Get("currency"),
+		ExternalID: query.Get("external_id"),
+	}
+	if v := query.Get("value"); v != "" {
+		value, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			http.Error(w, "value must be a number", http.StatusBadRequest)
+			return
+		}
+		conv.Value = value
+	}
+	if _, ok := h.record(w, tenantCtx, conv); !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+	w.Write(transparentGIF)
+}
+
+// record validates and stores conv, writing the error response itself when it
+// fails.
+func (h *ConversionHandler) record(w http.ResponseWriter, tenantCtx *middleware.TenantContext, conv *analytics.Conversion) (recorded, ok bool) {
+	if err := conv.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false, false
+	}
+
+	service := analytics.NewService(analytics.NewRepository(tenantCtx.DB))
+	recorded, err := service.RecordConversion(conv, h.attributionWindow, time.Now())
+	switch err {
+	case nil:
+		return recorded, true
+	case analytics.ErrUnknownClick:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case analytics.ErrConversionTooLate:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return false, false
+}
+
+func (h *ConversionHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+
+	settings, err := analytics.NewRepository(tenantCtx.DB).GetConversionSettings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateSettings turns click IDs on destinations on or off. Redirect servers
+// cache settings, so changes take up to five minutes to apply.
+func (h *ConversionHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+
+	var settings analytics.ConversionSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := settings.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := analytics.NewRepository(tenantCtx.DB).SaveConversionSettings(&settings); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
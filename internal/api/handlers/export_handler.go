@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	apiContext "trackr/internal/api/context"
+	"trackr/internal/api/middleware"
+	"trackr/internal/engine/analytics"
+	"trackr/internal/platform/auth"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type ExportHandler struct {
+	store       *analytics.ExportStore
+	maxSyncRows int    // Larger exports must run as jobs
+	baseURL     string // Prefix of signed download URLs, e.g. https://api.trackr.io
+}
+
+func NewExportHandler(store *analytics.ExportStore, maxSyncRows int, baseURL string) *ExportHandler {
+	if maxSyncRows <= 0 {
+		maxSyncRows = 100000
+	}
+	return &ExportHandler{store: store, maxSyncRows: maxSyncRows, baseURL: baseURL}
+}
+
+func exportRequestFromQuery(r *http.Request) analytics.ExportRequest {
+	q := r.URL.Query()
+	return analytics.ExportRequest{
+		Dataset:   q.Get("dataset"),
+		Format:    q.Get("format"),
+		LinkID:    q.Get("link_id"),
+		StartDate: q.Get("start_date"),
+		EndDate:   q.Get("end_date"),
+	}
+}
+
+// Export streams an export in the response. Query params: dataset (clicks,
+// daily_stats), format (csv, ndjson, parquet), link_id, start_date, end_date.
+// Exports over the synchronous row limit are refused; create a job instead.
+func (h *ExportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+
+	req := exportRequestFromQuery(r)
+	if err := req.Validate(time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := analytics.NewRepository(tenantCtx.DB)
+	service := analytics.NewService(repo)
+
+	rows, err := service.CountExportRows(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rows > h.maxSyncRows {
+		http.Error(w, "export has "+strconv.Itoa(rows)+" rows; use POST /api/v1/analytics/exports for more than "+strconv.Itoa(h.maxSyncRows), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	w.Header().Set("Content-Type", req.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="`+req.Filename()+`"`)
+	if _, err := service.Export(w, req); err != nil {
+		// Headers are already sent; the client sees a truncated file
+		log.Printf("Export for %s failed mid-stream: %v", tenantCtx.OrgID, err)
+	}
+}
+
+// CreateJob starts a background export from the JSON body (the same fields as
+// Export's query params) and returns the pending job.
+func (h *ExportHandler) CreateJob(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+	claims := r.Context().Value(apiContext.Claims).(*auth.Claims)
+
+	var req analytics.ExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.store.Start(tenantCtx.DB, tenantCtx.OrgID, claims.UserID, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// GetJob reports a job's status, with a signed download URL once completed.
+func (h *ExportHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+	params := r.Context().Value(apiContext.Params).(httprouter.Params)
+
+	job, err := analytics.NewRepository(tenantCtx.DB).GetExportJob(params.ByName("job_id"))
+	if err == analytics.ErrExportNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.store.Present(tenantCtx.OrgID, job, h.baseURL, time.Now())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+func (h *ExportHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+
+	jobs, err := analytics.NewRepository(tenantCtx.DB).ListExportJobs(50)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	for _, job := range jobs {
+		h.store.Present(tenantCtx.OrgID, job, h.baseURL, now)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// Download serves a finished export. It is unauthenticated: the signed,
+// expiring URL is the credential, so warehouse loaders can fetch it directly.
+func (h *ExportHandler) Download(w http.ResponseWriter, r *http.Request) {
+	params := r.Context().Value(apiContext.Params).(httprouter.Params)
+	file := params.ByName("file")
+
+	f, err := h.store.Open(params.ByName("org_id"), file, r.URL.Query().Get("expires"), r.URL.Query().Get("signature"), time.Now())
+	if err == analytics.ErrInvalidDownload {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	format := strings.TrimPrefix(filepath.Ext(file), ".")
+	w.Header().Set("Content-Type", (&analytics.ExportRequest{Format: format}).ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="`+file+`"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, file, info.ModTime(), f)
+}
@@ -1,12 +1,21 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"trackr/internal/engine/linkhealth"
 	"trackr/internal/engine/links"
+	"trackr/internal/engine/redirect"
+	"trackr/internal/engine/webhooks"
 	"trackr/internal/platform/auth"
 	"trackr/internal/platform/database"
+	"trackr/internal/platform/repositories"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -15,10 +24,40 @@ type LinkHandler struct {
 	// In a real scenario, we might use a factory to get the service per tenant
 	// But since the service depends on a repo which depends on a DB connection...
 	// We will resolve the service inside the handler using the tenant context.
+	linkCache *redirect.LinkCache
+	screener  links.Screener // Platform-wide destination screening
+	synonyms  links.Synonyms // Word list for vanity code suggestions
+	logos     *links.LogoStore
+
+	shortDomain string                         // Host of short URLs for orgs without a verified domain
+	domains     *repositories.DomainRepository // Orgs' verified domains; may be nil
+}
+
+func NewLinkHandler(linkCache *redirect.LinkCache, screener links.Screener, synonyms links.Synonyms, logos *links.LogoStore) *LinkHandler {
+	return &LinkHandler{linkCache: linkCache, screener: screener, synonyms: synonyms, logos: logos}
 }
 
-func NewLinkHandler() *LinkHandler {
-	return &LinkHandler{}
+// WithShortDomains sets the host printed in QR codes: the org's first verified
+// domain, or shortDomain when it has none.
+func (h *LinkHandler) WithShortDomains(shortDomain string, domains *repositories.DomainRepository) *LinkHandler {
+	h.shortDomain = shortDomain
+	h.domains = domains
+	return h
+}
+
+// screenedService returns a service that screens destinations against the
+// platform rules and the organization's own allow/deny lists, and raises
+// link.* webhook events.
+func (h *LinkHandler) screenedService(tenantCtx *database.TenantContext, repo *links.Repository) (*links.Service, error) {
+	screener, err := links.ScreenerForOrg(repo, h.screener)
+	if err != nil {
+		return nil, err
+	}
+	return links.NewService(repo).WithScreener(screener).WithEmitter(linkEvents(tenantCtx)), nil
+}
+
+func linkEvents(tenantCtx *database.TenantContext) *webhooks.OrgEmitter {
+	return webhooks.NewDispatcher(repositories.NewWebhookRepository(tenantCtx.DB)).ForOrg(tenantCtx.OrgID)
 }
 
 func (h *LinkHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -55,7 +94,11 @@ func (h *LinkHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	repo := links.NewRepository(tenantCtx.DB)
-	service := links.NewService(repo)
+	service, err := h.screenedService(tenantCtx, repo)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	link, err := service.CreateLink(linkReq, req.ShortCode)
 	if err != nil {
@@ -114,6 +157,7 @@ func (h *LinkHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 func (h *LinkHandler) Update(w http.ResponseWriter, r *http.Request) {
 	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	claims := r.Context().Value("claims").(*auth.Claims)
 	params := r.Context().Value("params").(httprouter.Params)
 	linkID := params.ByName("link_id")
 
@@ -124,30 +168,53 @@ func (h *LinkHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	repo := links.NewRepository(tenantCtx.DB)
-	service := links.NewService(repo)
-
-	link, err := service.UpdateLink(linkID, &req)
+	service, err := h.screenedService(tenantCtx, repo)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	link, err := service.UpdateLink(linkID, &req, claims.UserID)
+	if err != nil {
+		var screenErr *links.ScreeningError
+		var invalid *links.ValidationError
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Link not found", http.StatusNotFound)
+		case errors.As(err, &screenErr):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.As(err, &invalid):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			log.Printf("Update of link %s failed: %v", linkID, err)
+			http.Error(w, "Failed to update link", http.StatusInternalServerError)
+		}
+		return
+	}
+	h.linkCache.InvalidateLink(link.ID)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(link)
 }
 
 func (h *LinkHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	claims := r.Context().Value("claims").(*auth.Claims)
 	params := r.Context().Value("params").(httprouter.Params)
 	linkID := params.ByName("link_id")
 
 	repo := links.NewRepository(tenantCtx.DB)
-	service := links.NewService(repo)
+	service := links.NewService(repo).WithEmitter(linkEvents(tenantCtx))
 
-	if err := service.ArchiveLink(linkID); err != nil {
+	if err := service.ArchiveLink(linkID, claims.UserID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Link not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.linkCache.InvalidateLink(linkID)
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -166,20 +233,565 @@ func (h *LinkHandler) GetQRCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Assuming short domain is in config or constructed.
-	// For now, let's hardcode the domain or retrieve from context if available.
-	// Ideally, it comes from config.
-	shortURL := "https://trk.io/" + link.ShortCode // Should be configurable
+	shortURL := h.qrShortURL(tenantCtx.OrgID)(link)
 
-	size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+	// ?variant=poster encodes a named variant so scans are attributed to it
+	content, err := service.QRCodeContent(link, shortURL, r.URL.Query().Get("variant"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 
-	qrBytes, err := links.GenerateQRCode(shortURL, size)
+	opts, err := h.qrOptions(r, tenantCtx.OrgID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "image/png")
-	w.Header().Set("Cache-Control", "public, max-age=31536000") // 1 year
+	qrBytes, err := links.GenerateStyledQRCode(content, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", links.QRContentType(opts.Format))
+	w.Header().Set("Cache-Control", "private, max-age=300") // Logo, colors and code can change
 	w.Write(qrBytes)
 }
+
+// qrShortURL returns the URL encoded in the org's QR codes, on the domain its
+// links are served from.
+func (h *LinkHandler) qrShortURL(orgID string) func(*links.Link) string {
+	host := h.shortDomain
+	if h.domains != nil {
+		domains, err := h.domains.ListByOrg(orgID)
+		if err != nil {
+			log.Printf("Failed to load domains for org %s: %v", orgID, err)
+		}
+		for _, d := range domains {
+			if d.Verified {
+				host = d.Domain
+				break
+			}
+		}
+	}
+	return func(link *links.Link) string {
+		return "https://" + host + "/" + link.ShortCode
+	}
+}
+
+// BatchQRCodes streams a ZIP of QR codes for the links selected in the body
+// (link_ids or utm_campaign), styled with the same query parameters as GetQRCode,
+// plus a manifest.csv mapping files to short URLs and destinations.
+func (h *LinkHandler) BatchQRCodes(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+
+	var filter links.QRBatchFilter
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := h.qrOptions(r, tenantCtx.OrgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Reject bad styling before the response starts streaming
+	if err := opts.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	service := links.NewService(links.NewRepository(tenantCtx.DB))
+
+	items, err := service.QRBatch(&filter, h.qrShortURL(tenantCtx.OrgID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="qr-codes.zip"`)
+	if err := links.WriteQRBatch(w, items, opts); err != nil {
+		// Headers are already sent; the client sees a truncated archive
+		log.Printf("QR batch for org %s failed: %v", tenantCtx.OrgID, err)
+	}
+}
+
+// qrOptions reads QR styling from the query string: format (png, svg, pdf),
+// size, fg and bg (#RRGGBB), ecc (L, M, Q, H), margin (quiet zone in modules)
+// and logo=true to embed the organization's uploaded logo.
+func (h *LinkHandler) qrOptions(r *http.Request, orgID string) (links.QROptions, error) {
+	query := r.URL.Query()
+
+	opts := links.QROptions{
+		Format:          strings.ToLower(query.Get("format")),
+		ErrorCorrection: query.Get("ecc"),
+	}
+	opts.Size, _ = strconv.Atoi(query.Get("size"))
+
+	if v := query.Get("fg"); v != "" {
+		c, err := links.ParseHexColor(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Foreground = c
+	}
+	if v := query.Get("bg"); v != "" {
+		c, err := links.ParseHexColor(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Background = c
+	}
+	if v := query.Get("margin"); v != "" {
+		margin, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, errors.New("invalid margin")
+		}
+		opts.QuietZone = &margin
+	}
+
+	if query.Get("logo") == "true" {
+		logo, err := h.logos.Load(orgID)
+		if err != nil {
+			return opts, err
+		}
+		if logo == nil {
+			return opts, errors.New("no QR logo uploaded for this organization")
+		}
+		opts.Logo = logo
+	}
+
+	return opts, nil
+}
+
+// UploadQRLogo stores the request body (PNG or JPEG) as the organization's QR center logo.
+func (h *LinkHandler) UploadQRLogo(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+
+	// Read one byte past the limit so oversized uploads are rejected rather than truncated
+	data, err := io.ReadAll(io.LimitReader(r.Body, 1<<20+1))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.logos.Save(tenantCtx.OrgID, data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *LinkHandler) DeleteQRLogo(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+
+	if err := h.logos.Delete(tenantCtx.OrgID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *LinkHandler) ListQRVariants(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	params := r.Context().Value("params").(httprouter.Params)
+
+	service := links.NewService(links.NewRepository(tenantCtx.DB))
+
+	variants, err := service.ListQRVariants(params.ByName("link_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(variants)
+}
+
+func (h *LinkHandler) CreateQRVariant(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	claims := r.Context().Value("claims").(*auth.Claims)
+	params := r.Context().Value("params").(httprouter.Params)
+
+	var req struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	service := links.NewService(links.NewRepository(tenantCtx.DB))
+
+	variant, err := service.CreateQRVariant(&links.QRVariant{
+		LinkID:      params.ByName("link_id"),
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedBy:   claims.UserID,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(variant)
+}
+
+func (h *LinkHandler) DeleteQRVariant(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	params := r.Context().Value("params").(httprouter.Params)
+
+	service := links.NewService(links.NewRepository(tenantCtx.DB))
+
+	if err := service.DeleteQRVariant(params.ByName("link_id"), params.ByName("variant_id")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *LinkHandler) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	params := r.Context().Value("params").(httprouter.Params)
+	linkID := params.ByName("link_id")
+
+	repo := links.NewRepository(tenantCtx.DB)
+	service := links.NewService(repo)
+
+	revisions, err := service.ListRevisions(linkID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+func (h *LinkHandler) GetRevision(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	params := r.Context().Value("params").(httprouter.Params)
+	linkID := params.ByName("link_id")
+
+	revision, err := strconv.Atoi(params.ByName("revision"))
+	if err != nil || revision < 1 {
+		http.Error(w, "Invalid revision", http.StatusBadRequest)
+		return
+	}
+
+	repo := links.NewRepository(tenantCtx.DB)
+	service := links.NewService(repo)
+
+	rev, err := service.GetRevision(linkID, revision)
+	if err != nil {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rev)
+}
+
+// DiffRevisions compares :revision with ?compare_to (defaults to the revision
+// before it, i.e. "what did this revision change").
+func (h *LinkHandler) DiffRevisions(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	params := r.Context().Value("params").(httprouter.Params)
+	linkID := params.ByName("link_id")
+
+	revision, err := strconv.Atoi(params.ByName("revision"))
+	if err != nil || revision < 1 {
+		http.Error(w, "Invalid revision", http.StatusBadRequest)
+		return
+	}
+
+	compareTo := revision - 1
+	if v := r.URL.Query().Get("compare_to"); v != "" {
+		compareTo, err = strconv.Atoi(v)
+		if err != nil || compareTo < 0 {
+			http.Error(w, "Invalid compare_to revision", http.StatusBadRequest)
+			return
+		}
+	}
+
+	repo := links.NewRepository(tenantCtx.DB)
+	service := links.NewService(repo)
+
+	changes, err := service.DiffRevisions(linkID, compareTo, revision)
+	if err != nil {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"link_id": linkID,
+		"from":    compareTo,
+		"to":      revision,
+		"changes": changes,
+	})
+}
+
+func (h *LinkHandler) RollbackRevision(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	claims := r.Context().Value("claims").(*auth.Claims)
+	params := r.Context().Value("params").(httprouter.Params)
+	linkID := params.ByName("link_id")
+
+	revision, err := strconv.Atoi(params.ByName("revision"))
+	if err != nil || revision < 1 {
+		http.Error(w, "Invalid revision", http.StatusBadRequest)
+		return
+	}
+
+	repo := links.NewRepository(tenantCtx.DB)
+	service, err := h.screenedService(tenantCtx, repo)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	link, err := service.RollbackLink(linkID, revision, claims.UserID)
+	if err != nil {
+		var screenErr *links.ScreeningError
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Link or revision not found", http.StatusNotFound)
+		case errors.As(err, &screenErr):
+			// The restored destination is no longer allowed
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			log.Printf("Rollback of link %s to revision %d failed: %v", linkID, revision, err)
+			http.Error(w, "Failed to roll back link", http.StatusInternalServerError)
+		}
+		return
+	}
+	h.linkCache.InvalidateLink(link.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(link)
+}
+
+func (h *LinkHandler) ScheduleChange(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	claims := r.Context().Value("claims").(*auth.Claims)
+	params := r.Context().Value("params").(httprouter.Params)
+	linkID := params.ByName("link_id")
+
+	var req struct {
+		DestinationURL string               `json:"destination_url"`
+		Rules          *links.RedirectRules `json:"rules"`
+		Status         string               `json:"status"`
+		RunAt          int64                `json:"run_at"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	repo := links.NewRepository(tenantCtx.DB)
+	service, err := h.screenedService(tenantCtx, repo)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	change, err := service.ScheduleChange(linkID, &links.ScheduledChange{
+		DestinationURL: req.DestinationURL,
+		Rules:          req.Rules,
+		Status:         req.Status,
+		RunAt:          req.RunAt,
+		CreatedBy:      claims.UserID,
+	})
+	if err != nil {
+		var screenErr *links.ScreeningError
+		var invalid *links.ValidationError
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Link not found", http.StatusNotFound)
+		case errors.As(err, &screenErr):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.As(err, &invalid):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			log.Printf("Scheduling a change to link %s failed: %v", linkID, err)
+			http.Error(w, "Failed to schedule change", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(change)
+}
+
+func (h *LinkHandler) ListScheduledChanges(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	params := r.Context().Value("params").(httprouter.Params)
+	linkID := params.ByName("link_id")
+
+	repo := links.NewRepository(tenantCtx.DB)
+	service := links.NewService(repo)
+
+	changes, err := service.ListScheduledChanges(linkID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
+func (h *LinkHandler) CancelScheduledChange(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	params := r.Context().Value("params").(httprouter.Params)
+	linkID := params.ByName("link_id")
+	changeID := params.ByName("change_id")
+
+	repo := links.NewRepository(tenantCtx.DB)
+	service := links.NewService(repo)
+
+	if err := service.CancelScheduledChange(linkID, changeID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *LinkHandler) GetHealth(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	params := r.Context().Value("params").(httprouter.Params)
+	linkID := params.ByName("link_id")
+
+	repo := linkhealth.NewRepository(tenantCtx.DB)
+	status, err := repo.Get(linkID)
+	if err != nil {
+		http.Error(w, "No health check recorded for this link", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// ListHealth returns the latest check for each link; ?broken=true limits it to flagged links.
+func (h *LinkHandler) ListHealth(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+
+	brokenOnly, _ := strconv.ParseBool(r.URL.Query().Get("broken"))
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+	offset := (page - 1) * limit
+
+	repo := linkhealth.NewRepository(tenantCtx.DB)
+	statuses, err := repo.List(brokenOnly, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+func (h *LinkHandler) GetShortCodePolicy(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+
+	service := links.NewService(links.NewRepository(tenantCtx.DB))
+
+	policy, err := service.GetShortCodePolicy()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// UpdateShortCodePolicy replaces the policy. The alphabet may be given literally
+// or as a preset name: default, unambiguous, lowercase, lowercase_unambiguous.
+func (h *LinkHandler) UpdateShortCodePolicy(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	claims := r.Context().Value("claims").(*auth.Claims)
+
+	var req links.ShortCodePolicy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.UpdatedBy = claims.UserID
+
+	service := links.NewService(links.NewRepository(tenantCtx.DB))
+
+	policy, err := service.UpdateShortCodePolicy(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// CheckShortCode reports whether ?code= is available and suggests alternatives
+// from ?title= and ?destination_url=, or from an existing link via ?link_id=.
+func (h *LinkHandler) CheckShortCode(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	query := r.URL.Query()
+
+	seed := links.SuggestionSeed{
+		Code:           query.Get("code"),
+		Title:          query.Get("title"),
+		DestinationURL: query.Get("destination_url"),
+	}
+
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 || limit > 50 {
+		limit = 10
+	}
+
+	service := links.NewService(links.NewRepository(tenantCtx.DB))
+
+	if linkID := query.Get("link_id"); linkID != "" {
+		link, err := service.GetLink(linkID)
+		if err != nil {
+			http.Error(w, "Link not found", http.StatusNotFound)
+			return
+		}
+		if seed.Title == "" {
+			seed.Title = link.Title
+		}
+		if seed.DestinationURL == "" {
+			seed.DestinationURL = link.DestinationURL
+		}
+	}
+
+	result, err := service.CheckShortCodeAvailability(seed, h.synonyms, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
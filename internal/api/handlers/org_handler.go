@@ -2,37 +2,46 @@ package handlers
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"database/sql"
 	"os"
 	"path/filepath"
-	"io/ioutil"
+	"log"
 
 	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
 	"golang.org/x/crypto/bcrypt"
 
 	apiContext "trackr/internal/api/context"
+	"trackr/internal/engine/webhooks"
 	"trackr/internal/pkg/errors"
 	"trackr/internal/pkg/validator"
 	"trackr/internal/platform/models"
 	"trackr/internal/platform/repositories"
 	"trackr/internal/api/middleware"
 	"trackr/internal/platform/auth"
+	"trackr/internal/platform/database"
 )
 
 type OrgHandler struct {
 	orgRepo    *repositories.OrganizationRepository
 	userRepo   *repositories.UserRepository
+	domainRepo *repositories.DomainRepository
 	tokenSvc   *auth.TokenService
+	lookupTXT  func(host string) ([]string, error)
 }
 
-func NewOrgHandler(orgRepo *repositories.OrganizationRepository, userRepo *repositories.UserRepository, tokenSvc *auth.TokenService) *OrgHandler {
+func NewOrgHandler(orgRepo *repositories.OrganizationRepository, userRepo *repositories.UserRepository, domainRepo *repositories.DomainRepository, tokenSvc *auth.TokenService) *OrgHandler {
 	return &OrgHandler{
-		orgRepo:  orgRepo,
-		userRepo: userRepo,
-		tokenSvc: tokenSvc,
+		orgRepo:    orgRepo,
+		userRepo:   userRepo,
+		domainRepo: domainRepo,
+		tokenSvc:   tokenSvc,
+		lookupTXT:  net.LookupTXT,
 	}
 }
 
@@ -162,20 +171,8 @@ func (h *OrgHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 		// Run Tenant Migrations
 		// Assuming migrations/tenant exists relative to working directory
-		migrationDir := "migrations/tenant"
-		files, err := ioutil.ReadDir(migrationDir)
-		if err != nil {
-			return
-		}
-
-		for _, file := range files {
-			if filepath.Ext(file.Name()) == ".sql" {
-				content, err := ioutil.ReadFile(filepath.Join(migrationDir, file.Name()))
-				if err != nil {
-					continue
-				}
-				db.Exec(string(content))
-			}
+		if err := database.RunMigrations(db, "migrations/tenant"); err != nil {
+			log.Printf("Failed to migrate tenant DB for %s: %v", org.ID, err)
 		}
 	}()
 
@@ -207,69 +204,121 @@ type AddDomainRequest struct {
 }
 
 func (h *OrgHandler) AddDomain(w http.ResponseWriter, r *http.Request) {
+	tenant := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+
 	var req AddDomainRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		errors.WriteError(w, http.StatusBadRequest, errors.ErrCodeInvalidInput, "Invalid request body", nil)
 		return
 	}
 
-	_ = r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
-
-	// In a real implementation, we would insert into the `domains` table.
-	// DB Table `domains`: id, organization_id, domain, verified, verification_token, ...
-
-	// verificationToken := "trackr-verify=" + uuid.NewString()
-
-	// _, err := h.orgRepo.AddDomain(tenant.OrgID, req.Domain, verificationToken) ...
+	domain := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(req.Domain)), ".")
+	if domain == "" || !strings.Contains(domain, ".") || strings.ContainsAny(domain, "/: ") {
+		errors.WriteError(w, http.StatusBadRequest, errors.ErrCodeInvalidInput, "domain must be a bare hostname", nil)
+		return
+	}
 
-	// Since OrgRepo doesn't have AddDomain yet, and modifying it requires another step,
-	// I will simulate the logic here or add it to OrgRepo if I had more time.
-	// Given the constraints and the "finish fully" request, I should probably have added it.
-	// But I will provide a robust mock implementation here that "pretends" to do it for demonstration if I cannot change Repo easily now.
-	// Actually, I can just return the instructions.
+	taken, err := h.domainRepo.Taken(tenant.OrgID, domain)
+	if err != nil {
+		errors.WriteError(w, http.StatusInternalServerError, errors.ErrCodeInternal, "Database error", nil)
+		return
+	}
+	if taken {
+		errors.WriteError(w, http.StatusConflict, errors.ErrCodeConflict, "Domain already added", nil)
+		return
+	}
 
-	verificationToken := "trackr-verify=" + uuid.NewString()[:18]
+	d := &models.Domain{
+		ID:                "dom_" + uuid.NewString(),
+		OrganizationID:    tenant.OrgID,
+		Domain:            domain,
+		VerificationToken: "trackr-verify=" + uuid.NewString()[:18],
+		CreatedAt:         time.Now().Unix(),
+	}
+	if err := h.domainRepo.Create(d); err != nil {
+		errors.WriteError(w, http.StatusInternalServerError, errors.ErrCodeInternal, "Failed to add domain", nil)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{
-		"domain":             req.Domain,
-		"verification_token": verificationToken,
-		"instructions":       "Add TXT record to DNS: " + verificationToken,
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"domain":       d,
+		"instructions": "Add TXT record to DNS: " + d.VerificationToken,
 	})
 }
 
+// VerifyDomain looks for the domain's verification token in its TXT records.
+// Once found the domain serves short links, other organizations' pending
+// claims on it are dropped, and domain.verified is raised.
 func (h *OrgHandler) VerifyDomain(w http.ResponseWriter, r *http.Request) {
-	// In a real app, we fetch the domain from DB to get the expected token.
-	// Here we will simulate it or try to verify any "trackr-verify" record.
-
-	// domainID := ps.ByName("domain_id")
-	// domain := h.orgRepo.GetDomain(domainID)
+	tenant := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+	params := r.Context().Value(apiContext.Params).(httprouter.Params)
 
-	// For this exercise, let's assume we check the domain passed in body or query?
-	// The route is POST /api/v1/organizations/domains/:domain_id/verify
+	d, err := h.domainRepo.GetByID(tenant.OrgID, params.ByName("domain_id"))
+	if err != nil {
+		errors.WriteError(w, http.StatusInternalServerError, errors.ErrCodeInternal, "Database error", nil)
+		return
+	}
+	if d == nil {
+		errors.WriteError(w, http.StatusNotFound, errors.ErrCodeNotFound, "Domain not found", nil)
+		return
+	}
 
-	// Without DB access to get the domain name from domain_id, we can't really look up TXT records.
-	// I'll return a mock success response.
+	if !d.Verified {
+		records, err := h.lookupTXT(d.Domain)
+		found := false
+		for _, txt := range records {
+			if strings.TrimSpace(txt) == d.VerificationToken {
+				found = true
+				break
+			}
+		}
+		if !found {
+			message := "TXT record " + d.VerificationToken + " not found on " + d.Domain
+			if err != nil {
+				message += ": " + err.Error()
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"verified": false, "message": message})
+			return
+		}
 
-	// However, if I want to show "net.LookupTXT" usage:
-	/*
-	txtRecords, _ := net.LookupTXT("example.com")
-	for _, txt := range txtRecords {
-		if strings.HasPrefix(txt, "trackr-verify=") {
-			// verified
+		verifiedAt := time.Now().Unix()
+		ok, err := h.domainRepo.MarkVerified(d, verifiedAt)
+		if err != nil {
+			errors.WriteError(w, http.StatusInternalServerError, errors.ErrCodeInternal, "Failed to verify domain", nil)
+			return
+		}
+		if !ok {
+			errors.WriteError(w, http.StatusConflict, errors.ErrCodeConflict, "Domain is already verified by another organization", nil)
+			return
 		}
+		d.Verified = true
+		d.VerifiedAt = verifiedAt
+
+		webhooks.NewDispatcher(repositories.NewWebhookRepository(tenant.DB)).ForOrg(tenant.OrgID).Emit(webhooks.EventDomainVerified, map[string]interface{}{
+			"domain_id":   d.ID,
+			"domain":      d.Domain,
+			"verified_at": d.VerifiedAt,
+		})
 	}
-	*/
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"verified": true, "message": "Domain verified successfully"}`))
+	json.NewEncoder(w).Encode(map[string]interface{}{"verified": true, "message": "Domain verified successfully", "domain": d})
 }
 
 func (h *OrgHandler) ListDomains(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`[]`))
+	tenant := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+
+	domains, err := h.domainRepo.ListByOrg(tenant.OrgID)
+	if err != nil {
+		errors.WriteError(w, http.StatusInternalServerError, errors.ErrCodeInternal, "Database error", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(domains)
 }
 
 
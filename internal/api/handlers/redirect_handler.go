@@ -7,27 +7,40 @@ import (
 	"sync"
 	"time"
 
+	"trackr/internal/engine/analytics"
+	"trackr/internal/engine/fraud"
 	"trackr/internal/engine/links"
 	"trackr/internal/engine/redirect"
 	"trackr/internal/pkg/geoip"
 	"trackr/internal/pkg/parser"
 	"trackr/internal/platform/database"
 
-	"github.com/julienschmidt/httprouter"
+	"github.com/google/uuid"
 )
 
 type RedirectHandler struct {
 	// Dependencies
-	GlobalDB      *sql.DB
-	TenantPool    *database.TenantDBPool
-	GeoResolver   geoip.Resolver
-	LinkCache     *redirect.LinkCache
-	ClickLogger   *redirect.ClickLogger
-	SharedDomain  string
-	SystemOrgID   string // ID for the system_shared organization
+	GlobalDB     *sql.DB
+	TenantPool   *database.TenantDBPool
+	GeoResolver  geoip.Resolver
+	LinkCache    *redirect.LinkCache
+	ClickLogger  *redirect.ClickLogger
+	FraudScorer  *fraud.Scorer              // Nil stores every click with score 0
+	ClientIPs    *redirect.ClientIPResolver // Nil uses the connection's address
+	SharedDomain string
+	SystemOrgID  string // ID for the system_shared organization
 
 	// Domain Cache
 	domainCache sync.Map // map[string]cachedOrgID
+
+	// Short-code policy cache, so case-insensitive orgs don't cost a query per redirect
+	policyCache sync.Map // map[string]cachedPolicy
+
+	// Conversion settings cache; most orgs never append a click ID
+	conversionCache sync.Map // map[string]cachedConversionSettings
+
+	// QR variant names per link, so scans are only attributed to real variants
+	qrVariantCache sync.Map // map[string]cachedQRVariants
 }
 
 type cachedOrgID struct {
@@ -35,22 +48,57 @@ type cachedOrgID struct {
 	CachedAt time.Time
 }
 
-func NewRedirectHandler(globalDB *sql.DB, pool *database.TenantDBPool, sharedDomain string) *RedirectHandler {
+type cachedPolicy struct {
+	Policy   *links.ShortCodePolicy
+	CachedAt time.Time
+}
+
+type cachedConversionSettings struct {
+	Settings *analytics.ConversionSettings
+	CachedAt time.Time
+}
+
+type cachedQRVariants struct {
+	Names    map[string]bool
+	CachedAt time.Time
+}
+
+func NewRedirectHandler(globalDB *sql.DB, pool *database.TenantDBPool, linkCache *redirect.LinkCache, clickStream *redirect.ClickStream, fingerprints *analytics.Fingerprinter, sharedDomain string) *RedirectHandler {
 	return &RedirectHandler{
 		GlobalDB:     globalDB,
 		TenantPool:   pool,
 		GeoResolver:  geoip.NewDummyResolver(),
-		LinkCache:    redirect.NewLinkCache(5 * time.Minute),
-		ClickLogger:  redirect.NewClickLogger(),
+		LinkCache:    linkCache,
+		ClickLogger:  redirect.NewClickLogger(clickStream, fingerprints),
 		SharedDomain: sharedDomain,
 		SystemOrgID:  "system_shared",
 	}
 }
 
+// WithFraudScorer scores every click for fraud before it is logged.
+func (h *RedirectHandler) WithFraudScorer(scorer *fraud.Scorer) *RedirectHandler {
+	h.FraudScorer = scorer
+	return h
+}
+
+// WithClientIPResolver reads visitor IPs from the forwarding headers of
+// trusted proxies, for scoring, geo lookup and storage.
+func (h *RedirectHandler) WithClientIPResolver(resolver *redirect.ClientIPResolver) *RedirectHandler {
+	h.ClientIPs = resolver
+	return h
+}
+
+// Handle serves every path the API router does not match, so short codes can
+// span several segments ("summer/shoes") and wildcard links ("docs/*") can
+// forward deeper paths.
 func (h *RedirectHandler) Handle(w http.ResponseWriter, r *http.Request) {
-	params := r.Context().Value("params").(httprouter.Params)
-	shortCode := params.ByName("short_code")
-	if shortCode == "" {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := links.CleanRequestPath(r.URL.Path)
+	if path == "" {
 		http.NotFound(w, r)
 		return
 	}
@@ -83,13 +131,18 @@ func (h *RedirectHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Case-insensitive orgs match codes in any case, so normalize the lookup key;
+	// the original path is kept for what a wildcard link forwards
+	policy := h.getShortCodePolicy(orgID, org.DBFilePath)
+	lookupPath := policy.NormalizeCode(path)
+
 	// 3. Lookup Link (Cache -> DB)
 	// Check Cache First
 	var link *links.Link
 
-	// We key the cache by OrgID + ShortCode to prevent collisions across tenants if any
-	// (Though shortcodes should be unique per tenant)
-	cacheKey := orgID + ":" + shortCode
+	// We key the cache by OrgID + request path to prevent collisions across tenants.
+	// Wildcard links are cached once per distinct path they served.
+	cacheKey := orgID + ":" + lookupPath
 
 	if cached, found := h.LinkCache.Get(cacheKey); found {
 		// Reconstruct minimal link object from cache
@@ -99,7 +152,7 @@ func (h *RedirectHandler) Handle(w http.ResponseWriter, r *http.Request) {
 			Rules:          cached.Rules,
 			RedirectType:   cached.RedirectType,
 			Status:         cached.Status,
-			ShortCode:      shortCode,
+			ShortCode:      cached.ShortCode,
 		}
 	} else {
 		// Cache Miss - Load DB
@@ -109,8 +162,8 @@ func (h *RedirectHandler) Handle(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		linkRepo := links.NewRepository(tenantDB)
-		link, err = linkRepo.GetByShortCode(shortCode)
+		linkRepo := links.NewRepository(tenantDB).UseCaseInsensitiveCodes(policy.CaseInsensitive)
+		link, err = linkRepo.GetByPath(lookupPath)
 		if err != nil {
 			http.NotFound(w, r)
 			return
@@ -125,8 +178,12 @@ func (h *RedirectHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// HEAD requests get the same redirect but are not clicks: link unfurlers
+	// and uptime checkers send them
+	counted := r.Method == http.MethodGet
+
 	// 4. Build Request Context
-	ip := r.RemoteAddr
+	ip := h.ClientIPs.ClientIP(r)
 	ua := r.UserAgent()
 	country, _ := h.GeoResolver.Lookup(ip)
 	os, browser := parser.ParseUserAgent(ua)
@@ -142,6 +199,13 @@ func (h *RedirectHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		RequestTime: time.Now(),
 	}
 
+	// Score in the request path so the score is stored with the click; the
+	// scorer only uses local state
+	var fraudResult fraud.Result
+	if counted && h.FraudScorer != nil {
+		fraudResult = h.FraudScorer.Score(fraud.Click{IP: ip, LinkID: link.ID, UserAgent: ua, Header: r.Header, Time: reqCtx.RequestTime})
+	}
+
 	// 5. Evaluate Rules
 	finalURL := link.DestinationURL
 	if link.Rules != nil {
@@ -151,6 +215,24 @@ func (h *RedirectHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// QR codes tag scans with ?qr=<variant>; that marker is ours and is not forwarded
+	qrVariant, rawQuery := links.SplitQRVariant(r.URL.RawQuery)
+	if qrVariant != "" && !h.isQRVariant(orgID, org.DBFilePath, link.ID, qrVariant) {
+		qrVariant = ""
+	}
+
+	// Wildcard links forward the rest of the path and the incoming query params
+	if links.IsWildcard(link.ShortCode) {
+		finalURL = links.ForwardPath(finalURL, links.WildcardRemainder(link.ShortCode, path), rawQuery)
+	}
+
+	// Hand the click ID to the destination so it can report conversions against it
+	var clickID string
+	if settings := h.getConversionSettings(orgID, org.DBFilePath); counted && settings.AppendClickID {
+		clickID = uuid.New().String()
+		finalURL = analytics.AppendClickID(finalURL, settings.ClickIDParam, clickID)
+	}
+
 	// 6. Async Logging
 	incomingQuery := r.URL.Query()
 	utm := make(map[string]string)
@@ -161,8 +243,18 @@ func (h *RedirectHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	// Acquire DB connection for logger if we don't have it (e.g. cache hit case)
 	// Note: TenantPool.Get is cheap if cached
 	tenantDB, _ := h.TenantPool.Get(orgID, org.DBFilePath)
-	if tenantDB != nil {
-		go h.ClickLogger.LogClick(tenantDB, link.ID, link.ShortCode, finalURL, reqCtx, utm)
+	if counted && tenantDB != nil {
+		go h.ClickLogger.LogClick(tenantDB, redirect.Click{
+			ID:             clickID,
+			OrgID:          orgID,
+			LinkID:         link.ID,
+			ShortCode:      link.ShortCode,
+			DestinationURL: finalURL,
+			Request:        reqCtx,
+			UTM:            utm,
+			QRVariant:      qrVariant,
+			Fraud:          fraudResult,
+		})
 	}
 
 	// 7. Redirect
@@ -201,6 +293,88 @@ func (h *RedirectHandler) resolveOrgFromDomain(domain string) (string, error) {
 	return orgID, nil
 }
 
+// getShortCodePolicy falls back to the default policy if the tenant DB is
+// unavailable; the link lookup that follows reports that error properly.
+func (h *RedirectHandler) getShortCodePolicy(orgID, dbPath string) *links.ShortCodePolicy {
+	if val, ok := h.policyCache.Load(orgID); ok {
+		cached := val.(cachedPolicy)
+		if time.Since(cached.CachedAt) < 5*time.Minute {
+			return cached.Policy
+		}
+		h.policyCache.Delete(orgID)
+	}
+
+	tenantDB, err := h.TenantPool.Get(orgID, dbPath)
+	if err != nil {
+		return links.DefaultShortCodePolicy()
+	}
+	policy, err := links.NewRepository(tenantDB).GetShortCodePolicy()
+	if err != nil {
+		return links.DefaultShortCodePolicy()
+	}
+
+	h.policyCache.Store(orgID, cachedPolicy{Policy: policy, CachedAt: time.Now()})
+	return policy
+}
+
+// isQRVariant reports whether name is the link's default QR code or one of its
+// variants. Unknown names count as regular clicks, so made-up ?qr= values
+// don't show up in the QR breakdown.
+func (h *RedirectHandler) isQRVariant(orgID, dbPath, linkID, name string) bool {
+	if name == links.DefaultQRVariant {
+		return true
+	}
+
+	key := orgID + ":" + linkID
+	if val, ok := h.qrVariantCache.Load(key); ok {
+		cached := val.(cachedQRVariants)
+		if time.Since(cached.CachedAt) < 5*time.Minute {
+			return cached.Names[name]
+		}
+		h.qrVariantCache.Delete(key)
+	}
+
+	tenantDB, err := h.TenantPool.Get(orgID, dbPath)
+	if err != nil {
+		return false
+	}
+	variants, err := links.NewRepository(tenantDB).ListQRVariants(linkID)
+	if err != nil {
+		return false
+	}
+	names := make(map[string]bool, len(variants))
+	for _, v := range variants {
+		names[v.Name] = true
+	}
+
+	h.qrVariantCache.Store(key, cachedQRVariants{Names: names, CachedAt: time.Now()})
+	return names[name]
+}
+
+// getConversionSettings falls back to the defaults (no click ID) if the tenant
+// DB is unavailable.
+func (h *RedirectHandler) getConversionSettings(orgID, dbPath string) *analytics.ConversionSettings {
+	if val, ok := h.conversionCache.Load(orgID); ok {
+		cached := val.(cachedConversionSettings)
+		if time.Since(cached.CachedAt) < 5*time.Minute {
+			return cached.Settings
+		}
+		h.conversionCache.Delete(orgID)
+	}
+
+	tenantDB, err := h.TenantPool.Get(orgID, dbPath)
+	if err != nil {
+		return analytics.DefaultConversionSettings()
+	}
+	settings, err := analytics.NewRepository(tenantDB).GetConversionSettings()
+	if err != nil {
+		return analytics.DefaultConversionSettings()
+	}
+
+	h.conversionCache.Store(orgID, cachedConversionSettings{Settings: settings, CachedAt: time.Now()})
+	return settings
+}
+
 type OrgInfo struct {
 	ID         string
 	DBFilePath string
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"trackr/internal/engine/links"
+	"trackr/internal/engine/redirect"
+	"trackr/internal/platform/config"
+	"trackr/internal/platform/database"
+)
+
+func TestRedirectHandler_HeadRequestsAreNotClicks(t *testing.T) {
+	globalDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock database: %v", err)
+	}
+	defer globalDB.Close()
+	mock.MatchExpectationsInOrder(false)
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("SELECT db_file_path FROM organizations WHERE id = ?").
+			WithArgs("system_shared").
+			WillReturnRows(sqlmock.NewRows([]string{"db_file_path"}).AddRow(":memory:"))
+	}
+
+	pool := database.NewTenantDBPool(config.TenantDBConfig{BasePath: t.TempDir(), MaxConnectionsPerOrg: 1})
+	defer pool.CloseAll()
+	tenantDB, err := pool.Get("system_shared", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open tenant database: %v", err)
+	}
+	if err := database.RunMigrations(tenantDB, "../../../migrations/tenant"); err != nil {
+		t.Fatalf("Failed to migrate tenant database: %v", err)
+	}
+	link, err := links.NewService(links.NewRepository(tenantDB)).CreateLink(&links.Link{DestinationURL: "https://example.com", CreatedBy: "user1"}, "")
+	if err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	clicks := redirect.NewClickStream()
+	sub, _ := clicks.Subscribe("system_shared", "", 4)
+	defer sub.Close()
+	h := NewRedirectHandler(globalDB, pool, redirect.NewLinkCache(time.Minute), clicks, nil, "trk.test")
+
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req := httptest.NewRequest(method, "http://trk.test/"+link.ShortCode, nil)
+		req.Header.Set("Referer", "https://"+method+".example.com/")
+		rec := httptest.NewRecorder()
+		h.Handle(rec, req)
+		if rec.Code != http.StatusFound || rec.Header().Get("Location") != "https://example.com" {
+			t.Fatalf("%s: expected a redirect to the destination, got %d %q", method, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+
+	select {
+	case ev := <-sub.Events():
+		if ev.Referrer != "https://GET.example.com/" {
+			t.Fatalf("Logged a click for the %s request", ev.Referrer)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The GET request was not logged")
+	}
+	select {
+	case ev := <-sub.Events():
+		t.Errorf("Logged a click for the %s request", ev.Referrer)
+	case <-time.After(100 * time.Millisecond):
+	}
+	var logged int
+	tenantDB.QueryRow("SELECT COUNT(*) FROM clicks").Scan(&logged)
+	if logged != 1 {
+		t.Errorf("Expected 1 logged click, got %d", logged)
+	}
+}
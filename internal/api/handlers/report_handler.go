@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	apiContext "trackr/internal/api/context"
+	"trackr/internal/api/middleware"
+	"trackr/internal/engine/reports"
+	"trackr/internal/platform/auth"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type ReportHandler struct {
+	appURL string // Dashboard link in reports, e.g. https://app.trackr.io
+}
+
+func NewReportHandler(appURL string) *ReportHandler {
+	return &ReportHandler{appURL: appURL}
+}
+
+// Create subscribes to a scheduled report. Recipients default to the caller.
+func (h *ReportHandler) Create(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+	claims := r.Context().Value(apiContext.Claims).(*auth.Claims)
+
+	var req struct {
+		Name       string   `json:"name"`
+		Frequency  string   `json:"frequency"` // daily, weekly, monthly
+		Scope      string   `json:"scope"`     // org, links, campaign
+		LinkIDs    []string `json:"link_ids"`
+		Campaign   string   `json:"campaign"`
+		Recipients []string `json:"recipients"`
+		Timezone   string   `json:"timezone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Recipients) == 0 {
+		req.Recipients = []string{claims.Email}
+	}
+
+	sub := &reports.Subscription{
+		Name:       req.Name,
+		Frequency:  req.Frequency,
+		Scope:      req.Scope,
+		LinkIDs:    req.LinkIDs,
+		Campaign:   req.Campaign,
+		Recipients: req.Recipients,
+		Timezone:   req.Timezone,
+		CreatedBy:  claims.UserID,
+	}
+	now := time.Now()
+	if err := sub.Validate(now); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := reports.NewService(tenantCtx.DB).Create(sub, now)
+	if err == reports.ErrUnknownLinks {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+func (h *ReportHandler) List(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+
+	subs, err := reports.NewRepository(tenantCtx.DB).List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subs)
+}
+
+// Preview renders the report for the last complete period as an HTML page.
+func (h *ReportHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+	params := r.Context().Value(apiContext.Params).(httprouter.Params)
+
+	sub, err := reports.NewRepository(tenantCtx.DB).Get(params.ByName("report_id"))
+	if err == reports.ErrSubscriptionNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	report, err := reports.NewService(tenantCtx.DB).Build(sub, tenantCtx.OrgSlug, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	html, err := report.Preview(h.appURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(html))
+}
+
+// Delete unsubscribes. Members can delete their own subscriptions; admins and
+// owners can delete any.
+func (h *ReportHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+	claims := r.Context().Value(apiContext.Claims).(*auth.Claims)
+	params := r.Context().Value(apiContext.Params).(httprouter.Params)
+
+	repo := reports.NewRepository(tenantCtx.DB)
+	sub, err := repo.Get(params.ByName("report_id"))
+	if err == reports.ErrSubscriptionNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sub.CreatedBy != claims.UserID && claims.Role != "admin" && claims.Role != "owner" {
+		http.Error(w, "Only the creator or an admin can delete this report", http.StatusForbidden)
+		return
+	}
+
+	if _, err := repo.Delete(sub.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
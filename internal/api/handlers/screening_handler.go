@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	apiContext "trackr/internal/api/context"
+	"trackr/internal/api/middleware"
+	"trackr/internal/engine/links"
+	"trackr/internal/platform/auth"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type ScreeningHandler struct{}
+
+func NewScreeningHandler() *ScreeningHandler {
+	return &ScreeningHandler{}
+}
+
+func (h *ScreeningHandler) ListRules(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+
+	service := links.NewService(links.NewRepository(tenantCtx.DB))
+
+	rules, err := service.ListScreeningRules()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+func (h *ScreeningHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+	claims := r.Context().Value(apiContext.Claims).(*auth.Claims)
+
+	var req struct {
+		List   string `json:"list"`
+		Domain string `json:"domain"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	service := links.NewService(links.NewRepository(tenantCtx.DB))
+
+	rule, err := service.AddScreeningRule(&links.ScreeningRule{
+		List:      req.List,
+		Domain:    req.Domain,
+		CreatedBy: claims.UserID,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (h *ScreeningHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+	params := r.Context().Value(apiContext.Params).(httprouter.Params)
+
+	service := links.NewService(links.NewRepository(tenantCtx.DB))
+
+	if err := service.DeleteScreeningRule(params.ByName("rule_id")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListFlags returns links that were paused because their destination started failing screening.
+func (h *ScreeningHandler) ListFlags(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if limit <= 0 {
+		limit = 50
+	}
+
+	service := links.NewService(links.NewRepository(tenantCtx.DB))
+
+	flags, err := service.ListScreeningFlags(limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flags)
+}
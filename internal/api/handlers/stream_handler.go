@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	apiContext "trackr/internal/api/context"
+	"trackr/internal/api/middleware"
+	"trackr/internal/engine/links"
+	"trackr/internal/engine/redirect"
+	"trackr/internal/pkg/websocket"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	streamBuffer       = 256
+	streamKeepalive    = 15 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+// StreamHandler pushes clicks to dashboards as they are logged, over
+// Server-Sent Events or, when the client asks to upgrade, a WebSocket.
+type StreamHandler struct {
+	clicks   *redirect.ClickStream
+	upgrader *websocket.Upgrader
+}
+
+// StreamProtocol is the WebSocket subprotocol the stream speaks. Browsers
+// offer it alongside "bearer.<stream token>", and it is echoed back.
+const StreamProtocol = "trackr.stream"
+
+// NewStreamHandler serves streams to WebSocket clients on appDomain's pages
+// (and to non-browser clients).
+func NewStreamHandler(clicks *redirect.ClickStream, appDomain string) *StreamHandler {
+	return &StreamHandler{
+		clicks: clicks,
+		upgrader: &websocket.Upgrader{
+			AllowedOrigins: []string{appDomain},
+			Subprotocols:   []string{StreamProtocol},
+		},
+	}
+}
+
+// streamMessage is the WebSocket envelope; SSE uses the event name instead.
+type streamMessage struct {
+	Type    string               `json:"type"` // click, dropped
+	Click   *redirect.ClickEvent `json:"click,omitempty"`
+	Dropped uint64               `json:"dropped,omitempty"`
+}
+
+func (h *StreamHandler) LinkClicks(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+	params := r.Context().Value(apiContext.Params).(httprouter.Params)
+	linkID := params.ByName("link_id")
+
+	if _, err := links.NewRepository(tenantCtx.DB).GetByID(linkID); err != nil {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+
+	h.serve(w, r, tenantCtx.OrgID, linkID)
+}
+
+func (h *StreamHandler) OrgClicks(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value(apiContext.Tenant).(*middleware.TenantContext)
+	h.serve(w, r, tenantCtx.OrgID, "")
+}
+
+func (h *StreamHandler) serve(w http.ResponseWriter, r *http.Request, orgID, linkID string) {
+	sub, err := h.clicks.Subscribe(orgID, linkID, streamBuffer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	defer sub.Close()
+
+	if websocket.IsUpgrade(r) {
+		h.serveWebSocket(w, r, sub)
+		return
+	}
+	h.serveSSE(w, r, sub)
+}
+
+func (h *StreamHandler) serveSSE(w http.ResponseWriter, r *http.Request, sub *redirect.ClickSubscription) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx from buffering the stream
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	keepalive := time.NewTicker(streamKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if n := sub.TakeDropped(); n > 0 {
+				fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\":%d}\n\n", n)
+			}
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "id: %s\nevent: click\ndata: %s\n\n", ev.ID, data)
+		}
+		flusher.Flush()
+	}
+}
+
+func (h *StreamHandler) serveWebSocket(w http.ResponseWriter, r *http.Request, sub *redirect.ClickSubscription) {
+	conn, err := h.upgrader.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	keepalive := time.NewTicker(streamKeepalive)
+	defer keepalive.Stop()
+
+	send := func(msg streamMessage) error {
+		data, _ := json.Marshal(msg)
+		return conn.WriteText(data, streamWriteTimeout)
+	}
+
+	for {
+		select {
+		case <-conn.Done():
+			return
+		case <-keepalive.C:
+			if err := conn.Ping(streamWriteTimeout); err != nil {
+				return
+			}
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if n := sub.TakeDropped(); n > 0 {
+				if err := send(streamMessage{Type: "dropped", Dropped: n}); err != nil {
+					return
+				}
+			}
+			if err := send(streamMessage{Type: "click", Click: &ev}); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	apiContext "trackr/internal/api/context"
+	"trackr/internal/api/middleware"
+	"trackr/internal/engine/redirect"
+	"trackr/internal/platform/auth"
+	"trackr/internal/platform/config"
+	"trackr/internal/platform/database"
+	"trackr/internal/platform/repositories"
+)
+
+func TestStreamHandler_OrgClicksThroughTenantMiddleware(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock database: %v", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "slug", "name", "domain", "db_file_path", "plan_tier", "link_quota", "member_quota", "saml_enabled", "webhook_secret", "created_at", "updated_at", "deleted_at"}).
+		AddRow("org_123", "test-org", "Test Org", "test.com", ":memory:", "enterprise", 1000, 10, false, "secret", 1234567890, 1234567890, nil)
+	mock.ExpectQuery("SELECT (.+) FROM organizations WHERE id = ?").
+		WithArgs("org_123").
+		WillReturnRows(rows)
+
+	pool := database.NewTenantDBPool(config.TenantDBConfig{BasePath: t.TempDir(), MaxConnectionsPerOrg: 1})
+	defer pool.CloseAll()
+	tenantMid := middleware.NewTenantMiddleware(repositories.NewOrganizationRepository(db), pool)
+
+	clicks := redirect.NewClickStream()
+	h := NewStreamHandler(clicks, "app.trackr.test")
+	handler := tenantMid.Handle(h.OrgClicks)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), apiContext.Claims, &auth.Claims{OrganizationID: "org_123"})
+		handler(w, r.WithContext(ctx))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %q", ct)
+	}
+
+	// The preamble is flushed once the subscription exists
+	body := bufio.NewReader(resp.Body)
+	if line, _ := body.ReadString('\n'); !strings.HasPrefix(line, "retry:") {
+		t.Fatalf("Expected the retry preamble, got %q", line)
+	}
+
+	clicks.Publish("org_other", redirect.ClickEvent{ID: "click_other", LinkID: "link_2"})
+	clicks.Publish("org_123", redirect.ClickEvent{ID: "click_1", LinkID: "link_1"})
+
+	for {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Stream ended before the click arrived: %v", err)
+		}
+		if strings.Contains(line, "click_other") {
+			t.Fatal("Received another organization's click")
+		}
+		if strings.HasPrefix(line, "id: ") {
+			if id := strings.TrimSpace(strings.TrimPrefix(line, "id: ")); id != "click_1" {
+				t.Fatalf("Expected click_1, got %s", id)
+			}
+			break
+		}
+	}
+}
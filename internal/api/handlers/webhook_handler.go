@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"time"
 
+	"trackr/internal/engine/webhooks"
 	"trackr/internal/platform/database"
 	"trackr/internal/platform/models"
 	"trackr/internal/platform/repositories"
@@ -12,10 +16,29 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
-type WebhookHandler struct{}
+type WebhookHandler struct {
+	deliverer         *webhooks.Deliverer // Sends redeliveries and test events
+	secretGracePeriod time.Duration       // Default time a rotated-out secret keeps signing
+}
 
-func NewWebhookHandler() *WebhookHandler {
-	return &WebhookHandler{}
+func NewWebhookHandler(deliverer *webhooks.Deliverer, secretGracePeriod time.Duration) *WebhookHandler {
+	return &WebhookHandler{deliverer: deliverer, secretGracePeriod: secretGracePeriod}
+}
+
+// maxSecretGracePeriod bounds how long a rotated-out secret stays valid.
+const maxSecretGracePeriod = 7 * 24 * time.Hour
+
+// deliveryResponse is a delivery with its log of attempts.
+type deliveryResponse struct {
+	*models.WebhookDelivery
+	AttemptLog []*models.WebhookDeliveryAttempt `json:"attempt_log"`
+}
+
+// ListEvents returns the event catalogue: every event a webhook can subscribe
+// to, with the JSON schema of its data.
+func (h *WebhookHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks.Catalogue)
 }
 
 func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -36,6 +59,15 @@ func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := webhooks.ValidateURL(req.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := webhooks.ValidateEvents(req.Events); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	webhook := &models.Webhook{
 		URL:    req.URL,
 		Events: req.Events,
@@ -43,8 +75,12 @@ func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if webhook.Secret == "" {
-		// Generate a random secret if not provided
-		webhook.Secret = "whsec_" + string(time.Now().UnixNano()) // Simplified
+		secret, err := newWebhookSecret()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		webhook.Secret = secret
 	}
 
 	repo := repositories.NewWebhookRepository(tenantCtx.DB)
@@ -98,6 +134,18 @@ func (h *WebhookHandler) Update(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if req.URL != "" {
+		if err := webhooks.ValidateURL(req.URL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if len(req.Events) > 0 {
+		if err := webhooks.ValidateEvents(req.Events); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
 	repo := repositories.NewWebhookRepository(tenantCtx.DB)
 	webhook, err := repo.GetByID(id)
@@ -112,10 +160,12 @@ func (h *WebhookHandler) Update(w http.ResponseWriter, r *http.Request) {
 	if len(req.Events) > 0 {
 		webhook.Events = req.Events
 	}
-	if req.Secret != "" {
-		webhook.Secret = req.Secret
-	}
+	// A new secret is rotated in: the old one keeps signing for the default
+	// grace period so receivers can switch over without dropping deliveries
+	rotate := req.Secret != "" && req.Secret != webhook.Secret
+	reenabled := false
 	if req.Status != "" {
+		reenabled = req.Status == "active" && webhook.Status != "active"
 		webhook.Status = req.Status
 	}
 
@@ -123,6 +173,21 @@ func (h *WebhookHandler) Update(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if rotate {
+		if err := rotateSecret(repo, webhook, req.Secret, h.secretGracePeriod); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	// A webhook disabled for failing starts afresh when switched back on
+	if reenabled {
+		if err := repo.ResetRetryCount(webhook.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		webhook.RetryCount = 0
+		webhook.FailingSince = 0
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(webhook)
@@ -141,3 +206,198 @@ func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// RotateSecret replaces the webhook's signing secret with the one given or a
+// generated one. For grace_period_hours (default webhooks.secret_grace_period)
+// deliveries are signed with both secrets; 0 retires the old secret at once.
+func (h *WebhookHandler) RotateSecret(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	params := r.Context().Value("params").(httprouter.Params)
+
+	var req struct {
+		Secret           string `json:"secret"`
+		GracePeriodHours *int   `json:"grace_period_hours"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	grace := h.secretGracePeriod
+	if req.GracePeriodHours != nil {
+		grace = time.Duration(*req.GracePeriodHours) * time.Hour
+		if grace < 0 || grace > maxSecretGracePeriod {
+			http.Error(w, "grace_period_hours must be between 0 and 168", http.StatusBadRequest)
+			return
+		}
+	}
+
+	repo := repositories.NewWebhookRepository(tenantCtx.DB)
+	webhook, err := repo.GetByID(params.ByName("webhook_id"))
+	if err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = newWebhookSecret(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if secret == webhook.Secret {
+		http.Error(w, "secret must differ from the current secret", http.StatusBadRequest)
+		return
+	}
+
+	if err := rotateSecret(repo, webhook, secret, grace); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func rotateSecret(repo *repositories.WebhookRepository, webhook *models.Webhook, secret string, grace time.Duration) error {
+	var previousExpiresAt int64
+	if grace > 0 {
+		previousExpiresAt = time.Now().Add(grace).Unix()
+	}
+	if err := repo.RotateSecret(webhook.ID, secret, previousExpiresAt); err != nil {
+		return err
+	}
+
+	webhook.PreviousSecret, webhook.PreviousSecretExpiresAt = "", 0
+	if previousExpiresAt > 0 {
+		webhook.PreviousSecret, webhook.PreviousSecretExpiresAt = webhook.Secret, previousExpiresAt
+	}
+	webhook.Secret = secret
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// ListDeliveries returns the webhook's deliveries, newest first, optionally
+// only those with status (pending, delivered or failed).
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	params := r.Context().Value("params").(httprouter.Params)
+	id := params.ByName("webhook_id")
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.DeliveryStatusPending, models.DeliveryStatusDelivered, models.DeliveryStatusFailed:
+	default:
+		http.Error(w, "status must be pending, delivered or failed", http.StatusBadRequest)
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	repo := repositories.NewWebhookRepository(tenantCtx.DB)
+	if _, err := repo.GetByID(id); err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	deliveries, err := repo.ListDeliveries(id, status, limit, (page-1)*limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// GetDelivery returns one delivery with every request made for it: headers,
+// response status, the start of the response body and latency.
+func (h *WebhookHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	params := r.Context().Value("params").(httprouter.Params)
+
+	repo := repositories.NewWebhookRepository(tenantCtx.DB)
+	delivery, err := repo.GetDelivery(params.ByName("webhook_id"), params.ByName("delivery_id"))
+	if err != nil {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	attempts, err := repo.ListDeliveryAttempts(delivery.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveryResponse{WebhookDelivery: delivery, AttemptLog: attempts})
+}
+
+// Redeliver sends a past delivery's payload again, now, as a new delivery. The
+// response carries the attempt whether or not the receiver accepted it.
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	params := r.Context().Value("params").(httprouter.Params)
+
+	repo := repositories.NewWebhookRepository(tenantCtx.DB)
+	webhook, err := repo.GetByID(params.ByName("webhook_id"))
+	if err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	original, err := repo.GetDelivery(webhook.ID, params.ByName("delivery_id"))
+	if err != nil {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+
+	h.deliverNow(w, repo, webhook, webhooks.Redelivery(original, time.Now()))
+}
+
+// Test sends a ping event to the webhook, whatever events it subscribes to.
+func (h *WebhookHandler) Test(w http.ResponseWriter, r *http.Request) {
+	tenantCtx := r.Context().Value("tenant").(*database.TenantContext)
+	params := r.Context().Value("params").(httprouter.Params)
+
+	repo := repositories.NewWebhookRepository(tenantCtx.DB)
+	webhook, err := repo.GetByID(params.ByName("webhook_id"))
+	if err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	delivery, err := webhooks.Ping(webhook, tenantCtx.OrgID, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.deliverNow(w, repo, webhook, delivery)
+}
+
+func (h *WebhookHandler) deliverNow(w http.ResponseWriter, repo *repositories.WebhookRepository, webhook *models.Webhook, delivery *models.WebhookDelivery) {
+	attempt, err := h.deliverer.DeliverNow(repo, webhook, delivery)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(deliveryResponse{WebhookDelivery: delivery, AttemptLog: []*models.WebhookDeliveryAttempt{attempt}})
+}
@@ -2,39 +2,120 @@ package middleware
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
 	"strings"
+	"time"
 
 	apiContext "trackr/internal/api/context"
 	"trackr/internal/pkg/errors"
 	"trackr/internal/platform/auth"
+	"trackr/internal/platform/repositories"
 )
 
+// APIKeyPrefix starts every raw API key, which tells keys apart from JWTs.
+const APIKeyPrefix = "trk_"
+
 type AuthMiddleware struct {
 	tokenSvc *auth.TokenService
+	apiKeys  *repositories.APIKeyRepository // Nil disables API key authentication
 }
 
 func NewAuthMiddleware(tokenSvc *auth.TokenService) *AuthMiddleware {
 	return &AuthMiddleware{tokenSvc: tokenSvc}
 }
 
+// WithAPIKeys lets routes wrapped with AllowAPIKey authenticate with API keys.
+func (m *AuthMiddleware) WithAPIKeys(repo *repositories.APIKeyRepository) *AuthMiddleware {
+	m.apiKeys = repo
+	return m
+}
+
 func (m *AuthMiddleware) Handle(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			errors.WriteError(w, http.StatusUnauthorized, errors.ErrCodeUnauthorized, "Missing authorization header", nil)
+		token, ok := bearerToken(w, r)
+		if !ok {
+			return
+		}
+
+		claims, err := m.tokenSvc.ValidateToken(token)
+		if err != nil {
+			errors.WriteError(w, http.StatusUnauthorized, errors.ErrCodeUnauthorized, "Invalid or expired token", nil)
 			return
 		}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			errors.WriteError(w, http.StatusUnauthorized, errors.ErrCodeUnauthorized, "Invalid authorization header format", nil)
+		ctx := context.WithValue(r.Context(), apiContext.Claims, claims)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// AllowAPIKey is Handle for routes that servers and pages outside the
+// dashboard call: it also accepts an API key granted scope (or "*"), either as
+// the bearer token or, for pixels and other plain GETs, in the "key" query
+// parameter. Keys act with the role "api_key" on behalf of their creator.
+func (m *AuthMiddleware) AllowAPIKey(scope string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		jwtHandler := m.Handle(next)
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			rawKey := r.URL.Query().Get("key")
+			if rawKey == "" {
+				if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); strings.HasPrefix(token, APIKeyPrefix) {
+					rawKey = token
+				}
+			}
+			if rawKey == "" || m.apiKeys == nil {
+				jwtHandler(w, r)
+				return
+			}
+
+			hash := sha256.Sum256([]byte(rawKey))
+			key, err := m.apiKeys.GetByHash(hex.EncodeToString(hash[:]))
+			now := time.Now().Unix()
+			if err != nil || key.RevokedAt != nil || (key.ExpiresAt != nil && *key.ExpiresAt <= now) {
+				errors.WriteError(w, http.StatusUnauthorized, errors.ErrCodeUnauthorized, "Invalid or expired API key", nil)
+				return
+			}
+			if !hasScope(key.Scopes, scope) {
+				errors.WriteError(w, http.StatusForbidden, errors.ErrCodeForbidden, "API key lacks the "+scope+" scope", nil)
+				return
+			}
+			go m.apiKeys.UpdateLastUsed(key.ID)
+
+			claims := &auth.Claims{
+				UserID:         key.UserID,
+				OrganizationID: key.OrganizationID,
+				Role:           "api_key",
+				Scopes:         key.Scopes,
+			}
+			ctx := context.WithValue(r.Context(), apiContext.Claims, claims)
+			next(w, r.WithContext(ctx))
+		}
+	}
+}
+
+// StreamTokenProtocolPrefix marks a stream token offered as a WebSocket
+// subprotocol: "bearer.<token>".
+const StreamTokenProtocolPrefix = "bearer."
+
+// AllowStreamToken is Handle for the click streams. Browsers can't set headers
+// on EventSource or WebSocket requests, so a stream token (see
+// AuthHandler.StreamToken) is also accepted in the access_token query
+// parameter or as a WebSocket subprotocol.
+func (m *AuthMiddleware) AllowStreamToken(next http.HandlerFunc) http.HandlerFunc {
+	jwtHandler := m.Handle(next)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := streamToken(r)
+		if token == "" || r.Header.Get("Authorization") != "" {
+			jwtHandler(w, r)
 			return
 		}
 
-		claims, err := m.tokenSvc.ValidateToken(parts[1])
+		claims, err := m.tokenSvc.ValidateStreamToken(token)
 		if err != nil {
-			errors.WriteError(w, http.StatusUnauthorized, errors.ErrCodeUnauthorized, "Invalid or expired token", nil)
+			errors.WriteError(w, http.StatusUnauthorized, errors.ErrCodeUnauthorized, "Invalid or expired stream token", nil)
 			return
 		}
 
@@ -42,3 +123,41 @@ func (m *AuthMiddleware) Handle(next http.HandlerFunc) http.HandlerFunc {
 		next(w, r.WithContext(ctx))
 	}
 }
+
+func streamToken(r *http.Request) string {
+	if token := r.URL.Query().Get("access_token"); token != "" {
+		return token
+	}
+	for _, v := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(v, ",") {
+			if token, ok := strings.CutPrefix(strings.TrimSpace(protocol), StreamTokenProtocolPrefix); ok {
+				return token
+			}
+		}
+	}
+	return ""
+}
+
+func bearerToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		errors.WriteError(w, http.StatusUnauthorized, errors.ErrCodeUnauthorized, "Missing authorization header", nil)
+		return "", false
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		errors.WriteError(w, http.StatusUnauthorized, errors.ErrCodeUnauthorized, "Invalid authorization header format", nil)
+		return "", false
+	}
+	return parts[1], true
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope || s == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	apiContext "trackr/internal/api/context"
+	"trackr/internal/platform/auth"
+	"trackr/internal/platform/config"
+	"trackr/internal/platform/models"
+	"trackr/internal/platform/repositories"
+)
+
+func TestAuthMiddleware_AllowAPIKey(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	defer db.Close()
+	// The last-used update runs in the background; keep one shared in-memory DB
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE api_keys (
+		id TEXT PRIMARY KEY,
+		organization_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		key_hash TEXT UNIQUE NOT NULL,
+		key_prefix TEXT NOT NULL,
+		scopes TEXT NOT NULL,
+		last_used_at INTEGER,
+		expires_at INTEGER,
+		created_at INTEGER NOT NULL,
+		revoked_at INTEGER
+	)`)
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	repo := repositories.NewAPIKeyRepository(db)
+	createKey := func(raw string, scopes ...string) *models.APIKey {
+		hash := sha256.Sum256([]byte(raw))
+		key := &models.APIKey{OrganizationID: "org_1", UserID: "user_1", Name: raw, KeyHash: hex.EncodeToString(hash[:]), KeyPrefix: raw[:8], Scopes: scopes}
+		if err := repo.Create(key); err != nil {
+			t.Fatalf("Failed to create key: %v", err)
+		}
+		return key
+	}
+	createKey("trk_live_conv", "conversions:write")
+	createKey("trk_live_read", "links:read")
+	revoked := createKey("trk_live_gone", "*")
+	repo.Revoke(revoked.ID)
+
+	tokenSvc := auth.NewTokenService(config.JWTConfig{Secret: "test", AccessTokenTTL: time.Hour})
+	mw := NewAuthMiddleware(tokenSvc).WithAPIKeys(repo)
+
+	var got *auth.Claims
+	handler := mw.AllowAPIKey("conversions:write")(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Context().Value(apiContext.Claims).(*auth.Claims)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	jwt, _ := tokenSvc.GenerateAccessToken("user_2", "org_1", "member", "a@example.com")
+
+	tests := []struct {
+		name   string
+		target string
+		header string
+		want   int
+		role   string
+	}{
+		{"key in query", "/?key=trk_live_conv", "", http.StatusNoContent, "api_key"},
+		{"key as bearer", "/", "Bearer trk_live_conv", http.StatusNoContent, "api_key"},
+		{"jwt still accepted", "/", "Bearer " + jwt, http.StatusNoContent, "member"},
+		{"missing scope", "/?key=trk_live_read", "", http.StatusForbidden, ""},
+		{"revoked", "/", "Bearer trk_live_gone", http.StatusUnauthorized, ""},
+		{"unknown", "/?key=trk_live_nope", "", http.StatusUnauthorized, ""},
+		{"no credentials", "/", "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("Status = %d, want %d", rr.Code, tt.want)
+			}
+			if tt.role != "" && (got == nil || got.Role != tt.role || got.OrganizationID != "org_1") {
+				t.Errorf("Claims = %+v, want role %s in org_1", got, tt.role)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_AllowStreamToken(t *testing.T) {
+	tokenSvc := auth.NewTokenService(config.JWTConfig{Secret: "test", AccessTokenTTL: time.Hour})
+	mw := NewAuthMiddleware(tokenSvc)
+
+	var got *auth.Claims
+	handler := mw.AllowStreamToken(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Context().Value(apiContext.Claims).(*auth.Claims)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	jwt, _ := tokenSvc.GenerateAccessToken("user_2", "org_1", "member", "a@example.com")
+	access, _ := tokenSvc.ValidateToken(jwt)
+	stream, _ := tokenSvc.GenerateStreamToken(access)
+
+	tests := []struct {
+		name     string
+		target   string
+		header   string
+		protocol string
+		want     int
+	}{
+		{"stream token in query", "/?access_token=" + stream, "", "", http.StatusNoContent},
+		{"stream token as subprotocol", "/", "", StreamTokenProtocolPrefix + stream + ", trackr.stream", http.StatusNoContent},
+		{"jwt still accepted", "/", "Bearer " + jwt, "", http.StatusNoContent},
+		{"access token in query", "/?access_token=" + jwt, "", "", http.StatusUnauthorized},
+		{"garbage", "/?access_token=abc", "", "", http.StatusUnauthorized},
+		{"no credentials", "/", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.protocol != "" {
+				req.Header.Set("Sec-WebSocket-Protocol", tt.protocol)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("Status = %d, want %d", rr.Code, tt.want)
+			}
+			if tt.want == http.StatusNoContent && (got == nil || got.UserID != "user_2" || got.OrganizationID != "org_1") {
+				t.Errorf("Claims = %+v", got)
+			}
+		})
+	}
+
+	// Stream tokens open streams and nothing else
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+stream)
+	rr := httptest.NewRecorder()
+	mw.Handle(func(w http.ResponseWriter, r *http.Request) {})(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Stream token accepted as a bearer token: %d", rr.Code)
+	}
+}
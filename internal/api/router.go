@@ -21,6 +21,12 @@ type Dependencies struct {
 	AnalyticsHandler  *handlers.AnalyticsHandler
 	RedirectHandler   *handlers.RedirectHandler
 	WebhookHandler    *handlers.WebhookHandler
+	ScreeningHandler  *handlers.ScreeningHandler
+	StreamHandler     *handlers.StreamHandler
+	ExportHandler     *handlers.ExportHandler
+	ReportHandler     *handlers.ReportHandler
+	ConversionHandler *handlers.ConversionHandler
+	AnomalyHandler    *handlers.AnomalyHandler
 	APIKeyHandler     *handlers.APIKeyHandler
 	HealthHandler     *handlers.HealthHandler
 	MetricsHandler    *handlers.MetricsHandler
@@ -37,7 +43,10 @@ func NewRouter(deps *Dependencies) *httprouter.Router {
 	router.GET("/metrics", wrap(deps.MetricsHandler.Export))
 
 	// Public Redirect Endpoint
-	router.GET("/:short_code", wrap(deps.RedirectHandler.Handle))
+	// Short codes can be multi-segment paths, which a "/:short_code" route cannot
+	// express (and which would conflict with the static routes below), so
+	// redirects are served by the router's fallback handler.
+	router.NotFound = http.HandlerFunc(deps.RedirectHandler.Handle)
 
 	// Authentication routes
 	router.POST("/api/v1/auth/signup", wrap(deps.AuthHandler.Signup))
@@ -55,6 +64,9 @@ func NewRouter(deps *Dependencies) *httprouter.Router {
 	tenantMid := deps.TenantMiddleware
 	rateMid := middleware.RateLimit
 
+	// Short-lived tokens for opening click streams from browsers
+	router.POST("/api/v1/auth/stream-token", chain(deps.AuthHandler.StreamToken, authMid.Handle))
+
 	// Organization management
 	router.POST("/api/v1/organizations", wrap(deps.OrgHandler.Create))
 	router.GET("/api/v1/organizations/current",
@@ -103,14 +115,121 @@ func NewRouter(deps *Dependencies) *httprouter.Router {
 		chain(deps.LinkHandler.Delete, authMid.Handle, tenantMid.Handle, rateMid("api_write")))
 	router.GET("/api/v1/links/:link_id/qr",
 		chain(deps.LinkHandler.GetQRCode, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+	router.GET("/api/v1/links/:link_id/qr/variants",
+		chain(deps.LinkHandler.ListQRVariants, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+	router.POST("/api/v1/links/:link_id/qr/variants",
+		chain(deps.LinkHandler.CreateQRVariant, authMid.Handle, tenantMid.Handle, rateMid("api_write")))
+	router.DELETE("/api/v1/links/:link_id/qr/variants/:variant_id",
+		chain(deps.LinkHandler.DeleteQRVariant, authMid.Handle, tenantMid.Handle, rateMid("api_write")))
+	router.POST("/api/v1/qr/batch",
+		chain(deps.LinkHandler.BatchQRCodes, authMid.Handle, tenantMid.Handle, rateMid("api_write")))
+	router.PUT("/api/v1/qr/logo",
+		chain(deps.LinkHandler.UploadQRLogo, authMid.Handle, tenantMid.Handle, requireRole("admin", "owner")))
+	router.DELETE("/api/v1/qr/logo",
+		chain(deps.LinkHandler.DeleteQRLogo, authMid.Handle, tenantMid.Handle, requireRole("admin", "owner")))
+
+	// Short-code policy
+	router.GET("/api/v1/shortcode-policy",
+		chain(deps.LinkHandler.GetShortCodePolicy, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+	router.PUT("/api/v1/shortcode-policy",
+		chain(deps.LinkHandler.UpdateShortCodePolicy, authMid.Handle, tenantMid.Handle, requireRole("admin", "owner")))
+
+	router.GET("/api/v1/shortcodes/availability",
+		chain(deps.LinkHandler.CheckShortCode, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+
+	// Link revisions
+	router.GET("/api/v1/links/:link_id/revisions",
+		chain(deps.LinkHandler.ListRevisions, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+	router.GET("/api/v1/links/:link_id/revisions/:revision",
+		chain(deps.LinkHandler.GetRevision, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+	router.GET("/api/v1/links/:link_id/revisions/:revision/diff",
+		chain(deps.LinkHandler.DiffRevisions, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+	router.POST("/api/v1/links/:link_id/revisions/:revision/rollback",
+		chain(deps.LinkHandler.RollbackRevision, authMid.Handle, tenantMid.Handle, rateMid("api_write")))
+
+	// Scheduled link changes
+	router.POST("/api/v1/links/:link_id/schedule",
+		chain(deps.LinkHandler.ScheduleChange, authMid.Handle, tenantMid.Handle, rateMid("api_write")))
+	router.GET("/api/v1/links/:link_id/schedule",
+		chain(deps.LinkHandler.ListScheduledChanges, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+	router.DELETE("/api/v1/links/:link_id/schedule/:change_id",
+		chain(deps.LinkHandler.CancelScheduledChange, authMid.Handle, tenantMid.Handle, rateMid("api_write")))
+
+	// Destination health
+	router.GET("/api/v1/links/:link_id/health",
+		chain(deps.LinkHandler.GetHealth, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+	router.GET("/api/v1/link-health",
+		chain(deps.LinkHandler.ListHealth, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+
+	// Destination screening
+	router.GET("/api/v1/screening/rules",
+		chain(deps.ScreeningHandler.ListRules, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+	router.POST("/api/v1/screening/rules",
+		chain(deps.ScreeningHandler.CreateRule, authMid.Handle, tenantMid.Handle, requireRole("admin", "owner")))
+	router.DELETE("/api/v1/screening/rules/:rule_id",
+		chain(deps.ScreeningHandler.DeleteRule, authMid.Handle, tenantMid.Handle, requireRole("admin", "owner")))
+	router.GET("/api/v1/screening/flags",
+		chain(deps.ScreeningHandler.ListFlags, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
 
 	// Analytics
 	router.GET("/api/v1/links/:link_id/analytics",
 		chain(deps.AnalyticsHandler.GetLinkAnalytics, authMid.Handle, tenantMid.Handle, rateMid("analytics")))
+	router.GET("/api/v1/links/:link_id/analytics/uniques",
+		chain(deps.AnalyticsHandler.GetUniqueVisitors, authMid.Handle, tenantMid.Handle, rateMid("analytics")))
+	router.GET("/api/v1/links/:link_id/analytics/qr",
+		chain(deps.AnalyticsHandler.GetQRScans, authMid.Handle, tenantMid.Handle, rateMid("analytics")))
 	router.GET("/api/v1/links/:link_id/clicks",
 		chain(deps.AnalyticsHandler.GetLinkClicks, authMid.Handle, tenantMid.Handle, rateMid("analytics")))
+	router.GET("/api/v1/links/:link_id/clicks/stream",
+		chain(deps.StreamHandler.LinkClicks, authMid.AllowStreamToken, tenantMid.Handle, rateMid("analytics")))
+	router.GET("/api/v1/analytics/stream",
+		chain(deps.StreamHandler.OrgClicks, authMid.AllowStreamToken, tenantMid.Handle, rateMid("analytics")))
+	router.POST("/api/v1/analytics/query",
+		chain(deps.AnalyticsHandler.Query, authMid.Handle, tenantMid.Handle, rateMid("analytics")))
 	router.GET("/api/v1/analytics/overview",
 		chain(deps.AnalyticsHandler.GetOverview, authMid.Handle, tenantMid.Handle, rateMid("analytics")))
+	router.GET("/api/v1/analytics/conversions",
+		chain(deps.AnalyticsHandler.GetConversions, authMid.Handle, tenantMid.Handle, rateMid("analytics")))
+
+	// Exports; downloads are authorized by their signed URL
+	router.GET("/api/v1/analytics/export",
+		chain(deps.ExportHandler.Export, authMid.Handle, tenantMid.Handle, rateMid("analytics")))
+	router.POST("/api/v1/analytics/exports",
+		chain(deps.ExportHandler.CreateJob, authMid.Handle, tenantMid.Handle, rateMid("api_write")))
+	router.GET("/api/v1/analytics/exports",
+		chain(deps.ExportHandler.ListJobs, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+	router.GET("/api/v1/analytics/exports/:job_id",
+		chain(deps.ExportHandler.GetJob, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+	router.GET("/api/v1/exports/:org_id/:file",
+		chain(deps.ExportHandler.Download, rateMid("api_read")))
+
+	// Scheduled email reports
+	router.POST("/api/v1/reports",
+		chain(deps.ReportHandler.Create, authMid.Handle, tenantMid.Handle, rateMid("api_write")))
+	router.GET("/api/v1/reports",
+		chain(deps.ReportHandler.List, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+	router.GET("/api/v1/reports/:report_id/preview",
+		chain(deps.ReportHandler.Preview, authMid.Handle, tenantMid.Handle, rateMid("analytics")))
+	router.DELETE("/api/v1/reports/:report_id",
+		chain(deps.ReportHandler.Delete, authMid.Handle, tenantMid.Handle, rateMid("api_write")))
+
+	// Conversions, reported by destination sites with an API key
+	router.POST("/api/v1/conversions",
+		chain(deps.ConversionHandler.Record, authMid.AllowAPIKey("conversions:write"), tenantMid.Handle, rateMid("api_write")))
+	router.GET("/api/v1/conversions/pixel.gif",
+		chain(deps.ConversionHandler.Pixel, authMid.AllowAPIKey("conversions:write"), tenantMid.Handle, rateMid("api_write")))
+	router.GET("/api/v1/conversions/settings",
+		chain(deps.ConversionHandler.GetSettings, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+	router.PUT("/api/v1/conversions/settings",
+		chain(deps.ConversionHandler.UpdateSettings, authMid.Handle, tenantMid.Handle, requireRole("admin", "owner")))
+
+	// Traffic anomaly alerts
+	router.GET("/api/v1/anomalies",
+		chain(deps.AnomalyHandler.List, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+	router.GET("/api/v1/anomalies/settings",
+		chain(deps.AnomalyHandler.GetSettings, authMid.Handle, tenantMid.Handle, rateMid("api_read")))
+	router.PUT("/api/v1/anomalies/settings",
+		chain(deps.AnomalyHandler.UpdateSettings, authMid.Handle, tenantMid.Handle, requireRole("admin", "owner")))
 
 	// Webhooks
 	router.POST("/api/v1/webhooks",
@@ -123,6 +242,18 @@ func NewRouter(deps *Dependencies) *httprouter.Router {
 		chain(deps.WebhookHandler.Update, authMid.Handle, tenantMid.Handle, requireRole("admin", "owner")))
 	router.DELETE("/api/v1/webhooks/:webhook_id",
 		chain(deps.WebhookHandler.Delete, authMid.Handle, tenantMid.Handle, requireRole("admin", "owner")))
+	router.POST("/api/v1/webhooks/:webhook_id/rotate-secret",
+		chain(deps.WebhookHandler.RotateSecret, authMid.Handle, tenantMid.Handle, requireRole("admin", "owner")))
+	router.POST("/api/v1/webhooks/:webhook_id/test",
+		chain(deps.WebhookHandler.Test, authMid.Handle, tenantMid.Handle, requireRole("admin", "owner")))
+	router.GET("/api/v1/webhooks/:webhook_id/deliveries",
+		chain(deps.WebhookHandler.ListDeliveries, authMid.Handle, tenantMid.Handle, requireRole("admin", "owner")))
+	router.GET("/api/v1/webhooks/:webhook_id/deliveries/:delivery_id",
+		chain(deps.WebhookHandler.GetDelivery, authMid.Handle, tenantMid.Handle, requireRole("admin", "owner")))
+	router.POST("/api/v1/webhooks/:webhook_id/deliveries/:delivery_id/redeliver",
+		chain(deps.WebhookHandler.Redeliver, authMid.Handle, tenantMid.Handle, requireRole("admin", "owner")))
+	router.GET("/api/v1/webhook-events",
+		chain(deps.WebhookHandler.ListEvents, authMid.Handle))
 
 	// API Keys
 	router.POST("/api/v1/api-keys",
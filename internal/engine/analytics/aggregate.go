@@ -0,0 +1,377 @@
+package analytics
+
+import (
+	"database/sql"
+	"time"
+
+	"trackr/internal/engine/fraud"
+	"trackr/internal/pkg/hll"
+)
+
+// JobRollups names the rollup job in aggregation_checkpoints.
+const JobRollups = "rollups"
+
+// rollupDimensionColumns are the clicks columns broken down in dimension_stats,
+// keyed by the dimension name stored there (the query API's names).
+var rollupDimensionColumns = map[string]string{
+	"country":         "country_code",
+	"device":          "device_type",
+	"browser":         "browser",
+	"os":              "os",
+	"referrer_domain": "referrer_domain",
+	"utm_campaign":    "utm_campaign",
+}
+
+// HourlyStat is one link's clicks in one UTC hour.
+type HourlyStat struct {
+	LinkID    string
+	Hour      int64 // Start of the hour, unix ms
+	Clicks    int
+	UniqueIPs int
+}
+
+// DimensionStat is one link's clicks on one UTC day with one dimension value.
+// Clicks without a value are kept under "", so each dimension's rows add up to
+// the link's daily_stats clicks and neq filters stay exact.
+type DimensionStat struct {
+	LinkID    string
+	Date      string
+	Dimension string
+	Value     string
+	Clicks    int
+}
+
+// DayRollups holds every rollup row for one UTC day.
+type DayRollups struct {
+	Daily      []*DailyStat
+	Hourly     []HourlyStat
+	Dimensions []DimensionStat
+	Sketches   map[string]*hll.Sketch // Visitors per link
+	OrgSketch  *hll.Sketch            // Visitors across all links
+}
+
+// AggregationRun reports what one RefreshRollups call did.
+type AggregationRun struct {
+	FromDate string // First day re-aggregated
+	ToDate   string // Last day re-aggregated (yesterday)
+	Days     int
+	Rows     int // Rollup rows written across all tables
+}
+
+// RefreshRollups rebuilds daily_stats, hourly_stats, dimension_stats and the
+// visitor sketches for every complete UTC day since the last checkpoint, re-aggregating the
+// lookbackDays before it so clicks that arrive late still land in their day. Each day is replaced in a transaction,
+// so runs are idempotent and an interrupted run resumes from its checkpoint.
+// Without a checkpoint it starts at the first click, at most backfillDays ago.
+func (s *Service) RefreshRollups(now time.Time, lookbackDays, backfillDays int) (*AggregationRun, error) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	yesterday := today.AddDate(0, 0, -1)
+
+	checkpoint, err := s.repo.GetCheckpoint(JobRollups)
+	if err != nil {
+		return nil, err
+	}
+
+	var from time.Time
+	if checkpoint != "" {
+		last, err := time.Parse(dateLayout, checkpoint)
+		if err != nil {
+			return nil, err
+		}
+		from = last.AddDate(0, 0, 1-lookbackDays)
+	} else {
+		first, err := s.repo.FirstClickTime()
+		if err != nil {
+			return nil, err
+		}
+		if first == nil {
+			// Nothing to aggregate yet; later clicks start from here
+			return &AggregationRun{}, s.repo.SaveCheckpoint(JobRollups, yesterday.Format(dateLayout))
+		}
+		from = first.UTC().Truncate(24 * time.Hour)
+	}
+	if earliest := today.AddDate(0, 0, -backfillDays); from.Before(earliest) {
+		from = earliest
+	}
+
+	run := &AggregationRun{FromDate: from.Format(dateLayout), ToDate: yesterday.Format(dateLayout)}
+	for day := from; !day.After(yesterday); day = day.AddDate(0, 0, 1) {
+		date := day.Format(dateLayout)
+		rollups, err := s.repo.ComputeDayRollups(date)
+		if err != nil {
+			return run, err
+		}
+		if err := s.repo.ReplaceRollups(date, rollups); err != nil {
+			return run, err
+		}
+		if err := s.repo.SaveCheckpoint(JobRollups, date); err != nil {
+			return run, err
+		}
+		run.Days++
+		run.Rows += len(rollups.Daily) + len(rollups.Hourly) + len(rollups.Dimensions) + len(rollups.Sketches) + 1
+	}
+	return run, nil
+}
+
+// GetCheckpoint returns the last completed date for job, or "" if it never ran.
+func (r *Repository) GetCheckpoint(job string) (string, error) {
+	var date string
+	err := r.db.QueryRow("SELECT last_date FROM aggregation_checkpoints WHERE job = ?", job).Scan(&date)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return date, err
+}
+
+func (r *Repository) SaveCheckpoint(job, date string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO aggregation_checkpoints (job, last_date, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(job) DO UPDATE SET last_date = excluded.last_date, updated_at = excluded.updated_at
+	`, job, date, time.Now().Unix())
+	return err
+}
+
+// FirstClickTime returns when the oldest click was logged, or nil without clicks.
+func (r *Repository) FirstClickTime() (*time.Time, error) {
+	var ts sql.NullInt64
+	if err := r.db.QueryRow("SELECT MIN(timestamp) FROM clicks").Scan(&ts); err != nil {
+		return nil, err
+	}
+	if !ts.Valid {
+		return nil, nil
+	}
+	t := time.UnixMilli(ts.Int64)
+	return &t, nil
+}
+
+// computeRollups limits the rollup to one link when linkID is set.
+func (r *Repository) computeRollups(date, linkID string) ([]*DailyStat, error) {
+	start, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return nil, err
+	}
+	startTs := start.UnixMilli()
+	endTs := start.Add(24 * time.Hour).UnixMilli()
+
+	rows, err := r.db.Query(`
+		SELECT link_id, COUNT(*), SUM(fraud_score < ?), COUNT(DISTINCT ip_address)
+		FROM clicks
+		WHERE timestamp >= ? AND timestamp < ? AND (? = '' OR link_id = ?)
+		GROUP BY link_id
+		ORDER BY link_id
+	`, fraud.InvalidScore, startTs, endTs, linkID, linkID)
+	if err != nil {
+		return nil, err
+	}
+	var stats []*DailyStat
+	byLink := map[string]*DailyStat{}
+	for rows.Next() {
+		s := &DailyStat{Date: date}
+		if err := rows.Scan(&s.LinkID, &s.Clicks, &s.ValidClicks, &s.UniqueIPs); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats = append(stats, s)
+		byLink[s.LinkID] = s
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for column, set := range map[string]func(*DailyStat, string){
+		"country_code":    func(s *DailyStat, v string) { s.TopCountry = v },
+		"referrer_domain": func(s *DailyStat, v string) { s.TopReferrer = v },
+		"device_type":     func(s *DailyStat, v string) { s.TopDevice = v },
+	} {
+		top, err := r.topValuePerLink(column, startTs, endTs, linkID)
+		if err != nil {
+			return nil, err
+		}
+		for linkID, value := range top {
+			if s, ok := byLink[linkID]; ok {
+				set(s, value)
+			}
+		}
+	}
+	return stats, nil
+}
+
+// topValuePerLink returns each link's most common non-empty value of a column;
+// ties go to the alphabetically first value so reruns agree.
+func (r *Repository) topValuePerLink(column string, start, end int64, linkID string) (map[string]string, error) {
+	rows, err := r.db.Query(`
+		SELECT link_id, `+column+`, COUNT(*) AS total
+		FROM clicks
+		WHERE timestamp >= ? AND timestamp < ? AND (? = '' OR link_id = ?)
+		  AND `+column+` IS NOT NULL AND `+column+` != ''
+		GROUP BY link_id, `+column+`
+		ORDER BY link_id, total DESC, `+column+`
+	`, start, end, linkID, linkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	top := map[string]string{}
+	for rows.Next() {
+		var linkID, value string
+		var total int
+		if err := rows.Scan(&linkID, &value, &total); err != nil {
+			return nil, err
+		}
+		if _, seen := top[linkID]; !seen {
+			top[linkID] = value
+		}
+	}
+	return top, rows.Err()
+}
+
+// ComputeDayRollups computes the daily, hourly and per-dimension rollup rows
+// and visitor sketches of every link clicked on date (UTC).
+func (r *Repository) ComputeDayRollups(date string) (*DayRollups, error) {
+	start, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return nil, err
+	}
+	startTs := start.UnixMilli()
+	endTs := start.Add(24 * time.Hour).UnixMilli()
+
+	rollups := &DayRollups{}
+	if rollups.Daily, err = r.computeRollups(date, ""); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT link_id, (timestamp / 3600000) * 3600000 AS hour, COUNT(*), COUNT(DISTINCT ip_address)
+		FROM clicks
+		WHERE timestamp >= ? AND timestamp < ?
+		GROUP BY link_id, hour
+	`, startTs, endTs)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var h HourlyStat
+		if err := rows.Scan(&h.LinkID, &h.Hour, &h.Clicks, &h.UniqueIPs); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rollups.Hourly = append(rollups.Hourly, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for dimension, column := range rollupDimensionColumns {
+		rows, err := r.db.Query(`
+			SELECT link_id, COALESCE(`+column+`, '') AS value, COUNT(*)
+			FROM clicks
+			WHERE timestamp >= ? AND timestamp < ?
+			GROUP BY link_id, value
+		`, startTs, endTs)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			d := DimensionStat{Date: date, Dimension: dimension}
+			if err := rows.Scan(&d.LinkID, &d.Value, &d.Clicks); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			rollups.Dimensions = append(rollups.Dimensions, d)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if rollups.Sketches, rollups.OrgSketch, err = r.ClickSketches("", startTs, endTs); err != nil {
+		return nil, err
+	}
+	return rollups, nil
+}
+
+// ReplaceRollups swaps a day's rows in every rollup table in one transaction,
+// so links whose clicks were deleted don't keep stale rows.
+func (r *Repository) ReplaceRollups(date string, rollups *DayRollups) error {
+	start, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM daily_stats WHERE date = ?", date); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM hourly_stats WHERE hour >= ? AND hour < ?", start.UnixMilli(), start.Add(24*time.Hour).UnixMilli()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM dimension_stats WHERE date = ?", date); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM daily_sketches WHERE date = ?", date); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM org_daily_sketches WHERE date = ?", date); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	for _, s := range rollups.Daily {
+		_, err := tx.Exec(`
+			INSERT INTO daily_stats (id, link_id, date, clicks, valid_clicks, unique_ips, top_country, top_referrer, top_device, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, s.LinkID+"_"+date, s.LinkID, date, s.Clicks, s.ValidClicks, s.UniqueIPs,
+			nullIfEmpty(s.TopCountry), nullIfEmpty(s.TopReferrer), nullIfEmpty(s.TopDevice), now)
+		if err != nil {
+			return err
+		}
+	}
+	for _, h := range rollups.Hourly {
+		_, err := tx.Exec(`
+			INSERT INTO hourly_stats (link_id, hour, clicks, unique_ips) VALUES (?, ?, ?, ?)
+		`, h.LinkID, h.Hour, h.Clicks, h.UniqueIPs)
+		if err != nil {
+			return err
+		}
+	}
+	for _, d := range rollups.Dimensions {
+		_, err := tx.Exec(`
+			INSERT INTO dimension_stats (link_id, date, dimension, value, clicks) VALUES (?, ?, ?, ?, ?)
+		`, d.LinkID, d.Date, d.Dimension, d.Value, d.Clicks)
+		if err != nil {
+			return err
+		}
+	}
+	for linkID, sketch := range rollups.Sketches {
+		data, err := sketch.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO daily_sketches (link_id, date, sketch) VALUES (?, ?, ?)", linkID, date, data); err != nil {
+			return err
+		}
+	}
+	if rollups.OrgSketch != nil {
+		data, err := rollups.OrgSketch.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO org_daily_sketches (date, sketch) VALUES (?, ?)", date, data); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
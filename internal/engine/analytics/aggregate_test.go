@@ -0,0 +1,77 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestService_RefreshRollups(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	service := NewService(repo)
+
+	day1 := time.Date(2026, 3, 9, 10, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	insertClick(t, db, "c1", "l1", day1, "1.1.1.1", "US")
+	insertClick(t, db, "c2", "l1", day1.Add(time.Hour), "2.2.2.2", "DE")
+	insertClick(t, db, "c3", "l1", day1.Add(2*time.Hour), "2.2.2.2", "DE")
+	insertClick(t, db, "c4", "l2", day2, "3.3.3.3", "FR")
+
+	now := time.Date(2026, 3, 11, 8, 0, 0, 0, time.UTC)
+	run, err := service.RefreshRollups(now, 2, 30)
+	if err != nil {
+		t.Fatalf("RefreshRollups failed: %v", err)
+	}
+	if run.FromDate != "2026-03-09" || run.ToDate != "2026-03-10" || run.Days != 2 {
+		t.Errorf("Unexpected first run: %+v", run)
+	}
+
+	stats, _ := repo.GetDailyStats("l1", "2026-03-09", "2026-03-09")
+	if len(stats) != 1 || stats[0].Clicks != 3 || stats[0].UniqueIPs != 2 || stats[0].TopCountry != "DE" || stats[0].TopDevice != "mobile" {
+		t.Errorf("Unexpected l1 rollup: %+v", stats)
+	}
+
+	var hours, deClicks, noBrowser int
+	db.QueryRow("SELECT COUNT(*) FROM hourly_stats WHERE link_id = 'l1'").Scan(&hours)
+	db.QueryRow("SELECT clicks FROM dimension_stats WHERE link_id = 'l1' AND dimension = 'country' AND value = 'DE'").Scan(&deClicks)
+	db.QueryRow("SELECT clicks FROM dimension_stats WHERE link_id = 'l1' AND dimension = 'browser' AND value = ''").Scan(&noBrowser)
+	if hours != 3 || deClicks != 2 || noBrowser != 3 {
+		t.Errorf("Unexpected hourly/dimension rollups: %d hours, %d DE clicks, %d without browser", hours, deClicks, noBrowser)
+	}
+
+	// A late click for March 10 arrives; the next day's run picks it up via the lookback
+	insertClick(t, db, "c5", "l2", day2.Add(time.Hour), "4.4.4.4", "FR")
+	run, err = service.RefreshRollups(now.AddDate(0, 0, 1), 2, 30)
+	if err != nil {
+		t.Fatalf("Second run failed: %v", err)
+	}
+	if run.FromDate != "2026-03-09" || run.ToDate != "2026-03-11" {
+		t.Errorf("Unexpected second run range: %+v", run)
+	}
+
+	stats, _ = repo.GetDailyStats("l2", "2026-03-10", "2026-03-10")
+	if len(stats) != 1 || stats[0].Clicks != 2 {
+		t.Errorf("Expected late click to be aggregated: %+v", stats)
+	}
+
+	// Rerunning is idempotent
+	if _, err := service.RefreshRollups(now.AddDate(0, 0, 1), 2, 30); err != nil {
+		t.Fatalf("Rerun failed: %v", err)
+	}
+	var rows int
+	db.QueryRow("SELECT COUNT(*) FROM daily_stats").Scan(&rows)
+	if rows != 2 {
+		t.Errorf("Expected 2 rollup rows after rerun, got %d", rows)
+	}
+	db.QueryRow("SELECT COUNT(*) FROM hourly_stats").Scan(&rows)
+	if rows != 5 {
+		t.Errorf("Expected 5 hourly rows after rerun, got %d", rows)
+	}
+
+	checkpoint, _ := repo.GetCheckpoint(JobRollups)
+	if checkpoint != "2026-03-11" {
+		t.Errorf("Checkpoint = %q, want 2026-03-11", checkpoint)
+	}
+}
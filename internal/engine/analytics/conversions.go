@@ -0,0 +1,379 @@
+package analytics
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"trackr/internal/engine/fraud"
+)
+
+const (
+	GroupByLink     = "link"
+	GroupByCampaign = "campaign"
+	GroupByVariant  = "variant" // QR variant; regular clicks group under ""
+
+	DefaultClickIDParam = "trk_click_id"
+
+	maxConversionDays = 366
+)
+
+var (
+	ErrUnknownClick       = errors.New("unknown click_id")
+	ErrConversionTooLate  = errors.New("click is outside the attribution window")
+	conversionEventRe     = regexp.MustCompile(`^[a-z0-9_.-]{1,64}$`)
+	clickIDParamRe        = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+	currencyRe            = regexp.MustCompile(`^[A-Z]{3}$`)
+	conversionGroupColumn = map[string]string{
+		GroupByLink:     "link_id",
+		GroupByCampaign: "utm_campaign",
+		GroupByVariant:  "qr_variant",
+	}
+)
+
+// ConversionSettings controls whether redirects hand a click ID to the
+// destination so it can report conversions back.
+type ConversionSettings struct {
+	AppendClickID bool   `json:"append_click_id"`
+	ClickIDParam  string `json:"click_id_param"` // Query parameter carrying the click ID
+	UpdatedAt     int64  `json:"updated_at,omitempty"`
+}
+
+// DefaultConversionSettings leaves destinations untouched.
+func DefaultConversionSettings() *ConversionSettings {
+	return &ConversionSettings{ClickIDParam: DefaultClickIDParam}
+}
+
+func (s *ConversionSettings) Validate() error {
+	if s.ClickIDParam == "" {
+		s.ClickIDParam = DefaultClickIDParam
+	}
+	if !clickIDParamRe.MatchString(s.ClickIDParam) {
+		return errors.New("click_id_param must be 1-64 letters, digits, '_', '.' or '-'")
+	}
+	if strings.HasPrefix(strings.ToLower(s.ClickIDParam), "utm_") {
+		return errors.New("click_id_param must not be a utm_ parameter")
+	}
+	return nil
+}
+
+// AppendClickID adds param=clickID to destination, keeping its existing query
+// and fragment as they are. Unparseable destinations are returned unchanged.
+func AppendClickID(destination, param, clickID string) string {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+	pair := url.QueryEscape(param) + "=" + url.QueryEscape(clickID)
+	if u.RawQuery == "" {
+		u.RawQuery = pair
+	} else {
+		u.RawQuery += "&" + pair
+	}
+	return u.String()
+}
+
+// Conversion is a downstream event (signup, purchase) reported against a click.
+// Link, campaign and variant are copied from the click when it is recorded.
+type Conversion struct {
+	ID          string  `json:"id"`
+	ClickID     string  `json:"click_id"`
+	LinkID      string  `json:"link_id"`
+	UTMCampaign string  `json:"utm_campaign,omitempty"`
+	QRVariant   string  `json:"qr_variant,omitempty"`
+	Event       string  `json:"event"`
+	Value       float64 `json:"value"`
+	Currency    string  `json:"currency,omitempty"`
+	ExternalID  string  `json:"external_id,omitempty"` // Caller's ID; a repeat for the same click and event is ignored
+	ClickedAt   int64   `json:"clicked_at"`            // Unix ms
+	CreatedAt   int64   `json:"created_at"`
+}
+
+// Validate normalizes the event and currency and checks the reported fields.
+func (c *Conversion) Validate() error {
+	c.ClickID = strings.TrimSpace(c.ClickID)
+	c.Event = strings.ToLower(strings.TrimSpace(c.Event))
+	c.Currency = strings.ToUpper(strings.TrimSpace(c.Currency))
+	c.ExternalID = strings.TrimSpace(c.ExternalID)
+
+	if c.ClickID == "" {
+		return errors.New("click_id is required")
+	}
+	if !conversionEventRe.MatchString(c.Event) {
+		return errors.New("event must be 1-64 lowercase letters, digits, '_', '.' or '-'")
+	}
+	if math.IsNaN(c.Value) || math.IsInf(c.Value, 0) || c.Value < 0 {
+		return errors.New("value must be a non-negative number")
+	}
+	if c.Currency != "" && !currencyRe.MatchString(c.Currency) {
+		return errors.New("currency must be a 3-letter ISO 4217 code")
+	}
+	if c.Value > 0 && c.Currency == "" {
+		return errors.New("currency is required when value is set")
+	}
+	if len(c.ExternalID) > 128 {
+		return errors.New("external_id must be at most 128 characters")
+	}
+	return nil
+}
+
+// ConversionRequest selects clicks made between two inclusive UTC dates,
+// grouped by link, campaign or variant, optionally counting a single event.
+type ConversionRequest struct {
+	GroupBy   string // link, campaign or variant
+	StartDate string // YYYY-MM-DD
+	EndDate   string // YYYY-MM-DD
+	Event     string // Empty counts every event
+	ValidOnly bool   // Leave out clicks scored as fraud and their conversions
+}
+
+// Validate fills in defaults (per link over the last 30 days) and checks the
+// range.
+func (req *ConversionRequest) Validate(now time.Time) error {
+	if req.GroupBy == "" {
+		req.GroupBy = GroupByLink
+	}
+	if _, ok := conversionGroupColumn[req.GroupBy]; !ok {
+		return errors.New("group_by must be link, campaign or variant")
+	}
+	req.Event = strings.ToLower(req.Event)
+	if req.Event != "" && !conversionEventRe.MatchString(req.Event) {
+		return errors.New("invalid event")
+	}
+
+	if req.EndDate == "" {
+		req.EndDate = now.UTC().Format(dateLayout)
+	}
+	end, err := time.Parse(dateLayout, req.EndDate)
+	if err != nil {
+		return errors.New("invalid end_date: use YYYY-MM-DD")
+	}
+	if req.StartDate == "" {
+		req.StartDate = end.AddDate(0, 0, -29).Format(dateLayout)
+	}
+	start, err := time.Parse(dateLayout, req.StartDate)
+	if err != nil {
+		return errors.New("invalid start_date: use YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return errors.New("end_date must not be before start_date")
+	}
+	if int(end.Sub(start).Hours()/24)+1 > maxConversionDays {
+		return errors.New("range must be at most 366 days")
+	}
+	return nil
+}
+
+// ConversionStat is one group's funnel. Conversions are attributed to the time
+// of the click, so late conversions still land in the click's period.
+type ConversionStat struct {
+	Key             string             `json:"key"` // Link ID, campaign or variant; "" for untagged clicks
+	Clicks          int                `json:"clicks"`
+	ConvertedClicks int                `json:"converted_clicks"` // Clicks with at least one conversion
+	Conversions     int                `json:"conversions"`
+	ConversionRate  float64            `json:"conversion_rate"` // ConvertedClicks / Clicks
+	Revenue         map[string]float64 `json:"revenue"`         // Sum of values per currency
+}
+
+type ConversionBreakdown struct {
+	GroupBy   string           `json:"group_by"`
+	StartDate string           `json:"start_date"`
+	EndDate   string           `json:"end_date"`
+	Event     string           `json:"event,omitempty"`
+	ValidOnly bool             `json:"valid_only"`
+	Groups    []ConversionStat `json:"groups"` // Most conversions first
+}
+
+// RecordConversion attributes c to its click and stores it. A conversion
+// repeating an external ID already seen for the click and event is ignored and
+// reported as not recorded. window <= 0 accepts clicks of any age.
+func (s *Service) RecordConversion(c *Conversion, window time.Duration, now time.Time) (bool, error) {
+	if err := s.repo.attributeConversion(c); err != nil {
+		return false, err
+	}
+	if window > 0 && now.Sub(time.UnixMilli(c.ClickedAt)) > window {
+		return false, ErrConversionTooLate
+	}
+
+	c.ID = uuid.New().String()
+	c.CreatedAt = now.Unix()
+	return s.repo.InsertConversion(c)
+}
+
+// GetConversionBreakdown validates req and returns conversion rate and revenue
+// per group.
+func (s *Service) GetConversionBreakdown(req ConversionRequest, now time.Time) (*ConversionBreakdown, error) {
+	if err := req.Validate(now); err != nil {
+		return nil, err
+	}
+	start, _ := time.Parse(dateLayout, req.StartDate)
+	end, _ := time.Parse(dateLayout, req.EndDate)
+
+	groups, err := s.repo.ConversionStats(conversionGroupColumn[req.GroupBy], req.Event, start.UnixMilli(), end.AddDate(0, 0, 1).UnixMilli(), req.ValidOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &ConversionBreakdown{
+		GroupBy:   req.GroupBy,
+		StartDate: req.StartDate,
+		EndDate:   req.EndDate,
+		Event:     req.Event,
+		ValidOnly: req.ValidOnly,
+		Groups:    groups,
+	}, nil
+}
+
+func (r *Repository) GetConversionSettings() (*ConversionSettings, error) {
+	var s ConversionSettings
+	err := r.db.QueryRow(`
+		SELECT append_click_id, click_id_param, updated_at FROM conversion_settings WHERE id = 1
+	`).Scan(&s.AppendClickID, &s.ClickIDParam, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return DefaultConversionSettings(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *Repository) SaveConversionSettings(s *ConversionSettings) error {
+	s.UpdatedAt = time.Now().Unix()
+	_, err := r.db.Exec(`
+		INSERT INTO conversion_settings (id, append_click_id, click_id_param, updated_at)
+		VALUES (1, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			append_click_id = excluded.append_click_id,
+			click_id_param = excluded.click_id_param,
+			updated_at = excluded.updated_at
+	`, s.AppendClickID, s.ClickIDParam, s.UpdatedAt)
+	return err
+}
+
+// attributeConversion copies the link, campaign, variant and time of c's click.
+func (r *Repository) attributeConversion(c *Conversion) error {
+	var campaign, variant sql.NullString
+	err := r.db.QueryRow(`
+		SELECT link_id, utm_campaign, qr_variant, timestamp FROM clicks WHERE id = ?
+	`, c.ClickID).Scan(&c.LinkID, &campaign, &variant, &c.ClickedAt)
+	if err == sql.ErrNoRows {
+		return ErrUnknownClick
+	}
+	if err != nil {
+		return err
+	}
+	c.UTMCampaign = campaign.String
+	c.QRVariant = variant.String
+	return nil
+}
+
+// InsertConversion stores c, returning false if its external ID was a repeat.
+func (r *Repository) InsertConversion(c *Conversion) (bool, error) {
+	res, err := r.db.Exec(`
+		INSERT OR IGNORE INTO conversions (
+			id, click_id, link_id, utm_campaign, qr_variant, event, value, currency, external_id, clicked_at, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, c.ID, c.ClickID, c.LinkID, nullIfEmpty(c.UTMCampaign), nullIfEmpty(c.QRVariant), c.Event, c.Value,
+		nullIfEmpty(c.Currency), nullIfEmpty(c.ExternalID), c.ClickedAt, c.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ConversionStats groups clicks in [start, end) (Unix ms) by column, which
+// clicks and conversions share, and joins in their conversions.
+func (r *Repository) ConversionStats(column, event string, start, end int64, validOnly bool) ([]ConversionStat, error) {
+	eventFilter := ""
+	convArgs := []interface{}{start, end}
+	if event != "" {
+		eventFilter = "AND event = ?"
+		convArgs = append(convArgs, event)
+	}
+
+	args := append(append([]interface{}{}, convArgs...), start, end, validOnly, fraud.InvalidScore)
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT COALESCE(c.%[1]s, ''), COUNT(*), COUNT(v.n), COALESCE(SUM(v.n), 0)
+		FROM clicks c
+		LEFT JOIN (
+			SELECT click_id, COUNT(*) AS n FROM conversions
+			WHERE clicked_at >= ? AND clicked_at < ? %[2]s
+			GROUP BY click_id
+		) v ON v.click_id = c.id
+		WHERE c.timestamp >= ? AND c.timestamp < ? AND (? = 0 OR c.fraud_score < ?)
+		GROUP BY 1
+	`, column, eventFilter), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := map[string]*ConversionStat{}
+	for rows.Next() {
+		stat := &ConversionStat{Revenue: map[string]float64{}}
+		if err := rows.Scan(&stat.Key, &stat.Clicks, &stat.ConvertedClicks, &stat.Conversions); err != nil {
+			return nil, err
+		}
+		if stat.Clicks > 0 {
+			stat.ConversionRate = float64(stat.ConvertedClicks) / float64(stat.Clicks)
+		}
+		groups[stat.Key] = stat
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// validOnly also drops the revenue of fraudulent clicks
+	revenue, err := r.db.Query(fmt.Sprintf(`
+		SELECT COALESCE(%[1]s, ''), currency, SUM(value)
+		FROM conversions
+		WHERE clicked_at >= ? AND clicked_at < ? AND currency IS NOT NULL %[2]s
+			AND (? = 0 OR NOT EXISTS (SELECT 1 FROM clicks k WHERE k.id = conversions.click_id AND k.fraud_score >= ?))
+		GROUP BY 1, 2
+	`, column, eventFilter), append(convArgs, validOnly, fraud.InvalidScore)...)
+	if err != nil {
+		return nil, err
+	}
+	defer revenue.Close()
+
+	for revenue.Next() {
+		var key, currency string
+		var sum float64
+		if err := revenue.Scan(&key, &currency, &sum); err != nil {
+			return nil, err
+		}
+		// Conversions of a click deleted since are still revenue for its group
+		stat, ok := groups[key]
+		if !ok {
+			stat = &ConversionStat{Key: key, Revenue: map[string]float64{}}
+			groups[key] = stat
+		}
+		stat.Revenue[currency] = sum
+	}
+	if err := revenue.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]ConversionStat, 0, len(groups))
+	for _, stat := range groups {
+		out = append(out, *stat)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Conversions != out[j].Conversions {
+			return out[i].Conversions > out[j].Conversions
+		}
+		if out[i].Clicks != out[j].Clicks {
+			return out[i].Clicks > out[j].Clicks
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out, nil
+}
@@ -0,0 +1,143 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAppendClickID(t *testing.T) {
+	tests := []struct {
+		dest string
+		want string
+	}{
+		{"https://example.com/pricing", "https://example.com/pricing?trk_click_id=c+1"},
+		{"https://example.com/?a=1&b=x%2Fy", "https://example.com/?a=1&b=x%2Fy&trk_click_id=c+1"},
+		{"https://example.com/p?a=1#plans", "https://example.com/p?a=1&trk_click_id=c+1#plans"},
+	}
+	for _, tt := range tests {
+		if got := AppendClickID(tt.dest, DefaultClickIDParam, "c 1"); got != tt.want {
+			t.Errorf("AppendClickID(%q) = %q, want %q", tt.dest, got, tt.want)
+		}
+	}
+}
+
+func TestConversion_Validate(t *testing.T) {
+	c := &Conversion{ClickID: "c1", Event: " Purchase ", Value: 19.5, Currency: "eur"}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if c.Event != "purchase" || c.Currency != "EUR" {
+		t.Errorf("Normalized to %q %q, want purchase EUR", c.Event, c.Currency)
+	}
+
+	invalid := []Conversion{
+		{Event: "signup"},
+		{ClickID: "c1", Event: "sign up"},
+		{ClickID: "c1", Event: "purchase", Value: -1, Currency: "USD"},
+		{ClickID: "c1", Event: "purchase", Value: 10},
+		{ClickID: "c1", Event: "purchase", Value: 10, Currency: "dollars"},
+	}
+	for _, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded, want error", c)
+		}
+	}
+}
+
+func TestService_RecordConversion(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC)
+	insertClick(t, db, "c1", "l1", now.Add(-time.Hour), "1.1.1.1", "US")
+	insertClick(t, db, "old", "l1", now.AddDate(0, 0, -40), "1.1.1.1", "US")
+	db.Exec("UPDATE clicks SET utm_campaign = 'spring' WHERE id = 'c1'")
+
+	service := NewService(NewRepository(db))
+	window := 30 * 24 * time.Hour
+
+	c := &Conversion{ClickID: "c1", Event: "purchase", Value: 20, Currency: "USD", ExternalID: "order-1"}
+	recorded, err := service.RecordConversion(c, window, now)
+	if err != nil || !recorded {
+		t.Fatalf("RecordConversion = %v, %v; want recorded", recorded, err)
+	}
+	if c.LinkID != "l1" || c.UTMCampaign != "spring" || c.ClickedAt != now.Add(-time.Hour).UnixMilli() {
+		t.Errorf("Conversion not attributed to its click: %+v", c)
+	}
+
+	// The same order reported twice is stored once
+	recorded, err = service.RecordConversion(&Conversion{ClickID: "c1", Event: "purchase", Value: 20, Currency: "USD", ExternalID: "order-1"}, window, now)
+	if err != nil || recorded {
+		t.Errorf("Repeated external_id = %v, %v; want ignored", recorded, err)
+	}
+
+	if _, err := service.RecordConversion(&Conversion{ClickID: "nope", Event: "signup"}, window, now); err != ErrUnknownClick {
+		t.Errorf("Unknown click error = %v, want ErrUnknownClick", err)
+	}
+	if _, err := service.RecordConversion(&Conversion{ClickID: "old", Event: "signup"}, window, now); err != ErrConversionTooLate {
+		t.Errorf("Old click error = %v, want ErrConversionTooLate", err)
+	}
+}
+
+func TestService_GetConversionBreakdown(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC)
+	for _, id := range []string{"a1", "a2", "a3", "a4"} {
+		insertClick(t, db, id, "l1", now.Add(-time.Hour), "1.1.1.1", "US")
+	}
+	insertClick(t, db, "b1", "l2", now.Add(-time.Hour), "2.2.2.2", "DE")
+	// Before the range; its conversion must not count
+	insertClick(t, db, "x1", "l2", now.AddDate(0, 0, -3), "2.2.2.2", "DE")
+
+	service := NewService(NewRepository(db))
+	record := func(clickID, event string, value float64, currency string) {
+		c := &Conversion{ClickID: clickID, Event: event, Value: value, Currency: currency}
+		if err := c.Validate(); err != nil {
+			t.Fatalf("Validate failed: %v", err)
+		}
+		if _, err := service.RecordConversion(c, 0, now); err != nil {
+			t.Fatalf("RecordConversion failed: %v", err)
+		}
+	}
+	record("a1", "signup", 0, "")
+	record("a1", "purchase", 30, "USD")
+	record("a2", "purchase", 12.5, "USD")
+	record("a2", "purchase", 5, "EUR")
+	record("b1", "signup", 0, "")
+	record("x1", "purchase", 100, "USD")
+
+	bd, err := service.GetConversionBreakdown(ConversionRequest{StartDate: "2026-03-10", EndDate: "2026-03-11"}, now)
+	if err != nil {
+		t.Fatalf("GetConversionBreakdown failed: %v", err)
+	}
+	if bd.GroupBy != GroupByLink || len(bd.Groups) != 2 {
+		t.Fatalf("Breakdown = %+v, want 2 link groups", bd)
+	}
+
+	l1 := bd.Groups[0]
+	if l1.Key != "l1" || l1.Clicks != 4 || l1.ConvertedClicks != 2 || l1.Conversions != 4 || l1.ConversionRate != 0.5 {
+		t.Errorf("l1 = %+v, want 4 clicks, 2 converted, 4 conversions, rate 0.5", l1)
+	}
+	if l1.Revenue["USD"] != 42.5 || l1.Revenue["EUR"] != 5 {
+		t.Errorf("l1 revenue = %v, want USD 42.5, EUR 5", l1.Revenue)
+	}
+	l2 := bd.Groups[1]
+	if l2.Key != "l2" || l2.Clicks != 1 || l2.Conversions != 1 || l2.ConversionRate != 1 || len(l2.Revenue) != 0 {
+		t.Errorf("l2 = %+v, want 1 click converted once without revenue", l2)
+	}
+
+	// Filtering to one event
+	bd, err = service.GetConversionBreakdown(ConversionRequest{GroupBy: GroupByCampaign, StartDate: "2026-03-10", EndDate: "2026-03-11", Event: "signup"}, now)
+	if err != nil {
+		t.Fatalf("GetConversionBreakdown failed: %v", err)
+	}
+	if len(bd.Groups) != 1 || bd.Groups[0].Key != "" || bd.Groups[0].Clicks != 5 || bd.Groups[0].Conversions != 2 {
+		t.Errorf("Campaign breakdown = %+v, want one untagged group with 5 clicks, 2 signups", bd.Groups)
+	}
+
+	if _, err := service.GetConversionBreakdown(ConversionRequest{GroupBy: "country"}, now); err == nil {
+		t.Error("Unknown group_by accepted")
+	}
+}
@@ -0,0 +1,316 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"trackr/internal/pkg/parquet"
+)
+
+const (
+	ExportCSV     = "csv"
+	ExportNDJSON  = "ndjson"
+	ExportParquet = "parquet"
+
+	DatasetClicks     = "clicks"
+	DatasetDailyStats = "daily_stats"
+
+	maxExportDays = 366
+)
+
+// ExportRequest selects a dataset for a link, or the whole organization when
+// LinkID is empty, between two inclusive UTC dates.
+type ExportRequest struct {
+	Dataset   string `json:"dataset"` // clicks or daily_stats
+	Format    string `json:"format"`  // csv, ndjson or parquet
+	LinkID    string `json:"link_id,omitempty"`
+	StartDate string `json:"start_date"` // YYYY-MM-DD
+	EndDate   string `json:"end_date"`   // YYYY-MM-DD
+}
+
+// Validate fills in defaults (clicks as CSV over the last 30 days) and checks
+// the range.
+func (req *ExportRequest) Validate(now time.Time) error {
+	if req.Dataset == "" {
+		req.Dataset = DatasetClicks
+	}
+	if req.Format == "" {
+		req.Format = ExportCSV
+	}
+	if req.Dataset != DatasetClicks && req.Dataset != DatasetDailyStats {
+		return errors.New("dataset must be clicks or daily_stats")
+	}
+	if _, ok := exportContentTypes[req.Format]; !ok {
+		return errors.New("format must be csv, ndjson or parquet")
+	}
+
+	today := now.UTC().Format(dateLayout)
+	if req.EndDate == "" {
+		req.EndDate = today
+	}
+	end, err := time.Parse(dateLayout, req.EndDate)
+	if err != nil {
+		return errors.New("invalid end_date: use YYYY-MM-DD")
+	}
+	if req.StartDate == "" {
+		req.StartDate = end.AddDate(0, 0, -29).Format(dateLayout)
+	}
+	start, err := time.Parse(dateLayout, req.StartDate)
+	if err != nil {
+		return errors.New("invalid start_date: use YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return errors.New("end_date must not be before start_date")
+	}
+	if int(end.Sub(start).Hours()/24)+1 > maxExportDays {
+		return errors.New("range must be at most 366 days")
+	}
+	return nil
+}
+
+var exportContentTypes = map[string]string{
+	ExportCSV:     "text/csv; charset=utf-8",
+	ExportNDJSON:  "application/x-ndjson",
+	ExportParquet: "application/vnd.apache.parquet",
+}
+
+func (req *ExportRequest) ContentType() string {
+	return exportContentTypes[req.Format]
+}
+
+// Filename names the download, e.g. clicks_2026-03-01_2026-03-31.csv.
+func (req *ExportRequest) Filename() string {
+	return req.Dataset + "_" + req.StartDate + "_" + req.EndDate + "." + req.Format
+}
+
+// exportColumns are each dataset's columns in file order. Click exports carry
+// the visitor ID, never the raw IP or user agent.
+var exportColumns = map[string][]parquet.Column{
+	DatasetClicks: {
+		{Name: "id", Type: parquet.String},
+		{Name: "link_id", Type: parquet.String},
+		{Name: "short_code", Type: parquet.String},
+		{Name: "timestamp", Type: parquet.Timestamp},
+		{Name: "visitor_id", Type: parquet.String, Optional: true},
+		{Name: "country_code", Type: parquet.String, Optional: true},
+		{Name: "city", Type: parquet.String, Optional: true},
+		{Name: "device_type", Type: parquet.String, Optional: true},
+		{Name: "os", Type: parquet.String, Optional: true},
+		{Name: "browser", Type: parquet.String, Optional: true},
+		{Name: "referrer_domain", Type: parquet.String, Optional: true},
+		{Name: "utm_source", Type: parquet.String, Optional: true},
+		{Name: "utm_medium", Type: parquet.String, Optional: true},
+		{Name: "utm_campaign", Type: parquet.String, Optional: true},
+		{Name: "utm_term", Type: parquet.String, Optional: true},
+		{Name: "utm_content", Type: parquet.String, Optional: true},
+		{Name: "destination_url", Type: parquet.String},
+		{Name: "qr_variant", Type: parquet.String, Optional: true},
+		{Name: "fraud_score", Type: parquet.Int64},
+		{Name: "fraud_reasons", Type: parquet.String, Optional: true},
+	},
+	DatasetDailyStats: {
+		{Name: "link_id", Type: parquet.String},
+		{Name: "date", Type: parquet.String},
+		{Name: "clicks", Type: parquet.Int64},
+		{Name: "valid_clicks", Type: parquet.Int64},
+		{Name: "unique_ips", Type: parquet.Int64},
+		{Name: "top_country", Type: parquet.String, Optional: true},
+		{Name: "top_referrer", Type: parquet.String, Optional: true},
+		{Name: "top_device", Type: parquet.String, Optional: true},
+	},
+}
+
+// rowWriter writes export rows in one file format; values are string, int64
+// or nil, in exportColumns order.
+type rowWriter interface {
+	Write(row []interface{}) error
+	Close() error
+}
+
+func newRowWriter(w io.Writer, format string, columns []parquet.Column) (rowWriter, error) {
+	switch format {
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		header := make([]string, len(columns))
+		for i, c := range columns {
+			header[i] = c.Name
+		}
+		if err := cw.Write(header); err != nil {
+			return nil, err
+		}
+		return &csvRowWriter{w: cw, record: make([]string, len(columns))}, nil
+	case ExportNDJSON:
+		return &ndjsonRowWriter{enc: json.NewEncoder(w), columns: columns}, nil
+	case ExportParquet:
+		return parquet.NewWriter(w, columns, parquet.DefaultRowGroupSize), nil
+	}
+	return nil, errors.New("unsupported export format")
+}
+
+type csvRowWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func (c *csvRowWriter) Write(row []interface{}) error {
+	for i, v := range row {
+		switch x := v.(type) {
+		case nil:
+			c.record[i] = ""
+		case string:
+			c.record[i] = x
+		case int64:
+			c.record[i] = strconv.FormatInt(x, 10)
+		}
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvRowWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonRowWriter struct {
+	enc     *json.Encoder
+	columns []parquet.Column
+}
+
+func (n *ndjsonRowWriter) Write(row []interface{}) error {
+	obj := make(map[string]interface{}, len(row))
+	for i, v := range row {
+		obj[n.columns[i].Name] = v
+	}
+	return n.enc.Encode(obj)
+}
+
+func (n *ndjsonRowWriter) Close() error {
+	return nil
+}
+
+// Export streams the requested dataset to w row by row and returns the
+// number of rows written. req must already be validated.
+func (s *Service) Export(w io.Writer, req ExportRequest) (int, error) {
+	columns := exportColumns[req.Dataset]
+	rw, err := newRowWriter(w, req.Format, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	err = s.repo.StreamExport(req, len(columns), func(row []interface{}) error {
+		rows++
+		return rw.Write(row)
+	})
+	if err != nil {
+		return rows, err
+	}
+	return rows, rw.Close()
+}
+
+// CountExportRows returns how many rows an export would contain.
+func (s *Service) CountExportRows(req ExportRequest) (int, error) {
+	return s.repo.CountExportRows(req)
+}
+
+// exportQuery returns the SELECT for req (after the column list) and its args.
+func exportQuery(req ExportRequest) (string, []interface{}) {
+	start, _ := time.Parse(dateLayout, req.StartDate)
+	end, _ := time.Parse(dateLayout, req.EndDate)
+	if req.Dataset == DatasetDailyStats {
+		return " FROM daily_stats WHERE date >= ? AND date <= ? AND (? = '' OR link_id = ?)",
+			[]interface{}{req.StartDate, req.EndDate, req.LinkID, req.LinkID}
+	}
+	return " FROM clicks WHERE timestamp >= ? AND timestamp < ? AND (? = '' OR link_id = ?)",
+		[]interface{}{start.UnixMilli(), end.AddDate(0, 0, 1).UnixMilli(), req.LinkID, req.LinkID}
+}
+
+func (r *Repository) CountExportRows(req ExportRequest) (int, error) {
+	from, args := exportQuery(req)
+	var n int
+	err := r.db.QueryRow("SELECT COUNT(*)"+from, args...).Scan(&n)
+	return n, err
+}
+
+// StreamExport calls fn for each row of the export in time order without
+// holding more than one row in memory. The row slice is reused between calls.
+func (r *Repository) StreamExport(req ExportRequest, width int, fn func([]interface{}) error) error {
+	columns := ""
+	order := " ORDER BY date, link_id"
+	for i, c := range exportColumns[req.Dataset] {
+		if i > 0 {
+			columns += ", "
+		}
+		columns += c.Name
+	}
+	if req.Dataset == DatasetClicks {
+		order = " ORDER BY timestamp, id"
+	}
+
+	from, args := exportQuery(req)
+	rows, err := r.db.Query("SELECT "+columns+from+order, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cols := exportColumns[req.Dataset]
+	raw := make([]interface{}, width)
+	dest := make([]interface{}, width)
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+	row := make([]interface{}, width)
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, v := range raw {
+			row[i] = exportValue(v, cols[i])
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// exportValue normalizes a scanned value to string, int64 or nil. Empty
+// optional strings export as null.
+func exportValue(v interface{}, col parquet.Column) interface{} {
+	switch x := v.(type) {
+	case nil:
+		if !col.Optional {
+			if col.Type == parquet.String {
+				return ""
+			}
+			return int64(0)
+		}
+		return nil
+	case []byte:
+		v = string(x)
+	}
+	switch col.Type {
+	case parquet.String:
+		s, _ := v.(string)
+		if s == "" && col.Optional {
+			return nil
+		}
+		return s
+	default:
+		switch x := v.(type) {
+		case int64:
+			return x
+		case string:
+			n, _ := strconv.ParseInt(x, 10, 64)
+			return n
+		case float64:
+			return int64(x)
+		}
+		return int64(0)
+	}
+}
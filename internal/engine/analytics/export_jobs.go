@@ -0,0 +1,317 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ExportPending   = "pending"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+	ExportExpired   = "expired" // Reported only; the row stays completed
+)
+
+var (
+	ErrExportNotFound  = errors.New("export not found")
+	ErrInvalidDownload = errors.New("download link is invalid or has expired")
+
+	exportFilePattern = regexp.MustCompile(`^[0-9a-f-]{36}\.(csv|ndjson|parquet)$`)
+)
+
+type ExportJob struct {
+	ID string `json:"id"`
+	ExportRequest
+	Status      string `json:"status"`
+	Rows        int    `json:"rows"`
+	SizeBytes   int64  `json:"size_bytes"`
+	Error       string `json:"error,omitempty"`
+	CreatedBy   string `json:"created_by,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+	CompletedAt int64  `json:"completed_at,omitempty"`
+	ExpiresAt   int64  `json:"expires_at,omitempty"`
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// ExportStore runs background exports into dir/<org_id>/<job_id>.<format>
+// and hands out HMAC-signed download links that expire with the file.
+type ExportStore struct {
+	dir    string
+	secret []byte
+	ttl    time.Duration
+	slots  chan struct{} // Bounds exports running at once
+}
+
+func NewExportStore(dir, secret string, ttl time.Duration, concurrency int) *ExportStore {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	if concurrency < 1 {
+		concurrency = 2
+	}
+	return &ExportStore{dir: dir, secret: []byte(secret), ttl: ttl, slots: make(chan struct{}, concurrency)}
+}
+
+// Start records a pending job for req and runs it in the background.
+func (s *ExportStore) Start(db *sql.DB, orgID, createdBy string, req ExportRequest) (*ExportJob, error) {
+	job := &ExportJob{
+		ID:            uuid.New().String(),
+		ExportRequest: req,
+		Status:        ExportPending,
+		CreatedBy:     createdBy,
+		CreatedAt:     time.Now().Unix(),
+	}
+	if err := NewRepository(db).CreateExportJob(job); err != nil {
+		return nil, err
+	}
+	go s.run(db, orgID, *job)
+	return job, nil
+}
+
+func (s *ExportStore) run(db *sql.DB, orgID string, job ExportJob) {
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	repo := NewRepository(db)
+	job.Status = ExportRunning
+	if err := repo.UpdateExportJob(&job); err != nil {
+		log.Printf("Export %s: %v", job.ID, err)
+		return
+	}
+
+	rows, size, err := s.write(NewService(repo), orgID, &job)
+	job.CompletedAt = time.Now().Unix()
+	if err != nil {
+		log.Printf("Export %s for %s failed: %v", job.ID, orgID, err)
+		job.Status = ExportFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = ExportCompleted
+		job.Rows = rows
+		job.SizeBytes = size
+		job.ExpiresAt = time.Unix(job.CompletedAt, 0).Add(s.ttl).Unix()
+	}
+	if err := repo.UpdateExportJob(&job); err != nil {
+		log.Printf("Export %s: %v", job.ID, err)
+	}
+}
+
+// write exports to a temporary file and renames it into place, so a download
+// never sees a partial file.
+func (s *ExportStore) write(service *Service, orgID string, job *ExportJob) (int, int64, error) {
+	dir := filepath.Join(s.dir, orgID)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return 0, 0, err
+	}
+	path := filepath.Join(dir, exportFileName(job))
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, 0, err
+	}
+	rows, err := service.Export(f, job.ExportRequest)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return rows, 0, err
+	}
+
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return rows, 0, err
+	}
+	return rows, info.Size(), os.Rename(tmp, path)
+}
+
+func exportFileName(job *ExportJob) string {
+	return job.ID + "." + job.Format
+}
+
+// Present prepares a job for a response: completed jobs past their expiry are
+// reported as expired, and live ones get a signed download URL.
+func (s *ExportStore) Present(orgID string, job *ExportJob, baseURL string, now time.Time) {
+	if job.Status != ExportCompleted {
+		return
+	}
+	if now.Unix() >= job.ExpiresAt {
+		job.Status = ExportExpired
+		return
+	}
+	job.DownloadURL = baseURL + s.SignedPath(orgID, exportFileName(job), job.ExpiresAt)
+}
+
+// SignedPath returns the download path of an export file, valid until expires
+// (unix seconds).
+func (s *ExportStore) SignedPath(orgID, file string, expires int64) string {
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("signature", s.sign(orgID, file, expires))
+	return "/api/v1/exports/" + url.PathEscape(orgID) + "/" + file + "?" + q.Encode()
+}
+
+func (s *ExportStore) sign(orgID, file string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s/%s\n%d", orgID, file, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Open checks a signed download link and opens the file it names.
+func (s *ExportStore) Open(orgID, file, expires, signature string, now time.Time) (*os.File, error) {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now.Unix() >= exp {
+		return nil, ErrInvalidDownload
+	}
+	if !exportFilePattern.MatchString(file) || orgID == "" || filepath.Base(orgID) != orgID || orgID == ".." {
+		return nil, ErrInvalidDownload
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign(orgID, file, exp))) {
+		return nil, ErrInvalidDownload
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, orgID, file))
+	if os.IsNotExist(err) {
+		return nil, ErrInvalidDownload
+	}
+	return f, err
+}
+
+// Sweep deletes export files (and abandoned temporary files) older than the
+// download TTL and returns how many it removed.
+func (s *ExportStore) Sweep(now time.Time) (int, error) {
+	orgs, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, org := range orgs {
+		if !org.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(s.dir, org.Name()))
+		if err != nil {
+			return removed, err
+		}
+		for _, file := range files {
+			info, err := file.Info()
+			if err != nil || now.Sub(info.ModTime()) < s.ttl {
+				continue
+			}
+			if err := os.Remove(filepath.Join(s.dir, org.Name(), file.Name())); err == nil {
+				removed++
+			}
+		}
+	}
+	return removed, nil
+}
+
+// Watch sweeps expired exports every interval until stop is closed.
+func (s *ExportStore) Watch(interval time.Duration, stop <-chan struct{}) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if n, err := s.Sweep(now); err != nil {
+				log.Printf("Export sweep failed: %v", err)
+			} else if n > 0 {
+				log.Printf("Removed %d expired exports", n)
+			}
+		}
+	}
+}
+
+func (r *Repository) CreateExportJob(job *ExportJob) error {
+	_, err := r.db.Exec(`
+		INSERT INTO export_jobs (id, dataset, format, link_id, start_date, end_date, status, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, job.ID, job.Dataset, job.Format, nullIfEmpty(job.LinkID), job.StartDate, job.EndDate, job.Status,
+		nullIfEmpty(job.CreatedBy), job.CreatedAt)
+	return err
+}
+
+func (r *Repository) UpdateExportJob(job *ExportJob) error {
+	_, err := r.db.Exec(`
+		UPDATE export_jobs
+		SET status = ?, rows = ?, size_bytes = ?, error = ?, completed_at = ?, expires_at = ?
+		WHERE id = ?
+	`, job.Status, job.Rows, job.SizeBytes, nullIfEmpty(job.Error),
+		sql.NullInt64{Int64: job.CompletedAt, Valid: job.CompletedAt > 0},
+		sql.NullInt64{Int64: job.ExpiresAt, Valid: job.ExpiresAt > 0}, job.ID)
+	return err
+}
+
+const exportJobColumns = `id, dataset, format, link_id, start_date, end_date, status, rows, size_bytes,
+	error, created_by, created_at, completed_at, expires_at`
+
+func (r *Repository) GetExportJob(id string) (*ExportJob, error) {
+	job, err := scanExportJob(r.db.QueryRow("SELECT "+exportJobColumns+" FROM export_jobs WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrExportNotFound
+	}
+	return job, err
+}
+
+// ListExportJobs returns the most recent jobs first.
+func (r *Repository) ListExportJobs(limit int) ([]*ExportJob, error) {
+	rows, err := r.db.Query("SELECT "+exportJobColumns+" FROM export_jobs ORDER BY created_at DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*ExportJob{}
+	for rows.Next() {
+		job, err := scanExportJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func scanExportJob(row interface{ Scan(...interface{}) error }) (*ExportJob, error) {
+	job := &ExportJob{}
+	var linkID, errMsg, createdBy sql.NullString
+	var completedAt, expiresAt sql.NullInt64
+	err := row.Scan(&job.ID, &job.Dataset, &job.Format, &linkID, &job.StartDate, &job.EndDate, &job.Status,
+		&job.Rows, &job.SizeBytes, &errMsg, &createdBy, &job.CreatedAt, &completedAt, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	job.LinkID = linkID.String
+	job.Error = errMsg.String
+	job.CreatedBy = createdBy.String
+	job.CompletedAt = completedAt.Int64
+	job.ExpiresAt = expiresAt.Int64
+	return job, nil
+}
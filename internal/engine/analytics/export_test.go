@@ -0,0 +1,162 @@
+package analytics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestService_Export(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	day := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	insertClick(t, db, "c1", "l1", day, "1.1.1.1", "US")
+	insertClick(t, db, "c2", "l2", day.Add(time.Hour), "2.2.2.2", "")
+	insertClick(t, db, "c3", "l1", day.AddDate(0, 0, 2), "3.3.3.3", "DE") // Outside the range
+
+	service := NewService(NewRepository(db))
+	req := ExportRequest{Format: ExportCSV, StartDate: "2026-03-10", EndDate: "2026-03-11"}
+	if err := req.Validate(day); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rows, err := service.Export(&buf, req)
+	if err != nil || rows != 2 {
+		t.Fatalf("Export = %d rows, %v; want 2", rows, err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "id,link_id,short_code,timestamp,visitor_id,country_code") {
+		t.Fatalf("Unexpected CSV: %q", buf.String())
+	}
+	if strings.Contains(buf.String(), "1.1.1.1") {
+		t.Error("Exports must not contain raw IPs")
+	}
+	if !strings.HasPrefix(lines[1], "c1,l1,,1773144000000,,US,") {
+		t.Errorf("Unexpected first row: %q", lines[1])
+	}
+
+	// A single link as NDJSON; empty optional values are null
+	req = ExportRequest{Format: ExportNDJSON, LinkID: "l2", StartDate: "2026-03-10", EndDate: "2026-03-11"}
+	req.Validate(day)
+	buf.Reset()
+	if _, err := service.Export(&buf, req); err != nil {
+		t.Fatalf("NDJSON export failed: %v", err)
+	}
+	scanner := bufio.NewScanner(&buf)
+	var records []map[string]interface{}
+	for scanner.Scan() {
+		var rec map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("Invalid NDJSON line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 1 || records[0]["id"] != "c2" || records[0]["country_code"] != nil || records[0]["timestamp"].(float64) != float64(day.Add(time.Hour).UnixMilli()) {
+		t.Errorf("Unexpected NDJSON records: %+v", records)
+	}
+
+	// Rollups as Parquet
+	NewRepository(db).UpsertDailyStats(&DailyStat{Date: "2026-03-10", Clicks: 4, UniqueIPs: 3}, "l1")
+	req = ExportRequest{Dataset: DatasetDailyStats, Format: ExportParquet, StartDate: "2026-03-10", EndDate: "2026-03-10"}
+	req.Validate(day)
+	buf.Reset()
+	if rows, err := service.Export(&buf, req); err != nil || rows != 1 {
+		t.Fatalf("Parquet export = %d rows, %v", rows, err)
+	}
+	if data := buf.Bytes(); !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Error("Expected a Parquet file")
+	}
+}
+
+func TestExportRequest_Validate(t *testing.T) {
+	now := time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)
+	for _, req := range []ExportRequest{
+		{Format: "xlsx"},
+		{Dataset: "links"},
+		{StartDate: "2026-03-10", EndDate: "2026-03-01"},
+		{StartDate: "2024-01-01", EndDate: "2026-03-01"},
+		{StartDate: "yesterday"},
+	} {
+		if err := req.Validate(now); err == nil {
+			t.Errorf("Expected %+v to be rejected", req)
+		}
+	}
+}
+
+func TestExportStore_JobAndSignedDownload(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1) // One in-memory database shared with the job goroutine
+
+	now := time.Now().UTC()
+	insertClick(t, db, "c1", "l1", now, "1.1.1.1", "US")
+
+	store := NewExportStore(t.TempDir(), "secret", time.Hour, 1)
+	req := ExportRequest{Format: ExportCSV}
+	req.Validate(now)
+	job, err := store.Start(db, "org_1", "user_1", req)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	repo := NewRepository(db)
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != ExportCompleted && job.Status != ExportFailed && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		if job, err = repo.GetExportJob(job.ID); err != nil {
+			t.Fatalf("GetExportJob failed: %v", err)
+		}
+	}
+	if job.Status != ExportCompleted || job.Rows != 1 || job.SizeBytes == 0 {
+		t.Fatalf("Unexpected job: %+v", job)
+	}
+
+	store.Present("org_1", job, "https://api.example.com", time.Now())
+	u, err := url.Parse(job.DownloadURL)
+	if err != nil || !strings.HasPrefix(job.DownloadURL, "https://api.example.com/api/v1/exports/org_1/"+job.ID+".csv?") {
+		t.Fatalf("Unexpected download URL %q", job.DownloadURL)
+	}
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+	file := job.ID + ".csv"
+	tampered := "0" + signature[1:]
+	if tampered == signature {
+		tampered = "1" + signature[1:]
+	}
+
+	f, err := store.Open("org_1", file, expires, signature, time.Now())
+	if err != nil {
+		t.Fatalf("Open with a valid signature failed: %v", err)
+	}
+	f.Close()
+
+	for name, open := range map[string]func() error{
+		"other org": func() error { _, err := store.Open("org_2", file, expires, signature, time.Now()); return err },
+		"traversal": func() error { _, err := store.Open("..", file, expires, signature, time.Now()); return err },
+		"bad sig":   func() error { _, err := store.Open("org_1", file, expires, tampered, time.Now()); return err },
+		"expired": func() error {
+			_, err := store.Open("org_1", file, expires, signature, time.Now().Add(2*time.Hour))
+			return err
+		},
+		"longer life": func() error { _, err := store.Open("org_1", file, expires+"0", signature, time.Now()); return err },
+	} {
+		if err := open(); err != ErrInvalidDownload {
+			t.Errorf("%s: expected ErrInvalidDownload, got %v", name, err)
+		}
+	}
+
+	// Past the TTL the job reports expired and the file is swept
+	expired, _ := repo.GetExportJob(job.ID)
+	store.Present("org_1", expired, "", time.Now().Add(2*time.Hour))
+	if expired.Status != ExportExpired || expired.DownloadURL != "" {
+		t.Errorf("Expected an expired job without URL: %+v", expired)
+	}
+	if n, err := store.Sweep(time.Now().Add(2 * time.Hour)); err != nil || n != 1 {
+		t.Errorf("Sweep = %d, %v; want 1 file removed", n, err)
+	}
+}
@@ -0,0 +1,31 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Fingerprinter derives visitor IDs from request attributes with a keyed hash,
+// so unique-visitor counts don't need raw IPs and IDs can't be reversed or
+// matched across organizations without the secret.
+type Fingerprinter struct {
+	key []byte
+}
+
+func NewFingerprinter(secret string) *Fingerprinter {
+	return &Fingerprinter{key: []byte(secret)}
+}
+
+// VisitorID returns a stable 128-bit hex ID for a visitor of orgID. ip must be
+// the visitor's own address; behind a reverse proxy every visitor with the
+// same user agent would share one ID.
+func (f *Fingerprinter) VisitorID(orgID, ip, userAgent string) string {
+	mac := hmac.New(sha256.New, f.key)
+	mac.Write([]byte(orgID))
+	mac.Write([]byte{0})
+	mac.Write([]byte(ip))
+	mac.Write([]byte{0})
+	mac.Write([]byte(userAgent))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,173 @@
+package analytics
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	GranularityHour  = "hour"
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+
+	maxOverviewDays = 366
+	maxHourlyDays   = 7
+	overviewTopN    = 10
+	dateLayout      = "2006-01-02"
+)
+
+// OverviewRequest is an inclusive range of UTC dates.
+type OverviewRequest struct {
+	StartDate   string // YYYY-MM-DD
+	EndDate     string // YYYY-MM-DD
+	Granularity string // hour, day, week, month
+	ValidOnly   bool   // Leave out clicks scored as fraud; reads raw clicks instead of rollups
+}
+
+// Overview summarizes a whole organization over a date range.
+//
+// Past days come from the rollups (daily_stats, hourly_stats for the hourly
+// series, dimension_stats for breakdowns) and today from clicks.
+// UniqueVisitors merges per-day HyperLogLog sketches of the whole
+// organization, so repeat visitors count once; it is approximate. The hourly
+// series still adds up distinct IPs per link per hour.
+type Overview struct {
+	StartDate      string           `json:"start_date"`
+	EndDate        string           `json:"end_date"`
+	Granularity    string           `json:"granularity"`
+	TotalClicks    int              `json:"total_clicks"`
+	UniqueVisitors int              `json:"unique_visitors"`
+	TopLinks       []LinkCount      `json:"top_links"`
+	Countries      []DimensionCount `json:"countries"`
+	Devices        []DimensionCount `json:"devices"`
+	Browsers       []DimensionCount `json:"browsers"`
+	Referrers      []DimensionCount `json:"referrers"`
+	Series         []SeriesPoint    `json:"series"`
+	GeneratedAt    int64            `json:"generated_at"`
+}
+
+type LinkCount struct {
+	LinkID    string `json:"link_id"`
+	ShortCode string `json:"short_code"`
+	Clicks    int    `json:"clicks"`
+}
+
+type DimensionCount struct {
+	Value  string `json:"value"`
+	Clicks int    `json:"clicks"`
+}
+
+// SeriesPoint is one bucket; Bucket is the bucket's start (YYYY-MM-DD, or
+// YYYY-MM-DDTHH:00Z for hourly buckets).
+type SeriesPoint struct {
+	Bucket         string `json:"bucket"`
+	Clicks         int    `json:"clicks"`
+	UniqueVisitors int    `json:"unique_visitors"`
+}
+
+// Validate fills in defaults (the last 30 days, daily) and checks the range.
+func (req *OverviewRequest) Validate(now time.Time) error {
+	today := now.UTC().Format(dateLayout)
+	if req.EndDate == "" {
+		req.EndDate = today
+	}
+	if req.StartDate == "" {
+		end, err := time.Parse(dateLayout, req.EndDate)
+		if err != nil {
+			return errors.New("invalid end_date: use YYYY-MM-DD")
+		}
+		req.StartDate = end.AddDate(0, 0, -29).Format(dateLayout)
+	}
+	if req.Granularity == "" {
+		req.Granularity = GranularityDay
+	}
+
+	start, err := time.Parse(dateLayout, req.StartDate)
+	if err != nil {
+		return errors.New("invalid start_date: use YYYY-MM-DD")
+	}
+	end, err := time.Parse(dateLayout, req.EndDate)
+	if err != nil {
+		return errors.New("invalid end_date: use YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return errors.New("end_date must not be before start_date")
+	}
+	days := int(end.Sub(start).Hours()/24) + 1
+	if days > maxOverviewDays {
+		return errors.New("range must be at most 366 days")
+	}
+
+	switch req.Granularity {
+	case GranularityHour:
+		if days > maxHourlyDays {
+			return errors.New("hourly granularity is limited to 7 days")
+		}
+	case GranularityDay, GranularityWeek, GranularityMonth:
+	default:
+		return errors.New("granularity must be hour, day, week or month")
+	}
+	return nil
+}
+
+// bucketStart maps a UTC date to the start of its week (Monday) or month.
+func bucketStart(date time.Time, granularity string) string {
+	switch granularity {
+	case GranularityWeek:
+		offset := (int(date.Weekday()) + 6) % 7
+		return date.AddDate(0, 0, -offset).Format(dateLayout)
+	case GranularityMonth:
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC).Format(dateLayout)
+	default:
+		return date.Format(dateLayout)
+	}
+}
+
+// OverviewCache holds computed overviews briefly; they are expensive and the
+// underlying rollups only change when the aggregation worker runs.
+type OverviewCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedOverview
+}
+
+type cachedOverview struct {
+	overview *Overview
+	cachedAt time.Time
+}
+
+func NewOverviewCache(ttl time.Duration) *OverviewCache {
+	return &OverviewCache{ttl: ttl, entries: map[string]cachedOverview{}}
+}
+
+func (c *OverviewCache) Get(key string) (*Overview, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Since(entry.cachedAt) > c.ttl {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.overview, true
+}
+
+func (c *OverviewCache) Set(key string, overview *Overview) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Sweep expired entries occasionally so one-off ranges don't accumulate
+	if len(c.entries) >= 1000 {
+		for k, entry := range c.entries {
+			if time.Since(entry.cachedAt) > c.ttl {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = cachedOverview{overview: overview, cachedAt: time.Now()}
+}
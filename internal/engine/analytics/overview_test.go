@@ -0,0 +1,273 @@
+package analytics
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"trackr/internal/pkg/hll"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE links (
+		id TEXT PRIMARY KEY,
+		short_code TEXT UNIQUE NOT NULL
+	);
+	CREATE TABLE clicks (
+		id TEXT PRIMARY KEY,
+		link_id TEXT NOT NULL,
+		short_code TEXT NOT NULL,
+		timestamp INTEGER NOT NULL,
+		ip_address TEXT,
+		user_agent TEXT,
+		country_code TEXT,
+		city TEXT,
+		device_type TEXT,
+		os TEXT,
+		browser TEXT,
+		referrer TEXT,
+		referrer_domain TEXT,
+		utm_source TEXT,
+		utm_medium TEXT,
+		utm_campaign TEXT,
+		utm_term TEXT,
+		utm_content TEXT,
+		destination_url TEXT NOT NULL,
+		qr_variant TEXT,
+		visitor_id TEXT,
+		fraud_score INTEGER NOT NULL DEFAULT 0,
+		fraud_reasons TEXT
+	);
+	CREATE TABLE daily_stats (
+		id TEXT PRIMARY KEY,
+		link_id TEXT NOT NULL,
+		date TEXT NOT NULL,
+		clicks INTEGER DEFAULT 0,
+		valid_clicks INTEGER DEFAULT 0,
+		unique_ips INTEGER DEFAULT 0,
+		top_country TEXT,
+		top_referrer TEXT,
+		top_device TEXT,
+		created_at INTEGER NOT NULL,
+		UNIQUE(link_id, date)
+	);
+	CREATE TABLE hourly_stats (
+		link_id TEXT NOT NULL,
+		hour INTEGER NOT NULL,
+		clicks INTEGER NOT NULL DEFAULT 0,
+		unique_ips INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (link_id, hour)
+	);
+	CREATE TABLE dimension_stats (
+		link_id TEXT NOT NULL,
+		date TEXT NOT NULL,
+		dimension TEXT NOT NULL,
+		value TEXT NOT NULL,
+		clicks INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (link_id, date, dimension, value)
+	);
+	CREATE TABLE daily_sketches (
+		link_id TEXT NOT NULL,
+		date TEXT NOT NULL,
+		sketch BLOB NOT NULL,
+		PRIMARY KEY (link_id, date)
+	);
+	CREATE TABLE org_daily_sketches (
+		date TEXT PRIMARY KEY,
+		sketch BLOB NOT NULL
+	);
+	CREATE TABLE export_jobs (
+		id TEXT PRIMARY KEY,
+		dataset TEXT NOT NULL,
+		format TEXT NOT NULL,
+		link_id TEXT,
+		start_date TEXT NOT NULL,
+		end_date TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		rows INTEGER DEFAULT 0,
+		size_bytes INTEGER DEFAULT 0,
+		error TEXT,
+		created_by TEXT,
+		created_at INTEGER NOT NULL,
+		completed_at INTEGER,
+		expires_at INTEGER
+	);
+	CREATE TABLE conversions (
+		id TEXT PRIMARY KEY,
+		click_id TEXT NOT NULL,
+		link_id TEXT NOT NULL,
+		utm_campaign TEXT,
+		qr_variant TEXT,
+		event TEXT NOT NULL,
+		value REAL NOT NULL DEFAULT 0,
+		currency TEXT,
+		external_id TEXT,
+		clicked_at INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE UNIQUE INDEX idx_conversions_external ON conversions(click_id, event, external_id) WHERE external_id IS NOT NULL;
+	CREATE TABLE conversion_settings (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		append_click_id INTEGER NOT NULL DEFAULT 0,
+		click_id_param TEXT NOT NULL DEFAULT 'trk_click_id',
+		updated_at INTEGER NOT NULL
+	);
+	CREATE TABLE aggregation_checkpoints (
+		job TEXT PRIMARY KEY,
+		last_date TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	INSERT INTO links (id, short_code) VALUES ('l1', 'one'), ('l2', 'two');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+	return db
+}
+
+func insertClick(t *testing.T, db *sql.DB, id, linkID string, ts time.Time, ip, country string) {
+	_, err := db.Exec(`
+		INSERT INTO clicks (id, link_id, short_code, timestamp, ip_address, country_code, device_type, destination_url)
+		VALUES (?, ?, '', ?, ?, ?, 'mobile', 'https://example.com')
+	`, id, linkID, ts.UnixMilli(), ip, country)
+	if err != nil {
+		t.Fatalf("Failed to insert click: %v", err)
+	}
+}
+
+func insertOrgSketch(t *testing.T, db *sql.DB, date string, visitors ...string) {
+	sketch, _ := hll.New(hll.DefaultPrecision)
+	for _, v := range visitors {
+		sketch.Insert([]byte(v))
+	}
+	data, _ := sketch.MarshalBinary()
+	if _, err := db.Exec("INSERT INTO org_daily_sketches (date, sketch) VALUES (?, ?)", date, data); err != nil {
+		t.Fatalf("Failed to insert sketch: %v", err)
+	}
+}
+
+func TestService_GetOrgOverview(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// Wednesday; the week starts on Monday 2026-03-09
+	now := time.Date(2026, 3, 11, 15, 30, 0, 0, time.UTC)
+
+	repo := NewRepository(db)
+	repo.UpsertDailyStats(&DailyStat{Date: "2026-03-08", Clicks: 4, UniqueIPs: 3}, "l1")
+	repo.UpsertDailyStats(&DailyStat{Date: "2026-03-10", Clicks: 5, UniqueIPs: 2}, "l2")
+	// A rollup for today is ignored in favour of raw clicks
+	repo.UpsertDailyStats(&DailyStat{Date: "2026-03-11", Clicks: 100, UniqueIPs: 100}, "l1")
+	// Visitor 1.1.1.1 came back today, so it counts once
+	insertOrgSketch(t, db, "2026-03-08", "a", "b", "c")
+	insertOrgSketch(t, db, "2026-03-10", "a", "1.1.1.1")
+
+	insertClick(t, db, "c1", "l1", now.Add(-time.Hour), "1.1.1.1", "US")
+	insertClick(t, db, "c2", "l1", now.Add(-time.Hour), "1.1.1.1", "US")
+	insertClick(t, db, "c3", "l2", now.Add(-2*time.Hour), "2.2.2.2", "DE")
+
+	service := NewService(repo)
+
+	ov, err := service.GetOrgOverview(OverviewRequest{StartDate: "2026-03-08", EndDate: "2026-03-11", Granularity: GranularityWeek}, now)
+	if err != nil {
+		t.Fatalf("GetOrgOverview failed: %v", err)
+	}
+
+	if ov.TotalClicks != 12 || ov.UniqueVisitors != 5 {
+		t.Errorf("Totals = %d clicks, %d visitors; want 12, 5", ov.TotalClicks, ov.UniqueVisitors)
+	}
+	if len(ov.Series) != 2 || ov.Series[0].Bucket != "2026-03-02" || ov.Series[0].Clicks != 4 || ov.Series[1].Bucket != "2026-03-09" || ov.Series[1].Clicks != 8 || ov.Series[1].UniqueVisitors != 3 {
+		t.Errorf("Unexpected weekly series: %+v", ov.Series)
+	}
+	if len(ov.TopLinks) != 2 || ov.TopLinks[0].ShortCode != "one" || ov.TopLinks[0].Clicks != 6 {
+		t.Errorf("Unexpected top links: %+v", ov.TopLinks)
+	}
+	if len(ov.Countries) != 2 || ov.Countries[0].Value != "US" || ov.Countries[0].Clicks != 2 {
+		t.Errorf("Unexpected countries: %+v", ov.Countries)
+	}
+
+	hourly, err := service.GetOrgOverview(OverviewRequest{StartDate: "2026-03-11", EndDate: "2026-03-11", Granularity: GranularityHour}, now)
+	if err != nil {
+		t.Fatalf("Hourly overview failed: %v", err)
+	}
+	if len(hourly.Series) != 16 || hourly.Series[14].Bucket != "2026-03-11T14:00Z" || hourly.Series[14].Clicks != 2 {
+		t.Errorf("Unexpected hourly series: %d points, %+v", len(hourly.Series), hourly.Series)
+	}
+}
+
+func TestService_GetOrgOverviewValidOnly(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Date(2026, 3, 11, 15, 30, 0, 0, time.UTC)
+
+	repo := NewRepository(db)
+	// Rollups can't tell fraud apart, so valid-only overviews ignore them
+	repo.UpsertDailyStats(&DailyStat{Date: "2026-03-10", Clicks: 50, UniqueIPs: 50}, "l1")
+	insertOrgSketch(t, db, "2026-03-10", "a", "b")
+
+	insertClick(t, db, "c1", "l1", now.AddDate(0, 0, -1), "1.1.1.1", "US")
+	insertClick(t, db, "c2", "l2", now.AddDate(0, 0, -1), "2.2.2.2", "DE")
+	insertClick(t, db, "c3", "l2", now.Add(-time.Hour), "3.3.3.3", "DE")
+	insertClick(t, db, "c4", "l2", now.Add(-time.Hour), "3.3.3.3", "DE")
+	if _, err := db.Exec("UPDATE clicks SET fraud_score = 100 WHERE id IN ('c3', 'c4')"); err != nil {
+		t.Fatalf("Failed to score clicks: %v", err)
+	}
+
+	service := NewService(repo)
+	ov, err := service.GetOrgOverview(OverviewRequest{StartDate: "2026-03-10", EndDate: "2026-03-11", ValidOnly: true}, now)
+	if err != nil {
+		t.Fatalf("GetOrgOverview failed: %v", err)
+	}
+	if ov.TotalClicks != 2 || ov.UniqueVisitors != 2 {
+		t.Errorf("Totals = %d clicks, %d visitors; want 2, 2", ov.TotalClicks, ov.UniqueVisitors)
+	}
+	if len(ov.Series) != 2 || ov.Series[0].Clicks != 2 || ov.Series[1].Clicks != 0 {
+		t.Errorf("Unexpected daily series: %+v", ov.Series)
+	}
+	if len(ov.TopLinks) != 2 || ov.TopLinks[0].Clicks != 1 || ov.TopLinks[1].Clicks != 1 {
+		t.Errorf("Unexpected top links: %+v", ov.TopLinks)
+	}
+	if len(ov.Countries) != 2 || ov.Countries[0].Clicks != 1 {
+		t.Errorf("Unexpected countries: %+v", ov.Countries)
+	}
+
+	hourly, err := service.GetOrgOverview(OverviewRequest{StartDate: "2026-03-11", EndDate: "2026-03-11", Granularity: GranularityHour, ValidOnly: true}, now)
+	if err != nil {
+		t.Fatalf("Hourly overview failed: %v", err)
+	}
+	for _, p := range hourly.Series {
+		if p.Clicks != 0 {
+			t.Errorf("Hour %s has %d clicks; the only clicks today are fraud", p.Bucket, p.Clicks)
+		}
+	}
+}
+
+func TestOverviewRequest_Validate(t *testing.T) {
+	now := time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)
+
+	req := OverviewRequest{}
+	if err := req.Validate(now); err != nil || req.StartDate != "2026-02-10" || req.EndDate != "2026-03-11" || req.Granularity != GranularityDay {
+		t.Errorf("Unexpected defaults: %+v (%v)", req, err)
+	}
+
+	for _, bad := range []OverviewRequest{
+		{StartDate: "2026-03-11", EndDate: "2026-03-01"},
+		{StartDate: "2024-01-01", EndDate: "2026-01-01"},
+		{StartDate: "2026-03-01", EndDate: "2026-03-11", Granularity: GranularityHour},
+		{StartDate: "yesterday"},
+		{Granularity: "year"},
+	} {
+		if err := bad.Validate(now); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"trackr/internal/engine/fraud"
+)
+
+const (
+	MetricClicks         = "clicks"
+	MetricUniqueVisitors = "unique_visitors"
+
+	SourceClicks         = "clicks"
+	SourceDailyStats     = "daily_stats"
+	SourceHourlyStats    = "hourly_stats"
+	SourceDimensionStats = "dimension_stats"
+
+	defaultQueryLimit = 1000
+	maxQueryLimit     = 10000
+	maxQueryFilters   = 20
+	maxQueryRange     = 3 * 366 * 24 * time.Hour
+	maxHourlyRange    = 31 * 24 * time.Hour
+)
+
+// queryDimensions maps the public dimension names to clicks columns. Only
+// these names ever reach the SQL text; values are always bound parameters.
+var queryDimensions = map[string]string{
+	"link":            "link_id",
+	"country":         "country_code",
+	"city":            "city",
+	"device":          "device_type",
+	"os":              "os",
+	"browser":         "browser",
+	"referrer_domain": "referrer_domain",
+	"utm_source":      "utm_source",
+	"utm_medium":      "utm_medium",
+	"utm_campaign":    "utm_campaign",
+	"utm_term":        "utm_term",
+	"utm_content":     "utm_content",
+	"destination":     "destination_url",
+	"qr_variant":      "qr_variant",
+}
+
+// Query is an ad-hoc analytics question: metrics grouped by dimensions and
+// optional time buckets, over a time range, narrowed by filters.
+type Query struct {
+	Start      string   `json:"start"` // RFC 3339, or YYYY-MM-DD meaning the start of that day in Timezone
+	End        string   `json:"end"`   // RFC 3339 (exclusive), or YYYY-MM-DD (inclusive day)
+	Timezone   string   `json:"timezone"`
+	Interval   string   `json:"interval"` // hour, day, week, month, or empty for totals
+	Dimensions []string `json:"dimensions"`
+	Filters    []Filter `json:"filters"`
+	Metrics    []string `json:"metrics"`
+	Limit      int      `json:"limit"`
+	ValidOnly  bool     `json:"valid_only"` // Leave out clicks scored as fraud
+
+	start, end time.Time
+	loc        *time.Location
+}
+
+type Filter struct {
+	Dimension string   `json:"dimension"`
+	Op        string   `json:"op"` // eq, neq, in, not_in, contains
+	Values    []string `json:"values"`
+}
+
+type QueryResult struct {
+	Source    string     `json:"source"` // clicks, daily_stats, hourly_stats or dimension_stats
+	Start     string     `json:"start"`
+	End       string     `json:"end"`
+	Timezone  string     `json:"timezone"`
+	Interval  string     `json:"interval,omitempty"`
+	Rows      []QueryRow `json:"rows"`
+	Truncated bool       `json:"truncated"`
+}
+
+type QueryRow struct {
+	Bucket     string            `json:"bucket,omitempty"` // Bucket start in the query's timezone
+	Dimensions map[string]string `json:"dimensions,omitempty"`
+	Metrics    map[string]int    `json:"metrics"`
+}
+
+// Validate applies defaults and checks every name against the whitelists.
+func (q *Query) Validate(now time.Time) error {
+	if q.Timezone == "" {
+		q.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		return fmt.Errorf("unknown timezone %q", q.Timezone)
+	}
+	q.loc = loc
+
+	if q.End == "" {
+		q.end = now
+	} else if q.end, err = parseQueryTime(q.End, loc, true); err != nil {
+		return errors.New("invalid end: use RFC 3339 or YYYY-MM-DD")
+	}
+	if q.Start == "" {
+		q.start = q.end.AddDate(0, 0, -30)
+	} else if q.start, err = parseQueryTime(q.Start, loc, false); err != nil {
+		return errors.New("invalid start: use RFC 3339 or YYYY-MM-DD")
+	}
+	if !q.end.After(q.start) {
+		return errors.New("end must be after start")
+	}
+	if q.end.Sub(q.start) > maxQueryRange {
+		return errors.New("range must be at most 3 years")
+	}
+
+	switch q.Interval {
+	case "", GranularityDay, GranularityWeek, GranularityMonth:
+	case GranularityHour:
+		if q.end.Sub(q.start) > maxHourlyRange {
+			return errors.New("hourly interval is limited to 31 days")
+		}
+	default:
+		return errors.New("interval must be hour, day, week or month")
+	}
+
+	seen := map[string]bool{}
+	for _, d := range q.Dimensions {
+		if _, ok := queryDimensions[d]; !ok {
+			return fmt.Errorf("unknown dimension %q", d)
+		}
+		if seen[d] {
+			return fmt.Errorf("dimension %q listed twice", d)
+		}
+		seen[d] = true
+	}
+
+	if len(q.Metrics) == 0 {
+		q.Metrics = []string{MetricClicks}
+	}
+	for _, m := range q.Metrics {
+		if m != MetricClicks && m != MetricUniqueVisitors {
+			return fmt.Errorf("unknown metric %q", m)
+		}
+	}
+
+	if len(q.Filters) > maxQueryFilters {
+		return fmt.Errorf("at most %d filters", maxQueryFilters)
+	}
+	for _, f := range q.Filters {
+		if _, ok := queryDimensions[f.Dimension]; !ok {
+			return fmt.Errorf("unknown filter dimension %q", f.Dimension)
+		}
+		switch f.Op {
+		case "eq", "neq", "contains":
+			if len(f.Values) != 1 {
+				return fmt.Errorf("filter %q with op %s takes exactly one value", f.Dimension, f.Op)
+			}
+		case "in", "not_in":
+			if len(f.Values) == 0 || len(f.Values) > 100 {
+				return fmt.Errorf("filter %q with op %s takes 1 to 100 values", f.Dimension, f.Op)
+			}
+		default:
+			return fmt.Errorf("unknown filter op %q", f.Op)
+		}
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = defaultQueryLimit
+	}
+	if q.Limit > maxQueryLimit {
+		q.Limit = maxQueryLimit
+	}
+	return nil
+}
+
+func parseQueryTime(s string, loc *time.Location, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(dateLayout, s, loc)
+	if err != nil {
+		return t, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// queryBucket is one time bucket of the query's range.
+type queryBucket struct {
+	start, end time.Time
+}
+
+// buckets splits [start, end) at interval boundaries in the query's timezone,
+// so days, weeks and months follow local midnight across DST changes.
+func (q *Query) buckets() []queryBucket {
+	if q.Interval == "" {
+		return nil
+	}
+
+	local := q.start.In(q.loc)
+	var b time.Time
+	switch q.Interval {
+	case GranularityHour:
+		b = time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, q.loc)
+	case GranularityDay:
+		b = time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, q.loc)
+	case GranularityWeek:
+		b = time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, q.loc)
+		b = b.AddDate(0, 0, -((int(b.Weekday()) + 6) % 7))
+	case GranularityMonth:
+		b = time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, q.loc)
+	}
+
+	var out []queryBucket
+	for b.Before(q.end) {
+		var next time.Time
+		switch q.Interval {
+		case GranularityHour:
+			next = b.Add(time.Hour)
+		case GranularityDay:
+			next = b.AddDate(0, 0, 1)
+		case GranularityWeek:
+			next = b.AddDate(0, 0, 7)
+		case GranularityMonth:
+			next = b.AddDate(0, 1, 0)
+		}
+		out = append(out, queryBucket{start: b, end: next})
+		b = next
+	}
+	return out
+}
+
+// source picks the rollup table that answers the query exactly, or clicks.
+// Rollups only hold click counts up to rolledUpTo (exclusive), the end of the
+// last day the worker finished, so every source but clicks needs metric
+// clicks and an end no later than that. daily_stats and hourly_stats answer
+// by link only; dimension_stats adds one other rolled-up dimension. Day
+// rollups need whole UTC days, hourly_stats needs the range and every bucket
+// boundary on a UTC hour. Only clicks carries fraud scores, so valid-only
+// queries always read it.
+func (q *Query) source(rolledUpTo time.Time) string {
+	if q.ValidOnly {
+		return SourceClicks
+	}
+	for _, m := range q.Metrics {
+		if m != MetricClicks {
+			return SourceClicks
+		}
+	}
+	if q.end.After(rolledUpTo) {
+		return SourceClicks
+	}
+
+	// The one non-link dimension grouped or filtered on, if any
+	other := ""
+	names := append([]string{}, q.Dimensions...)
+	for _, f := range q.Filters {
+		names = append(names, f.Dimension)
+	}
+	for _, d := range names {
+		if d == "link" || d == other {
+			continue
+		}
+		if _, ok := rollupDimensionColumns[d]; !ok || other != "" {
+			return SourceClicks
+		}
+		other = d
+	}
+
+	if q.loc.String() == "UTC" && q.Interval != GranularityHour && isUTCMidnight(q.start) && isUTCMidnight(q.end) {
+		if other != "" {
+			return SourceDimensionStats
+		}
+		return SourceDailyStats
+	}
+	if other != "" || !isUTCHour(q.start) || !isUTCHour(q.end) {
+		return SourceClicks
+	}
+	for _, b := range q.buckets() {
+		if !isUTCHour(b.start) {
+			return SourceClicks
+		}
+	}
+	return SourceHourlyStats
+}
+
+func isUTCHour(t time.Time) bool {
+	return t.UTC().Equal(t.UTC().Truncate(time.Hour))
+}
+
+func isUTCMidnight(t time.Time) bool {
+	return t.UTC().Equal(t.UTC().Truncate(24 * time.Hour))
+}
+
+// builtQuery is the SQL text plus its bound arguments.
+type builtQuery struct {
+	sql  string
+	args []interface{}
+}
+
+// build translates the query into SQL. Identifiers come only from the
+// whitelists above; every caller-supplied value is a bound parameter.
+func (q *Query) build(source string) builtQuery {
+	var sb strings.Builder
+	var args []interface{}
+	buckets := q.buckets()
+
+	// dimension_stats keeps its one non-link dimension in value
+	rollupDimension := ""
+	column := func(dimension string) string {
+		switch {
+		case source == SourceClicks:
+			return "COALESCE(c." + queryDimensions[dimension] + ", '')"
+		case dimension == "link":
+			return "s.link_id"
+		default:
+			rollupDimension = dimension
+			return "s.value"
+		}
+	}
+	for _, d := range q.Dimensions {
+		column(d)
+	}
+	for _, f := range q.Filters {
+		column(f.Dimension)
+	}
+	daily := source == SourceDailyStats || source == SourceDimensionStats
+
+	if len(buckets) > 0 {
+		sb.WriteString("WITH buckets(bucket_start, range_start, range_end) AS (VALUES ")
+		for i, b := range buckets {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString("(?, ?, ?)")
+			if daily {
+				args = append(args, b.start.UnixMilli(), b.start.UTC().Format(dateLayout), b.end.UTC().Format(dateLayout))
+			} else {
+				args = append(args, b.start.UnixMilli(), b.start.UnixMilli(), b.end.UnixMilli())
+			}
+		}
+		sb.WriteString(") ")
+	}
+
+	var selects, groups []string
+	if len(buckets) > 0 {
+		selects = append(selects, "b.bucket_start")
+		groups = append(groups, "b.bucket_start")
+	}
+	for _, d := range q.Dimensions {
+		selects = append(selects, column(d))
+		groups = append(groups, column(d))
+	}
+	for _, m := range q.Metrics {
+		switch {
+		case source != SourceClicks:
+			selects = append(selects, "COALESCE(SUM(s.clicks), 0)")
+		case m == MetricClicks:
+			selects = append(selects, "COUNT(*)")
+		default:
+			selects = append(selects, "COUNT(DISTINCT COALESCE(c.visitor_id, c.ip_address))")
+		}
+	}
+
+	sb.WriteString("SELECT " + strings.Join(selects, ", "))
+	switch source {
+	case SourceDailyStats, SourceDimensionStats:
+		sb.WriteString(" FROM " + source + " s")
+		if len(buckets) > 0 {
+			sb.WriteString(" JOIN buckets b ON s.date >= b.range_start AND s.date < b.range_end")
+		}
+		sb.WriteString(" WHERE s.date >= ? AND s.date < ?")
+		args = append(args, q.start.UTC().Format(dateLayout), q.end.UTC().Format(dateLayout))
+		if source == SourceDimensionStats {
+			sb.WriteString(" AND s.dimension = ?")
+			args = append(args, rollupDimension)
+		}
+	case SourceHourlyStats:
+		sb.WriteString(" FROM hourly_stats s")
+		if len(buckets) > 0 {
+			sb.WriteString(" JOIN buckets b ON s.hour >= b.range_start AND s.hour < b.range_end")
+		}
+		sb.WriteString(" WHERE s.hour >= ? AND s.hour < ?")
+		args = append(args, q.start.UnixMilli(), q.end.UnixMilli())
+	default:
+		sb.WriteString(" FROM clicks c")
+		if len(buckets) > 0 {
+			sb.WriteString(" JOIN buckets b ON c.timestamp >= b.range_start AND c.timestamp < b.range_end")
+		}
+		sb.WriteString(" WHERE c.timestamp >= ? AND c.timestamp < ?")
+		args = append(args, q.start.UnixMilli(), q.end.UnixMilli())
+		if q.ValidOnly {
+			sb.WriteString(" AND c.fraud_score < ?")
+			args = append(args, fraud.InvalidScore)
+		}
+	}
+
+	for _, f := range q.Filters {
+		col := column(f.Dimension)
+		switch f.Op {
+		case "eq":
+			sb.WriteString(" AND " + col + " = ?")
+			args = append(args, f.Values[0])
+		case "neq":
+			sb.WriteString(" AND " + col + " != ?")
+			args = append(args, f.Values[0])
+		case "contains":
+			sb.WriteString(" AND " + col + ` LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+escapeLike(f.Values[0])+"%")
+		case "in", "not_in":
+			op := " IN ("
+			if f.Op == "not_in" {
+				op = " NOT IN ("
+			}
+			sb.WriteString(" AND " + col + op + strings.TrimSuffix(strings.Repeat("?,", len(f.Values)), ",") + ")")
+			for _, v := range f.Values {
+				args = append(args, v)
+			}
+		}
+	}
+
+	if len(groups) > 0 {
+		sb.WriteString(" GROUP BY " + strings.Join(groups, ", "))
+	}
+
+	// Buckets in time order, then the biggest groups first
+	order := []string{}
+	if len(buckets) > 0 {
+		order = append(order, "b.bucket_start")
+	}
+	order = append(order, fmt.Sprintf("%d DESC", len(selects)-len(q.Metrics)+1))
+	sb.WriteString(" ORDER BY " + strings.Join(order, ", "))
+
+	// One extra row tells us the result was truncated
+	sb.WriteString(" LIMIT ?")
+	args = append(args, q.Limit+1)
+
+	return builtQuery{sql: sb.String(), args: args}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
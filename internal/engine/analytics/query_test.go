@@ -0,0 +1,226 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestService_Query(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// 01:30 UTC on March 11 is still March 10 in New York
+	base := time.Date(2026, 3, 11, 1, 30, 0, 0, time.UTC)
+	insertClick(t, db, "c1", "l1", base, "1.1.1.1", "US")
+	insertClick(t, db, "c2", "l1", base.Add(time.Hour), "1.1.1.1", "US")
+	insertClick(t, db, "c3", "l2", base.Add(5*time.Hour), "2.2.2.2", "DE")
+	insertClick(t, db, "c4", "l2", base.Add(6*time.Hour), "3.3.3.3", "US'; DROP TABLE clicks; --")
+
+	service := NewService(NewRepository(db))
+	now := time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)
+
+	result, err := service.Query(&Query{
+		Start:      "2026-03-10",
+		End:        "2026-03-11",
+		Timezone:   "America/New_York",
+		Interval:   GranularityDay,
+		Dimensions: []string{"country"},
+		Metrics:    []string{MetricClicks, MetricUniqueVisitors},
+	}, now)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.Source != SourceClicks {
+		t.Errorf("Expected clicks source, got %s", result.Source)
+	}
+	if len(result.Rows) != 3 {
+		t.Fatalf("Expected 3 rows, got %+v", result.Rows)
+	}
+	first := result.Rows[0]
+	if first.Bucket != "2026-03-10" || first.Dimensions["country"] != "US" || first.Metrics[MetricClicks] != 2 || first.Metrics[MetricUniqueVisitors] != 1 {
+		t.Errorf("Unexpected first row: %+v", first)
+	}
+	if result.Rows[1].Bucket != "2026-03-11" {
+		t.Errorf("Expected later clicks in the March 11 bucket, got %+v", result.Rows[1])
+	}
+
+	// Filter values are bound, never interpolated
+	result, err = service.Query(&Query{
+		Start:   "2026-03-10",
+		End:     "2026-03-12",
+		Filters: []Filter{{Dimension: "country", Op: "in", Values: []string{"DE", "US'; DROP TABLE clicks; --"}}},
+	}, now)
+	if err != nil {
+		t.Fatalf("Filtered query failed: %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0].Metrics[MetricClicks] != 2 {
+		t.Errorf("Unexpected filtered totals: %+v", result.Rows)
+	}
+
+	result, err = service.Query(&Query{
+		Start:   "2026-03-10",
+		End:     "2026-03-12",
+		Filters: []Filter{{Dimension: "country", Op: "contains", Values: []string{"%"}}},
+	}, now)
+	if err != nil || result.Rows[0].Metrics[MetricClicks] != 0 {
+		t.Errorf("Expected LIKE wildcards in values to be escaped: %+v (%v)", result, err)
+	}
+}
+
+func TestService_QueryUsesRollups(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	repo.UpsertDailyStats(&DailyStat{Date: "2026-03-02", Clicks: 4}, "l1")
+	repo.UpsertDailyStats(&DailyStat{Date: "2026-03-10", Clicks: 5}, "l1")
+	repo.UpsertDailyStats(&DailyStat{Date: "2026-03-10", Clicks: 7}, "l2")
+	repo.SaveCheckpoint(JobRollups, "2026-03-19")
+
+	service := NewService(repo)
+	now := time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)
+
+	result, err := service.Query(&Query{
+		Start:      "2026-03-01",
+		End:        "2026-03-15",
+		Interval:   GranularityWeek,
+		Dimensions: []string{"link"},
+		Filters:    []Filter{{Dimension: "link", Op: "eq", Values: []string{"l1"}}},
+	}, now)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.Source != SourceDailyStats {
+		t.Errorf("Expected daily_stats source, got %s", result.Source)
+	}
+	if len(result.Rows) != 2 || result.Rows[0].Bucket != "2026-03-02" || result.Rows[1].Bucket != "2026-03-09" || result.Rows[1].Metrics[MetricClicks] != 5 {
+		t.Errorf("Unexpected rollup rows: %+v", result.Rows)
+	}
+
+	// Unique visitors are not exact in rollups, so raw clicks answer instead
+	result, err = service.Query(&Query{Start: "2026-03-01", End: "2026-03-15", Metrics: []string{MetricUniqueVisitors}}, now)
+	if err != nil || result.Source != SourceClicks {
+		t.Errorf("Expected clicks source for unique visitors: %+v (%v)", result, err)
+	}
+}
+
+func TestQuery_ValidateRejectsUnknownNames(t *testing.T) {
+	now := time.Now()
+	for _, q := range []Query{
+		{Dimensions: []string{"ip_address"}},
+		{Dimensions: []string{"country; DROP TABLE clicks"}},
+		{Metrics: []string{"revenue"}},
+		{Filters: []Filter{{Dimension: "country", Op: "like", Values: []string{"U%"}}}},
+		{Filters: []Filter{{Dimension: "country", Op: "eq"}}},
+		{Timezone: "Mars/Olympus"},
+		{Interval: GranularityHour, Start: "2026-01-01", End: "2026-03-01"},
+	} {
+		if err := q.Validate(now); err == nil {
+			t.Errorf("Expected %+v to be rejected", q)
+		}
+	}
+}
+
+func TestService_QueryUsesHourlyAndDimensionRollups(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	day := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	insertClick(t, db, "c1", "l1", day, "1.1.1.1", "US")
+	insertClick(t, db, "c2", "l1", day.Add(10*time.Minute), "1.1.1.1", "US")
+	insertClick(t, db, "c3", "l2", day.Add(5*time.Hour), "2.2.2.2", "DE")
+
+	repo := NewRepository(db)
+	service := NewService(repo)
+	now := time.Date(2026, 3, 12, 8, 0, 0, 0, time.UTC)
+	if _, err := service.RefreshRollups(now, 3, 30); err != nil {
+		t.Fatalf("RefreshRollups failed: %v", err)
+	}
+	// Rollups, not raw clicks, must answer these queries
+	db.Exec("DELETE FROM clicks")
+
+	// Whole hours in a whole-hour timezone
+	result, err := service.Query(&Query{
+		Start:    "2026-03-10T10:00:00+01:00",
+		End:      "2026-03-10T16:00:00+01:00",
+		Timezone: "Europe/Berlin",
+		Interval: GranularityHour,
+	}, now)
+	if err != nil {
+		t.Fatalf("Hourly query failed: %v", err)
+	}
+	if result.Source != SourceHourlyStats {
+		t.Errorf("Expected hourly_stats source, got %s", result.Source)
+	}
+	if len(result.Rows) != 2 || result.Rows[0].Bucket != "2026-03-10T10:00:00+01:00" || result.Rows[0].Metrics[MetricClicks] != 2 {
+		t.Errorf("Unexpected hourly rows: %+v", result.Rows)
+	}
+
+	// One rolled-up dimension over whole UTC days
+	result, err = service.Query(&Query{
+		Start:      "2026-03-10",
+		End:        "2026-03-10",
+		Dimensions: []string{"country"},
+		Filters:    []Filter{{Dimension: "link", Op: "in", Values: []string{"l1", "l2"}}},
+	}, now)
+	if err != nil {
+		t.Fatalf("Dimension query failed: %v", err)
+	}
+	if result.Source != SourceDimensionStats {
+		t.Errorf("Expected dimension_stats source, got %s", result.Source)
+	}
+	if len(result.Rows) != 2 || result.Rows[0].Dimensions["country"] != "US" || result.Rows[0].Metrics[MetricClicks] != 2 {
+		t.Errorf("Unexpected dimension rows: %+v", result.Rows)
+	}
+
+	// Two non-link dimensions are not rolled up together
+	result, err = service.Query(&Query{Start: "2026-03-10", End: "2026-03-10", Dimensions: []string{"country", "device"}}, now)
+	if err != nil || result.Source != SourceClicks {
+		t.Errorf("Expected clicks source for two dimensions: %+v (%v)", result, err)
+	}
+
+	// The overview reads past breakdowns from dimension_stats too
+	ov, err := service.GetOrgOverview(OverviewRequest{StartDate: "2026-03-10", EndDate: "2026-03-10", Granularity: GranularityHour}, now)
+	if err != nil {
+		t.Fatalf("GetOrgOverview failed: %v", err)
+	}
+	if len(ov.Countries) != 2 || ov.Countries[0].Value != "US" || ov.Countries[0].Clicks != 2 || ov.Series[9].Clicks != 2 {
+		t.Errorf("Unexpected overview from rollups: %+v", ov)
+	}
+}
+
+func TestService_ValidClicksOnly(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	day := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	insertClick(t, db, "c1", "l1", day, "1.1.1.1", "US")
+	insertClick(t, db, "c2", "l1", day.Add(time.Minute), "6.6.6.6", "US")
+	insertClick(t, db, "c3", "l1", day.Add(2*time.Minute), "6.6.6.6", "US")
+	db.Exec("UPDATE clicks SET fraud_score = 70, fraud_reasons = 'bot_user_agent,velocity' WHERE ip_address = '6.6.6.6'")
+
+	service := NewService(NewRepository(db))
+	now := time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC)
+	if _, err := service.RefreshRollups(now, 2, 30); err != nil {
+		t.Fatalf("RefreshRollups failed: %v", err)
+	}
+
+	// Rollups keep both counts, so valid-only queries read raw clicks
+	stats, _ := service.repo.GetDailyStats("l1", "2026-03-10", "2026-03-10")
+	if len(stats) != 1 || stats[0].Clicks != 3 || stats[0].ValidClicks != 1 {
+		t.Errorf("Unexpected rollup: %+v", stats)
+	}
+	result, err := service.Query(&Query{Start: "2026-03-10", End: "2026-03-10", ValidOnly: true}, now)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.Source != SourceClicks || result.Rows[0].Metrics[MetricClicks] != 1 {
+		t.Errorf("Valid-only query = %s %+v, want 1 click from clicks", result.Source, result.Rows)
+	}
+
+	all, _ := service.GetQRBreakdown("l1", day.UnixMilli(), now.UnixMilli(), false)
+	valid, _ := service.GetQRBreakdown("l1", day.UnixMilli(), now.UnixMilli(), true)
+	if all.Clicks != 3 || valid.Clicks != 1 {
+		t.Errorf("QR breakdown clicks = %d all, %d valid; want 3 and 1", all.Clicks, valid.Clicks)
+	}
+}
@@ -3,28 +3,49 @@ package analytics
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
+
+	"trackr/internal/engine/fraud"
 )
 
 type ClickStat struct {
-	Timestamp      int64  `json:"timestamp"`
-	CountryCode    string `json:"country_code"`
-	City           string `json:"city"`
-	DeviceType     string `json:"device_type"`
-	Browser        string `json:"browser"`
-	OS             string `json:"os"`
-	ReferrerDomain string `json:"referrer_domain"`
+	Timestamp      int64    `json:"timestamp"`
+	CountryCode    string   `json:"country_code"`
+	City           string   `json:"city"`
+	DeviceType     string   `json:"device_type"`
+	Browser        string   `json:"browser"`
+	OS             string   `json:"os"`
+	ReferrerDomain string   `json:"referrer_domain"`
+	FraudScore     int      `json:"fraud_score"`
+	FraudReasons   []string `json:"fraud_reasons,omitempty"`
 }
 
 type DailyStat struct {
+	LinkID      string `json:"link_id,omitempty"`
 	Date        string `json:"date"`
 	Clicks      int    `json:"clicks"`
+	ValidClicks int    `json:"valid_clicks"` // Clicks scoring below fraud.InvalidScore
 	UniqueIPs   int    `json:"unique_ips"`
 	TopCountry  string `json:"top_country"`
 	TopReferrer string `json:"top_referrer"`
 	TopDevice   string `json:"top_device"`
 }
 
+// QRVariantStat counts scans of one QR variant of a link.
+type QRVariantStat struct {
+	Variant   string `json:"variant"`
+	Scans     int    `json:"scans"`
+	UniqueIPs int    `json:"unique_ips"`
+}
+
+// QRBreakdown separates QR scans from regular clicks for a link.
+type QRBreakdown struct {
+	Clicks   int             `json:"clicks"`   // Regular, non-QR clicks
+	Scans    int             `json:"scans"`    // All QR scans
+	Variants []QRVariantStat `json:"variants"` // Scans per variant, most scanned first
+}
+
 type Repository struct {
 	db *sql.DB
 }
@@ -33,15 +54,17 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
-func (r *Repository) GetClicks(linkID string, start, end int64, limit, offset int) ([]ClickStat, error) {
+// GetClicks lists a link's clicks newest first; validOnly leaves out clicks
+// scored as fraud.
+func (r *Repository) GetClicks(linkID string, start, end int64, limit, offset int, validOnly bool) ([]ClickStat, error) {
 	query := `
-		SELECT timestamp, country_code, city, device_type, browser, os, referrer_domain
+		SELECT timestamp, country_code, city, device_type, browser, os, referrer_domain, fraud_score, fraud_reasons
 		FROM clicks
-		WHERE link_id = ? AND timestamp >= ? AND timestamp <= ?
+		WHERE link_id = ? AND timestamp >= ? AND timestamp <= ? AND (? = 0 OR fraud_score < ?)
 		ORDER BY timestamp DESC
 		LIMIT ? OFFSET ?
 	`
-	rows, err := r.db.Query(query, linkID, start, end, limit, offset)
+	rows, err := r.db.Query(query, linkID, start, end, validOnly, fraud.InvalidScore, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -50,9 +73,13 @@ func (r *Repository) GetClicks(linkID string, start, end int64, limit, offset in
 	var clicks []ClickStat
 	for rows.Next() {
 		var c ClickStat
-		if err := rows.Scan(&c.Timestamp, &c.CountryCode, &c.City, &c.DeviceType, &c.Browser, &c.OS, &c.ReferrerDomain); err != nil {
+		var reasons sql.NullString
+		if err := rows.Scan(&c.Timestamp, &c.CountryCode, &c.City, &c.DeviceType, &c.Browser, &c.OS, &c.ReferrerDomain, &c.FraudScore, &reasons); err != nil {
 			return nil, err
 		}
+		if reasons.String != "" {
+			c.FraudReasons = strings.Split(reasons.String, ",")
+		}
 		clicks = append(clicks, c)
 	}
 	return clicks, nil
@@ -60,7 +87,7 @@ func (r *Repository) GetClicks(linkID string, start, end int64, limit, offset in
 
 func (r *Repository) GetDailyStats(linkID string, startDate, endDate string) ([]DailyStat, error) {
 	query := `
-		SELECT date, clicks, unique_ips, top_country, top_referrer, top_device
+		SELECT date, clicks, COALESCE(valid_clicks, 0), unique_ips, top_country, top_referrer, top_device
 		FROM daily_stats
 		WHERE link_id = ? AND date >= ? AND date <= ?
 		ORDER BY date DESC
@@ -75,7 +102,7 @@ func (r *Repository) GetDailyStats(linkID string, startDate, endDate string) ([]
 	for rows.Next() {
 		var s DailyStat
 		var topCountry, topReferrer, topDevice sql.NullString
-		if err := rows.Scan(&s.Date, &s.Clicks, &s.UniqueIPs, &topCountry, &topReferrer, &topDevice); err != nil {
+		if err := rows.Scan(&s.Date, &s.Clicks, &s.ValidClicks, &s.UniqueIPs, &topCountry, &topReferrer, &topDevice); err != nil {
 			return nil, err
 		}
 		s.TopCountry = topCountry.String
@@ -86,37 +113,27 @@ func (r *Repository) GetDailyStats(linkID string, startDate, endDate string) ([]
 	return stats, nil
 }
 
-// Aggregation queries used by the worker (or on-demand if needed)
+// ComputeDailyStats computes one link's rollup for a UTC date on demand.
+// The worker uses ComputeDayRollups, which does every link in one pass.
 func (r *Repository) ComputeDailyStats(linkID, date string) (*DailyStat, error) {
-	startTime, _ := time.Parse("2006-01-02", date)
-	startTs := startTime.UnixMilli()
-	endTs := startTime.Add(24 * time.Hour).UnixMilli()
-
-	stat := &DailyStat{Date: date}
-
-	// Total Clicks
-	r.db.QueryRow("SELECT COUNT(*) FROM clicks WHERE link_id = ? AND timestamp >= ? AND timestamp < ?", linkID, startTs, endTs).Scan(&stat.Clicks)
-
-	// Unique IPs
-	r.db.QueryRow("SELECT COUNT(DISTINCT ip_address) FROM clicks WHERE link_id = ? AND timestamp >= ? AND timestamp < ?", linkID, startTs, endTs).Scan(&stat.UniqueIPs)
-
-	// Top Country
-	r.db.QueryRow(`
-		SELECT country_code FROM clicks
-		WHERE link_id = ? AND timestamp >= ? AND timestamp < ?
-		GROUP BY country_code ORDER BY COUNT(*) DESC LIMIT 1
-	`, linkID, startTs, endTs).Scan(&stat.TopCountry)
-
-	return stat, nil
+	stats, err := r.computeRollups(date, linkID)
+	if err != nil {
+		return nil, err
+	}
+	if len(stats) == 0 {
+		return &DailyStat{LinkID: linkID, Date: date}, nil
+	}
+	return stats[0], nil
 }
 
 func (r *Repository) UpsertDailyStats(stat *DailyStat, linkID string) error {
 	// SQLite upsert
 	query := `
-		INSERT INTO daily_stats (id, link_id, date, clicks, unique_ips, top_country, top_referrer, top_device, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO daily_stats (id, link_id, date, clicks, valid_clicks, unique_ips, top_country, top_referrer, top_device, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(link_id, date) DO UPDATE SET
 			clicks=excluded.clicks,
+			valid_clicks=excluded.valid_clicks,
 			unique_ips=excluded.unique_ips,
 			top_country=excluded.top_country,
 			top_referrer=excluded.top_referrer,
@@ -126,9 +143,250 @@ func (r *Repository) UpsertDailyStats(stat *DailyStat, linkID string) error {
 	id := fmt.Sprintf("%s_%s", linkID, stat.Date)
 
 	_, err := r.db.Exec(query,
-		id, linkID, stat.Date, stat.Clicks, stat.UniqueIPs,
+		id, linkID, stat.Date, stat.Clicks, stat.ValidClicks, stat.UniqueIPs,
 		stat.TopCountry, stat.TopReferrer, stat.TopDevice,
 		time.Now().Unix(),
 	)
 	return err
 }
+
+// GetQRBreakdown splits a link's clicks in [start, end] (unix ms) into regular
+// clicks and QR scans per variant. validOnly leaves out clicks scored as fraud.
+func (r *Repository) GetQRBreakdown(linkID string, start, end int64, validOnly bool) (*QRBreakdown, error) {
+	rows, err := r.db.Query(`
+		SELECT qr_variant, COUNT(*), COUNT(DISTINCT ip_address)
+		FROM clicks
+		WHERE link_id = ? AND timestamp >= ? AND timestamp <= ? AND (? = 0 OR fraud_score < ?)
+		GROUP BY qr_variant
+		ORDER BY COUNT(*) DESC, qr_variant
+	`, linkID, start, end, validOnly, fraud.InvalidScore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breakdown := &QRBreakdown{Variants: []QRVariantStat{}}
+	for rows.Next() {
+		var variant sql.NullString
+		var stat QRVariantStat
+		if err := rows.Scan(&variant, &stat.Scans, &stat.UniqueIPs); err != nil {
+			return nil, err
+		}
+		if !variant.Valid || variant.String == "" {
+			breakdown.Clicks += stat.Scans
+			continue
+		}
+		stat.Variant = variant.String
+		breakdown.Scans += stat.Scans
+		breakdown.Variants = append(breakdown.Variants, stat)
+	}
+	return breakdown, rows.Err()
+}
+
+type dayTotal struct {
+	Date      string
+	Clicks    int
+	UniqueIPs int
+}
+
+// DailyTotals sums daily_stats across all links for each date in [startDate, endDate].
+func (r *Repository) DailyTotals(startDate, endDate string) ([]dayTotal, error) {
+	rows, err := r.db.Query(`
+		SELECT date, SUM(clicks), SUM(unique_ips)
+		FROM daily_stats
+		WHERE date >= ? AND date <= ?
+		GROUP BY date
+		ORDER BY date
+	`, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []dayTotal
+	for rows.Next() {
+		var t dayTotal
+		if err := rows.Scan(&t.Date, &t.Clicks, &t.UniqueIPs); err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+// ClickDailyTotals counts raw clicks and distinct IPs across all links in
+// [start, end) (unix ms) per UTC date. validOnly leaves out clicks scored as fraud.
+func (r *Repository) ClickDailyTotals(start, end int64, validOnly bool) ([]dayTotal, error) {
+	rows, err := r.db.Query(`
+		SELECT strftime('%Y-%m-%d', timestamp / 1000, 'unixepoch') AS date, COUNT(*), COUNT(DISTINCT ip_address)
+		FROM clicks
+		WHERE timestamp >= ? AND timestamp < ? AND (? = 0 OR fraud_score < ?)
+		GROUP BY date
+		ORDER BY date
+	`, start, end, validOnly, fraud.InvalidScore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []dayTotal
+	for rows.Next() {
+		var t dayTotal
+		if err := rows.Scan(&t.Date, &t.Clicks, &t.UniqueIPs); err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+// HourlyTotals buckets clicks by UTC hour, keyed by the hour's start in unix
+// ms: hourly_stats in [histFrom, histTo) plus raw clicks in [clicksFrom,
+// clicksTo). Unique IPs are summed per link, as in daily_stats. validOnly
+// leaves out raw clicks scored as fraud.
+func (r *Repository) HourlyTotals(histFrom, histTo, clicksFrom, clicksTo int64, validOnly bool) (map[int64]dayTotal, error) {
+	rows, err := r.db.Query(`
+		SELECT hour, SUM(clicks), SUM(unique_ips)
+		FROM (
+			SELECT hour, clicks, unique_ips FROM hourly_stats WHERE hour >= ? AND hour < ?
+			UNION ALL
+			SELECT (timestamp / 3600000) * 3600000 AS hour, COUNT(*) AS clicks, COUNT(DISTINCT ip_address) AS unique_ips
+			FROM clicks
+			WHERE timestamp >= ? AND timestamp < ? AND (? = 0 OR fraud_score < ?)
+			GROUP BY link_id, hour
+		)
+		GROUP BY hour
+	`, histFrom, histTo, clicksFrom, clicksTo, validOnly, fraud.InvalidScore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := map[int64]dayTotal{}
+	for rows.Next() {
+		var hour int64
+		var t dayTotal
+		if err := rows.Scan(&hour, &t.Clicks, &t.UniqueIPs); err != nil {
+			return nil, err
+		}
+		totals[hour] = t
+	}
+	return totals, rows.Err()
+}
+
+// TopLinks ranks links by clicks from daily_stats in [startDate, endDate]
+// plus raw clicks in [clicksFrom, clicksTo) (unix ms). validOnly leaves out
+// raw clicks scored as fraud.
+func (r *Repository) TopLinks(startDate, endDate string, clicksFrom, clicksTo int64, limit int, validOnly bool) ([]LinkCount, error) {
+	rows, err := r.db.Query(`
+		SELECT t.link_id, COALESCE(l.short_code, ''), SUM(t.clicks) AS total
+		FROM (
+			SELECT link_id, clicks FROM daily_stats WHERE date >= ? AND date <= ?
+			UNION ALL
+			SELECT link_id, 1 FROM clicks WHERE timestamp >= ? AND timestamp < ? AND (? = 0 OR fraud_score < ?)
+		) t
+		LEFT JOIN links l ON l.id = t.link_id
+		GROUP BY t.link_id
+		ORDER BY total DESC, t.link_id
+		LIMIT ?
+	`, startDate, endDate, clicksFrom, clicksTo, validOnly, fraud.InvalidScore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	top := []LinkCount{}
+	for rows.Next() {
+		var lc LinkCount
+		if err := rows.Scan(&lc.LinkID, &lc.ShortCode, &lc.Clicks); err != nil {
+			return nil, err
+		}
+		top = append(top, lc)
+	}
+	return top, rows.Err()
+}
+
+// TopValues returns the most common values of a rollup dimension from
+// dimension_stats in [startDate, endDate] plus raw clicks in [clicksFrom,
+// clicksTo) (unix ms). validOnly leaves out raw clicks scored as fraud.
+func (r *Repository) TopValues(dimension, startDate, endDate string, clicksFrom, clicksTo int64, limit int, validOnly bool) ([]DimensionCount, error) {
+	column, ok := rollupDimensionColumns[dimension]
+	if !ok {
+		return nil, fmt.Errorf("unsupported dimension %q", dimension)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT value, SUM(clicks) AS total
+		FROM (
+			SELECT value, clicks FROM dimension_stats WHERE dimension = ? AND date >= ? AND date <= ? AND value != ''
+			UNION ALL
+			SELECT `+column+` AS value, 1 AS clicks
+			FROM clicks
+			WHERE timestamp >= ? AND timestamp < ? AND `+column+` IS NOT NULL AND `+column+` != ''
+				AND (? = 0 OR fraud_score < ?)
+		)
+		GROUP BY value
+		ORDER BY total DESC, value
+		LIMIT ?
+	`, dimension, startDate, endDate, clicksFrom, clicksTo, validOnly, fraud.InvalidScore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []DimensionCount{}
+	for rows.Next() {
+		var dc DimensionCount
+		if err := rows.Scan(&dc.Value, &dc.Clicks); err != nil {
+			return nil, err
+		}
+		values = append(values, dc)
+	}
+	return values, rows.Err()
+}
+
+// runQuery executes a built query whose columns are an optional bucket start,
+// then dimensions, then metrics.
+func (r *Repository) runQuery(q builtQuery, hasBucket bool, dimensions, metrics []string) ([]QueryRow, []int64, error) {
+	rows, err := r.db.Query(q.sql, q.args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var out []QueryRow
+	var bucketStarts []int64
+	for rows.Next() {
+		var bucket int64
+		dims := make([]string, len(dimensions))
+		vals := make([]int, len(metrics))
+
+		dest := []interface{}{}
+		if hasBucket {
+			dest = append(dest, &bucket)
+		}
+		for i := range dims {
+			dest = append(dest, &dims[i])
+		}
+		for i := range vals {
+			dest = append(dest, &vals[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+
+		row := QueryRow{Metrics: map[string]int{}}
+		if len(dimensions) > 0 {
+			row.Dimensions = map[string]string{}
+			for i, d := range dimensions {
+				row.Dimensions[d] = dims[i]
+			}
+		}
+		for i, m := range metrics {
+			row.Metrics[m] = vals[i]
+		}
+		out = append(out, row)
+		bucketStarts = append(bucketStarts, bucket)
+	}
+	return out, bucketStarts, rows.Err()
+}
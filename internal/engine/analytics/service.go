@@ -1,5 +1,11 @@
 package analytics
 
+import (
+	"time"
+
+	"trackr/internal/pkg/hll"
+)
+
 type Service struct {
 	repo *Repository
 }
@@ -8,10 +14,245 @@ func NewService(repo *Repository) *Service {
 	return &Service{repo: repo}
 }
 
-func (s *Service) GetClickHistory(linkID string, start, end int64, limit, offset int) ([]ClickStat, error) {
-	return s.repo.GetClicks(linkID, start, end, limit, offset)
+func (s *Service) GetClickHistory(linkID string, start, end int64, limit, offset int, validOnly bool) ([]ClickStat, error) {
+	return s.repo.GetClicks(linkID, start, end, limit, offset, validOnly)
 }
 
 func (s *Service) GetStatsOverview(linkID string, startDate, endDate string) ([]DailyStat, error) {
 	return s.repo.GetDailyStats(linkID, startDate, endDate)
 }
+
+func (s *Service) GetQRBreakdown(linkID string, start, end int64, validOnly bool) (*QRBreakdown, error) {
+	return s.repo.GetQRBreakdown(linkID, start, end, validOnly)
+}
+
+// GetOrgOverview builds the organization-wide overview for req as of now.
+func (s *Service) GetOrgOverview(req OverviewRequest, now time.Time) (*Overview, error) {
+	if err := req.Validate(now); err != nil {
+		return nil, err
+	}
+
+	now = now.UTC()
+	today := now.Format(dateLayout)
+	start, _ := time.Parse(dateLayout, req.StartDate)
+	end, _ := time.Parse(dateLayout, req.EndDate)
+
+	ov := &Overview{
+		StartDate:   req.StartDate,
+		EndDate:     req.EndDate,
+		Granularity: req.Granularity,
+		GeneratedAt: now.Unix(),
+	}
+
+	// Past days come from rollups, today from raw clicks
+	histEnd := req.EndDate
+	if histEnd >= today {
+		histEnd = now.AddDate(0, 0, -1).Format(dateLayout)
+	}
+	var clicksFrom, clicksTo int64
+	if req.StartDate <= today && req.EndDate >= today {
+		clicksFrom = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).UnixMilli()
+		clicksTo = now.UnixMilli() + 1
+	}
+	// Rollups carry no fraud scores, so valid-only overviews read raw clicks
+	// for the whole range
+	if req.ValidOnly {
+		histEnd = start.AddDate(0, 0, -1).Format(dateLayout)
+		clicksFrom = start.UnixMilli()
+		clicksTo = min(end.AddDate(0, 0, 1).UnixMilli(), now.UnixMilli()+1)
+	}
+
+	days := map[string]dayTotal{}
+	if req.StartDate <= histEnd {
+		totals, err := s.repo.DailyTotals(req.StartDate, histEnd)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range totals {
+			days[t.Date] = t
+		}
+	}
+	if clicksTo > clicksFrom {
+		totals, err := s.repo.ClickDailyTotals(clicksFrom, clicksTo, req.ValidOnly)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range totals {
+			days[t.Date] = t
+		}
+	}
+	for _, t := range days {
+		ov.TotalClicks += t.Clicks
+	}
+
+	// Visitor sketches per day, so uniques merge across days and links
+	sketches := map[string]*hll.Sketch{}
+	if req.StartDate <= histEnd {
+		stored, err := s.repo.StoredSketches("", req.StartDate, histEnd)
+		if err != nil {
+			return nil, err
+		}
+		sketches = stored
+	}
+	if clicksTo > clicksFrom {
+		daily, err := s.repo.ClickDailySketches(clicksFrom, clicksTo, req.ValidOnly)
+		if err != nil {
+			return nil, err
+		}
+		for date, sketch := range daily {
+			sketches[date] = sketch
+		}
+	}
+	visitors, _ := hll.New(hll.DefaultPrecision)
+	for _, sketch := range sketches {
+		if err := visitors.Merge(sketch); err != nil {
+			return nil, err
+		}
+	}
+	ov.UniqueVisitors = int(visitors.Estimate())
+
+	if req.Granularity == GranularityHour {
+		series, err := s.hourlySeries(start, end, now, clicksFrom, clicksTo, req.ValidOnly)
+		if err != nil {
+			return nil, err
+		}
+		ov.Series = series
+	} else {
+		series, err := bucketDays(days, sketches, start, end, req.Granularity)
+		if err != nil {
+			return nil, err
+		}
+		ov.Series = series
+	}
+
+	var err error
+	if ov.TopLinks, err = s.repo.TopLinks(req.StartDate, histEnd, clicksFrom, clicksTo, overviewTopN, req.ValidOnly); err != nil {
+		return nil, err
+	}
+
+	for dimension, dest := range map[string]*[]DimensionCount{
+		"country":         &ov.Countries,
+		"device":          &ov.Devices,
+		"browser":         &ov.Browsers,
+		"referrer_domain": &ov.Referrers,
+	} {
+		if *dest, err = s.repo.TopValues(dimension, req.StartDate, histEnd, clicksFrom, clicksTo, overviewTopN, req.ValidOnly); err != nil {
+			return nil, err
+		}
+	}
+
+	return ov, nil
+}
+
+// hourlySeries reads past hours from hourly_stats and today's from clicks in
+// [clicksFrom, clicksTo); valid-only series read every hour from clicks.
+func (s *Service) hourlySeries(start, end, now time.Time, clicksFrom, clicksTo int64, validOnly bool) ([]SeriesPoint, error) {
+	histTo := end.AddDate(0, 0, 1)
+	if today := now.Truncate(24 * time.Hour); histTo.After(today) {
+		histTo = today
+	}
+	if validOnly {
+		histTo = start
+	}
+	totals, err := s.repo.HourlyTotals(start.UnixMilli(), histTo.UnixMilli(), clicksFrom, clicksTo, validOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	series := []SeriesPoint{}
+	for hour := start; hour.Before(end.AddDate(0, 0, 1)) && !hour.After(now); hour = hour.Add(time.Hour) {
+		t := totals[hour.UnixMilli()]
+		series = append(series, SeriesPoint{
+			Bucket:         hour.Format("2006-01-02T15:00Z"),
+			Clicks:         t.Clicks,
+			UniqueVisitors: t.UniqueIPs,
+		})
+	}
+	return series, nil
+}
+
+// bucketDays rolls daily totals up into day, week or month buckets, including
+// empty buckets so charts have no gaps. Each bucket's uniques merge its days'
+// sketches.
+func bucketDays(days map[string]dayTotal, sketches map[string]*hll.Sketch, start, end time.Time, granularity string) ([]SeriesPoint, error) {
+	series := []SeriesPoint{}
+	visitors := []*hll.Sketch{}
+	index := map[string]int{}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		bucket := bucketStart(day, granularity)
+		i, ok := index[bucket]
+		if !ok {
+			i = len(series)
+			index[bucket] = i
+			series = append(series, SeriesPoint{Bucket: bucket})
+			sketch, _ := hll.New(hll.DefaultPrecision)
+			visitors = append(visitors, sketch)
+		}
+		date := day.Format(dateLayout)
+		series[i].Clicks += days[date].Clicks
+		if sketch, ok := sketches[date]; ok {
+			if err := visitors[i].Merge(sketch); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i := range series {
+		series[i].UniqueVisitors = int(visitors[i].Estimate())
+	}
+	return series, nil
+}
+
+// Query answers an ad-hoc analytics query from the cheapest source that can
+// answer it exactly: daily_stats, hourly_stats, dimension_stats or raw clicks.
+func (s *Service) Query(q *Query, now time.Time) (*QueryResult, error) {
+	if err := q.Validate(now); err != nil {
+		return nil, err
+	}
+
+	// Rollups cover every day up to the aggregation checkpoint
+	var rolledUpTo time.Time
+	checkpoint, err := s.repo.GetCheckpoint(JobRollups)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint != "" {
+		last, err := time.Parse(dateLayout, checkpoint)
+		if err != nil {
+			return nil, err
+		}
+		rolledUpTo = last.AddDate(0, 0, 1)
+		if today := now.UTC().Truncate(24 * time.Hour); rolledUpTo.After(today) {
+			rolledUpTo = today
+		}
+	}
+	source := q.source(rolledUpTo)
+	rows, bucketStarts, err := s.repo.runQuery(q.build(source), q.Interval != "", q.Dimensions, q.Metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{
+		Source:   source,
+		Start:    q.start.In(q.loc).Format(time.RFC3339),
+		End:      q.end.In(q.loc).Format(time.RFC3339),
+		Timezone: q.Timezone,
+		Interval: q.Interval,
+		Rows:     []QueryRow{},
+	}
+	if len(rows) > q.Limit {
+		rows = rows[:q.Limit]
+		result.Truncated = true
+	}
+	for i := range rows {
+		if q.Interval != "" {
+			start := time.UnixMilli(bucketStarts[i]).In(q.loc)
+			if q.Interval == GranularityHour {
+				rows[i].Bucket = start.Format(time.RFC3339)
+			} else {
+				rows[i].Bucket = start.Format(dateLayout)
+			}
+		}
+		result.Rows = append(result.Rows, rows[i])
+	}
+	return result, nil
+}
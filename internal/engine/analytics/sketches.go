@@ -0,0 +1,186 @@
+package analytics
+
+import (
+	"math"
+	"time"
+
+	"trackr/internal/engine/fraud"
+	"trackr/internal/pkg/hll"
+)
+
+// UniqueVisitors is an approximate distinct-visitor count over a date range,
+// merged from per-day HyperLogLog sketches so repeat visitors count once.
+type UniqueVisitors struct {
+	LinkID        string  `json:"link_id,omitempty"`
+	StartDate     string  `json:"start_date"`
+	EndDate       string  `json:"end_date"`
+	Visitors      uint64  `json:"unique_visitors"`
+	StandardError float64 `json:"standard_error"` // Relative, e.g. 0.016 for ±1.6%
+}
+
+// UniqueVisitors counts distinct visitors of linkID, or of the whole
+// organization when linkID is empty, between two inclusive UTC dates. Past
+// days come from stored sketches and today from raw clicks.
+func (s *Service) UniqueVisitors(linkID, startDate, endDate string, now time.Time) (*UniqueVisitors, error) {
+	req := OverviewRequest{StartDate: startDate, EndDate: endDate, Granularity: GranularityDay}
+	if err := req.Validate(now); err != nil {
+		return nil, err
+	}
+
+	now = now.UTC()
+	today := now.Format(dateLayout)
+	histEnd := req.EndDate
+	if histEnd >= today {
+		histEnd = now.AddDate(0, 0, -1).Format(dateLayout)
+	}
+
+	sketch, _ := hll.New(hll.DefaultPrecision)
+	if req.StartDate <= histEnd {
+		days, err := s.repo.StoredSketches(linkID, req.StartDate, histEnd)
+		if err != nil {
+			return nil, err
+		}
+		for _, day := range days {
+			if err := sketch.Merge(day); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if req.StartDate <= today && req.EndDate >= today {
+		todaySketch, err := s.todaySketch(linkID, now)
+		if err != nil {
+			return nil, err
+		}
+		if err := sketch.Merge(todaySketch); err != nil {
+			return nil, err
+		}
+	}
+
+	return &UniqueVisitors{
+		LinkID:        linkID,
+		StartDate:     req.StartDate,
+		EndDate:       req.EndDate,
+		Visitors:      sketch.Estimate(),
+		StandardError: standardError(sketch),
+	}, nil
+}
+
+// todaySketch builds a sketch of today's visitors (UTC) from raw clicks.
+func (s *Service) todaySketch(linkID string, now time.Time) (*hll.Sketch, error) {
+	from := now.Truncate(24 * time.Hour).UnixMilli()
+	links, org, err := s.repo.ClickSketches(linkID, from, now.UnixMilli()+1)
+	if err != nil {
+		return nil, err
+	}
+	if linkID == "" {
+		return org, nil
+	}
+	if sketch, ok := links[linkID]; ok {
+		return sketch, nil
+	}
+	return hll.New(hll.DefaultPrecision)
+}
+
+func standardError(s *hll.Sketch) float64 {
+	return math.Round(1.04/math.Sqrt(float64(uint64(1)<<s.Precision()))*1000) / 1000
+}
+
+// ClickSketches builds visitor sketches from raw clicks in [start, end) (unix
+// ms): one per link, plus one for all of them. Clicks logged before visitor
+// IDs existed fall back to their IP. linkID limits the scan to one link.
+func (r *Repository) ClickSketches(linkID string, start, end int64) (map[string]*hll.Sketch, *hll.Sketch, error) {
+	rows, err := r.db.Query(`
+		SELECT link_id, COALESCE(visitor_id, ip_address, '')
+		FROM clicks
+		WHERE timestamp >= ? AND timestamp < ? AND (? = '' OR link_id = ?)
+	`, start, end, linkID, linkID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	org, _ := hll.New(hll.DefaultPrecision)
+	links := map[string]*hll.Sketch{}
+	for rows.Next() {
+		var link, visitor string
+		if err := rows.Scan(&link, &visitor); err != nil {
+			return nil, nil, err
+		}
+		if visitor == "" {
+			continue
+		}
+		sketch, ok := links[link]
+		if !ok {
+			sketch, _ = hll.New(hll.DefaultPrecision)
+			links[link] = sketch
+		}
+		sketch.Insert([]byte(visitor))
+		org.Insert([]byte(visitor))
+	}
+	return links, org, rows.Err()
+}
+
+// ClickDailySketches builds the organization's visitor sketch for each UTC
+// date from raw clicks in [start, end) (unix ms), falling back to the IP like
+// ClickSketches. validOnly leaves out clicks scored as fraud.
+func (r *Repository) ClickDailySketches(start, end int64, validOnly bool) (map[string]*hll.Sketch, error) {
+	rows, err := r.db.Query(`
+		SELECT strftime('%Y-%m-%d', timestamp / 1000, 'unixepoch'), COALESCE(visitor_id, ip_address, '')
+		FROM clicks
+		WHERE timestamp >= ? AND timestamp < ? AND (? = 0 OR fraud_score < ?)
+	`, start, end, validOnly, fraud.InvalidScore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := map[string]*hll.Sketch{}
+	for rows.Next() {
+		var date, visitor string
+		if err := rows.Scan(&date, &visitor); err != nil {
+			return nil, err
+		}
+		if visitor == "" {
+			continue
+		}
+		sketch, ok := days[date]
+		if !ok {
+			sketch, _ = hll.New(hll.DefaultPrecision)
+			days[date] = sketch
+		}
+		sketch.Insert([]byte(visitor))
+	}
+	return days, rows.Err()
+}
+
+// StoredSketches returns the stored daily sketches of linkID, or of the
+// organization when linkID is empty, keyed by date in [startDate, endDate].
+func (r *Repository) StoredSketches(linkID, startDate, endDate string) (map[string]*hll.Sketch, error) {
+	query := "SELECT date, sketch FROM org_daily_sketches WHERE date >= ? AND date <= ?"
+	args := []interface{}{startDate, endDate}
+	if linkID != "" {
+		query = "SELECT date, sketch FROM daily_sketches WHERE link_id = ? AND date >= ? AND date <= ?"
+		args = append([]interface{}{linkID}, args...)
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sketches := map[string]*hll.Sketch{}
+	for rows.Next() {
+		var date string
+		var data []byte
+		if err := rows.Scan(&date, &data); err != nil {
+			return nil, err
+		}
+		sketch := &hll.Sketch{}
+		if err := sketch.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		sketches[date] = sketch
+	}
+	return sketches, rows.Err()
+}
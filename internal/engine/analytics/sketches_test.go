@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestService_UniqueVisitorsMergesDays(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	fp := NewFingerprinter("secret")
+	day1 := time.Date(2026, 3, 9, 10, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 3, 11, 8, 0, 0, 0, time.UTC)
+	clicks := []struct {
+		linkID string
+		ts     time.Time
+		ip     string
+	}{
+		{"l1", day1, "1.1.1.1"},
+		{"l1", day1.AddDate(0, 0, 1), "1.1.1.1"}, // Same visitor the next day
+		{"l1", day1.AddDate(0, 0, 1), "2.2.2.2"},
+		{"l2", day1, "1.1.1.1"}, // Same visitor on another link
+		{"l1", now.Add(-time.Hour), "3.3.3.3"},
+	}
+	for i, c := range clicks {
+		_, err := db.Exec(`
+			INSERT INTO clicks (id, link_id, short_code, timestamp, ip_address, visitor_id, destination_url)
+			VALUES (?, ?, '', ?, ?, ?, 'https://example.com')
+		`, i, c.linkID, c.ts.UnixMilli(), c.ip, fp.VisitorID("org_1", c.ip, "Mozilla/5.0"))
+		if err != nil {
+			t.Fatalf("Failed to insert click: %v", err)
+		}
+	}
+	// A click from before visitor IDs existed counts by IP
+	insertClick(t, db, "legacy", "l2", day1, "4.4.4.4", "US")
+
+	service := NewService(NewRepository(db))
+	if _, err := service.RefreshRollups(now, 3, 30); err != nil {
+		t.Fatalf("RefreshRollups failed: %v", err)
+	}
+
+	uniques, err := service.UniqueVisitors("l1", "2026-03-09", "2026-03-11", now)
+	if err != nil {
+		t.Fatalf("UniqueVisitors failed: %v", err)
+	}
+	if uniques.Visitors != 3 || uniques.StandardError != 0.016 {
+		t.Errorf("Unexpected l1 uniques: %+v", uniques)
+	}
+
+	org, err := service.UniqueVisitors("", "2026-03-09", "2026-03-10", now)
+	if err != nil {
+		t.Fatalf("Org UniqueVisitors failed: %v", err)
+	}
+	if org.Visitors != 3 {
+		t.Errorf("Expected 3 org visitors over past days, got %+v", org)
+	}
+}
+
+func TestFingerprinter_VisitorID(t *testing.T) {
+	a := NewFingerprinter("secret")
+	id := a.VisitorID("org_1", "1.1.1.1", "Mozilla/5.0")
+	if len(id) != 32 || id != a.VisitorID("org_1", "1.1.1.1", "Mozilla/5.0") {
+		t.Errorf("Expected a stable 32-char ID, got %q", id)
+	}
+	if id == a.VisitorID("org_2", "1.1.1.1", "Mozilla/5.0") {
+		t.Error("Visitor IDs must differ across organizations")
+	}
+	if id == NewFingerprinter("other").VisitorID("org_1", "1.1.1.1", "Mozilla/5.0") {
+		t.Error("Visitor IDs must depend on the secret")
+	}
+}
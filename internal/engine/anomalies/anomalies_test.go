@@ -0,0 +1,230 @@
+package anomalies
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const browserUA = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 Version/17.0 Safari/605.1.15"
+
+func setupTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE links (
+		id TEXT PRIMARY KEY,
+		short_code TEXT UNIQUE NOT NULL,
+		status TEXT DEFAULT 'active',
+		created_at INTEGER NOT NULL
+	);
+	CREATE TABLE clicks (
+		id TEXT PRIMARY KEY,
+		link_id TEXT NOT NULL,
+		timestamp INTEGER NOT NULL,
+		ip_address TEXT,
+		user_agent TEXT
+	);
+	CREATE TABLE hourly_stats (
+		link_id TEXT NOT NULL,
+		hour INTEGER NOT NULL,
+		clicks INTEGER NOT NULL DEFAULT 0,
+		unique_ips INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (link_id, hour)
+	);
+	CREATE TABLE anomaly_settings (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		enabled INTEGER NOT NULL DEFAULT 1,
+		spike_ratio REAL NOT NULL,
+		drop_ratio REAL NOT NULL,
+		min_clicks INTEGER NOT NULL,
+		ip_burst_share REAL NOT NULL,
+		bot_share REAL NOT NULL,
+		cooldown_minutes INTEGER NOT NULL,
+		recipients TEXT NOT NULL,
+		updated_by TEXT,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE TABLE anomaly_alerts (
+		id TEXT PRIMARY KEY,
+		link_id TEXT NOT NULL,
+		short_code TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		window_start INTEGER NOT NULL,
+		window_end INTEGER NOT NULL,
+		clicks INTEGER NOT NULL,
+		baseline REAL NOT NULL,
+		value REAL NOT NULL,
+		threshold REAL NOT NULL,
+		detail TEXT,
+		created_at INTEGER NOT NULL
+	);
+	CREATE UNIQUE INDEX idx_anomaly_alerts_window ON anomaly_alerts(link_id, kind, window_start);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+	return db
+}
+
+func insertLink(t *testing.T, db *sql.DB, id, code string, createdAt time.Time) {
+	if _, err := db.Exec("INSERT INTO links (id, short_code, created_at) VALUES (?, ?, ?)", id, code, createdAt.Unix()); err != nil {
+		t.Fatalf("Failed to insert link: %v", err)
+	}
+}
+
+// insertBaseline gives linkID perHour clicks in every hour of [from, to).
+func insertBaseline(t *testing.T, db *sql.DB, linkID string, from, to time.Time, perHour int) {
+	for h := from; h.Before(to); h = h.Add(time.Hour) {
+		if _, err := db.Exec("INSERT INTO hourly_stats (link_id, hour, clicks) VALUES (?, ?, ?)", linkID, h.UnixMilli(), perHour); err != nil {
+			t.Fatalf("Failed to insert rollup: %v", err)
+		}
+	}
+}
+
+func insertClicks(t *testing.T, db *sql.DB, linkID string, at time.Time, n int, ip func(i int) string, ua string) {
+	for i := 0; i < n; i++ {
+		_, err := db.Exec("INSERT INTO clicks (id, link_id, timestamp, ip_address, user_agent) VALUES (?, ?, ?, ?, ?)",
+			fmt.Sprintf("%s-%d-%d", linkID, at.UnixMilli(), i), linkID, at.UnixMilli()+int64(i), ip(i), ua)
+		if err != nil {
+			t.Fatalf("Failed to insert click: %v", err)
+		}
+	}
+}
+
+func TestSettings_Detect(t *testing.T) {
+	s := DefaultSettings()
+
+	tests := []struct {
+		name  string
+		w     LinkWindow
+		kinds []string
+	}{
+		{"quiet", LinkWindow{Clicks: 12, Baseline: 10, BaselineHours: 168, TopIPClicks: 2}, nil},
+		{"spike", LinkWindow{Clicks: 60, Baseline: 10, BaselineHours: 168, TopIPClicks: 2}, []string{KindSpike}},
+		{"spike on a quiet link", LinkWindow{Clicks: 50, Baseline: 0.2, BaselineHours: 168, TopIPClicks: 1}, []string{KindSpike}},
+		{"too new to judge", LinkWindow{Clicks: 60, Baseline: 1, BaselineHours: 6, TopIPClicks: 1}, nil},
+		{"drop", LinkWindow{Clicks: 5, Baseline: 80, BaselineHours: 168}, []string{KindDrop}},
+		{"small links never drop", LinkWindow{Clicks: 0, Baseline: 20, BaselineHours: 168}, nil},
+		{"ip burst and bots", LinkWindow{Clicks: 50, Baseline: 40, BaselineHours: 168, TopIP: "6.6.6.6", TopIPClicks: 30, BotClicks: 40}, []string{KindIPBurst, KindBotTraffic}},
+		{"too few clicks for shares", LinkWindow{Clicks: 10, Baseline: 10, BaselineHours: 168, TopIPClicks: 10, BotClicks: 10}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var kinds []string
+			for _, a := range s.Detect(tt.w) {
+				kinds = append(kinds, a.Kind)
+			}
+			if strings.Join(kinds, ",") != strings.Join(tt.kinds, ",") {
+				t.Errorf("Detect = %v, want %v", kinds, tt.kinds)
+			}
+		})
+	}
+}
+
+func TestService_Run(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// 14:20, so the 13:00-14:00 hour is checked against Mar 3-9
+	now := time.Date(2026, 3, 11, 14, 20, 0, 0, time.UTC)
+	hourStart := time.Date(2026, 3, 11, 13, 0, 0, 0, time.UTC)
+	baselineEnd := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	longAgo := now.AddDate(0, -3, 0)
+
+	insertLink(t, db, "l1", "promo", longAgo)
+	insertLink(t, db, "l2", "docs", longAgo)
+	insertLink(t, db, "l3", "launch", now.Add(-3*time.Hour))
+	insertBaseline(t, db, "l1", baselineEnd.AddDate(0, 0, -BaselineDays), baselineEnd, 10)
+	insertBaseline(t, db, "l2", baselineEnd.AddDate(0, 0, -BaselineDays), baselineEnd, 100)
+
+	// A click-fraud bot hammers l1 from one address, across many connections
+	// (older clicks kept the client port) and rotating user agents
+	insertClicks(t, db, "l1", hourStart.Add(5*time.Minute), 40, func(i int) string { return fmt.Sprintf("6.6.6.6:%d", 40000+i) }, "python-requests/2.31")
+	insertClicks(t, db, "l1", hourStart.Add(7*time.Minute), 30, func(int) string { return "6.6.6.6" }, "curl/8.4.0")
+	insertClicks(t, db, "l1", hourStart.Add(10*time.Minute), 10, func(i int) string { return fmt.Sprintf("1.1.1.%d", i) }, browserUA)
+	// l2 goes nearly silent
+	insertClicks(t, db, "l2", hourStart.Add(time.Minute), 5, func(i int) string { return fmt.Sprintf("2.2.2.%d", i) }, browserUA)
+	// l3 is new and popular, which is not an anomaly. Half its clicks came
+	// through a reverse proxy before it was trusted, stored as the proxy's address
+	insertClicks(t, db, "l3", hourStart.Add(time.Minute), 30, func(i int) string { return fmt.Sprintf("3.3.3.%d", i) }, browserUA)
+	insertClicks(t, db, "l3", hourStart.Add(2*time.Minute), 30, func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 50000+i) }, browserUA)
+	// Clicks in the current hour wait for the next run
+	insertClicks(t, db, "l2", now.Add(-time.Minute), 100, func(i int) string { return fmt.Sprintf("4.4.4.%d", i) }, browserUA)
+
+	service := NewService(NewRepository(db))
+	alerts, _, err := service.Run(now)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	var got []string
+	for _, a := range alerts {
+		got = append(got, a.ShortCode+":"+a.Kind)
+		if a.WindowStart != hourStart.UnixMilli() || a.WindowEnd != hourStart.Add(time.Hour).UnixMilli() {
+			t.Errorf("%s window = %d-%d, want the 13:00 hour", a.Kind, a.WindowStart, a.WindowEnd)
+		}
+	}
+	want := "docs:drop,promo:bot_traffic,promo:ip_burst,promo:spike"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("Alerts = %v, want %s", got, want)
+	}
+	for _, a := range alerts {
+		if a.Kind == KindIPBurst && (a.Detail != "6.6.6.6" || a.Value != 70.0/80.0) {
+			t.Errorf("IP burst = %s at %v, want 6.6.6.6 at 0.875", a.Detail, a.Value)
+		}
+		if a.Kind == KindSpike && (a.Baseline != 10 || a.Value != 8) {
+			t.Errorf("Spike = %vx over %v, want 8x over 10", a.Value, a.Baseline)
+		}
+	}
+
+	// The next hour the bot is still at it, but the cooldown holds alerts back
+	insertClicks(t, db, "l1", hourStart.Add(75*time.Minute), 70, func(int) string { return "6.6.6.6" }, "python-requests/2.31")
+	alerts, _, err = service.Run(now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	for _, a := range alerts {
+		if a.LinkID == "l1" {
+			t.Errorf("Alert %s on l1 during its cooldown", a.Kind)
+		}
+	}
+
+	listed, err := NewRepository(db).ListAlerts("l1", 10)
+	if err != nil || len(listed) != 3 {
+		t.Errorf("ListAlerts = %d alerts, %v; want 3", len(listed), err)
+	}
+
+	msg := Message(listed, []string{"ops@example.com"}, "Acme", "https://app.trackr.io")
+	if msg.Subject != "[Acme] Unusual traffic: 3 alerts" || !strings.Contains(msg.Text, "88% of 80 clicks came from 6.6.6.6") {
+		t.Errorf("Message = %q\n%s", msg.Subject, msg.Text)
+	}
+}
+
+func TestService_RunDisabled(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	settings := DefaultSettings()
+	settings.Enabled = false
+	if err := repo.SaveSettings(settings); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+
+	now := time.Date(2026, 3, 11, 14, 20, 0, 0, time.UTC)
+	insertLink(t, db, "l1", "promo", now.AddDate(0, -1, 0))
+	insertClicks(t, db, "l1", now.Add(-time.Hour), 100, func(int) string { return "6.6.6.6" }, "")
+
+	alerts, _, err := NewService(repo).Run(now)
+	if err != nil || len(alerts) != 0 {
+		t.Errorf("Run = %d alerts, %v; want none while disabled", len(alerts), err)
+	}
+}
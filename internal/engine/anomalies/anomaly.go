@@ -0,0 +1,172 @@
+package anomalies
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"time"
+)
+
+const (
+	KindSpike      = "spike"       // Far more clicks than the baseline rate
+	KindDrop       = "drop"        // Far fewer clicks than the baseline rate
+	KindIPBurst    = "ip_burst"    // Most clicks from a single IP
+	KindBotTraffic = "bot_traffic" // Most clicks from bots
+
+	// Window is the span of traffic checked against the baseline.
+	Window = time.Hour
+	// BaselineDays of hourly rollups make up a link's baseline rate.
+	BaselineDays = 7
+	// minBaselineHours of history are needed before spikes and drops are judged.
+	minBaselineHours = 24
+
+	maxRecipients = 20
+)
+
+// Settings are an organization's alert thresholds. A ratio or share of 0
+// turns that check off.
+type Settings struct {
+	Enabled         bool     `json:"enabled"`
+	SpikeRatio      float64  `json:"spike_ratio"`      // Alert when an hour has this many times the baseline rate
+	DropRatio       float64  `json:"drop_ratio"`       // Alert when an hour falls to this fraction of the baseline rate
+	MinClicks       int      `json:"min_clicks"`       // Hours (and, for drops, baselines) below this are not judged
+	IPBurstShare    float64  `json:"ip_burst_share"`   // Alert when one IP makes this share of an hour's clicks
+	BotShare        float64  `json:"bot_share"`        // Alert when bots make this share of an hour's clicks
+	CooldownMinutes int      `json:"cooldown_minutes"` // No repeat alert for the same link and kind within this
+	Recipients      []string `json:"recipients"`       // Emailed on each run that finds anomalies; webhooks get link.anomaly regardless
+	UpdatedBy       string   `json:"updated_by,omitempty"`
+	UpdatedAt       int64    `json:"updated_at,omitempty"`
+}
+
+// DefaultSettings catch bot floods and viral spikes without alerting on the
+// noise of small links.
+func DefaultSettings() *Settings {
+	return &Settings{
+		Enabled:         true,
+		SpikeRatio:      5,
+		DropRatio:       0.1,
+		MinClicks:       50,
+		IPBurstShare:    0.5,
+		BotShare:        0.5,
+		CooldownMinutes: 360,
+		Recipients:      []string{},
+	}
+}
+
+func (s *Settings) Validate() error {
+	if s.SpikeRatio != 0 && s.SpikeRatio < 1.5 {
+		return errors.New("spike_ratio must be 0 (off) or at least 1.5")
+	}
+	if s.DropRatio < 0 || s.DropRatio >= 1 {
+		return errors.New("drop_ratio must be between 0 (off) and 1")
+	}
+	if s.IPBurstShare < 0 || s.IPBurstShare > 1 || s.BotShare < 0 || s.BotShare > 1 {
+		return errors.New("ip_burst_share and bot_share must be between 0 (off) and 1")
+	}
+	if s.MinClicks < 1 {
+		return errors.New("min_clicks must be at least 1")
+	}
+	// Shorter cooldowns would alert twice for the same hour
+	if s.CooldownMinutes < int(Window/time.Minute) {
+		return fmt.Errorf("cooldown_minutes must be at least %d", int(Window/time.Minute))
+	}
+
+	if s.Recipients == nil {
+		s.Recipients = []string{}
+	}
+	if len(s.Recipients) > maxRecipients {
+		return fmt.Errorf("at most %d recipients", maxRecipients)
+	}
+	for i, r := range s.Recipients {
+		addr, err := mail.ParseAddress(r)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q", r)
+		}
+		s.Recipients[i] = addr.Address
+	}
+	return nil
+}
+
+// Alert is one anomaly in a link's traffic during [WindowStart, WindowEnd).
+type Alert struct {
+	ID          string  `json:"id"`
+	LinkID      string  `json:"link_id"`
+	ShortCode   string  `json:"short_code"`
+	Kind        string  `json:"kind"`
+	WindowStart int64   `json:"window_start"` // Unix ms
+	WindowEnd   int64   `json:"window_end"`
+	Clicks      int     `json:"clicks"`
+	Baseline    float64 `json:"baseline"`  // Clicks per hour over the last BaselineDays
+	Value       float64 `json:"value"`     // Ratio to baseline, or share of clicks
+	Threshold   float64 `json:"threshold"` // The setting Value crossed
+	Detail      string  `json:"detail,omitempty"`
+	CreatedAt   int64   `json:"created_at"`
+}
+
+// LinkWindow is a link's traffic in one window next to its baseline.
+type LinkWindow struct {
+	LinkID        string
+	ShortCode     string
+	Clicks        int
+	Baseline      float64 // Clicks per hour
+	BaselineHours int     // Hours of history behind Baseline
+	TopIP         string
+	TopIPClicks   int
+	BotClicks     int
+}
+
+// Detect returns the anomalies in w under s, without IDs or times.
+func (s *Settings) Detect(w LinkWindow) []*Alert {
+	var alerts []*Alert
+	add := func(kind string, value, threshold float64, detail string) {
+		alerts = append(alerts, &Alert{
+			LinkID:    w.LinkID,
+			ShortCode: w.ShortCode,
+			Kind:      kind,
+			Clicks:    w.Clicks,
+			Baseline:  w.Baseline,
+			Value:     value,
+			Threshold: threshold,
+			Detail:    detail,
+		})
+	}
+
+	if w.BaselineHours >= minBaselineHours {
+		// Links that usually see under a click an hour spike against one
+		expected := w.Baseline
+		if expected < 1 {
+			expected = 1
+		}
+		if s.SpikeRatio > 0 && w.Clicks >= s.MinClicks && float64(w.Clicks) >= s.SpikeRatio*expected {
+			add(KindSpike, float64(w.Clicks)/expected, s.SpikeRatio, "")
+		}
+		if s.DropRatio > 0 && w.Baseline >= float64(s.MinClicks) && float64(w.Clicks) <= s.DropRatio*w.Baseline {
+			add(KindDrop, float64(w.Clicks)/w.Baseline, s.DropRatio, "")
+		}
+	}
+
+	if w.Clicks >= s.MinClicks {
+		if share := float64(w.TopIPClicks) / float64(w.Clicks); s.IPBurstShare > 0 && share >= s.IPBurstShare {
+			add(KindIPBurst, share, s.IPBurstShare, w.TopIP)
+		}
+		if share := float64(w.BotClicks) / float64(w.Clicks); s.BotShare > 0 && share >= s.BotShare {
+			add(KindBotTraffic, share, s.BotShare, "")
+		}
+	}
+	return alerts
+}
+
+// Describe explains a in one line for emails and logs.
+func (a *Alert) Describe() string {
+	switch a.Kind {
+	case KindSpike:
+		return fmt.Sprintf("/%s: %d clicks in an hour, %.1fx its usual %.1f/hour", a.ShortCode, a.Clicks, a.Value, a.Baseline)
+	case KindDrop:
+		return fmt.Sprintf("/%s: %d clicks in an hour, down from its usual %.1f/hour", a.ShortCode, a.Clicks, a.Baseline)
+	case KindIPBurst:
+		return fmt.Sprintf("/%s: %.0f%% of %d clicks came from %s", a.ShortCode, a.Value*100, a.Clicks, a.Detail)
+	case KindBotTraffic:
+		return fmt.Sprintf("/%s: %.0f%% of %d clicks came from bots", a.ShortCode, a.Value*100, a.Clicks)
+	}
+	return fmt.Sprintf("/%s: %s", a.ShortCode, a.Kind)
+}
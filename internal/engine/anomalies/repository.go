@@ -0,0 +1,272 @@
+package anomalies
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net"
+	"time"
+
+	"trackr/internal/pkg/netguard"
+	"trackr/internal/pkg/parser"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) GetSettings() (*Settings, error) {
+	var s Settings
+	var recipientsRaw []byte
+	var updatedBy sql.NullString
+
+	err := r.db.QueryRow(`
+		SELECT enabled, spike_ratio, drop_ratio, min_clicks, ip_burst_share, bot_share, cooldown_minutes, recipients, updated_by, updated_at
+		FROM anomaly_settings WHERE id = 1
+	`).Scan(&s.Enabled, &s.SpikeRatio, &s.DropRatio, &s.MinClicks, &s.IPBurstShare, &s.BotShare, &s.CooldownMinutes, &recipientsRaw, &updatedBy, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return DefaultSettings(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.UpdatedBy = updatedBy.String
+	s.Recipients = []string{}
+	if len(recipientsRaw) > 0 {
+		json.Unmarshal(recipientsRaw, &s.Recipients)
+	}
+	return &s, nil
+}
+
+func (r *Repository) SaveSettings(s *Settings) error {
+	s.UpdatedAt = time.Now().Unix()
+
+	recipients, err := json.Marshal(s.Recipients)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO anomaly_settings (id, enabled, spike_ratio, drop_ratio, min_clicks, ip_burst_share, bot_share, cooldown_minutes, recipients, updated_by, updated_at)
+		VALUES (1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			enabled = excluded.enabled,
+			spike_ratio = excluded.spike_ratio,
+			drop_ratio = excluded.drop_ratio,
+			min_clicks = excluded.min_clicks,
+			ip_burst_share = excluded.ip_burst_share,
+			bot_share = excluded.bot_share,
+			cooldown_minutes = excluded.cooldown_minutes,
+			recipients = excluded.recipients,
+			updated_by = excluded.updated_by,
+			updated_at = excluded.updated_at
+	`, s.Enabled, s.SpikeRatio, s.DropRatio, s.MinClicks, s.IPBurstShare, s.BotShare, s.CooldownMinutes, string(recipients), s.UpdatedBy, s.UpdatedAt)
+	return err
+}
+
+// Windows collects every active link's traffic in [start, end) (Unix ms) from
+// raw clicks, next to its rate in hourly rollups over [baselineStart,
+// baselineEnd). Links with no clicks in either are left out.
+func (r *Repository) Windows(start, end, baselineStart, baselineEnd int64) ([]LinkWindow, error) {
+	windows := map[string]*LinkWindow{}
+
+	// Baseline; links created during it are averaged over their lifetime only
+	rows, err := r.db.Query(`
+		SELECT h.link_id, l.short_code, l.created_at, SUM(h.clicks)
+		FROM hourly_stats h
+		JOIN links l ON l.id = h.link_id
+		WHERE l.status = 'active' AND h.hour >= ? AND h.hour < ?
+		GROUP BY h.link_id
+	`, baselineStart, baselineEnd)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var w LinkWindow
+		var createdAt int64
+		var total int
+		if err := rows.Scan(&w.LinkID, &w.ShortCode, &createdAt, &total); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		from := baselineStart
+		if created := createdAt * 1000; created > from {
+			from = created
+		}
+		w.BaselineHours = int((baselineEnd - from) / int64(time.Hour/time.Millisecond))
+		if w.BaselineHours > 0 {
+			w.Baseline = float64(total) / float64(w.BaselineHours)
+		}
+		windows[w.LinkID] = &w
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The window itself, grouped by IP so bursts from one address show
+	rows, err = r.db.Query(`
+		SELECT c.link_id, l.short_code, l.created_at, COALESCE(c.ip_address, ''), COUNT(*)
+		FROM clicks c
+		JOIN links l ON l.id = c.link_id
+		WHERE l.status = 'active' AND c.timestamp >= ? AND c.timestamp < ?
+		GROUP BY c.link_id, c.ip_address
+	`, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ipClicks := map[string]map[string]int{}
+	for rows.Next() {
+		var linkID, shortCode, ip string
+		var createdAt int64
+		var n int
+		if err := rows.Scan(&linkID, &shortCode, &createdAt, &ip, &n); err != nil {
+			return nil, err
+		}
+		w, ok := windows[linkID]
+		if !ok {
+			// No rollups yet; new links only have the history they have lived
+			w = &LinkWindow{LinkID: linkID, ShortCode: shortCode}
+			if created := createdAt * 1000; created < baselineEnd {
+				w.BaselineHours = int((baselineEnd - max(created, baselineStart)) / int64(time.Hour/time.Millisecond))
+			}
+			windows[linkID] = w
+		}
+		w.Clicks += n
+		if ipClicks[linkID] == nil {
+			ipClicks[linkID] = map[string]int{}
+		}
+		// Older clicks were stored with the client port; one address is one source
+		ipClicks[linkID][bareIP(ip)] += n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Bots are recognised by user agent, counted separately so user agents
+	// don't split the IP groups above
+	rows, err = r.db.Query(`
+		SELECT c.link_id, COALESCE(c.user_agent, ''), COUNT(*)
+		FROM clicks c
+		JOIN links l ON l.id = c.link_id
+		WHERE l.status = 'active' AND c.timestamp >= ? AND c.timestamp < ?
+		GROUP BY c.link_id, c.user_agent
+	`, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var linkID, ua string
+		var n int
+		if err := rows.Scan(&linkID, &ua, &n); err != nil {
+			return nil, err
+		}
+		if w, ok := windows[linkID]; ok && parser.IsBot(ua) {
+			w.BotClicks += n
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]LinkWindow, 0, len(windows))
+	for _, w := range windows {
+		for ip, n := range ipClicks[w.LinkID] {
+			// Loopback and private addresses are a reverse proxy's own, stored
+			// before it was trusted; they hide the visitors and never burst
+			if !netguard.IsPublic(net.ParseIP(ip)) {
+				continue
+			}
+			if n > w.TopIPClicks || (n == w.TopIPClicks && ip < w.TopIP) {
+				w.TopIP, w.TopIPClicks = ip, n
+			}
+		}
+		out = append(out, *w)
+	}
+	return out, nil
+}
+
+// RecentKinds returns the kinds alerted per link for windows starting after
+// since, so the cooldown can hold back repeats.
+func (r *Repository) RecentKinds(since int64) (map[string]map[string]bool, error) {
+	rows, err := r.db.Query("SELECT link_id, kind FROM anomaly_alerts WHERE window_start > ?", since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recent := map[string]map[string]bool{}
+	for rows.Next() {
+		var linkID, kind string
+		if err := rows.Scan(&linkID, &kind); err != nil {
+			return nil, err
+		}
+		if recent[linkID] == nil {
+			recent[linkID] = map[string]bool{}
+		}
+		recent[linkID][kind] = true
+	}
+	return recent, rows.Err()
+}
+
+// InsertAlert stores a, returning false if the window was already alerted.
+func (r *Repository) InsertAlert(a *Alert) (bool, error) {
+	res, err := r.db.Exec(`
+		INSERT OR IGNORE INTO anomaly_alerts (id, link_id, short_code, kind, window_start, window_end, clicks, baseline, value, threshold, detail, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, a.ID, a.LinkID, a.ShortCode, a.Kind, a.WindowStart, a.WindowEnd, a.Clicks, a.Baseline, a.Value, a.Threshold,
+		sql.NullString{String: a.Detail, Valid: a.Detail != ""}, a.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListAlerts returns the newest alerts first, optionally for one link.
+func (r *Repository) ListAlerts(linkID string, limit int) ([]*Alert, error) {
+	query := `
+		SELECT id, link_id, short_code, kind, window_start, window_end, clicks, baseline, value, threshold, detail, created_at
+		FROM anomaly_alerts`
+	args := []interface{}{}
+	if linkID != "" {
+		query += " WHERE link_id = ?"
+		args = append(args, linkID)
+	}
+	query += " ORDER BY window_start DESC, kind LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []*Alert{}
+	for rows.Next() {
+		var a Alert
+		var detail sql.NullString
+		if err := rows.Scan(&a.ID, &a.LinkID, &a.ShortCode, &a.Kind, &a.WindowStart, &a.WindowEnd, &a.Clicks, &a.Baseline, &a.Value, &a.Threshold, &detail, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.Detail = detail.String
+		alerts = append(alerts, &a)
+	}
+	return alerts, rows.Err()
+}
+
+func bareIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,100 @@
+package anomalies
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"trackr/internal/pkg/mailer"
+)
+
+type Service struct {
+	repo *Repository
+}
+
+func NewService(repo *Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// Run checks the last complete hour before now against each link's baseline
+// and records new alerts, skipping links and kinds still in their cooldown.
+// Rerunning for the same hour finds nothing new.
+//
+// The baseline is the BaselineDays of hourly rollups that ended a day before
+// the hour's UTC day, so it never depends on rollups that are not written yet.
+func (s *Service) Run(now time.Time) ([]*Alert, *Settings, error) {
+	settings, err := s.repo.GetSettings()
+	if err != nil || !settings.Enabled {
+		return nil, settings, err
+	}
+
+	end := now.UTC().Truncate(Window)
+	start := end.Add(-Window)
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	baselineEnd := day.AddDate(0, 0, -1)
+	baselineStart := baselineEnd.AddDate(0, 0, -BaselineDays)
+
+	windows, err := s.repo.Windows(start.UnixMilli(), end.UnixMilli(), baselineStart.UnixMilli(), baselineEnd.UnixMilli())
+	if err != nil {
+		return nil, settings, err
+	}
+	cooldown := time.Duration(settings.CooldownMinutes) * time.Minute
+	recent, err := s.repo.RecentKinds(start.Add(-cooldown).UnixMilli())
+	if err != nil {
+		return nil, settings, err
+	}
+
+	var alerts []*Alert
+	for _, w := range windows {
+		for _, alert := range settings.Detect(w) {
+			if recent[alert.LinkID][alert.Kind] {
+				continue
+			}
+			alert.ID = uuid.New().String()
+			alert.WindowStart = start.UnixMilli()
+			alert.WindowEnd = end.UnixMilli()
+			alert.CreatedAt = now.Unix()
+
+			inserted, err := s.repo.InsertAlert(alert)
+			if err != nil {
+				return alerts, settings, err
+			}
+			if inserted {
+				alerts = append(alerts, alert)
+			}
+		}
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].ShortCode != alerts[j].ShortCode {
+			return alerts[i].ShortCode < alerts[j].ShortCode
+		}
+		return alerts[i].Kind < alerts[j].Kind
+	})
+	return alerts, settings, nil
+}
+
+// Message summarizes one run's alerts for email. appURL links to the dashboard.
+func Message(alerts []*Alert, recipients []string, orgName, appURL string) *mailer.Message {
+	subject := fmt.Sprintf("Unusual traffic on /%s", alerts[0].ShortCode)
+	if len(alerts) > 1 {
+		subject = fmt.Sprintf("Unusual traffic: %d alerts", len(alerts))
+	}
+
+	var body strings.Builder
+	hour := time.UnixMilli(alerts[0].WindowStart).UTC()
+	fmt.Fprintf(&body, "Trackr found unusual traffic for %s between %s and %s UTC:\n\n",
+		orgName, hour.Format("Jan 2 15:04"), hour.Add(Window).Format("15:04"))
+	for _, a := range alerts {
+		fmt.Fprintf(&body, "  - %s\n", a.Describe())
+	}
+	fmt.Fprintf(&body, "\nReview these links and adjust alert thresholds at %s/anomalies\n", appURL)
+
+	return &mailer.Message{
+		To:      recipients,
+		Subject: "[" + orgName + "] " + subject,
+		Text:    body.String(),
+	}
+}
@@ -0,0 +1,116 @@
+package fraud
+
+import (
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const chromeMac = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+
+func browserHeader() http.Header {
+	h := http.Header{}
+	h.Set("Accept", "text/html,application/xhtml+xml")
+	h.Set("Accept-Language", "en-US,en;q=0.9")
+	h.Set("Sec-CH-UA", `"Chromium";v="126", "Google Chrome";v="126"`)
+	h.Set("Sec-CH-UA-Mobile", "?0")
+	h.Set("Sec-CH-UA-Platform", `"macOS"`)
+	return h
+}
+
+func TestScorer_RequestSignals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "datacenters.txt")
+	os.WriteFile(path, []byte("# cloud\n203.0.113.0/24 AS64500 Example Cloud\nnot-a-cidr\n2001:db8::/32\n"), 0o644)
+	ranges, err := NewDatacenterRanges(path)
+	if err != nil {
+		t.Fatalf("NewDatacenterRanges failed: %v", err)
+	}
+	if label, ok := ranges.Lookup(netip.MustParseAddr("203.0.113.9")); !ok || label != "AS64500 Example Cloud" {
+		t.Errorf("Lookup = %q, %v; want the Example Cloud range", label, ok)
+	}
+
+	tests := []struct {
+		name    string
+		ip      string
+		ua      string
+		header  func(h http.Header)
+		reasons string
+		valid   bool
+	}{
+		{"browser", "198.51.100.1:5000", chromeMac, nil, "", true},
+		{"datacenter alone", "203.0.113.9:443", chromeMac, nil, ReasonDatacenterIP, true},
+		{"ipv6 datacenter", "[2001:db8::1]:443", chromeMac, nil, ReasonDatacenterIP, true},
+		{"library", "198.51.100.2", "python-requests/2.31", nil, ReasonBotUserAgent, false},
+		{"script headers", "198.51.100.3", chromeMac, func(h http.Header) { h.Del("Accept-Language") }, ReasonScriptHeaders, true},
+		{"client hints on firefox", "198.51.100.4", "Mozilla/5.0 (Windows NT 10.0; rv:127.0) Gecko/20100101 Firefox/127.0", nil, ReasonClientHintMismatch, true},
+		{"platform mismatch", "198.51.100.5", chromeMac, func(h http.Header) { h.Set("Sec-CH-UA-Platform", `"Windows"`) }, ReasonClientHintMismatch, true},
+		{"mobile mismatch", "198.51.100.6", chromeMac, func(h http.Header) { h.Set("Sec-CH-UA-Mobile", "?1") }, ReasonClientHintMismatch, true},
+		{"headless from a datacenter", "203.0.113.10", chromeMac, func(h http.Header) {
+			h.Del("Accept-Language")
+			h.Set("Sec-CH-UA-Platform", `"Linux"`)
+		}, ReasonClientHintMismatch + "," + ReasonDatacenterIP + "," + ReasonScriptHeaders, false},
+	}
+
+	scorer := NewScorer(ranges)
+	now := time.Now()
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := browserHeader()
+			if tt.header != nil {
+				tt.header(h)
+			}
+			// Minutes apart so repetition and velocity stay quiet
+			result := scorer.Score(Click{IP: tt.ip, LinkID: "l1", UserAgent: tt.ua, Header: h, Time: now.Add(time.Duration(i) * time.Minute)})
+			if got := strings.Join(result.Reasons, ","); got != tt.reasons {
+				t.Errorf("Reasons = %q, want %q", got, tt.reasons)
+			}
+			if result.Valid() != tt.valid {
+				t.Errorf("Score %d valid = %v, want %v", result.Score, result.Valid(), tt.valid)
+			}
+		})
+	}
+}
+
+func TestScorer_RepetitionAndVelocity(t *testing.T) {
+	scorer := NewScorer(nil)
+	now := time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC)
+	click := func(ip, linkID string, at time.Time) Result {
+		return scorer.Score(Click{IP: ip, LinkID: linkID, UserAgent: chromeMac, Header: browserHeader(), Time: at})
+	}
+
+	// A visitor coming back to a link every minute is fine five times
+	for i := 0; i < repeatLimit; i++ {
+		if r := click("198.51.100.1", "l1", now.Add(time.Duration(i)*time.Minute)); r.Score != 0 {
+			t.Fatalf("Click %d scored %d (%v), want 0", i, r.Score, r.Reasons)
+		}
+	}
+	if r := click("198.51.100.1", "l1", now.Add(6*time.Minute)); strings.Join(r.Reasons, ",") != ReasonIPRepeat {
+		t.Errorf("Sixth click reasons = %v, want ip_repeat", r.Reasons)
+	}
+	// Other links and, after the window, the same link start afresh
+	if r := click("198.51.100.1", "l2", now.Add(7*time.Minute)); r.Score != 0 {
+		t.Errorf("Other link scored %d (%v), want 0", r.Score, r.Reasons)
+	}
+	if r := click("198.51.100.1", "l1", now.Add(30*time.Minute)); r.Score != 0 {
+		t.Errorf("Click after the window scored %d (%v), want 0", r.Score, r.Reasons)
+	}
+
+	// Two clicks within a second
+	click("198.51.100.2", "l1", now)
+	if r := click("198.51.100.2", "l2", now.Add(300*time.Millisecond)); strings.Join(r.Reasons, ",") != ReasonVelocity {
+		t.Errorf("Fast second click reasons = %v, want velocity", r.Reasons)
+	}
+
+	// A bot spreading clicks over many links, 1.5s apart
+	var last Result
+	for i := 0; i <= burstLimit; i++ {
+		last = click("198.51.100.3", string(rune('a'+i%26))+"-link", now.Add(time.Duration(i)*1500*time.Millisecond))
+	}
+	if strings.Join(last.Reasons, ",") != ReasonVelocity {
+		t.Errorf("Burst across links reasons = %v, want velocity", last.Reasons)
+	}
+}
@@ -0,0 +1,125 @@
+package fraud
+
+import (
+	"bufio"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DatacenterRanges is a file-backed list of hosting and cloud provider
+// networks (e.g. exported from an ASN database). Each line is a CIDR,
+// optionally followed by a label such as "AS16509 Amazon"; '#' starts a
+// comment. Watch reloads the file whenever its modification time changes.
+type DatacenterRanges struct {
+	path string
+
+	mu       sync.RWMutex
+	prefixes []rangeEntry
+	modTime  time.Time
+}
+
+type rangeEntry struct {
+	prefix netip.Prefix
+	label  string
+}
+
+func NewDatacenterRanges(path string) (*DatacenterRanges, error) {
+	d := &DatacenterRanges{path: path}
+	if path == "" {
+		return d, nil
+	}
+	return d, d.Reload()
+}
+
+// Reload re-reads the file if it changed since the last load.
+func (d *DatacenterRanges) Reload() error {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return err
+	}
+
+	d.mu.RLock()
+	unchanged := info.ModTime().Equal(d.modTime)
+	d.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	f, err := os.Open(d.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var prefixes []rangeEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+		cidr, label, _ := strings.Cut(line, " ")
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			log.Printf("Fraud: skipping invalid datacenter range %q", cidr)
+			continue
+		}
+		prefixes = append(prefixes, rangeEntry{prefix: prefix.Masked(), label: strings.TrimSpace(label)})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.prefixes = prefixes
+	d.modTime = info.ModTime()
+	d.mu.Unlock()
+
+	log.Printf("Fraud: loaded %d datacenter ranges from %s", len(prefixes), d.path)
+	return nil
+}
+
+// Watch polls the file every interval until stop is closed.
+func (d *DatacenterRanges) Watch(interval time.Duration, stop <-chan struct{}) {
+	if d.path == "" {
+		return
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.Reload(); err != nil {
+				log.Printf("Fraud: failed to reload datacenter ranges: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Lookup reports whether ip is in a listed range, and that range's label.
+func (d *DatacenterRanges) Lookup(ip netip.Addr) (string, bool) {
+	ip = ip.Unmap()
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, e := range d.prefixes {
+		if e.prefix.Contains(ip) {
+			return e.label, true
+		}
+	}
+	return "", false
+}
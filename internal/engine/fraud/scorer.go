@@ -0,0 +1,228 @@
+package fraud
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"trackr/internal/pkg/parser"
+)
+
+// Reasons a click scored above zero, stored with the click.
+const (
+	ReasonIPRepeat           = "ip_repeat"             // Same IP clicked the same link many times recently
+	ReasonVelocity           = "velocity"              // Clicks from one IP faster than a person can click
+	ReasonDatacenterIP       = "datacenter_ip"         // IP belongs to a hosting or cloud network
+	ReasonBotUserAgent       = "bot_user_agent"        // User agent of a crawler, library or headless browser
+	ReasonScriptHeaders      = "script_headers"        // Browser user agent without headers every browser sends
+	ReasonClientHintMismatch = "client_hints_mismatch" // Client Hints contradict the user agent
+)
+
+const (
+	// InvalidScore is the score from which a click counts as invalid and is
+	// left out of "valid clicks only" analytics.
+	InvalidScore = 50
+	MaxScore     = 100
+
+	// Once one IP has clicked a link repeatLimit times within repeatWindow,
+	// its further clicks on that link are suspicious
+	repeatWindow = 10 * time.Minute
+	repeatLimit  = 5
+	// Clicks closer together than minInterval, or beyond burstLimit across all
+	// links within a minute, are faster than a person clicks
+	minInterval = time.Second
+	burstLimit  = 30
+)
+
+var weights = map[string]int{
+	ReasonIPRepeat:           30,
+	ReasonVelocity:           40,
+	ReasonDatacenterIP:       40,
+	ReasonBotUserAgent:       60,
+	ReasonScriptHeaders:      30,
+	ReasonClientHintMismatch: 40,
+}
+
+// Click is what the scorer sees of one redirect.
+type Click struct {
+	IP        string // Address, with or without a port
+	LinkID    string
+	UserAgent string
+	Header    http.Header
+	Time      time.Time
+}
+
+// Result is a click's fraud likelihood: 0 looks human, MaxScore is certainly
+// automated. Reasons name each signal that fired, in a stable order.
+type Result struct {
+	Score   int      `json:"fraud_score"`
+	Reasons []string `json:"fraud_reasons,omitempty"`
+}
+
+func (r Result) Valid() bool {
+	return r.Score < InvalidScore
+}
+
+// Scorer scores clicks using only local signals: the request itself, a
+// datacenter range list and the recent clicks this process has seen. With
+// several redirect servers each sees its own share of an IP's clicks, so the
+// repetition and velocity signals are a lower bound.
+type Scorer struct {
+	datacenters *DatacenterRanges // May be nil
+
+	mu        sync.Mutex
+	recent    map[string][]seenClick // By IP, oldest first, within repeatWindow
+	lastSweep time.Time
+}
+
+type seenClick struct {
+	linkID string
+	at     time.Time
+}
+
+func NewScorer(datacenters *DatacenterRanges) *Scorer {
+	return &Scorer{datacenters: datacenters, recent: map[string][]seenClick{}}
+}
+
+// Score rates c and remembers it for the repetition and velocity signals.
+func (s *Scorer) Score(c Click) Result {
+	reasons := map[string]bool{}
+
+	ip := c.IP
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	if parser.IsBot(c.UserAgent) {
+		reasons[ReasonBotUserAgent] = true
+	} else {
+		if missingBrowserHeaders(c.Header) {
+			reasons[ReasonScriptHeaders] = true
+		}
+		if clientHintsMismatch(c.UserAgent, c.Header) {
+			reasons[ReasonClientHintMismatch] = true
+		}
+	}
+
+	if addr, err := netip.ParseAddr(ip); err == nil && s.datacenters != nil {
+		if _, ok := s.datacenters.Lookup(addr); ok {
+			reasons[ReasonDatacenterIP] = true
+		}
+	}
+
+	if ip != "" {
+		repeat, velocity := s.observe(ip, c.LinkID, c.Time)
+		reasons[ReasonIPRepeat] = repeat
+		reasons[ReasonVelocity] = velocity
+	}
+
+	var result Result
+	for reason, fired := range reasons {
+		if fired {
+			result.Score += weights[reason]
+			result.Reasons = append(result.Reasons, reason)
+		}
+	}
+	if result.Score > MaxScore {
+		result.Score = MaxScore
+	}
+	sort.Strings(result.Reasons)
+	return result
+}
+
+// observe records a click from ip and reports whether it repeats a link too
+// often or comes too fast.
+func (s *Scorer) observe(ip, linkID string, at time.Time) (repeat, velocity bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if at.Sub(s.lastSweep) > repeatWindow {
+		s.sweep(at)
+	}
+
+	var kept []seenClick
+	sameLink, lastMinute := 0, 0
+	for _, seen := range s.recent[ip] {
+		if at.Sub(seen.at) > repeatWindow {
+			continue
+		}
+		kept = append(kept, seen)
+		if seen.linkID == linkID {
+			sameLink++
+		}
+		if at.Sub(seen.at) <= time.Minute {
+			lastMinute++
+		}
+	}
+	if n := len(kept); n > 0 && at.Sub(kept[n-1].at) < minInterval {
+		velocity = true
+	}
+	repeat = sameLink >= repeatLimit
+	velocity = velocity || lastMinute >= burstLimit
+
+	// Keep enough history for both signals without letting one IP grow unbounded
+	kept = append(kept, seenClick{linkID: linkID, at: at})
+	if len(kept) > 4*burstLimit {
+		kept = kept[len(kept)-4*burstLimit:]
+	}
+	s.recent[ip] = kept
+	return repeat, velocity
+}
+
+// sweep drops IPs with no click inside the window.
+func (s *Scorer) sweep(now time.Time) {
+	for ip, seen := range s.recent {
+		if len(seen) == 0 || now.Sub(seen[len(seen)-1].at) > repeatWindow {
+			delete(s.recent, ip)
+		}
+	}
+	s.lastSweep = now
+}
+
+// missingBrowserHeaders reports a request lacking headers every browser sends
+// on navigation, typical of scripts that only set a user agent.
+func missingBrowserHeaders(h http.Header) bool {
+	return h.Get("Accept") == "" || h.Get("Accept-Language") == ""
+}
+
+// clientHintsMismatch reports Client Hints that contradict the user agent.
+// Only Chromium browsers send Sec-CH-UA, so hints next to a Firefox or Safari
+// user agent, or a platform or mobile hint the user agent disagrees with,
+// point to a forged user agent.
+func clientHintsMismatch(ua string, h http.Header) bool {
+	brands := h.Get("Sec-CH-UA")
+	platform := strings.Trim(h.Get("Sec-CH-UA-Platform"), `"`)
+	mobile := h.Get("Sec-CH-UA-Mobile")
+	if brands == "" && platform == "" && mobile == "" {
+		return false
+	}
+
+	os, browser := parser.ParseUserAgent(ua)
+	if browser == "Firefox" || browser == "Safari" {
+		return true
+	}
+
+	if platform != "" && os != "Unknown" {
+		// The UA parser reports Android as Linux, since Android UAs mention both
+		expected := map[string]string{
+			"Windows": "Windows",
+			"macOS":   "macOS",
+			"Linux":   "Linux",
+			"Android": "Linux",
+		}[platform]
+		if expected != "" && expected != os {
+			return true
+		}
+	}
+
+	uaLower := strings.ToLower(ua)
+	uaMobile := strings.Contains(uaLower, "mobile") || strings.Contains(uaLower, "android")
+	if (mobile == "?1" && !uaMobile) || (mobile == "?0" && strings.Contains(uaLower, "mobile")) {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package linkhealth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"trackr/internal/pkg/netguard"
+)
+
+type Target struct {
+	LinkID    string
+	ShortCode string
+	URL       string
+}
+
+type Result struct {
+	LinkID        string   `json:"link_id"`
+	URL           string   `json:"url"`
+	StatusCode    int      `json:"status_code"`
+	LatencyMs     int64    `json:"latency_ms"`
+	RedirectChain []string `json:"redirect_chain"`
+	Error         string   `json:"error,omitempty"`
+	Broken        bool     `json:"broken"`
+	CheckedAt     int64    `json:"checked_at"`
+}
+
+// Checker probes destination URLs. The HTTP client is injectable so tests can
+// point it at local servers, and requests are limited per host so a large tenant
+// with thousands of links to one site does not hammer that site.
+//
+// Destinations are user-supplied, so every hop is refused if it names a
+// non-public address; the client passed in should also dial through
+// netguard.NewTransport so hostnames resolving to one are caught too.
+type Checker struct {
+	client       *http.Client
+	perHostLimit int
+	maxRedirects int
+	allowPrivate bool
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func NewChecker(client *http.Client, perHostLimit int) *Checker {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second, Transport: netguard.NewTransport(5 * time.Second)}
+	}
+	if perHostLimit < 1 {
+		perHostLimit = 2
+	}
+
+	// Redirects are followed manually so every hop can be recorded
+	noFollow := *client
+	noFollow.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &Checker{
+		client:       &noFollow,
+		perHostLimit: perHostLimit,
+		maxRedirects: 10,
+		hosts:        make(map[string]chan struct{}),
+	}
+}
+
+// AllowPrivateAddresses lets the checker probe loopback and private
+// destinations, for tests against local servers.
+func (c *Checker) AllowPrivateAddresses() *Checker {
+	c.allowPrivate = true
+	return c
+}
+
+// CheckAll checks targets with at most `concurrency` checks in flight overall.
+// Results are returned in the same order as targets.
+func (c *Checker) CheckAll(ctx context.Context, targets []Target, concurrency int) []Result {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]Result, len(targets))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, target := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, target Target) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = c.Check(ctx, target)
+		}(i, target)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// Check issues a HEAD request (falling back to GET for servers that reject HEAD)
+// and follows redirects up to maxRedirects, recording each hop.
+func (c *Checker) Check(ctx context.Context, target Target) Result {
+	result := Result{
+		LinkID:        target.LinkID,
+		URL:           target.URL,
+		RedirectChain: []string{},
+		CheckedAt:     time.Now().Unix(),
+	}
+
+	start := time.Now()
+	current := target.URL
+	seen := map[string]bool{}
+
+	for hop := 0; ; hop++ {
+		if hop > c.maxRedirects {
+			result.Error = "too many redirects"
+			break
+		}
+		if seen[current] {
+			result.Error = "redirect loop"
+			break
+		}
+		seen[current] = true
+
+		status, location, err := c.probe(ctx, current)
+		if err != nil {
+			result.Error = err.Error()
+			break
+		}
+		result.StatusCode = status
+
+		if status < 300 || status >= 400 || location == "" {
+			break
+		}
+
+		next, err := resolveLocation(current, location)
+		if err != nil {
+			result.Error = "invalid redirect location"
+			break
+		}
+		result.RedirectChain = append(result.RedirectChain, next)
+		current = next
+	}
+
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.Broken = isBroken(result)
+	return result
+}
+
+func (c *Checker) probe(ctx context.Context, rawURL string) (int, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return 0, "", errors.New("unsupported scheme " + u.Scheme)
+	}
+	if !c.allowPrivate {
+		host := u.Hostname()
+		if ip := netguard.ParseHost(host); (ip != nil && !netguard.IsPublic(ip)) || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return 0, "", errors.New("destination " + host + " is not a public address")
+		}
+	}
+
+	release, err := c.acquire(ctx, u.Host)
+	if err != nil {
+		return 0, "", err
+	}
+	defer release()
+
+	status, location, err := c.do(ctx, http.MethodHead, rawURL)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented || status == http.StatusForbidden) {
+		// Some servers reject HEAD outright; retry with GET before calling it broken
+		status, location, err = c.do(ctx, http.MethodGet, rawURL)
+	}
+	return status, location, err
+}
+
+func (c *Checker) do(ctx context.Context, method, rawURL string) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("User-Agent", "TrackrLinkChecker/1.0")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, resp.Header.Get("Location"), nil
+}
+
+func (c *Checker) acquire(ctx context.Context, host string) (func(), error) {
+	c.mu.Lock()
+	sem, ok := c.hosts[host]
+	if !ok {
+		sem = make(chan struct{}, c.perHostLimit)
+		c.hosts[host] = sem
+	}
+	c.mu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func resolveLocation(base, location string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	l, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(l).String(), nil
+}
+
+// isBroken treats transport errors and 4xx/5xx as broken. 429 only means the
+// destination is rate limiting the checker, not that visitors cannot reach it.
+func isBroken(r Result) bool {
+	if r.Error != "" {
+		return true
+	}
+	if r.StatusCode == http.StatusTooManyRequests {
+		return false
+	}
+	return r.StatusCode >= 400
+}
@@ -0,0 +1,125 @@
+package linkhealth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChecker_Check(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	checker := NewChecker(server.Client(), 2).AllowPrivateAddresses()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBroken bool
+		wantHops   int
+	}{
+		{"Healthy", "/ok", 200, false, 0},
+		{"Not Found", "/missing", 404, true, 0},
+		{"Redirect Followed", "/moved", 200, false, 1},
+		{"Redirect Loop", "/loop", 302, true, 1},
+		{"HEAD Rejected", "/no-head", 200, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := checker.Check(context.Background(), Target{LinkID: "link1", URL: server.URL + tt.path})
+			if result.StatusCode != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d (err %q)", tt.wantStatus, result.StatusCode, result.Error)
+			}
+			if result.Broken != tt.wantBroken {
+				t.Errorf("Expected broken=%v, got %v", tt.wantBroken, result.Broken)
+			}
+			if len(result.RedirectChain) != tt.wantHops {
+				t.Errorf("Expected %d hops, got %v", tt.wantHops, result.RedirectChain)
+			}
+		})
+	}
+}
+
+func TestChecker_PerHostLimit(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	checker := NewChecker(server.Client(), 2).AllowPrivateAddresses()
+
+	targets := make([]Target, 10)
+	for i := range targets {
+		targets[i] = Target{LinkID: "link", URL: server.URL}
+	}
+	results := checker.CheckAll(context.Background(), targets, 10)
+
+	if len(results) != len(targets) {
+		t.Fatalf("Expected %d results, got %d", len(targets), len(results))
+	}
+	if maxInFlight > 2 {
+		t.Errorf("Expected at most 2 concurrent requests to one host, got %d", maxInFlight)
+	}
+}
+
+func TestChecker_RejectsPrivateHops(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+	}))
+	defer server.Close()
+
+	// Route every dial to the test server so a public-looking URL reaches it
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}}
+	checker := NewChecker(client, 2)
+
+	result := checker.Check(context.Background(), Target{LinkID: "link1", URL: "http://93.184.216.34/"})
+	if !result.Broken || result.Error == "" || len(result.RedirectChain) != 1 {
+		t.Errorf("Redirect to a metadata address followed: %+v", result)
+	}
+
+	for _, target := range []string{"http://127.0.0.1:1/", "http://0x7f.1/", "http://localhost/"} {
+		if result := checker.Check(context.Background(), Target{LinkID: "link1", URL: target}); result.Error == "" {
+			t.Errorf("Check(%s) probed a private destination", target)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package linkhealth
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+type Status struct {
+	LinkID              string   `json:"link_id"`
+	URL                 string   `json:"url"`
+	StatusCode          int      `json:"status_code"`
+	LatencyMs           int64    `json:"latency_ms"`
+	RedirectChain       []string `json:"redirect_chain"`
+	Error               string   `json:"error,omitempty"`
+	Broken              bool     `json:"broken"`
+	ConsecutiveFailures int      `json:"consecutive_failures"`
+	BrokenSince         *int64   `json:"broken_since,omitempty"`
+	CheckedAt           int64    `json:"checked_at"`
+}
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Record stores a check result. A link is only flagged broken after
+// failureThreshold consecutive failing checks, which keeps a single timeout
+// from paging anyone. It reports whether this result flipped the link to broken.
+func (r *Repository) Record(result Result, failureThreshold int) (bool, error) {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+
+	var prevURL string
+	var prevFailures int
+	var prevBroken bool
+	var brokenSince sql.NullInt64
+	err := r.db.QueryRow("SELECT url, consecutive_failures, broken, broken_since FROM link_health WHERE link_id = ?", result.LinkID).
+		Scan(&prevURL, &prevFailures, &prevBroken, &brokenSince)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	// Failures of a previous destination say nothing about this one
+	if prevURL != result.URL {
+		prevFailures, prevBroken, brokenSince = 0, false, sql.NullInt64{}
+	}
+
+	failures := 0
+	if result.Broken {
+		failures = prevFailures + 1
+	}
+	broken := failures >= failureThreshold
+
+	if broken && !prevBroken {
+		brokenSince = sql.NullInt64{Int64: result.CheckedAt, Valid: true}
+	} else if !broken {
+		brokenSince = sql.NullInt64{}
+	}
+
+	chainJSON, _ := json.Marshal(result.RedirectChain)
+	var statusCode sql.NullInt64
+	if result.StatusCode > 0 {
+		statusCode = sql.NullInt64{Int64: int64(result.StatusCode), Valid: true}
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO link_health (link_id, url, status_code, latency_ms, redirect_chain, error, broken, consecutive_failures, broken_since, checked_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(link_id) DO UPDATE SET
+			url=excluded.url,
+			status_code=excluded.status_code,
+			latency_ms=excluded.latency_ms,
+			redirect_chain=excluded.redirect_chain,
+			error=excluded.error,
+			broken=excluded.broken,
+			consecutive_failures=excluded.consecutive_failures,
+			broken_since=excluded.broken_since,
+			checked_at=excluded.checked_at
+	`, result.LinkID, result.URL, statusCode, result.LatencyMs, string(chainJSON), result.Error,
+		broken, failures, brokenSince, result.CheckedAt)
+	if err != nil {
+		return false, err
+	}
+
+	return broken && !prevBroken, nil
+}
+
+func (r *Repository) Get(linkID string) (*Status, error) {
+	query := `
+		SELECT link_id, url, status_code, latency_ms, redirect_chain, error, broken, consecutive_failures, broken_since, checked_at
+		FROM link_health WHERE link_id = ?
+	`
+	return scanStatus(r.db.QueryRow(query, linkID))
+}
+
+func (r *Repository) List(brokenOnly bool, limit, offset int) ([]*Status, error) {
+	query := `
+		SELECT link_id, url, status_code, latency_ms, redirect_chain, error, broken, consecutive_failures, broken_since, checked_at
+		FROM link_health WHERE (? = 0 OR broken = 1)
+		ORDER BY checked_at DESC
+		LIMIT ? OFFSET ?
+	`
+	rows, err := r.db.Query(query, brokenOnly, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statuses := []*Status{}
+	for rows.Next() {
+		s, err := scanStatus(rows)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, rows.Err()
+}
+
+func scanStatus(s interface {
+	Scan(dest ...interface{}) error
+}) (*Status, error) {
+	var st Status
+	var statusCode, latency, brokenSince sql.NullInt64
+	var chainRaw []byte
+	var errStr sql.NullString
+
+	err := s.Scan(&st.LinkID, &st.URL, &statusCode, &latency, &chainRaw, &errStr,
+		&st.Broken, &st.ConsecutiveFailures, &brokenSince, &st.CheckedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	st.StatusCode = int(statusCode.Int64)
+	st.LatencyMs = latency.Int64
+	st.Error = errStr.String
+	if brokenSince.Valid {
+		val := brokenSince.Int64
+		st.BrokenSince = &val
+	}
+	st.RedirectChain = []string{}
+	if len(chainRaw) > 0 {
+		json.Unmarshal(chainRaw, &st.RedirectChain)
+	}
+
+	return &st, nil
+}
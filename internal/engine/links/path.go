@@ -0,0 +1,124 @@
+package links
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Short codes may be multi-segment paths ("summer/shoes"). A code whose last
+// segment is WildcardSegment ("docs/*") matches every deeper path and forwards
+// the remainder onto the destination.
+const (
+	WildcardSegment    = "*"
+	maxCodeSegments    = 5
+	maxSegmentLength   = 32
+	maxShortCodeLength = 64
+)
+
+// IsWildcard reports whether the code forwards deeper paths.
+func IsWildcard(code string) bool {
+	return strings.HasSuffix(code, "/"+WildcardSegment)
+}
+
+// CleanRequestPath turns a request path into the form codes are stored in:
+// no leading/trailing or repeated slashes. Dot segments are resolved the way a
+// browser would, so "docs/../admin" can't match one code and forward another
+// path.
+func CleanRequestPath(path string) string {
+	parts := strings.Split(path, "/")
+	kept := parts[:0]
+	for _, p := range parts {
+		switch p {
+		case "", ".":
+		case "..":
+			if len(kept) > 0 {
+				kept = kept[:len(kept)-1]
+			}
+		default:
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, "/")
+}
+
+// LookupKeys lists the codes that could serve a request path, most specific
+// first: the exact path, then wildcards from the deepest prefix up.
+// "a/b/c" -> ["a/b/c", "a/b/c/*", "a/b/*", "a/*"].
+func LookupKeys(path string) []string {
+	if path == "" {
+		return nil
+	}
+	keys := []string{path}
+	segments := strings.Split(path, "/")
+	for i := len(segments); i >= 1; i-- {
+		keys = append(keys, strings.Join(segments[:i], "/")+"/"+WildcardSegment)
+	}
+	return keys
+}
+
+// WildcardRemainder returns the part of path below a wildcard code's prefix.
+// For non-wildcard codes it is always empty. The prefix is skipped by segment
+// count, so the remainder keeps the request's case when codes are matched
+// case-insensitively.
+func WildcardRemainder(code, path string) string {
+	if !IsWildcard(code) {
+		return ""
+	}
+	prefixSegments := strings.Count(code, "/")
+	segments := strings.SplitN(path, "/", prefixSegments+1)
+	if len(segments) <= prefixSegments {
+		return "" // Path is the prefix itself
+	}
+	return segments[prefixSegments]
+}
+
+// ForwardPath appends a wildcard remainder to the destination path and the
+// incoming query string to the destination's. Incoming parameters are kept as
+// sent, except those the destination sets itself, which win on conflict.
+func ForwardPath(destination, remainder, rawQuery string) string {
+	if remainder == "" && rawQuery == "" {
+		return destination
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+
+	if remainder != "" {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + remainder
+		u.RawPath = ""
+	}
+
+	if rawQuery != "" {
+		own := u.Query()
+		var forwarded []string
+		for _, pair := range strings.Split(rawQuery, "&") {
+			key, _, _ := strings.Cut(pair, "=")
+			if k, err := url.QueryUnescape(key); pair == "" || err != nil || own.Has(k) {
+				continue
+			}
+			forwarded = append(forwarded, pair)
+		}
+		if len(forwarded) > 0 {
+			if u.RawQuery != "" {
+				u.RawQuery += "&"
+			}
+			u.RawQuery += strings.Join(forwarded, "&")
+		}
+	}
+
+	return u.String()
+}
+
+func isValidCodeSegment(segment string) bool {
+	if segment == "" || len(segment) > maxSegmentLength {
+		return false
+	}
+	for _, c := range segment {
+		if !isAlphanumeric(c) && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
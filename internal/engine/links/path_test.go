@@ -0,0 +1,118 @@
+package links
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsValidShortCode_Paths(t *testing.T) {
+	tests := []struct {
+		code  string
+		valid bool
+	}{
+		{"abc123", true},
+		{"summer/shoes", true},
+		{"team-a/q3_launch", true},
+		{"docs/*", true},
+		{"docs/guides/*", true},
+		{"*", false},
+		{"docs/*/more", false},
+		{"summer//shoes", false},
+		{"/summer", false},
+		{"summer/", false},
+		{"api/links", false},
+		{"Health/check", false},
+		{"a/b/c/d/e/f", false},
+		{"summer/sh oes", false},
+		{"ab", false},
+	}
+
+	for _, tt := range tests {
+		if got := isValidShortCode(tt.code); got != tt.valid {
+			t.Errorf("isValidShortCode(%q) = %v, want %v", tt.code, got, tt.valid)
+		}
+	}
+}
+
+func TestLookupKeys(t *testing.T) {
+	got := LookupKeys("docs/guides/install")
+	want := []string{"docs/guides/install", "docs/guides/install/*", "docs/guides/*", "docs/*"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupKeys = %v, want %v", got, want)
+	}
+	cleaned := map[string]string{
+		"//docs///guides/":      "docs/guides",
+		"/docs/./guides":        "docs/guides",
+		"/docs/../admin":        "admin",
+		"/../../docs/guides/..": "docs",
+		"/docs/..":              "",
+	}
+	for path, want := range cleaned {
+		if got := CleanRequestPath(path); got != want {
+			t.Errorf("CleanRequestPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestForwardPath(t *testing.T) {
+	tests := []struct {
+		code, path, destination, query, want string
+	}{
+		{"docs/*", "docs/guides/install", "https://docs.example.com/v2", "", "https://docs.example.com/v2/guides/install"},
+		{"docs/*", "docs/guides/install", "https://docs.example.com/v2/", "", "https://docs.example.com/v2/guides/install"},
+		{"docs/*", "docs", "https://docs.example.com/v2", "", "https://docs.example.com/v2"},
+		{"docs/*", "docs/a", "https://docs.example.com/?lang=en", "lang=de&ref=x", "https://docs.example.com/a?lang=en&ref=x"},
+		{"docs/*", "docs/a", "https://docs.example.com/?z=1&a=2", "q=a%2Bb&q=c&flag", "https://docs.example.com/a?z=1&a=2&q=a%2Bb&q=c&flag"},
+		{"docs/*", "Docs/Guides/Install", "https://docs.example.com", "", "https://docs.example.com/Guides/Install"},
+		{"summer/shoes", "summer/shoes", "https://shop.example.com/shoes", "", "https://shop.example.com/shoes"},
+	}
+
+	for _, tt := range tests {
+		got := ForwardPath(tt.destination, WildcardRemainder(tt.code, tt.path), tt.query)
+		if got != tt.want {
+			t.Errorf("ForwardPath(%q, %q) = %q, want %q", tt.code, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRepository_GetByPath(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewService(NewRepository(db))
+	create := func(code string) *Link {
+		link, err := service.CreateLink(&Link{DestinationURL: "https://example.com/" + code, CreatedBy: "user1"}, code)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", code, err)
+		}
+		return link
+	}
+
+	docs := create("docs/*")
+	guides := create("docs/guides/*")
+	exact := create("docs/guides/faq")
+
+	repo := NewRepository(db)
+	tests := map[string]string{
+		"docs":                   docs.ID,
+		"docs/api/v1":            docs.ID,
+		"docs/guides":            guides.ID,
+		"docs/guides/install":    guides.ID,
+		"docs/guides/faq":        exact.ID,
+		"docs/guides/faq/deeper": guides.ID,
+	}
+	for path, wantID := range tests {
+		link, err := repo.GetByPath(path)
+		if err != nil {
+			t.Errorf("GetByPath(%q) failed: %v", path, err)
+			continue
+		}
+		if link.ID != wantID {
+			t.Errorf("GetByPath(%q) = %s, want %s", path, link.ShortCode, wantID)
+		}
+	}
+
+	if _, err := repo.GetByPath("blog/post"); err == nil {
+		t.Error("Expected no match for blog/post")
+	}
+}
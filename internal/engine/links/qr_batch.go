@@ -0,0 +1,110 @@
+package links
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// MaxQRBatchSize caps how many links one batch request may render.
+const MaxQRBatchSize = 500
+
+// QRBatchFilter selects the links for a batch: explicit IDs or every link whose
+// default UTM campaign matches.
+type QRBatchFilter struct {
+	LinkIDs     []string `json:"link_ids"`
+	UTMCampaign string   `json:"utm_campaign"`
+	Variant     string   `json:"variant"` // Optional named QR variant each link must have
+}
+
+// QRBatchItem is one link's entry in a batch archive.
+type QRBatchItem struct {
+	ShortCode      string
+	ShortURL       string
+	DestinationURL string
+	Content        string // What the QR code encodes
+}
+
+// WriteQRBatch writes a ZIP with one QR code per item and a manifest.csv.
+// Items are ordered by short code and filenames derive from it, so the same
+// selection always produces the same archive layout.
+func WriteQRBatch(w io.Writer, items []QRBatchItem, opts QROptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	ext := opts.Format
+	if ext == "" {
+		ext = QRFormatPNG
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].ShortCode < items[j].ShortCode })
+
+	zw := zip.NewWriter(w)
+	manifest := [][]string{{"filename", "short_code", "short_url", "qr_content", "destination_url"}}
+	used := map[string]bool{}
+
+	for _, item := range items {
+		data, err := GenerateStyledQRCode(item.Content, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", item.ShortCode, err)
+		}
+
+		filename := qrBatchFilename(item.ShortCode, ext, used)
+		method := zip.Deflate
+		if ext == QRFormatPNG {
+			method = zip.Store // Already compressed
+		}
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: filename, Method: method})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+		manifest = append(manifest, []string{filename, item.ShortCode, item.ShortURL, item.Content, item.DestinationURL})
+	}
+
+	f, err := zw.Create("manifest.csv")
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	if err := cw.WriteAll(manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// qrBatchFilename turns a short code into a flat filename ("summer/shoes" ->
+// "summer_shoes.png"). Names are deduplicated ignoring case, since codes that
+// differ only in case would overwrite each other on most desktop filesystems.
+func qrBatchFilename(code, ext string, used map[string]bool) string {
+	base := strings.NewReplacer("/", "_", WildcardSegment, "all").Replace(code)
+	if base == "" {
+		base = "link"
+	}
+	name := base + "." + ext
+	for n := 2; used[strings.ToLower(name)]; n++ {
+		name = fmt.Sprintf("%s-%d.%s", base, n, ext)
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+// validateQRBatchFilter checks that exactly one selector is set and the batch is not too large.
+func validateQRBatchFilter(filter *QRBatchFilter) error {
+	if len(filter.LinkIDs) > 0 && filter.UTMCampaign != "" {
+		return errors.New("use either link_ids or utm_campaign, not both")
+	}
+	if len(filter.LinkIDs) == 0 && filter.UTMCampaign == "" {
+		return errors.New("link_ids or utm_campaign is required")
+	}
+	if len(filter.LinkIDs) > MaxQRBatchSize {
+		return fmt.Errorf("at most %d links per batch", MaxQRBatchSize)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package links
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestService_QRBatch(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewService(NewRepository(db))
+	campaign := &UTMParams{Campaign: "spring"}
+
+	var ids []string
+	for _, code := range []string{"zeta", "alpha", "summer/shoes"} {
+		link, err := service.CreateLink(&Link{DestinationURL: "https://example.com/" + code, DefaultUTMParams: campaign, CreatedBy: "user1"}, code)
+		if err != nil {
+			t.Fatalf("Failed to create link %s: %v", code, err)
+		}
+		ids = append(ids, link.ID)
+	}
+	if _, err := service.CreateLink(&Link{DestinationURL: "https://example.com/other", CreatedBy: "user1"}, "other"); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	shortURL := func(l *Link) string { return "https://trk.io/" + l.ShortCode }
+
+	items, err := service.QRBatch(&QRBatchFilter{UTMCampaign: "spring"}, shortURL)
+	if err != nil {
+		t.Fatalf("QRBatch by campaign failed: %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 campaign links, got %d", len(items))
+	}
+
+	if _, err := service.QRBatch(&QRBatchFilter{LinkIDs: []string{ids[0], "missing"}}, shortURL); err == nil {
+		t.Error("Expected unknown link ID to be rejected")
+	}
+	if _, err := service.QRBatch(&QRBatchFilter{LinkIDs: ids, Variant: "poster"}, shortURL); err == nil {
+		t.Error("Expected unregistered variant to be rejected")
+	}
+	if _, err := service.QRBatch(&QRBatchFilter{}, shortURL); err == nil {
+		t.Error("Expected empty filter to be rejected")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteQRBatch(&buf, items, QROptions{Format: QRFormatSVG, Size: 256}); err != nil {
+		t.Fatalf("WriteQRBatch failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Invalid zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	want := []string{"alpha.svg", "summer_shoes.svg", "zeta.svg", "manifest.csv"}
+	if len(names) != len(want) {
+		t.Fatalf("Archive files = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("Archive files = %v, want %v", names, want)
+		}
+	}
+
+	mf, _ := zr.File[3].Open()
+	records, err := csv.NewReader(mf).ReadAll()
+	mf.Close()
+	if err != nil {
+		t.Fatalf("Invalid manifest: %v", err)
+	}
+	if len(records) != 4 || records[2][0] != "summer_shoes.svg" || records[2][2] != "https://trk.io/summer/shoes" || records[2][4] != "https://example.com/summer/shoes" {
+		t.Errorf("Unexpected manifest: %v", records)
+	}
+	if records[1][3] != "https://trk.io/alpha?qr=default" {
+		t.Errorf("Expected QR content to carry the default variant, got %q", records[1][3])
+	}
+}
+
+func TestQRBatchFilename(t *testing.T) {
+	used := map[string]bool{}
+	got := []string{
+		qrBatchFilename("Promo", "png", used),
+		qrBatchFilename("promo", "png", used),
+		qrBatchFilename("docs/*", "png", used),
+	}
+	want := []string{"Promo.png", "promo-2.png", "docs_all.png"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("qrBatchFilename #%d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
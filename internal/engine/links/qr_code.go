@@ -1,30 +1,416 @@
 package links
 
 import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
 
 	"github.com/skip2/go-qrcode"
 )
 
+const (
+	QRFormatPNG = "png"
+	QRFormatSVG = "svg"
+	QRFormatPDF = "pdf"
+)
+
+// QROptions controls how a QR code is rendered. Zero values fall back to the
+// previous behaviour: a 512px black-on-white PNG with medium error correction.
+type QROptions struct {
+	Format          string      // png, svg, pdf
+	Size            int         // Pixels for PNG; SVG/PDF use it as the nominal width in px/pt
+	Foreground      color.Color // Defaults to black
+	Background      color.Color // Defaults to white
+	ErrorCorrection string      // L, M, Q, H
+	QuietZone       *int        // Border in modules; nil means the standard 4
+	Logo            image.Image // Optional center logo; forces H error correction
+}
+
+// logoMaxShare is the largest share of the symbol's width a logo may cover.
+// High error correction restores ~30% of codewords; staying well under keeps
+// codes scannable with room for print damage.
+const logoMaxShare = 0.22
+
+// QRContentType returns the MIME type for a QR format.
+func QRContentType(format string) string {
+	switch format {
+	case QRFormatSVG:
+		return "image/svg+xml"
+	case QRFormatPDF:
+		return "application/pdf"
+	default:
+		return "image/png"
+	}
+}
+
 func GenerateQRCode(shortURL string, size int) ([]byte, error) {
+	return GenerateStyledQRCode(shortURL, QROptions{Size: size})
+}
+
+// GenerateStyledQRCode renders content as a QR code in the requested format and style.
+func GenerateStyledQRCode(content string, opts QROptions) ([]byte, error) {
+	level, quietZone, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate QR code
+	qr, err := qrcode.New(content, level)
+	if err != nil {
+		return nil, err
+	}
+	qr.DisableBorder = true
+
+	m := newQRMatrix(qr.Bitmap(), quietZone)
+
+	switch opts.Format {
+	case QRFormatSVG:
+		return m.svg(opts)
+	case QRFormatPDF:
+		return m.pdf(opts)
+	default:
+		return m.png(opts)
+	}
+}
+
+// Validate reports whether the options can render, without rendering anything.
+func (o QROptions) Validate() error {
+	_, _, err := o.normalize()
+	return err
+}
+
+// normalize fills in defaults and checks the options, returning the recovery
+// level and quiet zone to render with.
+func (o *QROptions) normalize() (qrcode.RecoveryLevel, int, error) {
 	// Default size
-	if size == 0 {
-		size = 512
+	if o.Size == 0 {
+		o.Size = 512
 	}
 
 	// Validate size
-	if size < 128 || size > 2048 {
-		return nil, errors.New("invalid size: must be between 128 and 2048")
+	if o.Size < 128 || o.Size > 2048 {
+		return 0, 0, errors.New("invalid size: must be between 128 and 2048")
 	}
 
-	// Generate QR code
-	qr, err := qrcode.New(shortURL, qrcode.Medium)
+	switch o.Format {
+	case "":
+		o.Format = QRFormatPNG
+	case QRFormatPNG, QRFormatSVG, QRFormatPDF:
+	default:
+		return 0, 0, errors.New("invalid format: must be png, svg or pdf")
+	}
+	if o.Foreground == nil {
+		o.Foreground = color.Black
+	}
+	if o.Background == nil {
+		o.Background = color.White
+	}
+	if contrastRatio(o.Foreground, o.Background) < 3 {
+		return 0, 0, errors.New("foreground and background colors need more contrast to scan reliably")
+	}
+
+	quietZone := 4
+	if o.QuietZone != nil {
+		quietZone = *o.QuietZone
+	}
+	if quietZone < 0 || quietZone > 16 {
+		return 0, 0, errors.New("invalid quiet zone: must be between 0 and 16 modules")
+	}
+
+	level, err := parseRecoveryLevel(o.ErrorCorrection)
 	if err != nil {
+		return 0, 0, err
+	}
+	if o.Logo != nil {
+		// A logo hides modules; only the highest level reliably recovers them
+		level = qrcode.Highest
+	}
+	return level, quietZone, nil
+}
+
+// ParseHexColor accepts #RGB or #RRGGBB, with or without the '#'.
+func ParseHexColor(s string) (color.Color, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return nil, errors.New("invalid color: use #RRGGBB")
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil, errors.New("invalid color: use #RRGGBB")
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+func parseRecoveryLevel(level string) (qrcode.RecoveryLevel, error) {
+	switch strings.ToUpper(level) {
+	case "L":
+		return qrcode.Low, nil
+	case "", "M":
+		return qrcode.Medium, nil
+	case "Q":
+		return qrcode.High, nil
+	case "H":
+		return qrcode.Highest, nil
+	default:
+		return 0, errors.New("invalid error correction level: must be L, M, Q or H")
+	}
+}
+
+// contrastRatio is the WCAG contrast ratio between two colors (1 to 21).
+func contrastRatio(a, b color.Color) float64 {
+	la, lb := relativeLuminance(a), relativeLuminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+func relativeLuminance(c color.Color) float64 {
+	r, g, b, _ := c.RGBA()
+	channel := func(v uint32) float64 {
+		s := float64(v) / 0xffff
+		if s <= 0.03928 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(r) + 0.7152*channel(g) + 0.0722*channel(b)
+}
+
+// qrMatrix is the module grid including the quiet zone.
+type qrMatrix struct {
+	modules [][]bool
+	n       int
+}
+
+func newQRMatrix(bitmap [][]bool, quietZone int) *qrMatrix {
+	n := len(bitmap) + 2*quietZone
+	modules := make([][]bool, n)
+	for y := range modules {
+		modules[y] = make([]bool, n)
+	}
+	for y, row := range bitmap {
+		copy(modules[y+quietZone][quietZone:], row)
+	}
+	return &qrMatrix{modules: modules, n: n}
+}
+
+// logoBox returns the logo placement in module units, centered and no wider
+// than logoMaxShare of the symbol, keeping the logo's aspect ratio.
+func (m *qrMatrix) logoBox(logo image.Image) (x, y, w, h float64) {
+	b := logo.Bounds()
+	maxSide := float64(m.n) * logoMaxShare
+	scale := maxSide / math.Max(float64(b.Dx()), float64(b.Dy()))
+	w, h = float64(b.Dx())*scale, float64(b.Dy())*scale
+	return (float64(m.n) - w) / 2, (float64(m.n) - h) / 2, w, h
+}
+
+func (m *qrMatrix) png(opts QROptions) ([]byte, error) {
+	size := opts.Size
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	scale := float64(size) / float64(m.n)
+	fg := color.RGBAModel.Convert(opts.Foreground).(color.RGBA)
+	bg := color.RGBAModel.Convert(opts.Background).(color.RGBA)
+
+	for py := 0; py < size; py++ {
+		my := int(float64(py) / scale)
+		for px := 0; px < size; px++ {
+			mx := int(float64(px) / scale)
+			if m.modules[my][mx] {
+				img.SetRGBA(px, py, fg)
+			} else {
+				img.SetRGBA(px, py, bg)
+			}
+		}
+	}
+
+	if opts.Logo != nil {
+		lx, ly, lw, lh := m.logoBox(opts.Logo)
+		drawScaled(img, opts.Logo, image.Rect(
+			int(lx*scale), int(ly*scale), int((lx+lw)*scale), int((ly+lh)*scale),
+		), opts.Background)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
 		return nil, err
 	}
+	return buf.Bytes(), nil
+}
+
+func (m *qrMatrix) svg(opts QROptions) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n",
+		opts.Size, opts.Size, m.n, m.n)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s"/>`+"\n", m.n, m.n, hexColor(opts.Background))
+
+	// One path with a horizontal run per subpath keeps files small
+	fmt.Fprintf(&buf, `<path fill="%s" d="`, hexColor(opts.Foreground))
+	m.runs(func(x, y, length int) {
+		fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", x, y, length, length)
+	})
+	buf.WriteString("\"/>\n")
+
+	if opts.Logo != nil {
+		lx, ly, lw, lh := m.logoBox(opts.Logo)
+		var logoPNG bytes.Buffer
+		if err := png.Encode(&logoPNG, opts.Logo); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, `<rect x="%.3f" y="%.3f" width="%.3f" height="%.3f" fill="%s"/>`+"\n", lx, ly, lw, lh, hexColor(opts.Background))
+		fmt.Fprintf(&buf, `<image x="%.3f" y="%.3f" width="%.3f" height="%.3f" href="data:image/png;base64,%s"/>`+"\n",
+			lx, ly, lw, lh, base64.StdEncoding.EncodeToString(logoPNG.Bytes()))
+	}
+
+	buf.WriteString("</svg>\n")
+	return buf.Bytes(), nil
+}
+
+// pdf writes a single-page PDF with the modules as vector rectangles. The
+// format is simple enough to emit by hand, which avoids a PDF dependency.
+func (m *qrMatrix) pdf(opts QROptions) ([]byte, error) {
+	size := float64(opts.Size)
+	unit := size / float64(m.n)
+
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "%s rg\n0 0 %.2f %.2f re f\n", pdfColor(opts.Background), size, size)
+	fmt.Fprintf(&content, "%s rg\n", pdfColor(opts.Foreground))
+	m.runs(func(x, y, length int) {
+		// PDF's origin is bottom-left
+		fmt.Fprintf(&content, "%.3f %.3f %.3f %.3f re\n", float64(x)*unit, size-float64(y+1)*unit, float64(length)*unit, unit)
+	})
+	content.WriteString("f\n")
+
+	var logoStream []byte
+	var logoW, logoH int
+	if opts.Logo != nil {
+		lx, ly, lw, lh := m.logoBox(opts.Logo)
+		fmt.Fprintf(&content, "%s rg\n%.3f %.3f %.3f %.3f re f\n", pdfColor(opts.Background), lx*unit, size-(ly+lh)*unit, lw*unit, lh*unit)
+		fmt.Fprintf(&content, "q %.3f 0 0 %.3f %.3f %.3f cm /Logo Do Q\n", lw*unit, lh*unit, lx*unit, size-(ly+lh)*unit)
+
+		var err error
+		logoStream, logoW, logoH, err = pdfImageStream(opts.Logo, opts.Background)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resources := "<< >>"
+	if logoStream != nil {
+		resources = "<< /XObject << /Logo 5 0 R >> >>"
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Contents 4 0 R /Resources %s >>", size, size, resources),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+	}
+	if logoStream != nil {
+		objects = append(objects, fmt.Sprintf(
+			"<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream",
+			logoW, logoH, len(logoStream), logoStream))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return buf.Bytes(), nil
+}
 
-	qr.DisableBorder = false
+// runs calls fn for every horizontal run of dark modules.
+func (m *qrMatrix) runs(fn func(x, y, length int)) {
+	for y, row := range m.modules {
+		for x := 0; x < m.n; {
+			if !row[x] {
+				x++
+				continue
+			}
+			start := x
+			for x < m.n && row[x] {
+				x++
+			}
+			fn(start, y, x-start)
+		}
+	}
+}
+
+// drawScaled paints src into dst's rect with nearest-neighbour scaling,
+// compositing transparent logo pixels over the background color.
+func drawScaled(dst *image.RGBA, src image.Image, rect image.Rectangle, background color.Color) {
+	sb := src.Bounds()
+	br, bg, bb, _ := background.RGBA()
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		sy := sb.Min.Y + (y-rect.Min.Y)*sb.Dy()/rect.Dy()
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			sx := sb.Min.X + (x-rect.Min.X)*sb.Dx()/rect.Dx()
+			r, g, b, a := src.At(sx, sy).RGBA()
+			// Colors are alpha-premultiplied, so blending only adds the background share
+			inv := 0xffff - a
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r + br*inv/0xffff),
+				G: uint16(g + bg*inv/0xffff),
+				B: uint16(b + bb*inv/0xffff),
+				A: 0xffff,
+			})
+		}
+	}
+}
+
+// pdfImageStream flattens the logo onto the background and returns zlib-compressed RGB samples.
+func pdfImageStream(logo image.Image, background color.Color) ([]byte, int, int, error) {
+	b := logo.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	drawScaled(flat, logo, flat.Bounds(), background)
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	row := make([]byte, 3*b.Dx())
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			c := flat.RGBAAt(x, y)
+			row[3*x], row[3*x+1], row[3*x+2] = c.R, c.G, c.B
+		}
+		if _, err := zw.Write(row); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, 0, 0, err
+	}
+	return buf.Bytes(), b.Dx(), b.Dy(), nil
+}
+
+func hexColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
 
-	// Return PNG bytes
-	return qr.PNG(size)
+func pdfColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("%.3f %.3f %.3f", float64(r)/0xffff, float64(g)/0xffff, float64(b)/0xffff)
 }
@@ -1,6 +1,11 @@
 package links
 
 import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
 	"testing"
 )
 
@@ -44,3 +49,103 @@ func TestGenerateQRCode(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateStyledQRCode(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for i := range logo.Pix {
+		logo.Pix[i] = 0xff
+	}
+	red, _ := ParseHexColor("#c00")
+	cream, _ := ParseHexColor("fffdf0")
+	margin := 2
+
+	tests := []struct {
+		name    string
+		opts    QROptions
+		prefix  string
+		wantErr bool
+	}{
+		{"PNG with colors", QROptions{Foreground: red, Background: cream}, "\x89PNG", false},
+		{"SVG", QROptions{Format: QRFormatSVG, ErrorCorrection: "q", QuietZone: &margin}, "<?xml", false},
+		{"PDF with logo", QROptions{Format: QRFormatPDF, Logo: logo}, "%PDF-1.4", false},
+		{"PNG with logo", QROptions{Logo: logo, Size: 300}, "\x89PNG", false},
+		{"Unknown format", QROptions{Format: "gif"}, "", true},
+		{"Bad ECC", QROptions{ErrorCorrection: "X"}, "", true},
+		{"Low contrast", QROptions{Foreground: cream, Background: color.White}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GenerateStyledQRCode("https://trk.io/summer", tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateStyledQRCode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.HasPrefix(got, []byte(tt.prefix)) {
+				t.Errorf("Output does not start with %q", tt.prefix)
+			}
+		})
+	}
+
+	if _, err := ParseHexColor("#12345"); err == nil {
+		t.Error("Expected error for malformed color")
+	}
+}
+
+func TestGenerateStyledQRCode_LogoForcesHighCorrection(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	zero := 0
+
+	plain, err := GenerateStyledQRCode("https://trk.io/summer", QROptions{Format: QRFormatSVG, ErrorCorrection: "L", QuietZone: &zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withLogo, err := GenerateStyledQRCode("https://trk.io/summer", QROptions{Format: QRFormatSVG, ErrorCorrection: "L", QuietZone: &zero, Logo: logo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	highest, err := GenerateStyledQRCode("https://trk.io/summer", QROptions{Format: QRFormatSVG, ErrorCorrection: "H", QuietZone: &zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	viewBox := func(svg []byte) string {
+		s := string(svg)
+		i := strings.Index(s, "viewBox=")
+		return s[i : i+strings.Index(s[i:], " shape")]
+	}
+	if viewBox(withLogo) != viewBox(highest) || viewBox(plain) == viewBox(highest) {
+		t.Errorf("Expected logo to force H correction: plain %s, logo %s, H %s", viewBox(plain), viewBox(withLogo), viewBox(highest))
+	}
+	if !strings.Contains(string(withLogo), "data:image/png;base64,") {
+		t.Error("Expected embedded logo in SVG")
+	}
+}
+
+func TestLogoStore(t *testing.T) {
+	store := NewLogoStore(t.TempDir())
+
+	if logo, err := store.Load("org1"); err != nil || logo != nil {
+		t.Fatalf("Expected no logo, got %v (err %v)", logo, err)
+	}
+
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 64, 64)))
+	if err := store.Save("org1", buf.Bytes()); err != nil {
+		t.Fatalf("Failed to save logo: %v", err)
+	}
+	if err := store.Save("org1", []byte("not an image")); err == nil {
+		t.Error("Expected error for invalid image")
+	}
+
+	logo, err := store.Load("org1")
+	if err != nil || logo == nil || logo.Bounds().Dx() != 64 {
+		t.Fatalf("Unexpected logo: %v (err %v)", logo, err)
+	}
+
+	if err := store.Delete("org1"); err != nil {
+		t.Fatal(err)
+	}
+	if logo, _ := store.Load("org1"); logo != nil {
+		t.Error("Expected logo to be deleted")
+	}
+}
@@ -0,0 +1,93 @@
+package links
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/jpeg" // Logos may be uploaded as JPEG
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+const (
+	maxLogoBytes     = 1 << 20 // 1 MB upload limit
+	maxLogoDimension = 1024
+)
+
+// LogoStore keeps one QR center logo per organization as a PNG file under dir.
+type LogoStore struct {
+	dir string
+}
+
+func NewLogoStore(dir string) *LogoStore {
+	return &LogoStore{dir: dir}
+}
+
+// Save validates an uploaded PNG or JPEG and stores it re-encoded as PNG, so
+// nothing but decoded pixels from the upload ever reaches disk.
+func (s *LogoStore) Save(orgID string, data []byte) error {
+	if len(data) > maxLogoBytes {
+		return errors.New("logo must be at most 1 MB")
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return errors.New("logo must be a PNG or JPEG image")
+	}
+	if cfg.Width > maxLogoDimension || cfg.Height > maxLogoDimension {
+		return errors.New("logo must be at most 1024x1024 pixels")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return errors.New("logo must be a PNG or JPEG image")
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+
+	// Write then rename so a concurrent QR render never reads a partial file
+	tmp := s.path(orgID) + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(orgID))
+}
+
+// Load returns the organization's logo, or nil if none was uploaded.
+func (s *LogoStore) Load(orgID string) (image.Image, error) {
+	f, err := os.Open(s.path(orgID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return png.Decode(f)
+}
+
+func (s *LogoStore) Delete(orgID string) error {
+	err := os.Remove(s.path(orgID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *LogoStore) path(orgID string) string {
+	// Org IDs are UUIDs; Base guards against anything path-like regardless
+	return filepath.Join(s.dir, filepath.Base(orgID)+".png")
+}
@@ -0,0 +1,80 @@
+package links
+
+import (
+	"net/url"
+	"strings"
+)
+
+// QR codes encode the short URL with ?qr=<variant> so the redirect can tell a
+// scan from a regular click and attribute it to the printed piece it came from.
+const (
+	QRVariantParam   = "qr"
+	DefaultQRVariant = "default"
+	maxQRVariantName = 32
+)
+
+// QRVariant is a named QR code for a link (poster, flyer, packaging).
+type QRVariant struct {
+	ID          string `json:"id"`
+	LinkID      string `json:"link_id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	CreatedBy   string `json:"created_by"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+// IsValidQRVariantName accepts lowercase slugs of letters, digits, '-' and '_'.
+func IsValidQRVariantName(name string) bool {
+	if name == "" || len(name) > maxQRVariantName {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// QRVariantURL is the content encoded in a variant's QR code.
+func QRVariantURL(shortURL, variant string) string {
+	if variant == "" {
+		variant = DefaultQRVariant
+	}
+	sep := "?"
+	if strings.Contains(shortURL, "?") {
+		sep = "&"
+	}
+	return shortURL + sep + QRVariantParam + "=" + url.QueryEscape(variant)
+}
+
+// SplitQRVariant removes the qr parameter from a request's query string, so it
+// is not forwarded to the destination, and returns the variant it named. The
+// other pairs are kept exactly as sent. A malformed variant is dropped and the
+// request counts as a regular click.
+func SplitQRVariant(rawQuery string) (variant, rest string) {
+	if rawQuery == "" {
+		return "", ""
+	}
+	found := false
+	kept := make([]string, 0, strings.Count(rawQuery, "&")+1)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		key, value, _ := strings.Cut(pair, "=")
+		if k, err := url.QueryUnescape(key); err != nil || k != QRVariantParam {
+			kept = append(kept, pair)
+			continue
+		}
+		if !found {
+			variant, _ = url.QueryUnescape(value)
+			found = true
+		}
+	}
+	if !found {
+		return "", rawQuery
+	}
+	variant = strings.ToLower(variant)
+	if !IsValidQRVariantName(variant) {
+		variant = ""
+	}
+	return variant, strings.Join(kept, "&")
+}
@@ -0,0 +1,81 @@
+package links
+
+import "testing"
+
+func TestSplitQRVariant(t *testing.T) {
+	tests := []struct {
+		query   string
+		variant string
+		rest    string
+	}{
+		{"", "", ""},
+		{"utm_source=x", "", "utm_source=x"},
+		{"qr=poster", "poster", ""},
+		{"qr=Poster&utm_source=x", "poster", "utm_source=x"},
+		{"qr=bad%20name&a=1", "", "a=1"},
+		{"utm_qr=x&aqr=y", "", "utm_qr=x&aqr=y"},
+		{"b=2&qr=flyer&a=%2F+x&a=1", "flyer", "b=2&a=%2F+x&a=1"},
+		{"q%72=poster&x", "poster", "x"},
+	}
+
+	for _, tt := range tests {
+		variant, rest := SplitQRVariant(tt.query)
+		if variant != tt.variant || rest != tt.rest {
+			t.Errorf("SplitQRVariant(%q) = (%q, %q), want (%q, %q)", tt.query, variant, rest, tt.variant, tt.rest)
+		}
+	}
+}
+
+func TestQRVariantURL(t *testing.T) {
+	if got := QRVariantURL("https://trk.io/abc", ""); got != "https://trk.io/abc?qr=default" {
+		t.Errorf("Unexpected default URL %q", got)
+	}
+	if got := QRVariantURL("https://trk.io/abc?x=1", "flyer"); got != "https://trk.io/abc?x=1&qr=flyer" {
+		t.Errorf("Unexpected variant URL %q", got)
+	}
+}
+
+func TestService_QRVariants(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewService(NewRepository(db))
+
+	link, err := service.CreateLink(&Link{DestinationURL: "https://example.com", CreatedBy: "user1"}, "promo")
+	if err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	variant, err := service.CreateQRVariant(&QRVariant{LinkID: link.ID, Name: " Poster ", CreatedBy: "user1"})
+	if err != nil {
+		t.Fatalf("Failed to create variant: %v", err)
+	}
+	if variant.Name != "poster" {
+		t.Errorf("Expected normalized name poster, got %q", variant.Name)
+	}
+
+	for _, name := range []string{"poster", "default", "has space", ""} {
+		if _, err := service.CreateQRVariant(&QRVariant{LinkID: link.ID, Name: name, CreatedBy: "user1"}); err == nil {
+			t.Errorf("Expected variant %q to be rejected", name)
+		}
+	}
+	if _, err := service.CreateQRVariant(&QRVariant{LinkID: "missing", Name: "flyer", CreatedBy: "user1"}); err == nil {
+		t.Error("Expected variant for unknown link to be rejected")
+	}
+
+	content, err := service.QRCodeContent(link, "https://trk.io/promo", "poster")
+	if err != nil || content != "https://trk.io/promo?qr=poster" {
+		t.Errorf("QRCodeContent = (%q, %v)", content, err)
+	}
+	if _, err := service.QRCodeContent(link, "https://trk.io/promo", "flyer"); err == nil {
+		t.Error("Expected unregistered variant to be rejected")
+	}
+
+	if err := service.DeleteQRVariant(link.ID, variant.ID); err != nil {
+		t.Fatalf("Failed to delete variant: %v", err)
+	}
+	variants, _ := service.ListQRVariants(link.ID)
+	if len(variants) != 0 {
+		t.Errorf("Expected no variants after delete, got %d", len(variants))
+	}
+}
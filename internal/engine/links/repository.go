@@ -3,11 +3,15 @@ package links
 import (
 	"database/sql"
 	"encoding/json"
+	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 type Repository struct {
-	db *sql.DB
+	db              *sql.DB
+	caseInsensitive bool
 }
 
 func NewRepository(db *sql.DB) *Repository {
@@ -15,35 +19,7 @@ func NewRepository(db *sql.DB) *Repository {
 }
 
 func (r *Repository) Create(link *Link) error {
-	query := `
-		INSERT INTO links (
-			id, short_code, destination_url, title, created_by,
-			redirect_type, rules, default_utm_params, status,
-			expires_at, password_hash, click_count, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
-
-	rulesJSON, _ := json.Marshal(link.Rules)
-	utmJSON, _ := json.Marshal(link.DefaultUTMParams)
-
-	_, err := r.db.Exec(query,
-		link.ID,
-		link.ShortCode,
-		link.DestinationURL,
-		link.Title,
-		link.CreatedBy,
-		link.RedirectType,
-		string(rulesJSON),
-		string(utmJSON),
-		link.Status,
-		link.ExpiresAt,
-		link.PasswordHash,
-		link.ClickCount,
-		link.CreatedAt,
-		link.UpdatedAt,
-	)
-
-	return err
+	return createLink(r.db, link)
 }
 
 func (r *Repository) GetByID(id string) (*Link, error) {
@@ -62,44 +38,252 @@ func (r *Repository) GetByShortCode(shortCode string) (*Link, error) {
 		SELECT id, short_code, destination_url, title, created_by,
 		       redirect_type, rules, default_utm_params, status,
 		       expires_at, password_hash, click_count, last_click_at, created_at, updated_at
-		FROM links WHERE short_code = ?
+		FROM links WHERE short_code = ?` + r.codeCollation() + `
 	`
 	row := r.db.QueryRow(query, shortCode)
 	return scanLink(row)
 }
 
+// GetByPath resolves a request path to a link: an exact code match wins,
+// otherwise the wildcard code with the longest matching prefix.
+func (r *Repository) GetByPath(path string) (*Link, error) {
+	keys := LookupKeys(path)
+	if len(keys) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(keys)), ",")
+	args := make([]interface{}, len(keys))
+	for i, k := range keys {
+		args[i] = k
+	}
+
+	query := `
+		SELECT id, short_code, destination_url, title, created_by,
+		       redirect_type, rules, default_utm_params, status,
+		       expires_at, password_hash, click_count, last_click_at, created_at, updated_at
+		FROM links WHERE short_code` + r.codeCollation() + ` IN (` + placeholders + `)
+	`
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := map[string]*Link{}
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		found[r.codeKey(link.ShortCode)] = link
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, k := range keys {
+		if link, ok := found[r.codeKey(k)]; ok {
+			return link, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
 func (r *Repository) ExistsByShortCode(shortCode string) (bool, error) {
 	var exists bool
-	query := "SELECT EXISTS(SELECT 1 FROM links WHERE short_code = ?)"
+	query := "SELECT EXISTS(SELECT 1 FROM links WHERE short_code = ?" + r.codeCollation() + ")"
 	err := r.db.QueryRow(query, shortCode).Scan(&exists)
 	return exists, err
 }
 
+// ExistingShortCodes returns the subset of codes already in use. Under
+// case-insensitive matching the keys are lowercased.
+func (r *Repository) ExistingShortCodes(codes []string) (map[string]bool, error) {
+	taken := map[string]bool{}
+	if len(codes) == 0 {
+		return taken, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(codes)), ",")
+	args := make([]interface{}, len(codes))
+	for i, c := range codes {
+		args[i] = c
+	}
+
+	rows, err := r.db.Query("SELECT short_code FROM links WHERE short_code"+r.codeCollation()+" IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		taken[r.codeKey(code)] = true
+	}
+	return taken, rows.Err()
+}
+
+// UseCaseInsensitiveCodes makes short-code lookups ignore case, as required by a
+// policy with CaseInsensitive set. Codes created before the policy was switched
+// on keep their stored case but still match.
+func (r *Repository) UseCaseInsensitiveCodes(enabled bool) *Repository {
+	r.caseInsensitive = enabled
+	return r
+}
+
+func (r *Repository) codeKey(code string) string {
+	if r.caseInsensitive {
+		return strings.ToLower(code)
+	}
+	return code
+}
+
+func (r *Repository) codeCollation() string {
+	if r.caseInsensitive {
+		return " COLLATE NOCASE"
+	}
+	return ""
+}
+
+// GetShortCodePolicy returns the organization's policy, or the default one if none is stored.
+func (r *Repository) GetShortCodePolicy() (*ShortCodePolicy, error) {
+	var p ShortCodePolicy
+	var prefix, updatedBy sql.NullString
+	var reservedRaw, blockedRaw []byte
+
+	err := r.db.QueryRow(`
+		SELECT length, alphabet, case_insensitive, prefix, reserved_words, blocked_words, updated_by, updated_at
+		FROM shortcode_policy WHERE id = 1
+	`).Scan(&p.Length, &p.Alphabet, &p.CaseInsensitive, &prefix, &reservedRaw, &blockedRaw, &updatedBy, &p.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return DefaultShortCodePolicy(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.Prefix = prefix.String
+	p.UpdatedBy = updatedBy.String
+	p.ReservedWords = []string{}
+	p.BlockedWords = []string{}
+	if len(reservedRaw) > 0 {
+		json.Unmarshal(reservedRaw, &p.ReservedWords)
+	}
+	if len(blockedRaw) > 0 {
+		json.Unmarshal(blockedRaw, &p.BlockedWords)
+	}
+	return &p, nil
+}
+
+func (r *Repository) SaveShortCodePolicy(p *ShortCodePolicy) error {
+	p.UpdatedAt = time.Now().Unix()
+
+	reserved, err := json.Marshal(p.ReservedWords)
+	if err != nil {
+		return err
+	}
+	blocked, err := json.Marshal(p.BlockedWords)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO shortcode_policy (id, length, alphabet, case_insensitive, prefix, reserved_words, blocked_words, updated_by, updated_at)
+		VALUES (1, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			length = excluded.length,
+			alphabet = excluded.alphabet,
+			case_insensitive = excluded.case_insensitive,
+			prefix = excluded.prefix,
+			reserved_words = excluded.reserved_words,
+			blocked_words = excluded.blocked_words,
+			updated_by = excluded.updated_by,
+			updated_at = excluded.updated_at
+	`, p.Length, p.Alphabet, p.CaseInsensitive, nullString(p.Prefix), string(reserved), string(blocked), p.UpdatedBy, p.UpdatedAt)
+	return err
+}
+
 func (r *Repository) Update(link *Link) error {
+	return updateLink(r.db, link)
+}
+
+// UpdateWithRevision saves the link and appends a revision in one transaction
+// so the history never drifts from the live row.
+func (r *Repository) UpdateWithRevision(link *Link, rev *Revision) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateLink(tx, link); err != nil {
+		return err
+	}
+	if err := insertRevision(tx, link, rev); err != nil {
+		return err
+	}
+	// A new destination starts with a clean health record
+	for _, field := range rev.ChangedFields {
+		if field == "destination_url" {
+			if _, err := tx.Exec("DELETE FROM link_health WHERE link_id = ?", link.ID); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return tx.Commit()
+}
+
+// CreateWithRevision inserts the link together with its initial revision.
+func (r *Repository) CreateWithRevision(link *Link, rev *Revision) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := createLink(tx, link); err != nil {
+		return err
+	}
+	if err := insertRevision(tx, link, rev); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) ListRevisions(linkID string) ([]*Revision, error) {
 	query := `
-		UPDATE links SET
-			destination_url = ?, title = ?, redirect_type = ?,
-			rules = ?, default_utm_params = ?, status = ?,
-			expires_at = ?, password_hash = ?, updated_at = ?
-		WHERE id = ?
+		SELECT id, link_id, revision, changed_by, changed_fields, snapshot, restored_from, created_at
+		FROM link_revisions WHERE link_id = ?
+		ORDER BY revision DESC
 	`
+	rows, err := r.db.Query(query, linkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	rulesJSON, _ := json.Marshal(link.Rules)
-	utmJSON, _ := json.Marshal(link.DefaultUTMParams)
+	revisions := []*Revision{}
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
 
-	_, err := r.db.Exec(query,
-		link.DestinationURL,
-		link.Title,
-		link.RedirectType,
-		string(rulesJSON),
-		string(utmJSON),
-		link.Status,
-		link.ExpiresAt,
-		link.PasswordHash,
-		time.Now().Unix(),
-		link.ID,
-	)
-	return err
+func (r *Repository) GetRevision(linkID string, revision int) (*Revision, error) {
+	query := `
+		SELECT id, link_id, revision, changed_by, changed_fields, snapshot, restored_from, created_at
+		FROM link_revisions WHERE link_id = ? AND revision = ?
+	`
+	return scanRevision(r.db.QueryRow(query, linkID, revision))
 }
 
 func (r *Repository) Delete(id string) error {
@@ -140,6 +324,100 @@ func (r *Repository) List(limit, offset int) ([]*Link, error) {
 	return links, nil
 }
 
+// ListByIDs returns the links with the given IDs; unknown IDs are skipped.
+func (r *Repository) ListByIDs(ids []string) ([]*Link, error) {
+	if len(ids) == 0 {
+		return []*Link{}, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	return r.queryLinks(`
+		SELECT id, short_code, destination_url, title, created_by,
+		       redirect_type, rules, default_utm_params, status,
+		       expires_at, password_hash, click_count, last_click_at, created_at, updated_at
+		FROM links
+		WHERE id IN (`+placeholders+`)
+		ORDER BY short_code
+	`, args...)
+}
+
+// ListByCampaign returns up to limit non-archived links whose default UTM campaign matches.
+func (r *Repository) ListByCampaign(campaign string, limit int) ([]*Link, error) {
+	return r.queryLinks(`
+		SELECT id, short_code, destination_url, title, created_by,
+		       redirect_type, rules, default_utm_params, status,
+		       expires_at, password_hash, click_count, last_click_at, created_at, updated_at
+		FROM links
+		WHERE json_extract(default_utm_params, '$.utm_campaign') = ? AND status != 'archived'
+		ORDER BY short_code
+		LIMIT ?
+	`, campaign, limit)
+}
+
+func (r *Repository) queryLinks(query string, args ...interface{}) ([]*Link, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []*Link{}
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// ListActive returns every active link; used by background jobs that walk the
+// whole tenant rather than paginating.
+func (r *Repository) ListActive() ([]*Link, error) {
+	query := `
+		SELECT id, short_code, destination_url, title, created_by,
+		       redirect_type, rules, default_utm_params, status,
+		       expires_at, password_hash, click_count, last_click_at, created_at, updated_at
+		FROM links
+		WHERE status = 'active'
+		ORDER BY created_at ASC
+	`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []*Link
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// ListExpired returns the links that are still live but whose expires_at is at
+// or before now.
+func (r *Repository) ListExpired(now int64) ([]*Link, error) {
+	return r.queryLinks(`
+		SELECT id, short_code, destination_url, title, created_by,
+		       redirect_type, rules, default_utm_params, status,
+		       expires_at, password_hash, click_count, last_click_at, created_at, updated_at
+		FROM links
+		WHERE expires_at IS NOT NULL AND expires_at <= ? AND status != 'archived'
+		ORDER BY expires_at ASC
+	`, now)
+}
+
 func scanLink(s interface {
 	Scan(dest ...interface{}) error
 }) (*Link, error) {
@@ -187,3 +465,359 @@ func scanLink(s interface {
 
 	return &link, nil
 }
+
+func (r *Repository) CreateScheduledChange(change *ScheduledChange) error {
+	change.ID = uuid.New().String()
+	change.State = ScheduleStatePending
+	change.CreatedAt = time.Now().Unix()
+
+	var rulesJSON interface{}
+	if change.Rules != nil {
+		b, err := json.Marshal(change.Rules)
+		if err != nil {
+			return err
+		}
+		rulesJSON = string(b)
+	}
+
+	_, err := r.db.Exec(`
+		INSERT INTO scheduled_changes (id, link_id, destination_url, rules, status, run_at, state, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, change.ID, change.LinkID, nullString(change.DestinationURL), rulesJSON, nullString(change.Status),
+		change.RunAt, change.State, change.CreatedBy, change.CreatedAt)
+	return err
+}
+
+func (r *Repository) ListScheduledChanges(linkID string) ([]*ScheduledChange, error) {
+	query := `
+		SELECT id, link_id, destination_url, rules, status, run_at, state, created_by, last_error, applied_at, created_at
+		FROM scheduled_changes WHERE link_id = ?
+		ORDER BY run_at ASC
+	`
+	return r.queryScheduledChanges(query, linkID)
+}
+
+// ListDueScheduledChanges returns pending changes whose run_at has passed, oldest first,
+// so that several changes on one link are applied in the order they were meant to happen.
+func (r *Repository) ListDueScheduledChanges(now int64, limit int) ([]*ScheduledChange, error) {
+	query := `
+		SELECT id, link_id, destination_url, rules, status, run_at, state, created_by, last_error, applied_at, created_at
+		FROM scheduled_changes WHERE state = 'pending' AND run_at <= ?
+		ORDER BY run_at ASC, created_at ASC
+		LIMIT ?
+	`
+	return r.queryScheduledChanges(query, now, limit)
+}
+
+// CancelScheduledChange only affects pending changes; it reports false if nothing was cancelled.
+func (r *Repository) CancelScheduledChange(linkID, changeID string) (bool, error) {
+	res, err := r.db.Exec(`
+		UPDATE scheduled_changes SET state = 'cancelled'
+		WHERE id = ? AND link_id = ? AND state = 'pending'
+	`, changeID, linkID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *Repository) MarkScheduledChange(id, state, lastError string) error {
+	_, err := r.db.Exec(`
+		UPDATE scheduled_changes SET state = ?, last_error = ?, applied_at = ? WHERE id = ?
+	`, state, nullString(lastError), time.Now().Unix(), id)
+	return err
+}
+
+func (r *Repository) queryScheduledChanges(query string, args ...interface{}) ([]*ScheduledChange, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*ScheduledChange{}
+	for rows.Next() {
+		var c ScheduledChange
+		var destination, status, lastError sql.NullString
+		var rulesRaw []byte
+		var appliedAt sql.NullInt64
+
+		if err := rows.Scan(&c.ID, &c.LinkID, &destination, &rulesRaw, &status, &c.RunAt, &c.State,
+			&c.CreatedBy, &lastError, &appliedAt, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		c.DestinationURL = destination.String
+		c.Status = status.String
+		c.LastError = lastError.String
+		if appliedAt.Valid {
+			val := appliedAt.Int64
+			c.AppliedAt = &val
+		}
+		if len(rulesRaw) > 0 {
+			json.Unmarshal(rulesRaw, &c.Rules)
+		}
+		changes = append(changes, &c)
+	}
+	return changes, rows.Err()
+}
+
+func (r *Repository) ListScreeningRules() ([]*ScreeningRule, error) {
+	rows, err := r.db.Query(`
+		SELECT id, list, domain, created_by, created_at
+		FROM screening_rules ORDER BY list, domain
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []*ScreeningRule{}
+	for rows.Next() {
+		var rule ScreeningRule
+		if err := rows.Scan(&rule.ID, &rule.List, &rule.Domain, &rule.CreatedBy, &rule.CreatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, &rule)
+	}
+	return rules, rows.Err()
+}
+
+func (r *Repository) CreateScreeningRule(rule *ScreeningRule) error {
+	rule.ID = uuid.New().String()
+	rule.CreatedAt = time.Now().Unix()
+
+	_, err := r.db.Exec(`
+		INSERT INTO screening_rules (id, list, domain, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, rule.ID, rule.List, rule.Domain, rule.CreatedBy, rule.CreatedAt)
+	return err
+}
+
+func (r *Repository) DeleteScreeningRule(id string) (bool, error) {
+	res, err := r.db.Exec("DELETE FROM screening_rules WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *Repository) CreateScreeningFlag(flag *ScreeningFlag) error {
+	_, err := r.db.Exec(`
+		INSERT INTO link_screening_flags (link_id, screener, reason, flagged_at)
+		VALUES (?, ?, ?, ?)
+	`, flag.LinkID, flag.Screener, flag.Reason, flag.FlaggedAt)
+	return err
+}
+
+func (r *Repository) ListScreeningFlags(limit, offset int) ([]*ScreeningFlag, error) {
+	rows, err := r.db.Query(`
+		SELECT f.link_id, l.short_code, f.screener, f.reason, f.flagged_at
+		FROM link_screening_flags f
+		JOIN links l ON l.id = f.link_id
+		ORDER BY f.flagged_at DESC, f.id DESC
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := []*ScreeningFlag{}
+	for rows.Next() {
+		var f ScreeningFlag
+		if err := rows.Scan(&f.LinkID, &f.ShortCode, &f.Screener, &f.Reason, &f.FlaggedAt); err != nil {
+			return nil, err
+		}
+		flags = append(flags, &f)
+	}
+	return flags, rows.Err()
+}
+
+func (r *Repository) ListQRVariants(linkID string) ([]*QRVariant, error) {
+	rows, err := r.db.Query(`
+		SELECT id, link_id, name, description, created_by, created_at
+		FROM qr_variants WHERE link_id = ? ORDER BY name
+	`, linkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []*QRVariant{}
+	for rows.Next() {
+		var v QRVariant
+		var description sql.NullString
+		if err := rows.Scan(&v.ID, &v.LinkID, &v.Name, &description, &v.CreatedBy, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		v.Description = description.String
+		variants = append(variants, &v)
+	}
+	return variants, rows.Err()
+}
+
+func (r *Repository) QRVariantExists(linkID, name string) (bool, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM qr_variants WHERE link_id = ? AND name = ?", linkID, name).Scan(&count)
+	return count > 0, err
+}
+
+func (r *Repository) CreateQRVariant(v *QRVariant) error {
+	v.ID = uuid.New().String()
+	v.CreatedAt = time.Now().Unix()
+
+	_, err := r.db.Exec(`
+		INSERT INTO qr_variants (id, link_id, name, description, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, v.ID, v.LinkID, v.Name, nullString(v.Description), v.CreatedBy, v.CreatedAt)
+	return err
+}
+
+func (r *Repository) DeleteQRVariant(linkID, id string) (bool, error) {
+	res, err := r.db.Exec("DELETE FROM qr_variants WHERE id = ? AND link_id = ?", id, linkID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func createLink(e execer, link *Link) error {
+	query := `
+		INSERT INTO links (
+			id, short_code, destination_url, title, created_by,
+			redirect_type, rules, default_utm_params, status,
+			expires_at, password_hash, click_count, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	rulesJSON, _ := json.Marshal(link.Rules)
+	utmJSON, _ := json.Marshal(link.DefaultUTMParams)
+
+	_, err := e.Exec(query,
+		link.ID,
+		link.ShortCode,
+		link.DestinationURL,
+		link.Title,
+		link.CreatedBy,
+		link.RedirectType,
+		string(rulesJSON),
+		string(utmJSON),
+		link.Status,
+		link.ExpiresAt,
+		link.PasswordHash,
+		link.ClickCount,
+		link.CreatedAt,
+		link.UpdatedAt,
+	)
+
+	return err
+}
+
+func updateLink(e execer, link *Link) error {
+	query := `
+		UPDATE links SET
+			destination_url = ?, title = ?, redirect_type = ?,
+			rules = ?, default_utm_params = ?, status = ?,
+			expires_at = ?, password_hash = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	rulesJSON, _ := json.Marshal(link.Rules)
+	utmJSON, _ := json.Marshal(link.DefaultUTMParams)
+	link.UpdatedAt = time.Now().Unix()
+
+	_, err := e.Exec(query,
+		link.DestinationURL,
+		link.Title,
+		link.RedirectType,
+		string(rulesJSON),
+		string(utmJSON),
+		link.Status,
+		link.ExpiresAt,
+		link.PasswordHash,
+		link.UpdatedAt,
+		link.ID,
+	)
+	return err
+}
+
+// insertRevision numbers the revision inside the caller's transaction and stores
+// the link's current state as its snapshot.
+func insertRevision(tx *sql.Tx, link *Link, rev *Revision) error {
+	var latest sql.NullInt64
+	if err := tx.QueryRow("SELECT MAX(revision) FROM link_revisions WHERE link_id = ?", link.ID).Scan(&latest); err != nil {
+		return err
+	}
+
+	snapshot := *link
+	rev.ID = uuid.New().String()
+	rev.LinkID = link.ID
+	rev.Revision = int(latest.Int64) + 1
+	rev.Snapshot = &snapshot
+	rev.CreatedAt = time.Now().Unix()
+	if rev.ChangedFields == nil {
+		rev.ChangedFields = []string{}
+	}
+
+	fieldsJSON, err := json.Marshal(rev.ChangedFields)
+	if err != nil {
+		return err
+	}
+	snapshotJSON, err := json.Marshal(rev.Snapshot)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO link_revisions (id, link_id, revision, changed_by, changed_fields, snapshot, restored_from, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, rev.ID, rev.LinkID, rev.Revision, rev.ChangedBy, string(fieldsJSON), string(snapshotJSON), rev.RestoredFrom, rev.CreatedAt)
+	return err
+}
+
+func scanRevision(s interface {
+	Scan(dest ...interface{}) error
+}) (*Revision, error) {
+	var rev Revision
+	var fieldsRaw, snapshotRaw []byte
+	var restoredFrom sql.NullInt64
+
+	err := s.Scan(
+		&rev.ID,
+		&rev.LinkID,
+		&rev.Revision,
+		&rev.ChangedBy,
+		&fieldsRaw,
+		&snapshotRaw,
+		&restoredFrom,
+		&rev.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if restoredFrom.Valid {
+		val := int(restoredFrom.Int64)
+		rev.RestoredFrom = &val
+	}
+	if err := json.Unmarshal(fieldsRaw, &rev.ChangedFields); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(snapshotRaw, &rev.Snapshot); err != nil {
+		return nil, err
+	}
+
+	return &rev, nil
+}
@@ -32,6 +32,72 @@ func setupTestDB(t *testing.T) *sql.DB {
 		created_at INTEGER NOT NULL,
 		updated_at INTEGER NOT NULL
 	);
+	CREATE TABLE link_revisions (
+		id TEXT PRIMARY KEY,
+		link_id TEXT NOT NULL,
+		revision INTEGER NOT NULL,
+		changed_by TEXT NOT NULL,
+		changed_fields TEXT NOT NULL,
+		snapshot TEXT NOT NULL,
+		restored_from INTEGER,
+		created_at INTEGER NOT NULL,
+		UNIQUE(link_id, revision)
+	);
+	CREATE TABLE scheduled_changes (
+		id TEXT PRIMARY KEY,
+		link_id TEXT NOT NULL,
+		destination_url TEXT,
+		rules TEXT,
+		status TEXT,
+		run_at INTEGER NOT NULL,
+		state TEXT DEFAULT 'pending',
+		created_by TEXT NOT NULL,
+		last_error TEXT,
+		applied_at INTEGER,
+		created_at INTEGER NOT NULL
+	);
+	CREATE TABLE shortcode_policy (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		length INTEGER NOT NULL,
+		alphabet TEXT NOT NULL,
+		case_insensitive INTEGER DEFAULT 0,
+		prefix TEXT,
+		reserved_words TEXT,
+		blocked_words TEXT,
+		updated_by TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE TABLE screening_rules (
+		id TEXT PRIMARY KEY,
+		list TEXT NOT NULL,
+		domain TEXT NOT NULL,
+		created_by TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		UNIQUE(list, domain)
+	);
+	CREATE TABLE link_screening_flags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		link_id TEXT NOT NULL,
+		screener TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		flagged_at INTEGER NOT NULL
+	);
+	CREATE TABLE qr_variants (
+		id TEXT PRIMARY KEY,
+		link_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		description TEXT,
+		created_by TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		UNIQUE(link_id, name)
+	);
+	CREATE TABLE link_health (
+		link_id TEXT PRIMARY KEY,
+		url TEXT NOT NULL,
+		broken BOOLEAN DEFAULT FALSE,
+		consecutive_failures INTEGER DEFAULT 0,
+		checked_at INTEGER NOT NULL
+	);
 	`
 	_, err = db.Exec(query)
 	if err != nil {
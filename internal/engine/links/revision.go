@@ -0,0 +1,110 @@
+package links
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+type Revision struct {
+	ID            string   `json:"id"`
+	LinkID        string   `json:"link_id"`
+	Revision      int      `json:"revision"`
+	ChangedBy     string   `json:"changed_by"`
+	ChangedFields []string `json:"changed_fields"`
+	Snapshot      *Link    `json:"snapshot"`
+	RestoredFrom  *int     `json:"restored_from,omitempty"`
+	CreatedAt     int64    `json:"created_at"`
+}
+
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+const passwordChanged = "password_changed"
+
+// revisionFields lists the user-editable link fields tracked in revisions.
+// Counters (click_count, last_click_at) and timestamps are deliberately excluded.
+// The password is only reported as changed, never with its hash.
+var revisionFields = []struct {
+	name string
+	get  func(*Link) interface{}
+}{
+	{"destination_url", func(l *Link) interface{} { return l.DestinationURL }},
+	{"title", func(l *Link) interface{} { return l.Title }},
+	{"redirect_type", func(l *Link) interface{} { return l.RedirectType }},
+	{"rules", func(l *Link) interface{} { return l.Rules }},
+	{"default_utm_params", func(l *Link) interface{} { return l.DefaultUTMParams }},
+	{"status", func(l *Link) interface{} { return l.Status }},
+	{"expires_at", func(l *Link) interface{} { return l.ExpiresAt }},
+	{passwordChanged, func(l *Link) interface{} { return l.PasswordHash }},
+}
+
+// DiffLinks returns the tracked fields that differ between two link states.
+// A nil link is treated as an empty one, so diffing against nil lists every set field.
+func DiffLinks(from, to *Link) []FieldChange {
+	if from == nil {
+		from = &Link{}
+	}
+	if to == nil {
+		to = &Link{}
+	}
+
+	changes := []FieldChange{}
+	for _, f := range revisionFields {
+		a, b := f.get(from), f.get(to)
+		if sameValue(a, b) {
+			continue
+		}
+		if f.name == passwordChanged {
+			changes = append(changes, FieldChange{Field: f.name})
+		} else {
+			changes = append(changes, FieldChange{Field: f.name, From: a, To: b})
+		}
+	}
+	return changes
+}
+
+func changedFieldNames(changes []FieldChange) []string {
+	names := make([]string, 0, len(changes))
+	for _, c := range changes {
+		names = append(names, c.Field)
+	}
+	return names
+}
+
+// sameValue compares through JSON so that nil pointers and empty structs,
+// which encode identically once stored, are not reported as changes.
+func sameValue(a, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return string(ja) == string(jb)
+}
+
+// redacted returns a copy of the revision without the snapshot's password hash,
+// for showing history to users.
+func (r *Revision) redacted() *Revision {
+	public := *r
+	if r.Snapshot != nil {
+		snapshot := *r.Snapshot
+		snapshot.PasswordHash = ""
+		public.Snapshot = &snapshot
+	}
+	return &public
+}
+
+// restoreFields copies the tracked fields of a snapshot onto the live link.
+func restoreFields(dst, snapshot *Link) {
+	dst.DestinationURL = snapshot.DestinationURL
+	dst.Title = snapshot.Title
+	dst.RedirectType = snapshot.RedirectType
+	dst.Rules = snapshot.Rules
+	dst.DefaultUTMParams = snapshot.DefaultUTMParams
+	dst.Status = snapshot.Status
+	dst.ExpiresAt = snapshot.ExpiresAt
+	dst.PasswordHash = snapshot.PasswordHash
+}
@@ -0,0 +1,256 @@
+package links
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiffLinks(t *testing.T) {
+	from := &Link{DestinationURL: "https://a.example.com", Title: "Launch", Status: "active"}
+	to := &Link{DestinationURL: "https://b.example.com", Title: "Launch", Status: "paused"}
+
+	changes := DiffLinks(from, to)
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %d: %+v", len(changes), changes)
+	}
+	if changes[0].Field != "destination_url" || changes[0].From != "https://a.example.com" || changes[0].To != "https://b.example.com" {
+		t.Errorf("Unexpected destination change: %+v", changes[0])
+	}
+	if changes[1].Field != "status" {
+		t.Errorf("Expected status change, got %s", changes[1].Field)
+	}
+
+	// nil rules and empty rules are stored identically, so they are not a change
+	if got := DiffLinks(&Link{Rules: nil}, &Link{Rules: nil}); len(got) != 0 {
+		t.Errorf("Expected no changes, got %+v", got)
+	}
+}
+
+func TestService_RevisionsAndRollback(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewService(NewRepository(db))
+
+	link, err := service.CreateLink(&Link{DestinationURL: "https://v1.example.com", CreatedBy: "user1"}, "launch")
+	if err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	if _, err := service.UpdateLink(link.ID, &Link{DestinationURL: "https://v2.example.com"}, "user2"); err != nil {
+		t.Fatalf("Failed to update link: %v", err)
+	}
+
+	// An update that changes nothing must not add a revision
+	if _, err := service.UpdateLink(link.ID, &Link{DestinationURL: "https://v2.example.com"}, "user2"); err != nil {
+		t.Fatalf("Failed to update link: %v", err)
+	}
+
+	revisions, err := service.ListRevisions(link.ID)
+	if err != nil {
+		t.Fatalf("Failed to list revisions: %v", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("Expected 2 revisions, got %d", len(revisions))
+	}
+	if revisions[0].Revision != 2 || revisions[0].ChangedBy != "user2" {
+		t.Errorf("Unexpected latest revision: %+v", revisions[0])
+	}
+	if len(revisions[0].ChangedFields) != 1 || revisions[0].ChangedFields[0] != "destination_url" {
+		t.Errorf("Expected destination_url change, got %v", revisions[0].ChangedFields)
+	}
+
+	changes, err := service.DiffRevisions(link.ID, 1, 2)
+	if err != nil {
+		t.Fatalf("Failed to diff revisions: %v", err)
+	}
+	if len(changes) != 1 || changes[0].To != "https://v2.example.com" {
+		t.Errorf("Unexpected diff: %+v", changes)
+	}
+
+	restored, err := service.RollbackLink(link.ID, 1, "user3")
+	if err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if restored.DestinationURL != "https://v1.example.com" {
+		t.Errorf("Expected v1 destination after rollback, got %s", restored.DestinationURL)
+	}
+
+	latest, err := service.GetRevision(link.ID, 3)
+	if err != nil {
+		t.Fatalf("Expected rollback revision: %v", err)
+	}
+	if latest.RestoredFrom == nil || *latest.RestoredFrom != 1 {
+		t.Errorf("Expected revision 3 to be restored from 1, got %v", latest.RestoredFrom)
+	}
+}
+
+func TestService_RevisionsHidePasswordHash(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewService(NewRepository(db))
+	link, err := service.CreateLink(&Link{DestinationURL: "https://v1.example.com", CreatedBy: "user1", PasswordHash: "$2a$10$hash"}, "")
+	if err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	service.UpdateLink(link.ID, &Link{DestinationURL: "https://v2.example.com"}, "user2")
+
+	revisions, err := service.ListRevisions(link.ID)
+	if err != nil || len(revisions) != 2 {
+		t.Fatalf("ListRevisions = %d, %v", len(revisions), err)
+	}
+	for _, rev := range revisions {
+		if rev.Snapshot.PasswordHash != "" {
+			t.Errorf("Revision %d leaks the password hash", rev.Revision)
+		}
+	}
+	if rev, _ := service.GetRevision(link.ID, 1); rev.Snapshot.PasswordHash != "" {
+		t.Error("GetRevision leaks the password hash")
+	}
+
+	changes, err := service.DiffRevisions(link.ID, 0, 1)
+	if err != nil {
+		t.Fatalf("Failed to diff revisions: %v", err)
+	}
+	found := false
+	for _, c := range changes {
+		if c.Field == "password_hash" || c.From == "$2a$10$hash" || c.To == "$2a$10$hash" {
+			t.Errorf("Diff leaks the password hash: %+v", c)
+		}
+		if c.Field == "password_changed" {
+			found = c.From == nil && c.To == nil
+		}
+	}
+	if !found {
+		t.Errorf("Expected a bare password_changed marker, got %+v", changes)
+	}
+
+	// Rollback still restores from the stored snapshot, hash included
+	if _, err := service.RollbackLink(link.ID, 1, "user3"); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if restored, _ := service.GetLink(link.ID); restored.PasswordHash != "$2a$10$hash" {
+		t.Errorf("Rollback lost the password hash: %q", restored.PasswordHash)
+	}
+}
+
+func TestService_DestinationChangeResetsHealth(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewService(NewRepository(db))
+	link, err := service.CreateLink(&Link{DestinationURL: "https://old.example.com", CreatedBy: "user1"}, "")
+	if err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	healthRows := func() int {
+		var n int
+		db.QueryRow("SELECT COUNT(*) FROM link_health WHERE link_id = ?", link.ID).Scan(&n)
+		return n
+	}
+	if _, err := db.Exec("INSERT INTO link_health (link_id, url, broken, consecutive_failures, checked_at) VALUES (?, ?, 1, 5, 0)", link.ID, link.DestinationURL); err != nil {
+		t.Fatalf("Failed to insert health: %v", err)
+	}
+
+	// Other changes keep the record
+	service.UpdateLink(link.ID, &Link{Title: "Renamed"}, "user1")
+	if healthRows() != 1 {
+		t.Fatal("A title change cleared the health record")
+	}
+
+	service.UpdateLink(link.ID, &Link{DestinationURL: "https://new.example.com"}, "user1")
+	if healthRows() != 0 {
+		t.Error("A new destination kept the old health record")
+	}
+
+	db.Exec("INSERT INTO link_health (link_id, url, broken, consecutive_failures, checked_at) VALUES (?, ?, 1, 5, 0)", link.ID, "https://new.example.com")
+	if _, err := service.RollbackLink(link.ID, 1, "user1"); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if healthRows() != 0 {
+		t.Error("Rolling back the destination kept the health record")
+	}
+}
+
+type recordedEvent struct {
+	eventType string
+	event     *Event
+}
+
+type recordingEmitter struct {
+	events []recordedEvent
+}
+
+func (e *recordingEmitter) Emit(eventType string, data interface{}) {
+	e.events = append(e.events, recordedEvent{eventType, data.(*Event)})
+}
+
+func TestService_EmitsLinkEvents(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	emitter := &recordingEmitter{}
+	service := NewService(NewRepository(db)).WithEmitter(emitter)
+
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	link, err := service.CreateLink(&Link{DestinationURL: "https://v1.example.com", CreatedBy: "user1", PasswordHash: "secret", ExpiresAt: &expiresAt}, "launch")
+	if err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	service.UpdateLink(link.ID, &Link{Title: "Launch"}, "user2")
+	service.UpdateLink(link.ID, &Link{Title: "Launch"}, "user2") // No change, no event
+
+	other, _ := service.CreateLink(&Link{DestinationURL: "https://other.example.com", CreatedBy: "user1"}, "other")
+	if err := service.ArchiveLink(other.ID, "user3"); err != nil {
+		t.Fatalf("ArchiveLink failed: %v", err)
+	}
+	service.ArchiveLink(other.ID, "user3") // Already archived, no event
+
+	expired, err := service.ExpireLinks(expiresAt)
+	if err != nil || len(expired) != 1 || expired[0].ID != link.ID {
+		t.Fatalf("ExpireLinks = %v, %v; want the launch link", expired, err)
+	}
+	if expired, _ := service.ExpireLinks(expiresAt + 60); len(expired) != 0 {
+		t.Errorf("Expired links expired again: %v", expired)
+	}
+
+	want := []struct{ eventType, linkID, changedBy string }{
+		{"link.created", link.ID, ""},
+		{"link.updated", link.ID, "user2"},
+		{"link.created", other.ID, ""},
+		{"link.archived", other.ID, "user3"},
+		{"link.expired", link.ID, ExpiryActor},
+	}
+	if len(emitter.events) != len(want) {
+		t.Fatalf("Emitted %d events, want %d: %+v", len(emitter.events), len(want), emitter.events)
+	}
+	for i, w := range want {
+		got := emitter.events[i]
+		if got.eventType != w.eventType || got.event.Link.ID != w.linkID || got.event.ChangedBy != w.changedBy {
+			t.Errorf("Event %d = %s %s by %q, want %s %s by %q", i, got.eventType, got.event.Link.ID, got.event.ChangedBy, w.eventType, w.linkID, w.changedBy)
+		}
+		if got.event.Link.PasswordHash != "" {
+			t.Errorf("Event %d leaks the password hash", i)
+		}
+	}
+	if fields := emitter.events[1].event.ChangedFields; len(fields) != 1 || fields[0] != "title" {
+		t.Errorf("link.updated changed_fields = %v", fields)
+	}
+	if status := emitter.events[4].event.Link.Status; status != "archived" {
+		t.Errorf("Expired link status = %s", status)
+	}
+	if link, _ := service.GetLink(link.ID); link.PasswordHash != "secret" {
+		t.Errorf("Emitting cleared the stored password hash")
+	}
+
+	// Archiving is recorded like any other change, so it can be rolled back
+	revisions, _ := service.ListRevisions(other.ID)
+	if len(revisions) != 2 || revisions[0].ChangedBy != "user3" || len(revisions[0].ChangedFields) != 1 || revisions[0].ChangedFields[0] != "status" {
+		t.Fatalf("Revisions after archiving = %+v", revisions)
+	}
+	restored, err := service.RollbackLink(other.ID, revisions[1].Revision, "user1")
+	if err != nil || restored.Status != "active" {
+		t.Errorf("Rollback of archive = %+v, %v", restored, err)
+	}
+}
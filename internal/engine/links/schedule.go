@@ -0,0 +1,31 @@
+package links
+
+type ScheduledChange struct {
+	ID             string         `json:"id"`
+	LinkID         string         `json:"link_id"`
+	DestinationURL string         `json:"destination_url,omitempty"`
+	Rules          *RedirectRules `json:"rules,omitempty"`
+	Status         string         `json:"status,omitempty"` // active, paused
+	RunAt          int64          `json:"run_at"`
+	State          string         `json:"state"` // pending, applied, cancelled, failed
+	CreatedBy      string         `json:"created_by"`
+	LastError      string         `json:"last_error,omitempty"`
+	AppliedAt      *int64         `json:"applied_at,omitempty"`
+	CreatedAt      int64          `json:"created_at"`
+}
+
+const (
+	ScheduleStatePending   = "pending"
+	ScheduleStateApplied   = "applied"
+	ScheduleStateCancelled = "cancelled"
+	ScheduleStateFailed    = "failed"
+)
+
+// asUpdate converts the scheduled change into the partial link accepted by UpdateLink.
+func (c *ScheduledChange) asUpdate() *Link {
+	return &Link{
+		DestinationURL: c.DestinationURL,
+		Rules:          c.Rules,
+		Status:         c.Status,
+	}
+}
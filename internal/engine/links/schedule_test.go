@@ -0,0 +1,131 @@
+package links
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestService_ApplyDueChanges(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewService(NewRepository(db))
+
+	link, err := service.CreateLink(&Link{DestinationURL: "https://teaser.example.com", CreatedBy: "user1"}, "launch")
+	if err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	runAt := time.Now().Add(time.Hour).Unix()
+	if _, err := service.ScheduleChange(link.ID, &ScheduledChange{
+		DestinationURL: "https://launch.example.com",
+		RunAt:          runAt,
+		CreatedBy:      "user2",
+	}); err != nil {
+		t.Fatalf("Failed to schedule change: %v", err)
+	}
+	cancelled, err := service.ScheduleChange(link.ID, &ScheduledChange{Status: "paused", RunAt: runAt, CreatedBy: "user2"})
+	if err != nil {
+		t.Fatalf("Failed to schedule change: %v", err)
+	}
+	if err := service.CancelScheduledChange(link.ID, cancelled.ID); err != nil {
+		t.Fatalf("Failed to cancel change: %v", err)
+	}
+
+	// Nothing is due yet
+	applied, err := service.ApplyDueChanges(time.Now().Unix())
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("Expected no due changes, got %d (err %v)", len(applied), err)
+	}
+
+	applied, err = service.ApplyDueChanges(runAt)
+	if err != nil {
+		t.Fatalf("Failed to apply changes: %v", err)
+	}
+	if len(applied) != 1 || applied[0].State != ScheduleStateApplied {
+		t.Fatalf("Expected one applied change, got %+v", applied)
+	}
+
+	updated, _ := service.GetLink(link.ID)
+	if updated.DestinationURL != "https://launch.example.com" || updated.Status != "active" {
+		t.Errorf("Unexpected link after apply: %s %s", updated.DestinationURL, updated.Status)
+	}
+
+	rev, err := service.GetRevision(link.ID, 2)
+	if err != nil || rev.ChangedBy != "user2" {
+		t.Errorf("Expected revision 2 by user2, got %+v (err %v)", rev, err)
+	}
+}
+
+func TestService_ScheduleChangeValidation(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewService(NewRepository(db)).WithScreener(&PrivateAddressScreener{})
+	link, _ := service.CreateLink(&Link{DestinationURL: "https://example.com", CreatedBy: "user1"}, "")
+
+	future := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name   string
+		change *ScheduledChange
+	}{
+		{"Empty Change", &ScheduledChange{RunAt: future}},
+		{"Past RunAt", &ScheduledChange{Status: "paused", RunAt: time.Now().Add(-time.Hour).Unix()}},
+		{"Invalid Status", &ScheduledChange{Status: "archived", RunAt: future}},
+		{"Invalid Destination", &ScheduledChange{DestinationURL: "ftp://example.com", RunAt: future}},
+		{"Blocked Rule Destination", &ScheduledChange{Rules: &RedirectRules{Geo: map[string]string{"US": "http://169.254.169.254/"}}, RunAt: future}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.ScheduleChange(link.ID, tt.change)
+			var invalid *ValidationError
+			var screenErr *ScreeningError
+			if !errors.As(err, &invalid) && !errors.As(err, &screenErr) {
+				t.Errorf("Expected a validation or screening error, got %v", err)
+			}
+		})
+	}
+
+	if _, err := service.ScheduleChange("missing", &ScheduledChange{Status: "paused", RunAt: future}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for a missing link, got %v", err)
+	}
+}
+
+func TestService_ApplyDueChangesSkipsArchivedLinks(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewService(NewRepository(db))
+	link, err := service.CreateLink(&Link{DestinationURL: "https://example.com", CreatedBy: "user1"}, "")
+	if err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	runAt := time.Now().Add(time.Hour).Unix()
+	if _, err := service.ScheduleChange(link.ID, &ScheduledChange{Status: "active", RunAt: runAt, CreatedBy: "user1"}); err != nil {
+		t.Fatalf("Failed to schedule change: %v", err)
+	}
+	if err := service.ArchiveLink(link.ID, "user1"); err != nil {
+		t.Fatalf("Failed to archive link: %v", err)
+	}
+
+	applied, err := service.ApplyDueChanges(runAt)
+	if err != nil {
+		t.Fatalf("Failed to apply changes: %v", err)
+	}
+	if len(applied) != 1 || applied[0].State != ScheduleStateFailed {
+		t.Fatalf("Expected the change to fail, got %+v", applied)
+	}
+
+	archived, _ := service.GetLink(link.ID)
+	if archived.Status != "archived" {
+		t.Errorf("Scheduled change brought an archived link back as %s", archived.Status)
+	}
+
+	if _, err := service.ScheduleChange(link.ID, &ScheduledChange{Status: "active", RunAt: runAt, CreatedBy: "user1"}); err == nil {
+		t.Error("Expected scheduling on an archived link to fail")
+	}
+}
@@ -0,0 +1,412 @@
+package links
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"trackr/internal/pkg/netguard"
+	"trackr/internal/pkg/punycode"
+)
+
+// Screener inspects a destination URL and returns a *ScreeningError if the
+// destination must not be used.
+type Screener interface {
+	Screen(u *url.URL) error
+}
+
+type ScreeningError struct {
+	Screener string `json:"screener"`
+	Reason   string `json:"reason"`
+}
+
+func (e *ScreeningError) Error() string {
+	return "destination rejected: " + e.Reason
+}
+
+// ScreeningPipeline runs screeners in order and stops at the first rejection.
+type ScreeningPipeline []Screener
+
+func (p ScreeningPipeline) Screen(u *url.URL) error {
+	for _, s := range p {
+		if s == nil {
+			continue
+		}
+		if err := s.Screen(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PlatformScreeningOptions configures the screeners that apply to every organization.
+type PlatformScreeningOptions struct {
+	AllowDomains []string
+	DenyDomains  []string
+	ShortDomains []string // Our own redirect domains; linking to them creates loops
+	Blocklist    *Blocklist
+	LookupIP     func(host string) ([]net.IP, error) // Optional DNS resolution for private-address checks
+}
+
+func NewPlatformScreener(opts PlatformScreeningOptions) ScreeningPipeline {
+	pipeline := ScreeningPipeline{
+		&DomainListScreener{Source: "platform", Allow: opts.AllowDomains, Deny: opts.DenyDomains},
+		&ShortDomainScreener{Domains: opts.ShortDomains},
+		&PrivateAddressScreener{LookupIP: opts.LookupIP},
+		&HomographScreener{},
+	}
+	if opts.Blocklist != nil {
+		pipeline = append(pipeline, opts.Blocklist)
+	}
+	return pipeline
+}
+
+// DomainListScreener enforces allow/deny lists. Entries match the domain and all
+// of its subdomains. An empty allow list allows everything not denied.
+type DomainListScreener struct {
+	Source string // "platform" or "org", reported in rejections
+	Allow  []string
+	Deny   []string
+}
+
+func (s *DomainListScreener) Screen(u *url.URL) error {
+	host := normalizeHost(u.Hostname())
+
+	for _, d := range s.Deny {
+		if matchesDomain(host, d) {
+			return &ScreeningError{Screener: s.Source + "_deny_list", Reason: host + " is on the " + s.Source + " deny list"}
+		}
+	}
+
+	if len(s.Allow) == 0 {
+		return nil
+	}
+	for _, d := range s.Allow {
+		if matchesDomain(host, d) {
+			return nil
+		}
+	}
+	return &ScreeningError{Screener: s.Source + "_allow_list", Reason: host + " is not on the " + s.Source + " allow list"}
+}
+
+// ShortDomainScreener rejects destinations on our own short domains, which
+// would send visitors around a redirect loop.
+type ShortDomainScreener struct {
+	Domains []string
+}
+
+func (s *ShortDomainScreener) Screen(u *url.URL) error {
+	host := normalizeHost(u.Hostname())
+	for _, d := range s.Domains {
+		if d != "" && matchesDomain(host, d) {
+			return &ScreeningError{Screener: "redirect_loop", Reason: "destination points back to short domain " + d}
+		}
+	}
+	return nil
+}
+
+// PrivateAddressScreener rejects loopback, private, link-local and other
+// reserved destinations. Literal IPs (including the integer, hex, octal and
+// shorthand forms browsers accept) are always checked; hostnames are only
+// resolved when LookupIP is set.
+type PrivateAddressScreener struct {
+	LookupIP func(host string) ([]net.IP, error)
+}
+
+func (s *PrivateAddressScreener) Screen(u *url.URL) error {
+	host := normalizeHost(u.Hostname())
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return &ScreeningError{Screener: "private_address", Reason: "destination resolves to a loopback address"}
+	}
+
+	if ip := netguard.ParseHost(host); ip != nil {
+		return checkPublicIP(ip)
+	}
+
+	if s.LookupIP == nil {
+		return nil
+	}
+	ips, err := s.LookupIP(host)
+	if err != nil {
+		// Unresolvable hosts are the health checker's concern, not screening's
+		return nil
+	}
+	for _, ip := range ips {
+		if err := checkPublicIP(ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkPublicIP(ip net.IP) error {
+	if !netguard.IsPublic(ip) {
+		return &ScreeningError{Screener: "private_address", Reason: "destination " + ip.String() + " is not a public address"}
+	}
+	return nil
+}
+
+// HomographScreener rejects internationalised hostnames that imitate Latin
+// ones: labels mixing Latin with Cyrillic or Greek, and labels written entirely
+// in Cyrillic/Greek letters that are visually identical to Latin letters.
+type HomographScreener struct{}
+
+// latinLookalikes are Cyrillic and Greek letters rendered identically (or nearly so) to Latin ones.
+const latinLookalikes = "аеорсуxхіјѕԁӏԛԝһвкмнтαοрνυικτ"
+
+func (s *HomographScreener) Screen(u *url.URL) error {
+	for _, label := range strings.Split(normalizeHost(u.Hostname()), ".") {
+		decoded, err := punycode.ToUnicode(label)
+		if err != nil {
+			return &ScreeningError{Screener: "homograph", Reason: "malformed internationalised label " + label}
+		}
+		if isASCII(decoded) {
+			continue
+		}
+		if isHomograph(decoded) {
+			return &ScreeningError{Screener: "homograph", Reason: "hostname label " + label + " (" + decoded + ") imitates a Latin domain"}
+		}
+	}
+	return nil
+}
+
+func isHomograph(label string) bool {
+	var latin, cyrillic, greek, lookalike, letters int
+	for _, r := range label {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Greek, r):
+			greek++
+		}
+		if strings.ContainsRune(latinLookalikes, r) {
+			lookalike++
+		}
+	}
+
+	// Mixed Latin/Cyrillic/Greek within one label is never legitimate
+	scripts := 0
+	for _, n := range []int{latin, cyrillic, greek} {
+		if n > 0 {
+			scripts++
+		}
+	}
+	if scripts > 1 {
+		return true
+	}
+
+	// Whole-script confusable: every letter could pass for Latin
+	return (cyrillic > 0 || greek > 0) && lookalike == letters
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// Blocklist is a file-backed set of blocked domains (e.g. an imported phishing
+// feed). Lines may be bare domains or full URLs; '#' starts a comment.
+// Watch reloads the file whenever its modification time changes.
+type Blocklist struct {
+	path string
+
+	mu      sync.RWMutex
+	domains map[string]bool
+	modTime time.Time
+}
+
+func NewBlocklist(path string) (*Blocklist, error) {
+	b := &Blocklist{path: path, domains: map[string]bool{}}
+	if path == "" {
+		return b, nil
+	}
+	return b, b.Reload()
+}
+
+// Reload re-reads the file if it changed since the last load.
+func (b *Blocklist) Reload() error {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return err
+	}
+
+	b.mu.RLock()
+	unchanged := info.ModTime().Equal(b.modTime)
+	b.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	f, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	domains := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+		if strings.Contains(line, "://") {
+			if u, err := url.Parse(line); err == nil {
+				line = u.Hostname()
+			}
+		}
+		domains[normalizeHost(line)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.domains = domains
+	b.modTime = info.ModTime()
+	b.mu.Unlock()
+
+	log.Printf("Screening: loaded %d blocklist entries from %s", len(domains), b.path)
+	return nil
+}
+
+// Watch polls the file every interval until stop is closed.
+func (b *Blocklist) Watch(interval time.Duration, stop <-chan struct{}) {
+	if b.path == "" {
+		return
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.Reload(); err != nil {
+				log.Printf("Screening: failed to reload blocklist: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (b *Blocklist) Screen(u *url.URL) error {
+	host := normalizeHost(u.Hostname())
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	// Check the host and every parent domain
+	for h := host; h != ""; {
+		if b.domains[h] {
+			return &ScreeningError{Screener: "blocklist", Reason: host + " is on the blocklist"}
+		}
+		i := strings.IndexByte(h, '.')
+		if i < 0 {
+			break
+		}
+		h = h[i+1:]
+	}
+	return nil
+}
+
+// NewOrgScreener builds the organization's own allow/deny screener from its stored rules.
+func NewOrgScreener(rules []*ScreeningRule) *DomainListScreener {
+	s := &DomainListScreener{Source: "org"}
+	for _, rule := range rules {
+		switch rule.List {
+		case "allow":
+			s.Allow = append(s.Allow, rule.Domain)
+		case "deny":
+			s.Deny = append(s.Deny, rule.Domain)
+		}
+	}
+	return s
+}
+
+// ScreenerForOrg combines the organization's stored rules with the platform screener.
+// Org rules run first so an org deny is reported as such rather than by a platform check.
+func ScreenerForOrg(repo *Repository, platform Screener) (Screener, error) {
+	rules, err := repo.ListScreeningRules()
+	if err != nil {
+		return nil, err
+	}
+	return ScreeningPipeline{NewOrgScreener(rules), platform}, nil
+}
+
+type ScreeningRule struct {
+	ID        string `json:"id"`
+	List      string `json:"list"` // allow, deny
+	Domain    string `json:"domain"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type ScreeningFlag struct {
+	LinkID    string `json:"link_id"`
+	ShortCode string `json:"short_code"`
+	Screener  string `json:"screener"`
+	Reason    string `json:"reason"`
+	FlaggedAt int64  `json:"flagged_at"`
+}
+
+// screenDestinations runs the screener against the link's destination and
+// every rule destination, since rules can redirect visitors just as well.
+func screenDestinations(link *Link, screener Screener) error {
+	if screener == nil {
+		return nil
+	}
+
+	destinations := []string{link.DestinationURL}
+	if link.Rules != nil {
+		for _, dest := range link.Rules.Geo {
+			destinations = append(destinations, dest)
+		}
+		for _, dest := range link.Rules.Device {
+			destinations = append(destinations, dest)
+		}
+	}
+
+	for _, dest := range destinations {
+		u, err := url.Parse(dest)
+		if err != nil {
+			return &ScreeningError{Screener: "url", Reason: "invalid destination " + dest}
+		}
+		if err := screener.Screen(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+func matchesDomain(host, domain string) bool {
+	domain = normalizeHost(domain)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
@@ -0,0 +1,187 @@
+package links
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlatformScreener(t *testing.T) {
+	screener := NewPlatformScreener(PlatformScreeningOptions{
+		DenyDomains:  []string{"evil.example"},
+		ShortDomains: []string{"trk.io"},
+		LookupIP: func(host string) ([]net.IP, error) {
+			if host == "internal.example.com" {
+				return []net.IP{net.ParseIP("10.0.0.5")}, nil
+			}
+			return []net.IP{net.ParseIP("93.184.216.34")}, nil
+		},
+	})
+
+	tests := []struct {
+		url      string
+		screener string // empty means allowed
+	}{
+		{"https://example.com/page", ""},
+		{"https://evil.example/", "platform_deny_list"},
+		{"https://login.evil.example/", "platform_deny_list"},
+		{"https://notevil.example/", ""},
+		{"https://trk.io/abc123", "redirect_loop"},
+		{"http://127.0.0.1/admin", "private_address"},
+		{"http://[::1]:8080/", "private_address"},
+		{"http://192.168.1.1/", "private_address"},
+		{"http://169.254.169.254/latest/meta-data", "private_address"},
+		{"http://2130706433/", "private_address"},
+		{"http://0x7f.1/", "private_address"},
+		{"http://0177.0.0.1/", "private_address"},
+		{"http://127.1/", "private_address"},
+		{"http://100.64.1.1/", "private_address"},
+		{"http://0.0.0.0:8080/", "private_address"},
+		{"http://[::ffff:169.254.169.254]/", "private_address"},
+		{"http://198.18.0.1/", "private_address"},
+		{"http://localhost:3000/", "private_address"},
+		{"https://internal.example.com/", "private_address"},
+		{"https://xn--pple-43d.com/", "homograph"},   // Cyrillic 'а' in "apple"
+		{"https://xn--80ak6aa92e.com/", "homograph"}, // All-Cyrillic "аррӏе"
+		{"https://xn--mnchen-3ya.de/", ""},           // München
+		{"https://xn--e1afmkfd.xn--p1ai/", ""},       // пример.рф
+	}
+
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		err := screener.Screen(u)
+
+		var screenErr *ScreeningError
+		if tt.screener == "" {
+			if err != nil {
+				t.Errorf("Screen(%q) rejected: %v", tt.url, err)
+			}
+			continue
+		}
+		if !errors.As(err, &screenErr) || screenErr.Screener != tt.screener {
+			t.Errorf("Screen(%q) = %v, want %s rejection", tt.url, err, tt.screener)
+		}
+	}
+}
+
+func TestDomainListScreener_AllowList(t *testing.T) {
+	s := &DomainListScreener{Source: "org", Allow: []string{"example.com"}, Deny: []string{"bad.example.com"}}
+
+	for raw, allowed := range map[string]bool{
+		"https://example.com/":          true,
+		"https://shop.example.com/":     true,
+		"https://bad.example.com/":      false,
+		"https://other.org/":            false,
+		"https://example.com.evil.net/": false,
+	} {
+		u, _ := url.Parse(raw)
+		if err := s.Screen(u); (err == nil) != allowed {
+			t.Errorf("Screen(%q) = %v, want allowed=%v", raw, err, allowed)
+		}
+	}
+}
+
+func TestBlocklist_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("# phishing feed\nphish.example\nhttps://malware.example/payload.exe\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	blocklist, err := NewBlocklist(path)
+	if err != nil {
+		t.Fatalf("Failed to load blocklist: %v", err)
+	}
+
+	blocked := func(raw string) bool {
+		u, _ := url.Parse(raw)
+		return blocklist.Screen(u) != nil
+	}
+
+	if !blocked("https://phish.example/login") || !blocked("https://cdn.malware.example/") {
+		t.Error("Expected listed domains and their subdomains to be blocked")
+	}
+	if blocked("https://fresh.example/") {
+		t.Error("Did not expect fresh.example to be blocked yet")
+	}
+
+	// Rewrite with a later mtime so Reload picks it up
+	if err := os.WriteFile(path, []byte("fresh.example\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+
+	if err := blocklist.Reload(); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if !blocked("https://fresh.example/") || blocked("https://phish.example/") {
+		t.Error("Reload did not replace blocklist entries")
+	}
+}
+
+func TestService_ScreeningOnCreateAndRescreen(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	platform := &DomainListScreener{Source: "platform"}
+
+	if _, err := NewService(repo).AddScreeningRule(&ScreeningRule{List: "deny", Domain: "Competitor.com", CreatedBy: "user1"}); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	screener, err := ScreenerForOrg(repo, platform)
+	if err != nil {
+		t.Fatalf("Failed to build screener: %v", err)
+	}
+	service := NewService(repo).WithScreener(screener)
+
+	if _, err := service.CreateLink(&Link{DestinationURL: "https://www.competitor.com/", CreatedBy: "user1"}, ""); err == nil {
+		t.Error("Expected org deny rule to reject the link")
+	}
+
+	// Rules destinations are screened as well
+	rules := &RedirectRules{Geo: map[string]string{"US": "http://10.1.2.3/"}}
+	if _, err := NewService(repo).WithScreener(&PrivateAddressScreener{}).CreateLink(&Link{DestinationURL: "https://example.com", Rules: rules, CreatedBy: "user1"}, ""); err == nil {
+		t.Error("Expected private rule destination to be rejected")
+	}
+
+	link, err := service.CreateLink(&Link{DestinationURL: "https://partner.example/", CreatedBy: "user1"}, "partner")
+	if err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	// The partner domain is later added to the platform deny list
+	platform.Deny = []string{"partner.example"}
+
+	flags, err := service.FlagBlockedLinks()
+	if err != nil {
+		t.Fatalf("FlagBlockedLinks failed: %v", err)
+	}
+	if len(flags) != 1 || flags[0].LinkID != link.ID || flags[0].Screener != "platform_deny_list" {
+		t.Fatalf("Unexpected flags: %+v", flags)
+	}
+
+	paused, _ := service.GetLink(link.ID)
+	if paused.Status != "paused" {
+		t.Errorf("Expected link to be paused, got %s", paused.Status)
+	}
+	rev, err := service.GetRevision(link.ID, 2)
+	if err != nil || rev.ChangedBy != ScreeningActor {
+		t.Errorf("Expected screening revision, got %+v (err %v)", rev, err)
+	}
+
+	stored, err := service.ListScreeningFlags(10, 0)
+	if err != nil || len(stored) != 1 || stored[0].ShortCode != "partner" {
+		t.Errorf("Unexpected stored flags: %+v (err %v)", stored, err)
+	}
+
+	// Paused links are not flagged again
+	if flags, _ := service.FlagBlockedLinks(); len(flags) != 0 {
+		t.Errorf("Expected no new flags, got %d", len(flags))
+	}
+}
@@ -2,26 +2,71 @@ package links
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"trackr/internal/engine/webhooks"
 )
 
 type Service struct {
-	repo *Repository
+	repo     *Repository
+	screener Screener
+	emitter  Emitter
+}
+
+// Emitter raises webhook events; webhooks.OrgEmitter implements it.
+type Emitter interface {
+	Emit(eventType string, data interface{})
+}
+
+// Event is the data of the link.* webhook events.
+type Event struct {
+	Link          *Link    `json:"link"`
+	ChangedFields []string `json:"changed_fields,omitempty"`
+	ChangedBy     string   `json:"changed_by,omitempty"`
 }
 
 func NewService(repo *Repository) *Service {
 	return &Service{repo: repo}
 }
 
+// WithScreener sets the destination screening pipeline applied on every write.
+func (s *Service) WithScreener(screener Screener) *Service {
+	s.screener = screener
+	return s
+}
+
+// WithEmitter raises link.* webhook events for every change made through the service.
+func (s *Service) WithEmitter(emitter Emitter) *Service {
+	s.emitter = emitter
+	return s
+}
+
+// emit sends a link event without the password hash.
+func (s *Service) emit(eventType string, link *Link, changedFields []string, changedBy string) {
+	if s.emitter == nil {
+		return
+	}
+	public := *link
+	public.PasswordHash = ""
+	s.emitter.Emit(eventType, &Event{Link: &public, ChangedFields: changedFields, ChangedBy: changedBy})
+}
+
 func (s *Service) CreateLink(req *Link, customShortCode string) (*Link, error) {
-	if err := ValidateLink(req); err != nil {
+	if err := ValidateLink(req, s.screener); err != nil {
 		return nil, err
 	}
 
-	// Generate Short Code
-	shortCode, err := GenerateShortCode(customShortCode, s.repo)
+	// Generate Short Code under the organization's policy
+	policy, err := s.repo.GetShortCodePolicy()
+	if err != nil {
+		return nil, err
+	}
+	s.repo.UseCaseInsensitiveCodes(policy.CaseInsensitive)
+
+	shortCode, err := policy.Generate(customShortCode, s.repo)
 	if err != nil {
 		return nil, err
 	}
@@ -48,18 +93,68 @@ func (s *Service) CreateLink(req *Link, customShortCode string) (*Link, error) {
 		link.RedirectType = "temporary"
 	}
 
-	if err := s.repo.Create(link); err != nil {
+	initial := &Revision{
+		ChangedBy:     link.CreatedBy,
+		ChangedFields: changedFieldNames(DiffLinks(nil, link)),
+	}
+	if err := s.repo.CreateWithRevision(link, initial); err != nil {
 		return nil, err
 	}
+	s.emit(webhooks.EventLinkCreated, link, nil, "")
 
 	return link, nil
 }
 
+func (s *Service) GetShortCodePolicy() (*ShortCodePolicy, error) {
+	return s.repo.GetShortCodePolicy()
+}
+
+// UpdateShortCodePolicy only affects codes created afterwards; existing links keep their codes.
+func (s *Service) UpdateShortCodePolicy(policy *ShortCodePolicy) (*ShortCodePolicy, error) {
+	policy.Normalize()
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveShortCodePolicy(policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// CheckShortCodeAvailability reports whether seed.Code can be used and suggests
+// available alternatives derived from the title and destination.
+func (s *Service) CheckShortCodeAvailability(seed SuggestionSeed, synonyms Synonyms, limit int) (*Availability, error) {
+	policy, err := s.repo.GetShortCodePolicy()
+	if err != nil {
+		return nil, err
+	}
+	s.repo.UseCaseInsensitiveCodes(policy.CaseInsensitive)
+
+	result := &Availability{Code: policy.NormalizeCode(seed.Code)}
+	if seed.Code != "" {
+		if err := policy.CheckCustomCode(result.Code); err != nil {
+			result.Reason = err.Error()
+		} else if exists, err := s.repo.ExistsByShortCode(result.Code); err != nil {
+			return nil, err
+		} else if exists {
+			result.Reason = "short code already taken"
+		} else {
+			result.Available = true
+		}
+	}
+
+	result.Suggestions, err = SuggestShortCodes(policy, s.repo, seed, synonyms, limit)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (s *Service) GetLink(id string) (*Link, error) {
 	return s.repo.GetByID(id)
 }
 
-func (s *Service) UpdateLink(id string, updates *Link) (*Link, error) {
+func (s *Service) UpdateLink(id string, updates *Link, updatedBy string) (*Link, error) {
 	existing, err := s.repo.GetByID(id)
 	if err != nil {
 		return nil, err
@@ -67,44 +162,454 @@ func (s *Service) UpdateLink(id string, updates *Link) (*Link, error) {
 	if existing == nil {
 		return nil, errors.New("link not found")
 	}
+	before := *existing
 
-	// Apply updates
+	applyUpdates(existing, updates)
+
+	// Validate again before saving
+	if err := ValidateLink(existing, s.screener); err != nil {
+		return nil, err
+	}
+
+	return s.saveRevision(&before, existing, updatedBy, nil, webhooks.EventLinkUpdated)
+}
+
+// applyUpdates copies the fields set in updates onto link.
+func applyUpdates(link, updates *Link) {
 	if updates.DestinationURL != "" {
-		existing.DestinationURL = updates.DestinationURL
+		link.DestinationURL = updates.DestinationURL
 	}
 	if updates.Title != "" {
-		existing.Title = updates.Title
+		link.Title = updates.Title
 	}
 	if updates.RedirectType != "" {
-		existing.RedirectType = updates.RedirectType
+		link.RedirectType = updates.RedirectType
 	}
 	if updates.Status != "" {
-		existing.Status = updates.Status
+		link.Status = updates.Status
 	}
 	if updates.Rules != nil {
-		existing.Rules = updates.Rules
+		link.Rules = updates.Rules
 	}
 	if updates.DefaultUTMParams != nil {
-		existing.DefaultUTMParams = updates.DefaultUTMParams
+		link.DefaultUTMParams = updates.DefaultUTMParams
 	}
 	// ... other fields
+}
 
-	// Validate again before saving
-	if err := ValidateLink(existing); err != nil {
+// ListRevisions returns the link's history without password hashes.
+func (s *Service) ListRevisions(linkID string) ([]*Revision, error) {
+	revisions, err := s.repo.ListRevisions(linkID)
+	if err != nil {
+		return nil, err
+	}
+	for i, rev := range revisions {
+		revisions[i] = rev.redacted()
+	}
+	return revisions, nil
+}
+
+// GetRevision returns one revision without its password hash.
+func (s *Service) GetRevision(linkID string, revision int) (*Revision, error) {
+	rev, err := s.repo.GetRevision(linkID, revision)
+	if err != nil {
+		return nil, err
+	}
+	return rev.redacted(), nil
+}
+
+// DiffRevisions reports what changed going from revision `from` to revision `to`.
+// A `from` of 0 diffs against an empty link.
+func (s *Service) DiffRevisions(linkID string, from, to int) ([]FieldChange, error) {
+	target, err := s.repo.GetRevision(linkID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var base *Link
+	if from > 0 {
+		rev, err := s.repo.GetRevision(linkID, from)
+		if err != nil {
+			return nil, err
+		}
+		base = rev.Snapshot
+	}
+
+	return DiffLinks(base, target.Snapshot), nil
+}
+
+// RollbackLink restores the tracked fields of a previous revision. The rollback
+// itself is recorded as a new revision, so history is never rewritten.
+func (s *Service) RollbackLink(id string, revision int, rolledBackBy string) (*Link, error) {
+	existing, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	before := *existing
+
+	rev, err := s.repo.GetRevision(id, revision)
+	if err != nil {
 		return nil, err
 	}
 
-	if err := s.repo.Update(existing); err != nil {
+	restoreFields(existing, rev.Snapshot)
+	if err := ValidateLink(existing, s.screener); err != nil {
 		return nil, err
 	}
 
-	return existing, nil
+	return s.saveRevision(&before, existing, rolledBackBy, &revision, webhooks.EventLinkUpdated)
 }
 
-func (s *Service) ArchiveLink(id string) error {
-	return s.repo.Delete(id)
+// saveRevision persists the link only when a tracked field actually changed,
+// so no-op updates do not pad the history, and raises eventType for the change.
+func (s *Service) saveRevision(before, after *Link, changedBy string, restoredFrom *int, eventType string) (*Link, error) {
+	changes := DiffLinks(before, after)
+	if len(changes) == 0 {
+		return after, nil
+	}
+
+	rev := &Revision{
+		ChangedBy:     changedBy,
+		ChangedFields: changedFieldNames(changes),
+		RestoredFrom:  restoredFrom,
+	}
+	if err := s.repo.UpdateWithRevision(after, rev); err != nil {
+		return nil, err
+	}
+	s.emit(eventType, after, rev.ChangedFields, changedBy)
+
+	return after, nil
+}
+
+// ArchiveLink archives the link, recording a revision so it can be rolled
+// back, and raises link.archived.
+func (s *Service) ArchiveLink(id string, archivedBy string) error {
+	link, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	before := *link
+	link.Status = "archived"
+	_, err = s.saveRevision(&before, link, archivedBy, nil, webhooks.EventLinkArchived)
+	return err
+}
+
+// ExpiryActor is recorded as the author of revisions made by link expiry.
+const ExpiryActor = "system:expiry"
+
+// ExpireLinks archives every active or paused link whose expires_at is at or
+// before now, recording a revision and raising link.expired for each.
+func (s *Service) ExpireLinks(now int64) ([]*Link, error) {
+	due, err := s.repo.ListExpired(now)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := []*Link{}
+	for _, link := range due {
+		before := *link
+		link.Status = "archived"
+		if _, err := s.saveRevision(&before, link, ExpiryActor, nil, webhooks.EventLinkExpired); err != nil {
+			return expired, err
+		}
+		expired = append(expired, link)
+	}
+	return expired, nil
 }
 
 func (s *Service) ListLinks(limit, offset int) ([]*Link, error) {
 	return s.repo.List(limit, offset)
 }
+
+// ScheduleChange queues a destination/rules/status change on a link for a future time.
+func (s *Service) ScheduleChange(linkID string, change *ScheduledChange) (*ScheduledChange, error) {
+	if change.DestinationURL == "" && change.Rules == nil && change.Status == "" {
+		return nil, &ValidationError{Reason: "scheduled change must set destination_url, rules or status"}
+	}
+	if change.Status != "" && change.Status != "active" && change.Status != "paused" {
+		return nil, &ValidationError{Reason: "status must be 'active' or 'paused'"}
+	}
+	if change.RunAt <= time.Now().Unix() {
+		return nil, &ValidationError{Reason: "run_at must be in the future"}
+	}
+
+	existing, err := s.repo.GetByID(linkID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Status == "archived" {
+		return nil, errLinkArchived
+	}
+
+	// Validate the link as it would look once the change is applied, rule
+	// destinations included
+	candidate := *existing
+	applyUpdates(&candidate, change.asUpdate())
+	if err := ValidateLink(&candidate, s.screener); err != nil {
+		return nil, err
+	}
+
+	change.LinkID = linkID
+	if err := s.repo.CreateScheduledChange(change); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+func (s *Service) ListScheduledChanges(linkID string) ([]*ScheduledChange, error) {
+	return s.repo.ListScheduledChanges(linkID)
+}
+
+func (s *Service) CancelScheduledChange(linkID, changeID string) error {
+	cancelled, err := s.repo.CancelScheduledChange(linkID, changeID)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return errors.New("scheduled change not found or no longer pending")
+	}
+	return nil
+}
+
+// errLinkArchived refuses changes to links that were deleted or expired, so a
+// scheduled "active" cannot bring them back.
+var errLinkArchived = &ValidationError{Reason: "link is archived"}
+
+// ApplyDueChanges applies every pending change whose run_at has passed. Each change
+// goes through UpdateLink so it is validated and recorded as a revision by the
+// user who scheduled it. A failing change is marked failed and does not stop the
+// rest; so is a change to a link archived since it was scheduled.
+func (s *Service) ApplyDueChanges(now int64) ([]*ScheduledChange, error) {
+	due, err := s.repo.ListDueScheduledChanges(now, 500)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range due {
+		link, err := s.repo.GetByID(change.LinkID)
+		if err == nil && link.Status == "archived" {
+			err = errLinkArchived
+		}
+		if err == nil {
+			_, err = s.UpdateLink(change.LinkID, change.asUpdate(), change.CreatedBy)
+		}
+		if err != nil {
+			change.State = ScheduleStateFailed
+			change.LastError = err.Error()
+		} else {
+			change.State = ScheduleStateApplied
+		}
+
+		if err := s.repo.MarkScheduledChange(change.ID, change.State, change.LastError); err != nil {
+			return due, err
+		}
+	}
+
+	return due, nil
+}
+
+// ScreeningActor is recorded as the author of revisions made by screening.
+const ScreeningActor = "system:screening"
+
+// FlagBlockedLinks re-screens every active link and pauses those that no longer
+// pass, e.g. because their domain was added to a blocklist after creation. The
+// pause bypasses validation (the link would fail it) but is still recorded as a revision.
+func (s *Service) FlagBlockedLinks() ([]*ScreeningFlag, error) {
+	if s.screener == nil {
+		return nil, nil
+	}
+
+	active, err := s.repo.ListActive()
+	if err != nil {
+		return nil, err
+	}
+
+	flags := []*ScreeningFlag{}
+	for _, link := range active {
+		err := screenDestinations(link, s.screener)
+		var screenErr *ScreeningError
+		if !errors.As(err, &screenErr) {
+			continue
+		}
+
+		before := *link
+		link.Status = "paused"
+		if _, err := s.saveRevision(&before, link, ScreeningActor, nil, webhooks.EventLinkUpdated); err != nil {
+			return flags, err
+		}
+
+		flag := &ScreeningFlag{
+			LinkID:    link.ID,
+			ShortCode: link.ShortCode,
+			Screener:  screenErr.Screener,
+			Reason:    screenErr.Reason,
+			FlaggedAt: time.Now().Unix(),
+		}
+		if err := s.repo.CreateScreeningFlag(flag); err != nil {
+			return flags, err
+		}
+		flags = append(flags, flag)
+	}
+
+	return flags, nil
+}
+
+func (s *Service) ListScreeningRules() ([]*ScreeningRule, error) {
+	return s.repo.ListScreeningRules()
+}
+
+func (s *Service) AddScreeningRule(rule *ScreeningRule) (*ScreeningRule, error) {
+	if rule.List != "allow" && rule.List != "deny" {
+		return nil, errors.New("list must be 'allow' or 'deny'")
+	}
+	rule.Domain = normalizeHost(rule.Domain)
+	if rule.Domain == "" || strings.ContainsAny(rule.Domain, "/: ") {
+		return nil, errors.New("domain must be a bare hostname")
+	}
+	if err := s.repo.CreateScreeningRule(rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (s *Service) DeleteScreeningRule(id string) error {
+	deleted, err := s.repo.DeleteScreeningRule(id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errors.New("screening rule not found")
+	}
+	return nil
+}
+
+func (s *Service) ListScreeningFlags(limit, offset int) ([]*ScreeningFlag, error) {
+	return s.repo.ListScreeningFlags(limit, offset)
+}
+
+func (s *Service) ListQRVariants(linkID string) ([]*QRVariant, error) {
+	return s.repo.ListQRVariants(linkID)
+}
+
+func (s *Service) CreateQRVariant(v *QRVariant) (*QRVariant, error) {
+	v.Name = strings.ToLower(strings.TrimSpace(v.Name))
+	if !IsValidQRVariantName(v.Name) {
+		return nil, errors.New("variant name must be 1-32 lowercase letters, digits, '-' or '_'")
+	}
+	if v.Name == DefaultQRVariant {
+		return nil, errors.New("'default' is reserved for QR codes without a named variant")
+	}
+	if _, err := s.repo.GetByID(v.LinkID); err != nil {
+		return nil, errors.New("link not found")
+	}
+
+	exists, err := s.repo.QRVariantExists(v.LinkID, v.Name)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, errors.New("variant already exists for this link")
+	}
+
+	if err := s.repo.CreateQRVariant(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s *Service) DeleteQRVariant(linkID, id string) error {
+	deleted, err := s.repo.DeleteQRVariant(linkID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errors.New("QR variant not found")
+	}
+	return nil
+}
+
+// QRCodeContent returns what a link's QR code should encode for the named
+// variant. An empty name or "default" needs no registered variant.
+func (s *Service) QRCodeContent(link *Link, shortURL, variant string) (string, error) {
+	variant = strings.ToLower(variant)
+	if variant != "" && variant != DefaultQRVariant {
+		exists, err := s.repo.QRVariantExists(link.ID, variant)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return "", errors.New("QR variant not found")
+		}
+	}
+	return QRVariantURL(shortURL, variant), nil
+}
+
+// QRBatch resolves a batch filter into the QR codes to render. shortURL builds
+// a link's public short URL.
+func (s *Service) QRBatch(filter *QRBatchFilter, shortURL func(*Link) string) ([]QRBatchItem, error) {
+	if err := validateQRBatchFilter(filter); err != nil {
+		return nil, err
+	}
+
+	var batch []*Link
+	var err error
+	if len(filter.LinkIDs) > 0 {
+		batch, err = s.repo.ListByIDs(filter.LinkIDs)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) != len(uniqueStrings(filter.LinkIDs)) {
+			found := map[string]bool{}
+			for _, link := range batch {
+				found[link.ID] = true
+			}
+			var missing []string
+			for _, id := range filter.LinkIDs {
+				if !found[id] {
+					missing = append(missing, id)
+				}
+			}
+			return nil, errors.New("links not found: " + strings.Join(missing, ", "))
+		}
+	} else {
+		// Fetch one extra so an oversized campaign is reported rather than truncated
+		batch, err = s.repo.ListByCampaign(filter.UTMCampaign, MaxQRBatchSize+1)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) > MaxQRBatchSize {
+			return nil, fmt.Errorf("campaign has more than %d links; select them by ID in smaller batches", MaxQRBatchSize)
+		}
+		if len(batch) == 0 {
+			return nil, errors.New("no links found for campaign")
+		}
+	}
+
+	items := make([]QRBatchItem, 0, len(batch))
+	for _, link := range batch {
+		url := shortURL(link)
+		content, err := s.QRCodeContent(link, url, filter.Variant)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", link.ShortCode, err)
+		}
+		items = append(items, QRBatchItem{
+			ShortCode:      link.ShortCode,
+			ShortURL:       url,
+			DestinationURL: link.DestinationURL,
+			Content:        content,
+		})
+	}
+	return items, nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
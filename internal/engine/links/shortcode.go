@@ -1,10 +1,10 @@
 package links
 
 import (
+	"crypto/rand"
 	"errors"
-	"math/rand"
+	"math/big"
 	"strings"
-	"time"
 )
 
 const (
@@ -12,23 +12,127 @@ const (
 	shortCodeLength = 7
 )
 
+// Alphabet presets selectable by name in a short-code policy.
+var shortCodeAlphabets = map[string]string{
+	"default":               shortCodeChars,
+	"unambiguous":           "abcdefghjkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789", // No 0/O, 1/l/I
+	"lowercase":             "abcdefghijklmnopqrstuvwxyz0123456789",
+	"lowercase_unambiguous": "abcdefghjkmnpqrstuvwxyz23456789",
+}
+
+// systemReservedCodes collide with our own routes and can never be used.
+var systemReservedCodes = []string{"api", "admin", "dashboard", "login", "signup", "health", "metrics"}
+
 type CodeAvailabilityChecker interface {
 	ExistsByShortCode(code string) (bool, error)
 }
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
+// ShortCodePolicy controls how an organization's short codes are generated and
+// which custom codes are accepted.
+type ShortCodePolicy struct {
+	Length          int      `json:"length"`           // Length of the random part of generated codes
+	Alphabet        string   `json:"alphabet"`         // Characters used for generated codes
+	CaseInsensitive bool     `json:"case_insensitive"` // Codes are stored lowercase and matched ignoring case
+	Prefix          string   `json:"prefix,omitempty"` // Namespace ("mkt-" or "sales/") prepended to generated codes and required on custom ones
+	ReservedWords   []string `json:"reserved_words"`   // Exact codes the org does not allow
+	BlockedWords    []string `json:"blocked_words"`    // Substrings (e.g. profanity) rejected anywhere in a code
+	UpdatedBy       string   `json:"updated_by,omitempty"`
+	UpdatedAt       int64    `json:"updated_at,omitempty"`
 }
 
-func GenerateShortCode(customCode string, checker CodeAvailabilityChecker) (string, error) {
+// DefaultShortCodePolicy matches the behaviour before policies were configurable.
+func DefaultShortCodePolicy() *ShortCodePolicy {
+	return &ShortCodePolicy{
+		Length:        shortCodeLength,
+		Alphabet:      shortCodeChars,
+		ReservedWords: []string{},
+		BlockedWords:  []string{},
+	}
+}
+
+// Normalize resolves alphabet presets, removes duplicate characters and folds
+// everything to lowercase for case-insensitive policies.
+func (p *ShortCodePolicy) Normalize() {
+	if preset, ok := shortCodeAlphabets[p.Alphabet]; ok {
+		p.Alphabet = preset
+	}
+	if p.CaseInsensitive {
+		p.Alphabet = strings.ToLower(p.Alphabet)
+		p.Prefix = strings.ToLower(p.Prefix)
+	}
+
+	seen := map[rune]bool{}
+	var b strings.Builder
+	for _, c := range p.Alphabet {
+		if !seen[c] {
+			seen[c] = true
+			b.WriteRune(c)
+		}
+	}
+	p.Alphabet = b.String()
+
+	p.ReservedWords = normalizeWords(p.ReservedWords)
+	p.BlockedWords = normalizeWords(p.BlockedWords)
+}
+
+func (p *ShortCodePolicy) Validate() error {
+	// Case-insensitive codes are stored lowercase, so the prefix they must start with is too
+	if p.CaseInsensitive {
+		p.Prefix = strings.ToLower(p.Prefix)
+	}
+	if p.Length < 4 || p.Length > 12 {
+		return errors.New("length must be between 4 and 12")
+	}
+	if len(p.Alphabet) < 10 {
+		return errors.New("alphabet must contain at least 10 distinct characters")
+	}
+	for _, c := range p.Alphabet {
+		if !isAlphanumeric(c) {
+			return errors.New("alphabet may only contain letters and digits")
+		}
+	}
+	if len(p.Prefix) > 16 {
+		return errors.New("prefix must be at most 16 characters")
+	}
+	for _, c := range p.Prefix {
+		if !isAlphanumeric(c) && c != '-' && c != '_' && c != '/' {
+			return errors.New("prefix may only contain letters, digits, '-', '_' and '/'")
+		}
+	}
+	// A '/' makes the prefix a path namespace ("sales/"), so it must be a clean path
+	if strings.Contains(p.Prefix, "/") && CleanRequestPath(p.Prefix)+"/" != p.Prefix {
+		return errors.New("a namespace prefix must look like 'team/' or 'team/sub/'")
+	}
+	// Every code starts with the prefix, so its first segment must not shadow our routes
+	first, _, _ := strings.Cut(p.Prefix, "/")
+	for _, r := range systemReservedCodes {
+		if strings.EqualFold(first, r) {
+			return errors.New("prefix must not start with the reserved word " + r)
+		}
+	}
+	return nil
+}
+
+// NormalizeCode returns the form a code is stored and looked up in.
+func (p *ShortCodePolicy) NormalizeCode(code string) string {
+	if p.CaseInsensitive {
+		return strings.ToLower(code)
+	}
+	return code
+}
+
+// Generate returns customCode if it is valid and available, otherwise a new
+// random code from the policy's alphabet.
+func (p *ShortCodePolicy) Generate(customCode string, checker CodeAvailabilityChecker) (string, error) {
 	// Use custom code if provided
 	if customCode != "" {
-		if !isValidShortCode(customCode) {
-			return "", errors.New("invalid short code format")
+		code := p.NormalizeCode(customCode)
+		if err := p.CheckCustomCode(code); err != nil {
+			return "", err
 		}
 
 		// Check availability
-		exists, err := checker.ExistsByShortCode(customCode)
+		exists, err := checker.ExistsByShortCode(code)
 		if err != nil {
 			return "", err
 		}
@@ -36,13 +140,19 @@ func GenerateShortCode(customCode string, checker CodeAvailabilityChecker) (stri
 			return "", errors.New("short code already taken")
 		}
 
-		return customCode, nil
+		return code, nil
 	}
 
 	// Generate random code with collision retry
 	maxRetries := 5
 	for i := 0; i < maxRetries; i++ {
-		code := generateRandomCode(shortCodeLength)
+		code, err := p.randomCode(p.Length)
+		if err != nil {
+			return "", err
+		}
+		if p.containsBlockedWord(code) {
+			continue
+		}
 
 		exists, err := checker.ExistsByShortCode(code)
 		if err != nil {
@@ -55,45 +165,128 @@ func GenerateShortCode(customCode string, checker CodeAvailabilityChecker) (stri
 
 	// If collisions persist, increase length
 	// Try one more time with +1 length
-	code := generateRandomCode(shortCodeLength + 1)
+	code, err := p.randomCode(p.Length + 1)
+	if err != nil {
+		return "", err
+	}
 	exists, err := checker.ExistsByShortCode(code)
 	if err != nil {
 		return "", err
 	}
-	if exists {
+	if exists || p.containsBlockedWord(code) {
 		return "", errors.New("failed to generate unique short code")
 	}
 
 	return code, nil
 }
 
-func generateRandomCode(length int) string {
+// CheckCustomCode reports why a user-chosen code is not allowed under this policy.
+func (p *ShortCodePolicy) CheckCustomCode(code string) error {
+	rest := code
+	if prefix := p.NormalizeCode(p.Prefix); prefix != "" {
+		if !strings.HasPrefix(p.NormalizeCode(code), prefix) {
+			return errors.New("short code must start with " + prefix)
+		}
+		rest = code[len(prefix):]
+	}
+
+	if !isValidShortCode(rest) {
+		return errors.New("invalid short code format")
+	}
+
+	for _, word := range p.ReservedWords {
+		if strings.EqualFold(code, word) || strings.EqualFold(rest, word) {
+			return errors.New("short code is reserved")
+		}
+	}
+	if p.containsBlockedWord(code) {
+		return errors.New("short code contains a blocked word")
+	}
+	return nil
+}
+
+func (p *ShortCodePolicy) containsBlockedWord(code string) bool {
+	lower := strings.ToLower(code)
+	for _, word := range p.BlockedWords {
+		if word != "" && strings.Contains(lower, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// randomCode draws from crypto/rand; rand.Int avoids the modulo bias of
+// indexing the alphabet with a raw byte.
+func (p *ShortCodePolicy) randomCode(length int) (string, error) {
+	max := big.NewInt(int64(len(p.Alphabet)))
 	b := make([]byte, length)
 	for i := range b {
-		b[i] = shortCodeChars[rand.Intn(len(shortCodeChars))]
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = p.Alphabet[n.Int64()]
 	}
-	return string(b)
+	return p.NormalizeCode(p.Prefix) + string(b), nil
 }
 
+// GenerateShortCode generates a code under the default policy.
+func GenerateShortCode(customCode string, checker CodeAvailabilityChecker) (string, error) {
+	return DefaultShortCodePolicy().Generate(customCode, checker)
+}
+
+// isValidShortCode accepts single-segment alphanumeric codes of 3-12 characters,
+// or multi-segment paths ("summer/shoes", "docs/*") whose segments may also
+// use '-' and '_'. A wildcard is only allowed as the last of several segments.
 func isValidShortCode(code string) bool {
-	if len(code) < 3 || len(code) > 12 {
-		return false
-	}
+	segments := strings.Split(code, "/")
+
+	if len(segments) == 1 {
+		if len(code) < 3 || len(code) > 12 {
+			return false
+		}
 
-	// Only alphanumeric
-	for _, c := range code {
-		if !strings.ContainsRune(shortCodeChars, c) {
+		// Only alphanumeric
+		for _, c := range code {
+			if !isAlphanumeric(c) {
+				return false
+			}
+		}
+	} else {
+		if len(segments) > maxCodeSegments || len(code) > maxShortCodeLength {
 			return false
 		}
+		for i, segment := range segments {
+			if segment == WildcardSegment && i == len(segments)-1 {
+				continue
+			}
+			if !isValidCodeSegment(segment) {
+				return false
+			}
+		}
 	}
 
-	// Reserved codes
-	reserved := []string{"api", "admin", "dashboard", "login", "signup", "health", "metrics"}
-	for _, r := range reserved {
-		if strings.EqualFold(code, r) {
+	// Reserved codes; the first segment would shadow our own routes
+	for _, r := range systemReservedCodes {
+		if strings.EqualFold(segments[0], r) {
 			return false
 		}
 	}
 
 	return true
 }
+
+func isAlphanumeric(c rune) bool {
+	return strings.ContainsRune(shortCodeChars, c)
+}
+
+func normalizeWords(words []string) []string {
+	out := []string{}
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if w != "" {
+			out = append(out, w)
+		}
+	}
+	return out
+}
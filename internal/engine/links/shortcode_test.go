@@ -2,6 +2,7 @@ package links
 
 import (
 	"errors"
+	"strings"
 	"testing"
 )
 
@@ -47,3 +48,131 @@ func TestGenerateShortCode(t *testing.T) {
 		t.Errorf("Expected length %d, got %d", shortCodeLength, len(code))
 	}
 }
+
+func TestShortCodePolicy_Generate(t *testing.T) {
+	policy := &ShortCodePolicy{
+		Length:          6,
+		Alphabet:        "lowercase_unambiguous",
+		CaseInsensitive: true,
+		Prefix:          "MKT-",
+		ReservedWords:   []string{"pricing"},
+		BlockedWords:    []string{"Darn"},
+	}
+	policy.Normalize()
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	checker := &MockChecker{codes: map[string]bool{"mkt-taken": true}}
+
+	for i := 0; i < 50; i++ {
+		code, err := policy.Generate("", checker)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.HasPrefix(code, "mkt-") || len(code) != len("mkt-")+6 {
+			t.Fatalf("Unexpected generated code %q", code)
+		}
+		if strings.ContainsAny(code[4:], "01lioABC") {
+			t.Fatalf("Generated code %q uses characters outside the alphabet", code)
+		}
+	}
+
+	tests := []struct {
+		custom  string
+		want    string
+		wantErr bool
+	}{
+		{"MKT-Summer", "mkt-summer", false},
+		{"summer", "", true},      // Missing prefix
+		{"mkt-TAKEN", "", true},   // Taken, ignoring case
+		{"mkt-pricing", "", true}, // Org reserved word
+		{"mkt-darnit", "", true},  // Blocked substring
+		{"mkt-a", "", true},       // Too short after prefix
+		{"mkt-sale!", "", true},   // Invalid character
+	}
+	for _, tt := range tests {
+		code, err := policy.Generate(tt.custom, checker)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Generate(%q) error = %v, wantErr %v", tt.custom, err, tt.wantErr)
+			continue
+		}
+		if code != tt.want {
+			t.Errorf("Generate(%q) = %q, want %q", tt.custom, code, tt.want)
+		}
+	}
+}
+
+func TestShortCodePolicy_Validate(t *testing.T) {
+	bad := []*ShortCodePolicy{
+		{Length: 3, Alphabet: "default"},
+		{Length: 7, Alphabet: "abc123"},
+		{Length: 7, Alphabet: "abcdefghij-"},
+		{Length: 7, Alphabet: "default", Prefix: "a/b"},
+		{Length: 7, Alphabet: "default", Prefix: "api/"},
+		{Length: 7, Alphabet: "default", Prefix: "Health"},
+		{Length: 7, Alphabet: "default", Prefix: "admin/team/"},
+	}
+	for _, p := range bad {
+		p.Normalize()
+		if err := p.Validate(); err == nil {
+			t.Errorf("Expected validation error for %+v", p)
+		}
+	}
+}
+
+func TestShortCodePolicy_ValidateLowercasesPrefix(t *testing.T) {
+	// Validated without Normalize, e.g. a policy built in code
+	policy := &ShortCodePolicy{Length: 6, Alphabet: shortCodeChars, CaseInsensitive: true, Prefix: "Mkt-"}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	if policy.Prefix != "mkt-" {
+		t.Errorf("Prefix = %q, want mkt-", policy.Prefix)
+	}
+
+	// A mixed-case prefix loaded as stored still accepts custom codes
+	loaded := &ShortCodePolicy{Length: 6, Alphabet: shortCodeChars, CaseInsensitive: true, Prefix: "Mkt-"}
+	if err := loaded.CheckCustomCode(loaded.NormalizeCode("MKT-Spring")); err != nil {
+		t.Errorf("CheckCustomCode rejected a matching code: %v", err)
+	}
+}
+
+func TestService_CaseInsensitivePolicy(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewService(NewRepository(db))
+
+	if _, err := service.CreateLink(&Link{DestinationURL: "https://example.com", CreatedBy: "user1"}, "Promo"); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	// Case-sensitive by default: a differently cased code is a different code
+	if _, err := service.CreateLink(&Link{DestinationURL: "https://example.com", CreatedBy: "user1"}, "promo"); err != nil {
+		t.Fatalf("Expected promo to be available under the default policy: %v", err)
+	}
+
+	policy := DefaultShortCodePolicy()
+	policy.CaseInsensitive = true
+	if _, err := service.UpdateShortCodePolicy(policy); err != nil {
+		t.Fatalf("Failed to update policy: %v", err)
+	}
+
+	if _, err := service.CreateLink(&Link{DestinationURL: "https://example.com", CreatedBy: "user1"}, "PROMO"); err == nil {
+		t.Error("Expected PROMO to collide with existing codes once case-insensitive")
+	}
+
+	link, err := service.CreateLink(&Link{DestinationURL: "https://example.com", CreatedBy: "user1"}, "Launch")
+	if err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	if link.ShortCode != "launch" {
+		t.Errorf("Expected code stored lowercase, got %s", link.ShortCode)
+	}
+
+	found, err := NewRepository(db).UseCaseInsensitiveCodes(true).GetByShortCode("LAUNCH")
+	if err != nil || found.ID != link.ID {
+		t.Errorf("Expected case-insensitive lookup to find the link, got %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package links
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Synonyms maps a word to alternatives used when suggesting vanity codes,
+// e.g. "sale" -> ["deal", "offer"].
+type Synonyms map[string][]string
+
+// LoadSynonyms reads a word list with one "word: alt1, alt2" entry per line.
+// Blank lines and lines starting with '#' are ignored.
+func LoadSynonyms(path string) (Synonyms, error) {
+	syn := Synonyms{}
+	if path == "" {
+		return syn, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return syn, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		word, alts, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		word = slugWord(word)
+		for _, alt := range strings.Split(alts, ",") {
+			if alt = slugWord(alt); alt != "" && alt != word {
+				syn[word] = append(syn[word], alt)
+			}
+		}
+	}
+	return syn, scanner.Err()
+}
+
+type Availability struct {
+	Code        string       `json:"code"`
+	Available   bool         `json:"available"`
+	Reason      string       `json:"reason,omitempty"`
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+type Suggestion struct {
+	Code   string `json:"code"`
+	Source string `json:"source"` // title, destination, synonym, suffix
+	Score  int    `json:"-"`
+}
+
+// BulkCodeChecker reports which of several codes are already taken in one round trip.
+type BulkCodeChecker interface {
+	ExistingShortCodes(codes []string) (map[string]bool, error)
+}
+
+// SuggestionSeed is the text vanity codes are derived from.
+type SuggestionSeed struct {
+	Code           string // The code the user asked for, if any
+	Title          string
+	DestinationURL string
+}
+
+// stopWords are dropped from titles; they make codes longer without making them memorable.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "the": true, "of": true, "for": true, "to": true,
+	"in": true, "on": true, "at": true, "by": true, "with": true, "our": true, "your": true,
+	"is": true, "are": true, "www": true, "com": true, "html": true, "index": true,
+}
+
+// SuggestShortCodes returns up to limit available codes derived from the seed,
+// best first. Shorter codes and codes built from the title rank highest;
+// numeric suffixes are the fallback when every word is taken.
+func SuggestShortCodes(policy *ShortCodePolicy, checker BulkCodeChecker, seed SuggestionSeed, synonyms Synonyms, limit int) ([]Suggestion, error) {
+	candidates := map[string]Suggestion{}
+	add := func(body, source string, score int) {
+		code := policy.NormalizeCode(policy.Prefix + body)
+		if policy.CheckCustomCode(code) != nil {
+			return
+		}
+		// Prefer short codes: every character over 6 costs a point
+		if n := len(body) - 6; n > 0 {
+			score -= n
+		}
+		if existing, ok := candidates[code]; ok && existing.Score >= score {
+			return
+		}
+		candidates[code] = Suggestion{Code: code, Source: source, Score: score}
+	}
+
+	titleWords := seedWords(seed.Title)
+	destWords := destinationWords(seed.DestinationURL)
+	words := append(append([]string{}, titleWords...), destWords...)
+
+	for i, w := range titleWords {
+		add(w, "title", 40-i)
+		if i+1 < len(titleWords) {
+			add(w+titleWords[i+1], "title", 45-i)
+		}
+		for _, alt := range synonyms[w] {
+			add(alt, "synonym", 30-i)
+		}
+	}
+	for i, w := range destWords {
+		add(w, "destination", 25-i)
+		if i+1 < len(destWords) {
+			add(w+destWords[i+1], "destination", 28-i)
+		}
+		for _, alt := range synonyms[w] {
+			add(alt, "synonym", 15-i)
+		}
+	}
+	if base := slugWord(strings.TrimPrefix(policy.NormalizeCode(seed.Code), policy.Prefix)); base != "" {
+		for _, alt := range synonyms[base] {
+			add(alt, "synonym", 35)
+		}
+		words = append([]string{base}, words...)
+	}
+
+	// Numeric suffixes on the strongest bases
+	bases := words
+	if len(bases) > 3 {
+		bases = bases[:3]
+	}
+	for i, base := range bases {
+		for n := 1; n <= 5; n++ {
+			add(base+strconv.Itoa(n), "suffix", 10-i-n)
+		}
+	}
+
+	ranked := make([]Suggestion, 0, len(candidates))
+	codes := make([]string, 0, len(candidates))
+	for _, s := range candidates {
+		ranked = append(ranked, s)
+		codes = append(codes, s.Code)
+	}
+
+	taken, err := checker.ExistingShortCodes(codes)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Code < ranked[j].Code
+	})
+
+	out := []Suggestion{}
+	for _, s := range ranked {
+		if taken[policy.NormalizeCode(s.Code)] || strings.EqualFold(s.Code, seed.Code) {
+			continue
+		}
+		out = append(out, s)
+		if len(out) == limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func seedWords(text string) []string {
+	var words []string
+	for _, w := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if w = slugWord(w); w != "" && !stopWords[w] {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// destinationWords takes words from the host (minus www and the TLD) and the path.
+func destinationWords(raw string) []string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil
+	}
+	labels := strings.Split(u.Hostname(), ".")
+	if len(labels) > 1 {
+		labels = labels[:len(labels)-1]
+	}
+	return seedWords(strings.Join(labels, " ") + " " + u.Path)
+}
+
+// slugWord lowercases a word, folds accents ("café" -> "cafe") and drops
+// anything that is not an ASCII letter or digit.
+func slugWord(w string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(strings.ToLower(strings.TrimSpace(w))) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
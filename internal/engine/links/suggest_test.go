@@ -0,0 +1,133 @@
+package links
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type mockBulkChecker map[string]bool
+
+func (m mockBulkChecker) ExistingShortCodes(codes []string) (map[string]bool, error) {
+	taken := map[string]bool{}
+	for _, c := range codes {
+		if m[c] {
+			taken[c] = true
+		}
+	}
+	return taken, nil
+}
+
+func TestSuggestShortCodes(t *testing.T) {
+	policy := DefaultShortCodePolicy()
+	checker := mockBulkChecker{"summer": true, "shoes": true}
+	synonyms := Synonyms{"sale": {"deal", "offer"}}
+
+	seed := SuggestionSeed{
+		Code:           "summer",
+		Title:          "The Summer Sale on Shoes",
+		DestinationURL: "https://www.acme-store.com/collections/sandals",
+	}
+
+	suggestions, err := SuggestShortCodes(policy, checker, seed, synonyms, 20)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(suggestions) == 0 {
+		t.Fatal("Expected suggestions")
+	}
+
+	got := map[string]string{}
+	for _, s := range suggestions {
+		if checker[s.Code] {
+			t.Errorf("Suggested taken code %q", s.Code)
+		}
+		got[s.Code] = s.Source
+	}
+
+	for code, source := range map[string]string{
+		"summersale": "title",
+		"sale":       "title",
+		"deal":       "synonym",
+		"summer1":    "suffix",
+		"sandals":    "destination",
+	} {
+		if got[code] != source {
+			t.Errorf("Expected %q from %s, got %q", code, source, got[code])
+		}
+	}
+	if _, ok := got["the"]; ok {
+		t.Error("Stop words should not be suggested")
+	}
+
+	// Title-derived words outrank numeric suffixes
+	rank := map[string]int{}
+	for i, s := range suggestions {
+		rank[s.Code] = i
+	}
+	if rank["sale"] > rank["summer1"] {
+		t.Errorf("Expected sale to rank above summer1: %+v", suggestions)
+	}
+}
+
+func TestSuggestShortCodes_Policy(t *testing.T) {
+	policy := &ShortCodePolicy{Length: 7, Alphabet: "default", CaseInsensitive: true, Prefix: "eu-", BlockedWords: []string{"sale"}}
+	policy.Normalize()
+
+	suggestions, err := SuggestShortCodes(policy, mockBulkChecker{}, SuggestionSeed{Title: "Café Summer Sale"}, nil, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, s := range suggestions {
+		if s.Code[:3] != "eu-" {
+			t.Errorf("Suggestion %q is missing the policy prefix", s.Code)
+		}
+		if policy.CheckCustomCode(s.Code) != nil {
+			t.Errorf("Suggestion %q violates the policy", s.Code)
+		}
+	}
+	if len(suggestions) == 0 || suggestions[0].Code != "eu-cafesummer" {
+		t.Errorf("Expected eu-cafesummer first, got %+v", suggestions)
+	}
+}
+
+func TestLoadSynonyms(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "synonyms.txt")
+	os.WriteFile(path, []byte("# marketing words\nSale: deal, Offer , \nshoes: kicks\nnot a valid line\n"), 0644)
+
+	syn, err := LoadSynonyms(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(syn["sale"]) != 2 || syn["sale"][1] != "offer" || syn["shoes"][0] != "kicks" {
+		t.Errorf("Unexpected synonyms: %v", syn)
+	}
+}
+
+func TestService_CheckShortCodeAvailability(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewService(NewRepository(db))
+	if _, err := service.CreateLink(&Link{DestinationURL: "https://example.com", CreatedBy: "user1"}, "launch"); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	result, err := service.CheckShortCodeAvailability(SuggestionSeed{Code: "launch", Title: "Product Launch"}, nil, 5)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Available || result.Reason == "" {
+		t.Errorf("Expected launch to be unavailable, got %+v", result)
+	}
+	for _, s := range result.Suggestions {
+		if s.Code == "launch" {
+			t.Error("Suggested the taken code")
+		}
+	}
+
+	result, err = service.CheckShortCodeAvailability(SuggestionSeed{Code: "admin"}, nil, 5)
+	if err != nil || result.Available {
+		t.Errorf("Expected reserved code to be unavailable, got %+v (err %v)", result, err)
+	}
+}
@@ -1,27 +1,38 @@
 package links
 
 import (
-	"errors"
 	"net/url"
 )
 
-func ValidateLink(link *Link) error {
+// ValidationError is a problem with the request itself, which the caller can
+// fix, as opposed to a storage or screener failure.
+type ValidationError struct {
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Reason
+}
+
+// ValidateLink checks the link's shape and, when a screener is given, runs every
+// destination it can redirect to through the screening pipeline.
+func ValidateLink(link *Link, screener Screener) error {
 	if link.DestinationURL == "" {
-		return errors.New("destination_url is required")
+		return &ValidationError{Reason: "destination_url is required"}
 	}
 
 	u, err := url.Parse(link.DestinationURL)
 	if err != nil {
-		return errors.New("invalid destination_url format")
+		return &ValidationError{Reason: "invalid destination_url format"}
 	}
 
 	if u.Scheme != "http" && u.Scheme != "https" {
-		return errors.New("destination_url must start with http:// or https://")
+		return &ValidationError{Reason: "destination_url must start with http:// or https://"}
 	}
 
 	// Validate Redirect Type
 	if link.RedirectType != "" && link.RedirectType != "temporary" && link.RedirectType != "permanent" {
-		return errors.New("redirect_type must be 'temporary' or 'permanent'")
+		return &ValidationError{Reason: "redirect_type must be 'temporary' or 'permanent'"}
 	}
 
 	// Validate Rules (basic check)
@@ -29,5 +40,5 @@ func ValidateLink(link *Link) error {
 		// Could add deeper validation for country codes etc.
 	}
 
-	return nil
+	return screenDestinations(link, screener)
 }
@@ -8,6 +8,7 @@ import (
 
 type CachedLink struct {
 	ID             string
+	ShortCode      string // Matched code; differs from the cache key for wildcard links
 	DestinationURL string
 	Rules          *links.RedirectRules
 	RedirectType   string
@@ -15,40 +16,85 @@ type CachedLink struct {
 	CachedAt       time.Time
 }
 
+// maxLinkCacheEntries caps the cache. Wildcard links are cached once per path
+// they serve, so without a cap arbitrary paths would grow it without bound.
+const maxLinkCacheEntries = 100000
+
 type LinkCache struct {
-	store sync.Map // map[short_code]*CachedLink
-	ttl   time.Duration
+	mu         sync.RWMutex
+	entries    map[string]*CachedLink // by org and request path
+	ttl        time.Duration
+	maxEntries int
 }
 
 func NewLinkCache(ttl time.Duration) *LinkCache {
 	return &LinkCache{
-		ttl: ttl,
+		entries:    make(map[string]*CachedLink),
+		ttl:        ttl,
+		maxEntries: maxLinkCacheEntries,
 	}
 }
 
-func (c *LinkCache) Get(shortCode string) (*CachedLink, bool) {
-	val, ok := c.store.Load(shortCode)
+func (c *LinkCache) Get(key string) (*CachedLink, bool) {
+	c.mu.RLock()
+	link, ok := c.entries[key]
+	c.mu.RUnlock()
 	if !ok {
 		return nil, false
 	}
 
-	link := val.(*CachedLink)
 	if time.Since(link.CachedAt) > c.ttl {
-		c.store.Delete(shortCode)
+		c.mu.Lock()
+		if c.entries[key] == link {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
 		return nil, false
 	}
 
 	return link, true
 }
 
-func (c *LinkCache) Set(shortCode string, link *links.Link) {
+func (c *LinkCache) Set(key string, link *links.Link) {
 	cached := &CachedLink{
 		ID:             link.ID,
+		ShortCode:      link.ShortCode,
 		DestinationURL: link.DestinationURL,
 		Rules:          link.Rules,
 		RedirectType:   link.RedirectType,
 		Status:         link.Status,
 		CachedAt:       time.Now(),
 	}
-	c.store.Store(shortCode, cached)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Sweep expired entries when full; if everything is fresh, drop arbitrary
+	// entries rather than grow past the cap
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		for k, entry := range c.entries {
+			if time.Since(entry.CachedAt) > c.ttl {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < c.maxEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cached
+}
+
+// InvalidateLink drops every cached entry that resolves to the given link.
+// Entries are keyed by request path, so a link may be cached under several keys.
+func (c *LinkCache) InvalidateLink(linkID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if entry.ID == linkID {
+			delete(c.entries, key)
+		}
+	}
 }
@@ -0,0 +1,30 @@
+package redirect
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"trackr/internal/engine/links"
+)
+
+func TestLinkCache_Bounded(t *testing.T) {
+	cache := NewLinkCache(time.Minute)
+	cache.maxEntries = 3
+
+	docs := &links.Link{ID: "link_docs", ShortCode: "docs/*", Status: "active"}
+	for i := 0; i < 10; i++ {
+		cache.Set(fmt.Sprintf("org_1:docs/page-%d", i), docs)
+	}
+	if len(cache.entries) != 3 {
+		t.Errorf("Cache holds %d entries, want the cap of 3", len(cache.entries))
+	}
+	if _, ok := cache.Get("org_1:docs/page-9"); !ok {
+		t.Errorf("Most recent entry evicted")
+	}
+
+	cache.InvalidateLink("link_docs")
+	if len(cache.entries) != 0 {
+		t.Errorf("InvalidateLink left %d entries", len(cache.entries))
+	}
+}
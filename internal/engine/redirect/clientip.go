@@ -0,0 +1,90 @@
+package redirect
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIPResolver finds the visitor's address behind reverse proxies. The
+// forwarding headers are only believed when the connection comes from a
+// trusted proxy; anyone else could send them to pick their own IP.
+type ClientIPResolver struct {
+	trusted []*net.IPNet
+}
+
+// NewClientIPResolver trusts the given proxies, each an IP or a CIDR range.
+// With none, the connection's address is always the client's.
+func NewClientIPResolver(trustedProxies []string) (*ClientIPResolver, error) {
+	r := &ClientIPResolver{}
+	for _, p := range trustedProxies {
+		p = strings.TrimSpace(p)
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", p)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			r.trusted = append(r.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+		}
+		r.trusted = append(r.trusted, n)
+	}
+	return r, nil
+}
+
+// ClientIP returns the bare IP of the visitor. Behind trusted proxies it is
+// the rightmost X-Forwarded-For entry not added by one of them, so entries
+// the client itself sent are ignored; X-Real-IP is used when there is no
+// X-Forwarded-For.
+func (r *ClientIPResolver) ClientIP(req *http.Request) string {
+	peer := ClientIP(req.RemoteAddr)
+	if r == nil || !r.isTrusted(peer) {
+		return peer
+	}
+
+	var hops []string
+	for _, h := range req.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	if len(hops) == 0 {
+		if real := strings.TrimSpace(req.Header.Get("X-Real-IP")); net.ParseIP(real) != nil {
+			return real
+		}
+		return peer
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := ClientIP(strings.TrimSpace(hops[i]))
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		client = hop
+		if !r.isTrusted(hop) {
+			break
+		}
+	}
+	return client
+}
+
+func (r *ClientIPResolver) isTrusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range r.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package redirect
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	resolver, err := NewClientIPResolver([]string{"127.0.0.1", "::1", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewClientIPResolver: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       string
+	}{
+		{"direct", "203.0.113.5:51000", nil, "203.0.113.5"},
+		{"untrusted peer cannot forward", "203.0.113.5:51000", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "203.0.113.5"},
+		{"behind local proxy", "127.0.0.1:40000", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		{"IPv6 proxy", "[::1]:40000", http.Header{"X-Forwarded-For": {"2001:db8::7"}}, "2001:db8::7"},
+		{"spoofed entries are ignored", "127.0.0.1:40000", http.Header{"X-Forwarded-For": {"1.2.3.4, 198.51.100.1"}}, "198.51.100.1"},
+		{"proxy chain", "127.0.0.1:40000", http.Header{"X-Forwarded-For": {"198.51.100.1, 10.0.0.3"}}, "198.51.100.1"},
+		{"repeated headers", "127.0.0.1:40000", http.Header{"X-Forwarded-For": {"1.2.3.4", "198.51.100.1"}}, "198.51.100.1"},
+		{"garbage stops the walk", "127.0.0.1:40000", http.Header{"X-Forwarded-For": {"198.51.100.1, junk"}}, "127.0.0.1"},
+		{"real ip", "127.0.0.1:40000", http.Header{"X-Real-Ip": {"198.51.100.1"}}, "198.51.100.1"},
+		{"no header", "127.0.0.1:40000", nil, "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.header != nil {
+				req.Header = tt.header
+			}
+			if got := resolver.ClientIP(req); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPResolver_Nil(t *testing.T) {
+	var resolver *ClientIPResolver
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:40000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := resolver.ClientIP(req); got != "127.0.0.1" {
+		t.Errorf("ClientIP = %q, want the connection's address", got)
+	}
+}
+
+func TestNewClientIPResolver_Invalid(t *testing.T) {
+	for _, p := range []string{"localhost", "10.0.0.0/33", ""} {
+		if _, err := NewClientIPResolver([]string{p}); err == nil {
+			t.Errorf("Expected an error for %q", p)
+		}
+	}
+}
@@ -3,24 +3,57 @@ package redirect
 import (
 	"database/sql"
 	"log"
+	"net"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"trackr/internal/engine/analytics"
+	"trackr/internal/engine/fraud"
 	"trackr/internal/engine/links"
 )
 
 type ClickLogger struct {
 	// In a real system, this might use a channel buffer or a message queue
 	// For now, we will just spawn goroutines or use a simple worker pool
+
+	stream       *ClickStream             // Live subscribers; may be nil
+	fingerprints *analytics.Fingerprinter // Visitor IDs for unique counts; may be nil
+	events       ClickSink                // click.created webhooks; may be nil
+}
+
+// ClickSink receives every logged click, e.g. to batch click.created webhooks.
+type ClickSink interface {
+	Add(orgID string, db *sql.DB, click interface{})
+}
+
+func NewClickLogger(stream *ClickStream, fingerprints *analytics.Fingerprinter) *ClickLogger {
+	return &ClickLogger{stream: stream, fingerprints: fingerprints}
 }
 
-func NewClickLogger() *ClickLogger {
-	return &ClickLogger{}
+// WithClickEvents hands every logged click to sink as well as the live stream.
+func (l *ClickLogger) WithClickEvents(sink ClickSink) *ClickLogger {
+	l.events = sink
+	return l
+}
+
+// Click is one redirect to record.
+type Click struct {
+	ID             string // Set when the click ID was handed to the destination; generated otherwise
+	OrgID          string
+	LinkID         string
+	ShortCode      string
+	DestinationURL string
+	Request        links.RequestContext
+	UTM            map[string]string
+	QRVariant      string // Empty for regular clicks, names the QR code for scans
+	Fraud          fraud.Result
 }
 
 // LogClick is designed to be called in a goroutine
 // It takes all necessary data as values to avoid context cancellation issues
-func (l *ClickLogger) LogClick(db *sql.DB, linkID, shortCode, destURL string, reqCtx links.RequestContext, utm map[string]string) {
+func (l *ClickLogger) LogClick(db *sql.DB, click Click) {
 	// Ensure we don't crash the main process
 	defer func() {
 		if r := recover(); r != nil {
@@ -32,19 +65,28 @@ func (l *ClickLogger) LogClick(db *sql.DB, linkID, shortCode, destURL string, re
 		INSERT INTO clicks (
 			id, link_id, short_code, timestamp, ip_address, user_agent,
 			country_code, city, device_type, os, browser, referrer,
-			referrer_domain, utm_source, utm_medium, utm_campaign, destination_url
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			referrer_domain, utm_source, utm_medium, utm_campaign, destination_url,
+			qr_variant, visitor_id, fraud_score, fraud_reasons
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	// Simple referrer domain extraction
-	// In real implementation, use a proper URL parser
-	referrerDomain := ""
+	id := click.ID
+	if id == "" {
+		id = uuid.New().String()
+	}
+	timestamp := time.Now().UnixMilli()
+	reqCtx := click.Request
+
+	var visitorID sql.NullString
+	if l.fingerprints != nil {
+		visitorID = sql.NullString{String: l.fingerprints.VisitorID(click.OrgID, reqCtx.IPAddress, reqCtx.UserAgent), Valid: true}
+	}
 
 	_, err := db.Exec(query,
-		uuid.New().String(),
-		linkID,
-		shortCode,
-		time.Now().UnixMilli(),
+		id,
+		click.LinkID,
+		click.ShortCode,
+		timestamp,
 		reqCtx.IPAddress,
 		reqCtx.UserAgent,
 		reqCtx.CountryCode,
@@ -53,20 +95,66 @@ func (l *ClickLogger) LogClick(db *sql.DB, linkID, shortCode, destURL string, re
 		reqCtx.OS,
 		reqCtx.Browser,
 		reqCtx.Referrer,
-		referrerDomain,
-		utm["utm_source"],
-		utm["utm_medium"],
-		utm["utm_campaign"],
-		destURL,
+		referrerDomain(reqCtx.Referrer),
+		click.UTM["utm_source"],
+		click.UTM["utm_medium"],
+		click.UTM["utm_campaign"],
+		click.DestinationURL,
+		sql.NullString{String: click.QRVariant, Valid: click.QRVariant != ""},
+		visitorID,
+		click.Fraud.Score,
+		sql.NullString{String: strings.Join(click.Fraud.Reasons, ","), Valid: len(click.Fraud.Reasons) > 0},
 	)
 
 	if err != nil {
 		log.Printf("Failed to log click: %v", err)
+	} else {
+		event := ClickEvent{
+			ID:             id,
+			LinkID:         click.LinkID,
+			ShortCode:      click.ShortCode,
+			Timestamp:      timestamp,
+			CountryCode:    reqCtx.CountryCode,
+			DeviceType:     reqCtx.DeviceType,
+			OS:             reqCtx.OS,
+			Browser:        reqCtx.Browser,
+			Referrer:       reqCtx.Referrer,
+			DestinationURL: click.DestinationURL,
+			QRVariant:      click.QRVariant,
+			FraudScore:     click.Fraud.Score,
+		}
+		l.stream.Publish(click.OrgID, event)
+		if l.events != nil {
+			l.events.Add(click.OrgID, db, event)
+		}
 	}
 
 	// Increment click count (fire and forget)
-	_, err = db.Exec("UPDATE links SET click_count = click_count + 1, last_click_at = ? WHERE id = ?", time.Now().Unix(), linkID)
+	_, err = db.Exec("UPDATE links SET click_count = click_count + 1, last_click_at = ? WHERE id = ?", time.Now().Unix(), click.LinkID)
 	if err != nil {
 		log.Printf("Failed to increment click count: %v", err)
 	}
 }
+
+// referrerDomain returns the referrer's lowercased host without "www.", so
+// rollups group www.example.com and example.com together.
+func referrerDomain(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+	u, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// ClientIP returns the bare IP of a request's remote address. The port
+// changes with every connection, so keeping it would give one visitor a new
+// fingerprint per click.
+func ClientIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
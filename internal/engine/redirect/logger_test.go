@@ -0,0 +1,73 @@
+package redirect
+
+import (
+	"net/http"
+	"testing"
+
+	"trackr/internal/engine/analytics"
+)
+
+func TestReferrerDomain(t *testing.T) {
+	tests := map[string]string{
+		"":                                  "",
+		"https://www.Google.com/search?q=x": "google.com",
+		"http://news.ycombinator.com:8080/": "news.ycombinator.com",
+		"android-app://com.slack":           "com.slack",
+		"not a url":                         "",
+		"%zz":                               "",
+	}
+	for referrer, want := range tests {
+		if got := referrerDomain(referrer); got != want {
+			t.Errorf("referrerDomain(%q) = %q, want %q", referrer, got, want)
+		}
+	}
+}
+
+func TestClientIP_SameVisitorAcrossConnections(t *testing.T) {
+	fingerprints := analytics.NewFingerprinter("secret")
+	ua := "Mozilla/5.0"
+
+	first := ClientIP("203.0.113.5:51000")
+	second := ClientIP("203.0.113.5:62311")
+	if first != "203.0.113.5" || second != first {
+		t.Fatalf("ClientIP = %q, %q, want bare IP", first, second)
+	}
+	if fingerprints.VisitorID("org_1", first, ua) != fingerprints.VisitorID("org_1", second, ua) {
+		t.Errorf("Two connections from one visitor got different visitor IDs")
+	}
+
+	if got := ClientIP("[2001:db8::1]:443"); got != "2001:db8::1" {
+		t.Errorf("ClientIP(IPv6) = %q", got)
+	}
+	if got := ClientIP("198.51.100.7"); got != "198.51.100.7" {
+		t.Errorf("ClientIP without port = %q", got)
+	}
+}
+
+func TestClientIPResolver_VisitorsBehindProxy(t *testing.T) {
+	fingerprints := analytics.NewFingerprinter("secret")
+	resolver, err := NewClientIPResolver([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatalf("NewClientIPResolver: %v", err)
+	}
+	ua := "Mozilla/5.0"
+
+	visitor := func(remoteAddr, forwardedFor string) string {
+		req, _ := http.NewRequest("GET", "/abc", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		return fingerprints.VisitorID("org_1", resolver.ClientIP(req), ua)
+	}
+
+	alice := visitor("127.0.0.1:40001", "203.0.113.5")
+	bob := visitor("127.0.0.1:40002", "198.51.100.7")
+	if alice == bob {
+		t.Error("Two visitors behind the proxy got the same visitor ID")
+	}
+	if again := visitor("127.0.0.1:40003", "203.0.113.5"); again != alice {
+		t.Error("One visitor got a new visitor ID on a new proxy connection")
+	}
+	if direct := fingerprints.VisitorID("org_1", ClientIP("203.0.113.5:51000"), ua); direct != alice {
+		t.Error("A visitor got a different ID through the proxy than directly")
+	}
+}
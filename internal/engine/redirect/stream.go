@@ -0,0 +1,119 @@
+package redirect
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// MaxStreamSubscribers limits concurrent live streams per organization.
+const MaxStreamSubscribers = 50
+
+var ErrTooManySubscribers = errors.New("too many live streams open for this organization")
+
+// ClickEvent is the live view of a logged click. It deliberately omits the
+// visitor's IP address and user agent.
+type ClickEvent struct {
+	ID             string `json:"id"`
+	LinkID         string `json:"link_id"`
+	ShortCode      string `json:"short_code"`
+	Timestamp      int64  `json:"timestamp"` // Unix milliseconds
+	CountryCode    string `json:"country_code,omitempty"`
+	DeviceType     string `json:"device_type,omitempty"`
+	OS             string `json:"os,omitempty"`
+	Browser        string `json:"browser,omitempty"`
+	Referrer       string `json:"referrer,omitempty"`
+	DestinationURL string `json:"destination_url"`
+	QRVariant      string `json:"qr_variant,omitempty"`
+	FraudScore     int    `json:"fraud_score,omitempty"`
+}
+
+// ClickStream fans logged clicks out to live subscribers in this process.
+// Publishing never blocks: a subscriber whose buffer is full misses events and
+// is told how many it missed, so one slow dashboard cannot stall redirects.
+type ClickStream struct {
+	mu   sync.RWMutex
+	subs map[*ClickSubscription]struct{}
+}
+
+func NewClickStream() *ClickStream {
+	return &ClickStream{subs: map[*ClickSubscription]struct{}{}}
+}
+
+type ClickSubscription struct {
+	orgID   string
+	linkID  string // Empty for every link in the org
+	events  chan ClickEvent
+	dropped atomic.Uint64
+	stream  *ClickStream
+	once    sync.Once
+}
+
+// Subscribe registers for an org's clicks, or one link's when linkID is set.
+// The caller must Close the subscription.
+func (s *ClickStream) Subscribe(orgID, linkID string, buffer int) (*ClickSubscription, error) {
+	if buffer <= 0 {
+		buffer = 64
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for sub := range s.subs {
+		if sub.orgID == orgID {
+			count++
+		}
+	}
+	if count >= MaxStreamSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+
+	sub := &ClickSubscription{
+		orgID:  orgID,
+		linkID: linkID,
+		events: make(chan ClickEvent, buffer),
+		stream: s,
+	}
+	s.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Publish delivers the event to every matching subscriber without blocking.
+func (s *ClickStream) Publish(orgID string, ev ClickEvent) {
+	if s == nil {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for sub := range s.subs {
+		if sub.orgID != orgID || (sub.linkID != "" && sub.linkID != ev.LinkID) {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Events is closed when the subscription is closed.
+func (sub *ClickSubscription) Events() <-chan ClickEvent {
+	return sub.events
+}
+
+// TakeDropped returns how many events were dropped since the last call.
+func (sub *ClickSubscription) TakeDropped() uint64 {
+	return sub.dropped.Swap(0)
+}
+
+func (sub *ClickSubscription) Close() {
+	sub.once.Do(func() {
+		sub.stream.mu.Lock()
+		delete(sub.stream.subs, sub)
+		sub.stream.mu.Unlock()
+		close(sub.events)
+	})
+}
@@ -0,0 +1,66 @@
+package redirect
+
+import "testing"
+
+func TestClickStream_Filtering(t *testing.T) {
+	stream := NewClickStream()
+
+	orgSub, _ := stream.Subscribe("org1", "", 4)
+	linkSub, _ := stream.Subscribe("org1", "link1", 4)
+	otherSub, _ := stream.Subscribe("org2", "", 4)
+	defer orgSub.Close()
+	defer linkSub.Close()
+	defer otherSub.Close()
+
+	stream.Publish("org1", ClickEvent{ID: "c1", LinkID: "link1"})
+	stream.Publish("org1", ClickEvent{ID: "c2", LinkID: "link2"})
+
+	if got := len(orgSub.Events()); got != 2 {
+		t.Errorf("Org subscriber got %d events, want 2", got)
+	}
+	if got := len(linkSub.Events()); got != 1 {
+		t.Errorf("Link subscriber got %d events, want 1", got)
+	}
+	if got := len(otherSub.Events()); got != 0 {
+		t.Errorf("Other org subscriber got %d events, want 0", got)
+	}
+}
+
+func TestClickStream_DropsForSlowConsumer(t *testing.T) {
+	stream := NewClickStream()
+	sub, _ := stream.Subscribe("org1", "", 2)
+
+	for i := 0; i < 5; i++ {
+		stream.Publish("org1", ClickEvent{LinkID: "link1"})
+	}
+
+	if got := sub.TakeDropped(); got != 3 {
+		t.Errorf("Dropped = %d, want 3", got)
+	}
+	if got := sub.TakeDropped(); got != 0 {
+		t.Errorf("Dropped after take = %d, want 0", got)
+	}
+
+	sub.Close()
+	sub.Close()                                         // Idempotent
+	stream.Publish("org1", ClickEvent{LinkID: "link1"}) // Must not panic on a closed subscription
+
+	if _, ok := <-sub.Events(); !ok {
+		t.Error("Expected buffered events to remain readable after close")
+	}
+}
+
+func TestClickStream_SubscriberLimit(t *testing.T) {
+	stream := NewClickStream()
+	for i := 0; i < MaxStreamSubscribers; i++ {
+		if _, err := stream.Subscribe("org1", "", 1); err != nil {
+			t.Fatalf("Subscribe #%d failed: %v", i, err)
+		}
+	}
+	if _, err := stream.Subscribe("org1", "", 1); err != ErrTooManySubscribers {
+		t.Errorf("Expected ErrTooManySubscribers, got %v", err)
+	}
+	if _, err := stream.Subscribe("org2", "", 1); err != nil {
+		t.Errorf("Limit should be per organization: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package reports
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+)
+
+const (
+	chartWidth   = 600
+	chartHeight  = 160
+	chartPadding = 8
+)
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartGrid       = color.RGBA{0xe5, 0xe7, 0xeb, 0xff}
+	chartBar        = color.RGBA{0x4f, 0x46, 0xe5, 0xff}
+)
+
+// barChart renders values as a PNG bar chart scaled to the largest value,
+// with gridlines at quarters. Labels are left to the surrounding HTML: email
+// clients show the image as is, and the standard library has no fonts.
+func barChart(values []int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{chartBackground}, image.Point{}, draw.Src)
+
+	plotW, plotH := chartWidth-2*chartPadding, chartHeight-2*chartPadding
+	baseline := chartPadding + plotH
+	for q := 0; q <= 4; q++ {
+		y := baseline - plotH*q/4
+		draw.Draw(img, image.Rect(chartPadding, y, chartPadding+plotW, y+1), &image.Uniform{chartGrid}, image.Point{}, draw.Src)
+	}
+
+	max := 0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	if len(values) > 0 && max > 0 {
+		slot := float64(plotW) / float64(len(values))
+		gap := slot / 5
+		for i, v := range values {
+			if v <= 0 {
+				continue
+			}
+			h := plotH * v / max
+			if h < 1 {
+				h = 1
+			}
+			x0 := chartPadding + int(float64(i)*slot+gap/2)
+			x1 := chartPadding + int(float64(i+1)*slot-gap/2)
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			draw.Draw(img, image.Rect(x0, baseline-h, x1, baseline), &image.Uniform{chartBar}, image.Point{}, draw.Src)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,247 @@
+package reports
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"trackr/internal/pkg/mailer"
+)
+
+const chartContentID = "clicks-chart"
+
+// Title names the report, e.g. "Weekly report for Acme: Mar 2 – Mar 8, 2026".
+func (r *Report) Title() string {
+	frequency := r.Subscription.Frequency
+	return strings.ToUpper(frequency[:1]) + frequency[1:] + " report for " + r.OrgName + ": " + r.PeriodLabel()
+}
+
+// PeriodLabel formats the period in the subscription's timezone.
+func (r *Report) PeriodLabel() string {
+	last := r.End.Add(-time.Nanosecond)
+	switch r.Subscription.Frequency {
+	case FrequencyDaily:
+		return r.Start.Format("Mon Jan 2, 2006")
+	case FrequencyMonthly:
+		return r.Start.Format("January 2006")
+	}
+	if r.Start.Year() != last.Year() {
+		return r.Start.Format("Jan 2, 2006") + " – " + last.Format("Jan 2, 2006")
+	}
+	return r.Start.Format("Jan 2") + " – " + last.Format("Jan 2, 2006")
+}
+
+// ScopeLabel describes which links the report covers.
+func (r *Report) ScopeLabel() string {
+	switch r.Subscription.Scope {
+	case ScopeLinks:
+		if n := len(r.Subscription.LinkIDs); n != 1 {
+			return fmt.Sprintf("%d selected links", n)
+		}
+		return "1 selected link"
+	case ScopeCampaign:
+		return "Campaign " + r.Subscription.Campaign
+	}
+	return "All links"
+}
+
+// Message renders the report as an email with the click chart attached
+// inline. appURL links back to the dashboard.
+func (r *Report) Message(appURL string) (*mailer.Message, error) {
+	chart, err := barChart(r.seriesValues())
+	if err != nil {
+		return nil, err
+	}
+	html, err := r.HTML("cid:"+chartContentID, appURL)
+	if err != nil {
+		return nil, err
+	}
+	var text bytes.Buffer
+	if err := textReport.Execute(&text, r.view("", appURL)); err != nil {
+		return nil, err
+	}
+
+	subject := r.Title()
+	if r.Subscription.Name != "" {
+		subject = r.Subscription.Name + ": " + r.PeriodLabel()
+	}
+	return &mailer.Message{
+		To:      r.Subscription.Recipients,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html,
+		Inline: []mailer.Inline{{
+			ContentID:   chartContentID,
+			ContentType: "image/png",
+			Filename:    "clicks.png",
+			Data:        chart,
+		}},
+	}, nil
+}
+
+// Preview renders the report as a standalone HTML page with the chart
+// embedded as a data URI.
+func (r *Report) Preview(appURL string) (string, error) {
+	chart, err := barChart(r.seriesValues())
+	if err != nil {
+		return "", err
+	}
+	return r.HTML("data:image/png;base64,"+base64.StdEncoding.EncodeToString(chart), appURL)
+}
+
+// HTML renders the report body; chartSrc is the chart image's URL.
+func (r *Report) HTML(chartSrc, appURL string) (string, error) {
+	var buf bytes.Buffer
+	if err := htmlReport.Execute(&buf, r.view(chartSrc, appURL)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (r *Report) seriesValues() []int {
+	values := make([]int, len(r.Series))
+	for i, p := range r.Series {
+		values[i] = p.Clicks
+	}
+	return values
+}
+
+type reportView struct {
+	*Report
+	ChartSrc   htmltemplate.URL
+	AppURL     string
+	FirstLabel string
+	LastLabel  string
+	PeakClicks int
+	Tables     []tableView
+}
+
+type tableView struct {
+	Title  string
+	Header string
+	Rows   []ValueRow
+}
+
+func (r *Report) view(chartSrc, appURL string) reportView {
+	v := reportView{Report: r, ChartSrc: htmltemplate.URL(chartSrc), AppURL: appURL}
+	if n := len(r.Series); n > 0 {
+		v.FirstLabel, v.LastLabel = r.Series[0].Label, r.Series[n-1].Label
+	}
+	for _, p := range r.Series {
+		if p.Clicks > v.PeakClicks {
+			v.PeakClicks = p.Clicks
+		}
+	}
+	v.Tables = []tableView{
+		{Title: "Top countries", Header: "Country", Rows: labelEmpty(r.TopCountries, "Unknown")},
+		{Title: "Top referrers", Header: "Referrer", Rows: labelEmpty(r.TopReferrers, "Direct")},
+		{Title: "Devices", Header: "Device", Rows: labelEmpty(r.TopDevices, "Unknown")},
+	}
+	return v
+}
+
+func labelEmpty(rows []ValueRow, label string) []ValueRow {
+	out := make([]ValueRow, len(rows))
+	for i, row := range rows {
+		out[i] = row
+		if out[i].Value == "" {
+			out[i].Value = label
+		}
+	}
+	return out
+}
+
+// change formats the change from previous to current, e.g. "+12%".
+func change(current, previous int) string {
+	if previous == 0 {
+		if current == 0 {
+			return "no change"
+		}
+		return "new"
+	}
+	pct := float64(current-previous) / float64(previous) * 100
+	return fmt.Sprintf("%+.0f%%", pct)
+}
+
+// number formats n with thousands separators.
+func number(n int) string {
+	if n < 0 {
+		return "-" + number(-n)
+	}
+	s := fmt.Sprint(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+var templateFuncs = map[string]interface{}{
+	"change": change,
+	"number": number,
+}
+
+// Email clients ignore <style> blocks unevenly, so styles are inline
+var htmlReport = htmltemplate.Must(htmltemplate.New("report").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html>
+<body style="margin:0;padding:24px;background:#f3f4f6;font-family:Helvetica,Arial,sans-serif;color:#111827">
+<table role="presentation" width="640" cellpadding="0" cellspacing="0" style="margin:0 auto;background:#ffffff;border-radius:8px;padding:24px">
+<tr><td style="padding:0 0 16px">
+  <h1 style="margin:0;font-size:20px">{{.Title}}</h1>
+  <p style="margin:4px 0 0;color:#6b7280;font-size:14px">{{.ScopeLabel}}</p>
+</td></tr>
+<tr><td>
+  <table role="presentation" width="100%" cellpadding="8" cellspacing="0" style="font-size:14px">
+  <tr>
+    <td style="background:#eef2ff;border-radius:6px"><div style="color:#6b7280">Clicks</div><div style="font-size:24px;font-weight:bold">{{number .Clicks}}</div><div style="color:#6b7280">{{change .Clicks .PreviousClicks}} vs previous</div></td>
+    <td width="12"></td>
+    <td style="background:#eef2ff;border-radius:6px"><div style="color:#6b7280">Unique visitors</div><div style="font-size:24px;font-weight:bold">{{number .UniqueVisitors}}</div><div style="color:#6b7280">{{change .UniqueVisitors .PreviousUniqueVisitors}} vs previous</div></td>
+  </tr>
+  </table>
+</td></tr>
+{{if .Series}}<tr><td style="padding:16px 0 0">
+  <img src="{{.ChartSrc}}" width="600" height="160" alt="Clicks over time" style="display:block;max-width:100%">
+  <table role="presentation" width="600" cellpadding="0" cellspacing="0" style="font-size:12px;color:#6b7280">
+  <tr><td>{{.FirstLabel}}</td><td align="center">Peak: {{number .PeakClicks}} clicks</td><td align="right">{{.LastLabel}}</td></tr>
+  </table>
+</td></tr>{{end}}
+<tr><td style="padding:16px 0 0">
+  <h2 style="margin:0 0 8px;font-size:16px">Top links</h2>
+  {{if .TopLinks}}<table width="100%" cellpadding="6" cellspacing="0" style="font-size:14px;border-collapse:collapse">
+  <tr style="text-align:left;color:#6b7280"><th>Link</th><th>Destination</th><th style="text-align:right">Clicks</th></tr>
+  {{range .TopLinks}}<tr style="border-top:1px solid #e5e7eb"><td>{{.ShortCode}}{{if .Title}}<div style="color:#6b7280;font-size:12px">{{.Title}}</div>{{end}}</td><td style="word-break:break-all">{{.DestinationURL}}</td><td style="text-align:right">{{number .Clicks}}</td></tr>
+  {{end}}</table>{{else}}<p style="color:#6b7280;font-size:14px">No clicks in this period.</p>{{end}}
+</td></tr>
+{{range .Tables}}{{if .Rows}}<tr><td style="padding:16px 0 0">
+  <h2 style="margin:0 0 8px;font-size:16px">{{.Title}}</h2>
+  <table width="100%" cellpadding="6" cellspacing="0" style="font-size:14px;border-collapse:collapse">
+  <tr style="text-align:left;color:#6b7280"><th>{{.Header}}</th><th style="text-align:right">Clicks</th></tr>
+  {{range .Rows}}<tr style="border-top:1px solid #e5e7eb"><td>{{.Value}}</td><td style="text-align:right">{{number .Clicks}}</td></tr>
+  {{end}}</table>
+</td></tr>{{end}}{{end}}
+{{if .AppURL}}<tr><td style="padding:24px 0 0;font-size:12px;color:#6b7280">
+  <a href="{{.AppURL}}" style="color:#4f46e5">Open the dashboard</a> to explore further or change this report.
+</td></tr>{{end}}
+</table>
+</body>
+</html>
+`))
+
+var textReport = texttemplate.Must(texttemplate.New("report").Funcs(templateFuncs).Parse(`{{.Title}}
+{{.ScopeLabel}}
+
+Clicks: {{number .Clicks}} ({{change .Clicks .PreviousClicks}} vs previous)
+Unique visitors: {{number .UniqueVisitors}} ({{change .UniqueVisitors .PreviousUniqueVisitors}} vs previous)
+
+Top links:
+{{range .TopLinks}}  {{.ShortCode}}  {{number .Clicks}}  {{.DestinationURL}}
+{{else}}  No clicks in this period.
+{{end}}{{range .Tables}}{{if .Rows}}
+{{.Title}}:
+{{range .Rows}}  {{.Value}}  {{number .Clicks}}
+{{end}}{{end}}{{end}}{{if .AppURL}}
+Dashboard: {{.AppURL}}
+{{end}}`))
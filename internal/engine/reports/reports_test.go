@@ -0,0 +1,286 @@
+package reports
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"trackr/internal/pkg/mailer"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE links (
+		id TEXT PRIMARY KEY,
+		short_code TEXT UNIQUE NOT NULL,
+		destination_url TEXT NOT NULL,
+		title TEXT,
+		created_by TEXT NOT NULL,
+		redirect_type TEXT DEFAULT 'temporary',
+		rules TEXT,
+		default_utm_params TEXT,
+		status TEXT DEFAULT 'active',
+		expires_at INTEGER,
+		password_hash TEXT,
+		click_count INTEGER DEFAULT 0,
+		last_click_at INTEGER,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE TABLE clicks (
+		id TEXT PRIMARY KEY,
+		link_id TEXT NOT NULL,
+		short_code TEXT NOT NULL,
+		timestamp INTEGER NOT NULL,
+		ip_address TEXT,
+		country_code TEXT,
+		city TEXT,
+		device_type TEXT,
+		os TEXT,
+		browser TEXT,
+		referrer_domain TEXT,
+		utm_source TEXT,
+		utm_medium TEXT,
+		utm_campaign TEXT,
+		utm_term TEXT,
+		utm_content TEXT,
+		destination_url TEXT NOT NULL,
+		qr_variant TEXT,
+		visitor_id TEXT
+	);
+	CREATE TABLE aggregation_checkpoints (
+		job TEXT PRIMARY KEY,
+		last_date TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE TABLE report_subscriptions (
+		id TEXT PRIMARY KEY,
+		name TEXT,
+		frequency TEXT NOT NULL,
+		scope TEXT NOT NULL DEFAULT 'org',
+		link_ids TEXT,
+		campaign TEXT,
+		recipients TEXT NOT NULL,
+		timezone TEXT NOT NULL DEFAULT 'UTC',
+		created_by TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		last_sent_at INTEGER,
+		last_error TEXT,
+		next_run_at INTEGER NOT NULL
+	);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	return db
+}
+
+func insertLink(t *testing.T, db *sql.DB, id, code, title string) {
+	_, err := db.Exec(`INSERT INTO links (id, short_code, destination_url, title, created_by, password_hash, created_at, updated_at)
+		VALUES (?, ?, ?, ?, 'user_1', '', 0, 0)`, id, code, "https://example.com/"+code, title)
+	if err != nil {
+		t.Fatalf("Failed to insert link: %v", err)
+	}
+}
+
+func insertClick(t *testing.T, db *sql.DB, id, linkID string, ts time.Time, visitor, country, campaign string) {
+	_, err := db.Exec(`INSERT INTO clicks (id, link_id, short_code, timestamp, visitor_id, country_code, utm_campaign, destination_url)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 'https://example.com')`, id, linkID, linkID, ts.UnixMilli(), visitor, country, campaign)
+	if err != nil {
+		t.Fatalf("Failed to insert click: %v", err)
+	}
+}
+
+type recordingSender struct {
+	sent []*mailer.Message
+	err  error
+}
+
+func (r *recordingSender) Send(msg *mailer.Message) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.sent = append(r.sent, msg)
+	return nil
+}
+
+func TestSubscription_Schedule(t *testing.T) {
+	ny, _ := time.LoadLocation("America/New_York")
+
+	// Created on a Wednesday; the week closes at local midnight Sunday and is
+	// sent an hour later
+	sub := &Subscription{Frequency: FrequencyWeekly, Timezone: "America/New_York", Recipients: []string{"Ann <ann@example.com>"}}
+	if err := sub.Validate(time.Date(2026, 3, 11, 15, 0, 0, 0, ny)); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if want := time.Date(2026, 3, 16, 1, 0, 0, 0, ny).Unix(); sub.NextRunAt != want {
+		t.Errorf("NextRunAt = %v, want %v", time.Unix(sub.NextRunAt, 0).In(ny), time.Unix(want, 0).In(ny))
+	}
+	if sub.Scope != ScopeOrg || sub.Recipients[0] != "ann@example.com" {
+		t.Errorf("Unexpected defaults: %+v", sub)
+	}
+
+	start, end := sub.LastPeriod(time.Unix(sub.NextRunAt, 0))
+	if !start.Equal(time.Date(2026, 3, 9, 0, 0, 0, 0, ny)) || !end.Equal(time.Date(2026, 3, 16, 0, 0, 0, 0, ny)) {
+		t.Errorf("LastPeriod = %v – %v", start, end)
+	}
+
+	monthly := &Subscription{Frequency: FrequencyMonthly, Timezone: "UTC"}
+	start, end = monthly.LastPeriod(time.Date(2026, 4, 1, 2, 0, 0, 0, time.UTC))
+	if start.Format("2006-01-02") != "2026-03-01" || end.Format("2006-01-02") != "2026-04-01" {
+		t.Errorf("Monthly LastPeriod = %v – %v", start, end)
+	}
+	if next := monthly.NextRun(time.Date(2026, 4, 1, 2, 0, 0, 0, time.UTC)); !next.Equal(time.Date(2026, 5, 1, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("Monthly NextRun = %v", next)
+	}
+
+	for _, bad := range []Subscription{
+		{Frequency: "hourly", Recipients: []string{"a@example.com"}},
+		{Frequency: FrequencyDaily},
+		{Frequency: FrequencyDaily, Recipients: []string{"not an address"}},
+		{Frequency: FrequencyDaily, Scope: ScopeLinks, Recipients: []string{"a@example.com"}},
+		{Frequency: FrequencyDaily, Scope: ScopeCampaign, Recipients: []string{"a@example.com"}},
+		{Frequency: FrequencyDaily, Timezone: "Mars/Olympus", Recipients: []string{"a@example.com"}},
+	} {
+		if err := bad.Validate(time.Now()); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestService_SendDue(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	insertLink(t, db, "l1", "launch", "Launch post")
+	insertLink(t, db, "l2", "docs", "")
+	insertLink(t, db, "l3", "other", "")
+
+	// Week of Monday March 9, 2026 (UTC)
+	monday := time.Date(2026, 3, 9, 10, 0, 0, 0, time.UTC)
+	insertClick(t, db, "c1", "l1", monday, "v1", "US", "spring")
+	insertClick(t, db, "c2", "l1", monday.Add(time.Hour), "v2", "DE", "spring")
+	insertClick(t, db, "c3", "l2", monday.AddDate(0, 0, 2), "v1", "US", "")
+	insertClick(t, db, "c4", "l3", monday.AddDate(0, 0, 3), "v3", "FR", "")  // Not in scope
+	insertClick(t, db, "c5", "l1", monday.AddDate(0, 0, -7), "v1", "US", "") // Previous week
+
+	repo := NewRepository(db)
+	created := time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC)
+	sub := &Subscription{
+		ID:         "r1",
+		Name:       "Acme launch",
+		Frequency:  FrequencyWeekly,
+		Scope:      ScopeLinks,
+		LinkIDs:    []string{"l1", "l2"},
+		Recipients: []string{"am@example.com"},
+		CreatedBy:  "user_1",
+		CreatedAt:  created.Unix(),
+	}
+	if err := sub.Validate(created); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if err := repo.Create(sub); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	service := NewService(db)
+	sender := &recordingSender{}
+
+	// Nothing is due before the week closes
+	if n, err := service.SendDue(sender, "Acme", "https://app.trackr.io", created.AddDate(0, 0, 2)); err != nil || n != 0 {
+		t.Fatalf("SendDue before the period closed = %d, %v", n, err)
+	}
+
+	due := time.Unix(sub.NextRunAt, 0)
+	if n, err := service.SendDue(sender, "Acme", "https://app.trackr.io", due); err != nil || n != 1 {
+		t.Fatalf("SendDue = %d, %v; want 1", n, err)
+	}
+
+	msg := sender.sent[0]
+	if msg.Subject != "Acme launch: Mar 9 – Mar 15, 2026" || msg.To[0] != "am@example.com" {
+		t.Errorf("Unexpected message: %q to %v", msg.Subject, msg.To)
+	}
+	for _, want := range []string{"launch", "Launch post", "https://example.com/docs", "200% vs previous", `src="cid:clicks-chart"`, "Top countries"} {
+		if !strings.Contains(msg.HTML, want) {
+			t.Errorf("HTML report is missing %q", want)
+		}
+	}
+	if strings.Contains(msg.HTML, "other") {
+		t.Error("Report includes a link outside its scope")
+	}
+	if !strings.Contains(msg.Text, "Clicks: 3 (+200% vs previous)") || !strings.Contains(msg.Text, "Unique visitors: 2") {
+		t.Errorf("Unexpected text report:\n%s", msg.Text)
+	}
+	if len(msg.Inline) != 1 {
+		t.Fatalf("Expected an inline chart")
+	}
+	if _, err := png.Decode(bytes.NewReader(msg.Inline[0].Data)); err != nil {
+		t.Errorf("Chart is not a PNG: %v", err)
+	}
+
+	// Rescheduled for the next week and not sent twice
+	stored, err := repo.Get("r1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if stored.LastSentAt != due.Unix() || stored.NextRunAt != due.AddDate(0, 0, 7).Unix() {
+		t.Errorf("Unexpected schedule after sending: %+v", stored)
+	}
+	if n, _ := service.SendDue(sender, "Acme", "", due.Add(time.Minute)); n != 0 {
+		t.Errorf("Report sent twice")
+	}
+
+	// A failed delivery is retried later
+	failing := &recordingSender{err: errors.New("connection refused")}
+	next := time.Unix(stored.NextRunAt, 0)
+	if n, err := service.SendDue(failing, "Acme", "", next); err != nil || n != 0 {
+		t.Fatalf("SendDue with failing sender = %d, %v", n, err)
+	}
+	stored, _ = repo.Get("r1")
+	if stored.LastError != "connection refused" || stored.NextRunAt != next.Add(retryDelay).Unix() {
+		t.Errorf("Unexpected state after a failure: %+v", stored)
+	}
+}
+
+func TestService_BuildCampaignReport(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	insertLink(t, db, "l1", "launch", "")
+	day := time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)
+	insertClick(t, db, "c1", "l1", day.Add(9*time.Hour), "v1", "US", "spring")
+	insertClick(t, db, "c2", "l1", day.Add(9*time.Hour+time.Minute), "v2", "", "spring")
+	insertClick(t, db, "c3", "l1", day.Add(9*time.Hour+2*time.Minute), "v1", "US", "spring")
+	insertClick(t, db, "c4", "l1", day.Add(15*time.Hour), "v3", "US", "summer")
+
+	sub := &Subscription{Frequency: FrequencyDaily, Scope: ScopeCampaign, Campaign: "spring", Timezone: "UTC", Recipients: []string{"a@example.com"}}
+	report, err := NewService(db).Build(sub, "Acme", day.AddDate(0, 0, 1).Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if report.Clicks != 3 || report.UniqueVisitors != 2 || len(report.Series) != 24 || report.Series[9].Clicks != 3 || report.Series[15].Clicks != 0 {
+		t.Errorf("Unexpected report: clicks %d, series %+v", report.Clicks, report.Series)
+	}
+	if len(report.TopCountries) != 2 || report.TopCountries[0].Value != "US" {
+		t.Errorf("Unexpected countries: %+v", report.TopCountries)
+	}
+
+	html, err := report.Preview("")
+	if err != nil {
+		t.Fatalf("Preview failed: %v", err)
+	}
+	if !strings.Contains(html, "Daily report for Acme: Mon Mar 9, 2026") || !strings.Contains(html, "data:image/png;base64,") || !strings.Contains(html, "Unknown") {
+		t.Errorf("Unexpected preview:\n%s", html)
+	}
+}
@@ -0,0 +1,128 @@
+package reports
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) Create(s *Subscription) error {
+	linkIDs, err := json.Marshal(s.LinkIDs)
+	if err != nil {
+		return err
+	}
+	recipients, err := json.Marshal(s.Recipients)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`
+		INSERT INTO report_subscriptions (id, name, frequency, scope, link_ids, campaign, recipients, timezone,
+			created_by, created_at, next_run_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.ID, nullIfEmpty(s.Name), s.Frequency, s.Scope, string(linkIDs), nullIfEmpty(s.Campaign), string(recipients),
+		s.Timezone, s.CreatedBy, s.CreatedAt, s.NextRunAt)
+	return err
+}
+
+const subscriptionColumns = `id, name, frequency, scope, link_ids, campaign, recipients, timezone,
+	created_by, created_at, last_sent_at, last_error, next_run_at`
+
+func (r *Repository) Get(id string) (*Subscription, error) {
+	s, err := scanSubscription(r.db.QueryRow("SELECT "+subscriptionColumns+" FROM report_subscriptions WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrSubscriptionNotFound
+	}
+	return s, err
+}
+
+func (r *Repository) List() ([]*Subscription, error) {
+	return r.query("SELECT " + subscriptionColumns + " FROM report_subscriptions ORDER BY created_at")
+}
+
+// ListDue returns up to limit subscriptions whose next run is at or before now
+// (unix seconds), longest overdue first.
+func (r *Repository) ListDue(now int64, limit int) ([]*Subscription, error) {
+	return r.query("SELECT "+subscriptionColumns+" FROM report_subscriptions WHERE next_run_at <= ? ORDER BY next_run_at LIMIT ?", now, limit)
+}
+
+func (r *Repository) Delete(id string) (bool, error) {
+	res, err := r.db.Exec("DELETE FROM report_subscriptions WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// MarkSent records a delivered report and schedules the next one.
+func (r *Repository) MarkSent(id string, sentAt, nextRunAt int64) error {
+	_, err := r.db.Exec(`
+		UPDATE report_subscriptions SET last_sent_at = ?, last_error = NULL, next_run_at = ? WHERE id = ?
+	`, sentAt, nextRunAt, id)
+	return err
+}
+
+// MarkFailed records a failed delivery and when to try again.
+func (r *Repository) MarkFailed(id, errMsg string, retryAt int64) error {
+	_, err := r.db.Exec(`
+		UPDATE report_subscriptions SET last_error = ?, next_run_at = ? WHERE id = ?
+	`, errMsg, retryAt, id)
+	return err
+}
+
+func (r *Repository) query(query string, args ...interface{}) ([]*Subscription, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []*Subscription{}
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+func scanSubscription(row interface{ Scan(...interface{}) error }) (*Subscription, error) {
+	s := &Subscription{}
+	var name, linkIDs, campaign, lastError sql.NullString
+	var recipients string
+	var lastSentAt sql.NullInt64
+	err := row.Scan(&s.ID, &name, &s.Frequency, &s.Scope, &linkIDs, &campaign, &recipients, &s.Timezone,
+		&s.CreatedBy, &s.CreatedAt, &lastSentAt, &lastError, &s.NextRunAt)
+	if err != nil {
+		return nil, err
+	}
+	if linkIDs.Valid {
+		if err := json.Unmarshal([]byte(linkIDs.String), &s.LinkIDs); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal([]byte(recipients), &s.Recipients); err != nil {
+		return nil, err
+	}
+	s.Name = name.String
+	s.Campaign = campaign.String
+	s.LastError = lastError.String
+	s.LastSentAt = lastSentAt.Int64
+	return s, nil
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,274 @@
+package reports
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"trackr/internal/engine/analytics"
+	"trackr/internal/engine/links"
+	"trackr/internal/pkg/mailer"
+
+	"github.com/google/uuid"
+)
+
+const (
+	topLinksLimit  = 10
+	topValuesLimit = 5
+	dueBatchSize   = 100
+
+	// retryDelay spaces out attempts after a failed delivery
+	retryDelay = time.Hour
+)
+
+var ErrUnknownLinks = errors.New("link_ids contains links that do not exist")
+
+// Report is one period's summary for a subscription.
+type Report struct {
+	Subscription *Subscription
+	OrgName      string
+	Start, End   time.Time // In the subscription's timezone; End is exclusive
+
+	Clicks                 int
+	UniqueVisitors         int
+	PreviousClicks         int
+	PreviousUniqueVisitors int
+
+	Series       []SeriesPoint // Per hour for daily reports, per day otherwise
+	TopLinks     []LinkRow
+	TopCountries []ValueRow
+	TopReferrers []ValueRow
+	TopDevices   []ValueRow
+}
+
+type SeriesPoint struct {
+	Label  string
+	Clicks int
+}
+
+type LinkRow struct {
+	ShortCode      string
+	Title          string
+	DestinationURL string
+	Clicks         int
+}
+
+type ValueRow struct {
+	Value  string
+	Clicks int
+}
+
+type Service struct {
+	repo      *Repository
+	analytics *analytics.Service
+	links     *links.Repository
+}
+
+func NewService(db *sql.DB) *Service {
+	return &Service{
+		repo:      NewRepository(db),
+		analytics: analytics.NewService(analytics.NewRepository(db)),
+		links:     links.NewRepository(db),
+	}
+}
+
+// Create stores a new subscription after checking its links exist. sub must
+// already be validated.
+func (s *Service) Create(sub *Subscription, now time.Time) error {
+	if sub.Scope == ScopeLinks {
+		found, err := s.links.ListByIDs(sub.LinkIDs)
+		if err != nil {
+			return err
+		}
+		if len(found) != len(sub.LinkIDs) {
+			return ErrUnknownLinks
+		}
+	}
+
+	sub.ID = uuid.New().String()
+	sub.CreatedAt = now.Unix()
+	return s.repo.Create(sub)
+}
+
+// Build summarizes the last complete period of sub as of now, with the
+// period before it for comparison.
+func (s *Service) Build(sub *Subscription, orgName string, now time.Time) (*Report, error) {
+	start, end := sub.LastPeriod(now)
+	prevStart := periodStart(sub.Frequency, start.Add(-time.Nanosecond), sub.location())
+	report := &Report{Subscription: sub, OrgName: orgName, Start: start, End: end}
+
+	totals, err := s.query(sub, start, end, "", nil, 1)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := s.query(sub, prevStart, start, "", nil, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(totals) > 0 {
+		report.Clicks = totals[0].Metrics[analytics.MetricClicks]
+		report.UniqueVisitors = totals[0].Metrics[analytics.MetricUniqueVisitors]
+	}
+	if len(previous) > 0 {
+		report.PreviousClicks = previous[0].Metrics[analytics.MetricClicks]
+		report.PreviousUniqueVisitors = previous[0].Metrics[analytics.MetricUniqueVisitors]
+	}
+
+	if report.Series, err = s.series(sub, start, end); err != nil {
+		return nil, err
+	}
+	if report.TopLinks, err = s.topLinks(sub, start, end); err != nil {
+		return nil, err
+	}
+	for _, top := range []struct {
+		dimension string
+		dst       *[]ValueRow
+	}{
+		{"country", &report.TopCountries},
+		{"referrer_domain", &report.TopReferrers},
+		{"device", &report.TopDevices},
+	} {
+		rows, err := s.query(sub, start, end, "", []string{top.dimension}, topValuesLimit)
+		if err != nil {
+			return nil, err
+		}
+		*top.dst = []ValueRow{}
+		for _, row := range rows {
+			*top.dst = append(*top.dst, ValueRow{Value: row.Dimensions[top.dimension], Clicks: row.Metrics[analytics.MetricClicks]})
+		}
+	}
+	return report, nil
+}
+
+// query runs an analytics query over [start, end) narrowed to the
+// subscription's scope. Totals (no interval or dimensions) include unique
+// visitors.
+func (s *Service) query(sub *Subscription, start, end time.Time, interval string, dimensions []string, limit int) ([]analytics.QueryRow, error) {
+	q := &analytics.Query{
+		Start:      start.Format(time.RFC3339),
+		End:        end.Format(time.RFC3339),
+		Timezone:   sub.Timezone,
+		Interval:   interval,
+		Dimensions: dimensions,
+		Metrics:    []string{analytics.MetricClicks},
+		Limit:      limit,
+	}
+	if interval == "" && len(dimensions) == 0 {
+		q.Metrics = append(q.Metrics, analytics.MetricUniqueVisitors)
+	}
+	switch sub.Scope {
+	case ScopeLinks:
+		q.Filters = []analytics.Filter{{Dimension: "link", Op: "in", Values: sub.LinkIDs}}
+	case ScopeCampaign:
+		q.Filters = []analytics.Filter{{Dimension: "utm_campaign", Op: "eq", Values: []string{sub.Campaign}}}
+	}
+
+	result, err := s.analytics.Query(q, end)
+	if err != nil {
+		return nil, err
+	}
+	return result.Rows, nil
+}
+
+// series returns clicks per hour (daily reports) or per day, with empty
+// buckets filled in.
+func (s *Service) series(sub *Subscription, start, end time.Time) ([]SeriesPoint, error) {
+	hourly := sub.Frequency == FrequencyDaily
+	interval, key, label := analytics.GranularityDay, "2006-01-02", "Jan 2"
+	if hourly {
+		interval, key, label = analytics.GranularityHour, time.RFC3339, "15:04"
+	}
+
+	// At most one row per bucket, so the limit only has to exceed a month of days
+	rows, err := s.query(sub, start, end, interval, nil, 1000)
+	if err != nil {
+		return nil, err
+	}
+	clicks := make(map[string]int, len(rows))
+	for _, row := range rows {
+		clicks[row.Bucket] = row.Metrics[analytics.MetricClicks]
+	}
+
+	points := []SeriesPoint{}
+	for t := start; t.Before(end); {
+		points = append(points, SeriesPoint{Label: t.Format(label), Clicks: clicks[t.Format(key)]})
+		if hourly {
+			t = t.Add(time.Hour)
+		} else {
+			t = t.AddDate(0, 0, 1)
+		}
+	}
+	return points, nil
+}
+
+// topLinks returns the most clicked links with their short codes and titles.
+// Links deleted since are listed by ID.
+func (s *Service) topLinks(sub *Subscription, start, end time.Time) ([]LinkRow, error) {
+	rows, err := s.query(sub, start, end, "", []string{"link"}, topLinksLimit)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row.Dimensions["link"]
+	}
+	found, err := s.links.ListByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*links.Link, len(found))
+	for _, link := range found {
+		byID[link.ID] = link
+	}
+
+	out := make([]LinkRow, len(rows))
+	for i, row := range rows {
+		out[i] = LinkRow{ShortCode: ids[i], Clicks: row.Metrics[analytics.MetricClicks]}
+		if link := byID[ids[i]]; link != nil {
+			out[i].ShortCode = link.ShortCode
+			out[i].Title = link.Title
+			out[i].DestinationURL = link.DestinationURL
+		}
+	}
+	return out, nil
+}
+
+// SendDue builds and sends every report due at now and reschedules it. A
+// failed delivery is retried after retryDelay; once the next period has
+// closed, only that one is sent. Returns how many reports were sent.
+func (s *Service) SendDue(sender mailer.Sender, orgName, appURL string, now time.Time) (int, error) {
+	due, err := s.repo.ListDue(now.Unix(), dueBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, sub := range due {
+		err := s.send(sender, sub, orgName, appURL, now)
+		if err != nil {
+			log.Printf("Report %s for %s failed: %v", sub.ID, orgName, err)
+			if err := s.repo.MarkFailed(sub.ID, err.Error(), now.Add(retryDelay).Unix()); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		sent++
+		if err := s.repo.MarkSent(sub.ID, now.Unix(), sub.NextRun(now).Unix()); err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+func (s *Service) send(sender mailer.Sender, sub *Subscription, orgName, appURL string, now time.Time) error {
+	report, err := s.Build(sub, orgName, now)
+	if err != nil {
+		return err
+	}
+	msg, err := report.Message(appURL)
+	if err != nil {
+		return err
+	}
+	return sender.Send(msg)
+}
@@ -0,0 +1,157 @@
+package reports
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const (
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+
+	ScopeOrg      = "org"      // Every link
+	ScopeLinks    = "links"    // The links in LinkIDs
+	ScopeCampaign = "campaign" // Clicks tagged with utm_campaign = Campaign
+
+	maxRecipients = 20
+	maxScopeLinks = 100
+
+	// SendDelay holds a report back after its period closes so clicks still
+	// being logged at midnight are counted.
+	SendDelay = time.Hour
+)
+
+var ErrSubscriptionNotFound = errors.New("report subscription not found")
+
+// Subscription sends a summary of the last complete day, week (Monday to
+// Sunday) or calendar month in Timezone to its recipients.
+type Subscription struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name,omitempty"`
+	Frequency  string   `json:"frequency"`
+	Scope      string   `json:"scope"`
+	LinkIDs    []string `json:"link_ids,omitempty"`
+	Campaign   string   `json:"campaign,omitempty"`
+	Recipients []string `json:"recipients"`
+	Timezone   string   `json:"timezone"`
+	CreatedBy  string   `json:"created_by"`
+	CreatedAt  int64    `json:"created_at"`
+	LastSentAt int64    `json:"last_sent_at,omitempty"`
+	LastError  string   `json:"last_error,omitempty"`
+	NextRunAt  int64    `json:"next_run_at"`
+}
+
+// Validate applies defaults, checks the subscription and schedules its first
+// run after now.
+func (s *Subscription) Validate(now time.Time) error {
+	if s.Scope == "" {
+		s.Scope = ScopeOrg
+	}
+	if s.Timezone == "" {
+		s.Timezone = "UTC"
+	}
+
+	switch s.Frequency {
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly:
+	default:
+		return errors.New("frequency must be daily, weekly or monthly")
+	}
+
+	switch s.Scope {
+	case ScopeOrg:
+		s.LinkIDs, s.Campaign = nil, ""
+	case ScopeLinks:
+		if len(s.LinkIDs) == 0 || len(s.LinkIDs) > maxScopeLinks {
+			return fmt.Errorf("scope links takes 1 to %d link_ids", maxScopeLinks)
+		}
+		seen := map[string]bool{}
+		ids := s.LinkIDs[:0]
+		for _, id := range s.LinkIDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		s.LinkIDs, s.Campaign = ids, ""
+	case ScopeCampaign:
+		if strings.TrimSpace(s.Campaign) == "" {
+			return errors.New("scope campaign requires a campaign")
+		}
+		s.LinkIDs = nil
+	default:
+		return errors.New("scope must be org, links or campaign")
+	}
+
+	if len(s.Recipients) == 0 || len(s.Recipients) > maxRecipients {
+		return fmt.Errorf("between 1 and %d recipients are required", maxRecipients)
+	}
+	for i, r := range s.Recipients {
+		addr, err := mail.ParseAddress(r)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q", r)
+		}
+		s.Recipients[i] = addr.Address
+	}
+
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	s.NextRunAt = nextRun(s.Frequency, now, loc).Unix()
+	return nil
+}
+
+func (s *Subscription) location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// LastPeriod returns the most recent period that had closed SendDelay before
+// now. A worker that was down for a while reports only the latest period.
+func (s *Subscription) LastPeriod(now time.Time) (start, end time.Time) {
+	loc := s.location()
+	end = periodStart(s.Frequency, now.Add(-SendDelay), loc)
+	start = periodStart(s.Frequency, end.Add(-time.Nanosecond), loc)
+	return start, end
+}
+
+// NextRun returns when the period open at now will be reported.
+func (s *Subscription) NextRun(now time.Time) time.Time {
+	return nextRun(s.Frequency, now, s.location())
+}
+
+func nextRun(frequency string, now time.Time, loc *time.Location) time.Time {
+	start := periodStart(frequency, now.Add(-SendDelay), loc)
+	return addPeriod(frequency, start).Add(SendDelay)
+}
+
+// periodStart returns local midnight starting the day, Monday-based week or
+// month containing t.
+func periodStart(frequency string, t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	switch frequency {
+	case FrequencyWeekly:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case FrequencyMonthly:
+		return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+	}
+	return day
+}
+
+func addPeriod(frequency string, start time.Time) time.Time {
+	switch frequency {
+	case FrequencyWeekly:
+		return start.AddDate(0, 0, 7)
+	case FrequencyMonthly:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
@@ -0,0 +1,111 @@
+package webhooks
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	"trackr/internal/platform/repositories"
+)
+
+// ClickBatcher gathers clicks per organization and queues them as one
+// click.created event per size clicks, or per interval for quieter orgs, so a
+// busy link does not turn into one delivery per click.
+type ClickBatcher struct {
+	size     int
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*clickBatch // By org ID
+}
+
+type clickBatch struct {
+	db      *sql.DB
+	clicks  []interface{}
+	started time.Time
+}
+
+// ClickBatch is the data of a click.created event.
+type ClickBatch struct {
+	Count  int           `json:"count"`
+	Clicks []interface{} `json:"clicks"`
+}
+
+func NewClickBatcher(size int, interval time.Duration) *ClickBatcher {
+	if size < 1 {
+		size = 1
+	}
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &ClickBatcher{size: size, interval: interval, pending: map[string]*clickBatch{}}
+}
+
+// Add queues a click for orgID, whose tenant database is db. A full batch is
+// dispatched straight away.
+func (b *ClickBatcher) Add(orgID string, db *sql.DB, click interface{}) {
+	b.mu.Lock()
+	batch := b.pending[orgID]
+	if batch == nil {
+		batch = &clickBatch{db: db, started: time.Now()}
+		b.pending[orgID] = batch
+	}
+	batch.clicks = append(batch.clicks, click)
+	full := len(batch.clicks) >= b.size
+	if full {
+		delete(b.pending, orgID)
+	}
+	b.mu.Unlock()
+
+	if full {
+		b.dispatch(orgID, batch)
+	}
+}
+
+// Flush dispatches every batch started at least one interval before now, or
+// every batch when all is set.
+func (b *ClickBatcher) Flush(now time.Time, all bool) {
+	b.mu.Lock()
+	due := map[string]*clickBatch{}
+	for orgID, batch := range b.pending {
+		if all || now.Sub(batch.started) >= b.interval {
+			due[orgID] = batch
+			delete(b.pending, orgID)
+		}
+	}
+	b.mu.Unlock()
+
+	for orgID, batch := range due {
+		b.dispatch(orgID, batch)
+	}
+}
+
+// Run flushes batches as their interval elapses until stop is closed, then
+// flushes whatever is left.
+func (b *ClickBatcher) Run(stop <-chan struct{}) {
+	tick := b.interval / 4
+	if tick < time.Second {
+		tick = time.Second
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			b.Flush(now, false)
+		case <-stop:
+			b.Flush(time.Now(), true)
+			return
+		}
+	}
+}
+
+func (b *ClickBatcher) dispatch(orgID string, batch *clickBatch) {
+	dispatcher := NewDispatcher(repositories.NewWebhookRepository(batch.db))
+	data := &ClickBatch{Count: len(batch.clicks), Clicks: batch.clicks}
+	if err := dispatcher.Dispatch(EventClickCreated, orgID, data); err != nil {
+		log.Printf("Webhooks: failed to queue %d clicks for %s: %v", data.Count, orgID, err)
+	}
+}
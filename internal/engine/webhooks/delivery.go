@@ -0,0 +1,256 @@
+package webhooks
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"trackr/internal/pkg/netguard"
+	"trackr/internal/platform/models"
+	"trackr/internal/platform/repositories"
+	"trackr/pkg/webhooksig"
+)
+
+const (
+	BackoffLinear      = "linear"
+	BackoffExponential = "exponential"
+
+	// maxLoggedResponseBody is how much of a receiver's response is kept in
+	// the delivery log
+	maxLoggedResponseBody = 4 << 10
+)
+
+// RetryPolicy decides when a failed delivery is tried again, and when an
+// endpoint that keeps failing is disabled.
+type RetryPolicy struct {
+	MaxAttempts  int           // First attempt included
+	Backoff      string        // linear or exponential
+	BaseDelay    time.Duration // Wait after the first failed attempt
+	MaxDelay     time.Duration // Cap on any one wait; 0 for none
+	DisableAfter time.Duration // Failing this long without a success disables the webhook; 0 never does
+}
+
+// Delay is the wait after the given failed attempt (1-based).
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := p.BaseDelay
+	if p.Backoff == BackoffLinear {
+		delay *= time.Duration(attempt)
+	} else {
+		for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+			delay *= 2
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// Deliverer sends queued deliveries. One Deliverer is shared by every tenant
+// so that at most workers requests are in flight at once.
+//
+// Endpoints are user-supplied: a client without its own Transport is given
+// one that only dials public addresses, which also covers redirects and
+// hosts re-pointed after the webhook was saved.
+type Deliverer struct {
+	client *http.Client
+	policy RetryPolicy
+	sem    chan struct{}
+}
+
+func NewDeliverer(client *http.Client, policy RetryPolicy, workers int) *Deliverer {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if client.Transport == nil {
+		guarded := *client
+		guarded.Transport = netguard.NewTransport(5 * time.Second)
+		client = &guarded
+	}
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = 30 * time.Second
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return &Deliverer{client: client, policy: policy, sem: make(chan struct{}, workers)}
+}
+
+// DeliverDue attempts up to limit due deliveries from one tenant and returns
+// how many succeeded and failed.
+func (d *Deliverer) DeliverDue(repo *repositories.WebhookRepository, now time.Time, limit int) (delivered, failed int, err error) {
+	due, err := repo.DueDeliveries(now.Unix(), limit)
+	if err != nil || len(due) == 0 {
+		return 0, 0, err
+	}
+
+	// Each webhook's deliveries go out one at a time, oldest first, so a slow
+	// endpoint ties up one worker rather than all of them. The first failure
+	// ends the webhook's turn; the rest wait for the next run.
+	var order []string
+	byWebhook := map[string][]*models.WebhookDelivery{}
+	for _, delivery := range due {
+		if _, ok := byWebhook[delivery.WebhookID]; !ok {
+			order = append(order, delivery.WebhookID)
+		}
+		byWebhook[delivery.WebhookID] = append(byWebhook[delivery.WebhookID], delivery)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, webhookID := range order {
+		webhook, err := repo.GetByID(webhookID)
+		if err != nil {
+			log.Printf("Webhooks: skipping deliveries for %s: %v", webhookID, err)
+			continue
+		}
+
+		d.sem <- struct{}{}
+		wg.Add(1)
+		go func(webhook *models.Webhook, deliveries []*models.WebhookDelivery) {
+			defer func() {
+				<-d.sem
+				wg.Done()
+			}()
+			for _, delivery := range deliveries {
+				ok, _ := d.attempt(repo, webhook, delivery, now, true)
+				mu.Lock()
+				if ok {
+					delivered++
+				} else {
+					failed++
+				}
+				mu.Unlock()
+				if !ok {
+					return
+				}
+			}
+		}(webhook, byWebhook[webhookID])
+	}
+	wg.Wait()
+	return delivered, failed, nil
+}
+
+// DeliverNow makes a single attempt at a new delivery, e.g. a manual
+// redelivery or a test ping, and returns the logged attempt. A failure is not
+// retried: the caller sees it and can try again.
+func (d *Deliverer) DeliverNow(repo *repositories.WebhookRepository, webhook *models.Webhook, delivery *models.WebhookDelivery) (*models.WebhookDeliveryAttempt, error) {
+	if err := repo.CreateDeliveries([]*models.WebhookDelivery{delivery}); err != nil {
+		return nil, err
+	}
+	_, attempt := d.attempt(repo, webhook, delivery, time.Now(), false)
+	return attempt, nil
+}
+
+// attempt sends one delivery, logs the request and records the outcome on the
+// delivery and the webhook. A failure is rescheduled when retry is set and
+// attempts remain; a webhook failing for policy.DisableAfter is disabled.
+func (d *Deliverer) attempt(repo *repositories.WebhookRepository, webhook *models.Webhook, delivery *models.WebhookDelivery, now time.Time, retry bool) (bool, *models.WebhookDeliveryAttempt) {
+	delivery.Attempts++
+	attempt := d.send(webhook, delivery)
+	attempt.Attempt = delivery.Attempts
+	attempt.CreatedAt = now.Unix()
+	if err := repo.InsertDeliveryAttempt(attempt); err != nil {
+		log.Printf("Webhooks: failed to log attempt for delivery %s: %v", delivery.ID, err)
+	}
+
+	delivery.ResponseStatus = attempt.ResponseStatus
+	if attempt.Error == "" {
+		delivery.Status = models.DeliveryStatusDelivered
+		delivery.DeliveredAt = now.Unix()
+		delivery.LastError = ""
+		if err := repo.UpdateDelivery(delivery); err != nil {
+			log.Printf("Webhooks: failed to record delivery %s: %v", delivery.ID, err)
+		}
+		if err := repo.RecordSuccess(webhook.ID, delivery.DeliveredAt); err != nil {
+			log.Printf("Webhooks: failed to update webhook %s: %v", webhook.ID, err)
+		}
+		return true, attempt
+	}
+
+	delivery.LastError = attempt.Error
+	if !retry || delivery.Attempts >= d.policy.MaxAttempts {
+		delivery.Status = models.DeliveryStatusFailed
+	} else {
+		delivery.NextAttemptAt = now.Add(d.policy.Delay(delivery.Attempts)).Unix()
+	}
+	if err := repo.UpdateDelivery(delivery); err != nil {
+		log.Printf("Webhooks: failed to record delivery %s: %v", delivery.ID, err)
+	}
+
+	failingSince, err := repo.RecordFailure(webhook.ID, delivery.LastError, now.Unix())
+	if err != nil {
+		log.Printf("Webhooks: failed to update webhook %s: %v", webhook.ID, err)
+		return false, attempt
+	}
+	if d.policy.DisableAfter > 0 && now.Sub(time.Unix(failingSince, 0)) >= d.policy.DisableAfter {
+		log.Printf("Webhooks: disabling %s after failing since %s: %s", webhook.ID, time.Unix(failingSince, 0).UTC().Format(time.RFC3339), delivery.LastError)
+		if err := repo.UpdateStatus(webhook.ID, "failed"); err != nil {
+			log.Printf("Webhooks: failed to disable %s: %v", webhook.ID, err)
+		}
+		if err := repo.FailPendingDeliveries(webhook.ID, "webhook disabled after repeated failures"); err != nil {
+			log.Printf("Webhooks: failed to drop pending deliveries for %s: %v", webhook.ID, err)
+		}
+	}
+	return false, attempt
+}
+
+// send POSTs the delivery's payload and describes the exchange. Anything but a
+// 2xx response is an error.
+func (d *Deliverer) send(webhook *models.Webhook, delivery *models.WebhookDelivery) *models.WebhookDeliveryAttempt {
+	attempt := &models.WebhookDeliveryAttempt{
+		ID:         "wha_" + uuid.New().String(),
+		DeliveryID: delivery.ID,
+		WebhookID:  webhook.ID,
+		RequestURL: webhook.URL,
+	}
+
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequest("POST", webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Trackr-Webhooks/1.0")
+	req.Header.Set(webhooksig.Header, Sign(webhook, payload, time.Now()))
+	req.Header.Set("X-Trackr-Event", delivery.Event)
+	req.Header.Set("X-Trackr-Delivery", delivery.ID)
+
+	attempt.RequestHeaders = make(map[string]string, len(req.Header))
+	for name := range req.Header {
+		attempt.RequestHeaders[name] = req.Header.Get(name)
+	}
+
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	if err != nil {
+		attempt.LatencyMs = time.Since(start).Milliseconds()
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxLoggedResponseBody))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	attempt.LatencyMs = time.Since(start).Milliseconds()
+	attempt.ResponseStatus = resp.StatusCode
+	attempt.ResponseBody = strings.ToValidUTF8(string(body), "")
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+	}
+	return attempt
+}
@@ -0,0 +1,280 @@
+package webhooks
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"trackr/internal/platform/models"
+	"trackr/internal/platform/repositories"
+)
+
+func setupTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`
+	CREATE TABLE webhooks (
+		id TEXT PRIMARY KEY,
+		url TEXT NOT NULL,
+		events TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		status TEXT DEFAULT 'active',
+		retry_count INTEGER DEFAULT 0,
+		last_triggered_at INTEGER,
+		last_error TEXT,
+		failing_since INTEGER,
+		previous_secret TEXT,
+		previous_secret_expires_at INTEGER,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE TABLE webhook_deliveries (
+		id TEXT PRIMARY KEY,
+		webhook_id TEXT NOT NULL,
+		event_id TEXT NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at INTEGER NOT NULL,
+		response_status INTEGER,
+		last_error TEXT,
+		created_at INTEGER NOT NULL,
+		delivered_at INTEGER,
+		redelivery_of TEXT
+	);
+	CREATE TABLE webhook_delivery_attempts (
+		id TEXT PRIMARY KEY,
+		delivery_id TEXT NOT NULL,
+		webhook_id TEXT NOT NULL,
+		attempt INTEGER NOT NULL,
+		request_url TEXT NOT NULL,
+		request_headers TEXT NOT NULL,
+		response_status INTEGER,
+		response_body TEXT,
+		error TEXT,
+		latency_ms INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+	return db
+}
+
+// receiver answers with whatever status is stored in status and counts requests.
+func receiver(t *testing.T, status *atomic.Int32, hits *atomic.Int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.Header.Get("X-Trackr-Delivery") == "" || r.Header.Get("X-Trackr-Signature") == "" {
+			t.Errorf("Delivery without id or signature headers: %v", r.Header)
+		}
+		w.WriteHeader(int(status.Load()))
+		w.Write([]byte(strings.Repeat("x", 5000)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	exp := RetryPolicy{Backoff: BackoffExponential, BaseDelay: time.Minute, MaxDelay: 10 * time.Minute}
+	lin := RetryPolicy{Backoff: BackoffLinear, BaseDelay: time.Minute}
+
+	for attempt, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 4: 8 * time.Minute, 5: 10 * time.Minute, 60: 10 * time.Minute} {
+		if got := exp.Delay(attempt); got != want {
+			t.Errorf("Exponential Delay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+	if got := lin.Delay(3); got != 3*time.Minute {
+		t.Errorf("Linear Delay(3) = %v, want 3m", got)
+	}
+}
+
+func TestDeliverer_RetriesWithBackoff(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var status, hits atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	srv := receiver(t, &status, &hits)
+
+	repo := repositories.NewWebhookRepository(db)
+	hook := &models.Webhook{URL: srv.URL, Events: []string{"link.broken"}, Secret: "whsec_test"}
+	if err := repo.Create(hook); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	other := &models.Webhook{URL: srv.URL, Events: []string{"link.created"}, Secret: "whsec_other"}
+	repo.Create(other)
+
+	if err := NewDispatcher(repo).Dispatch("link.broken", "org_1", map[string]string{"link_id": "l1"}); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: BackoffExponential, BaseDelay: time.Minute}
+	deliverer := NewDeliverer(srv.Client(), policy, 2)
+	now := time.Now()
+
+	// First attempt fails and is rescheduled a minute out
+	if delivered, failed, err := deliverer.DeliverDue(repo, now, 10); err != nil || delivered != 0 || failed != 1 {
+		t.Fatalf("DeliverDue = %d delivered, %d failed, %v; want one failure", delivered, failed, err)
+	}
+	if _, failed, _ := deliverer.DeliverDue(repo, now.Add(30*time.Second), 10); failed != 0 {
+		t.Errorf("Delivery retried before its backoff elapsed")
+	}
+
+	// Second attempt two minutes after the first
+	deliverer.DeliverDue(repo, now.Add(time.Minute), 10)
+	due, _ := repo.DueDeliveries(now.Add(3*time.Minute).Unix(), 10)
+	if len(due) != 1 || due[0].Attempts != 2 || due[0].NextAttemptAt != now.Add(3*time.Minute).Unix() || due[0].ResponseStatus != 503 {
+		t.Fatalf("After two failures: %+v", due)
+	}
+
+	// The receiver recovers on the third attempt
+	status.Store(http.StatusNoContent)
+	if delivered, _, _ := deliverer.DeliverDue(repo, now.Add(3*time.Minute), 10); delivered != 1 {
+		t.Fatalf("Third attempt not delivered")
+	}
+	delivery, _ := repo.GetDelivery(hook.ID, due[0].ID)
+	if delivery.Status != models.DeliveryStatusDelivered || delivery.Attempts != 3 || delivery.LastError != "" {
+		t.Errorf("Delivered delivery = %+v", delivery)
+	}
+	hook, _ = repo.GetByID(hook.ID)
+	if hook.RetryCount != 0 || hook.FailingSince != 0 || hook.LastTriggeredAt == 0 {
+		t.Errorf("Webhook after success = %+v", hook)
+	}
+	if hits.Load() != 3 {
+		t.Errorf("Receiver got %d requests, want 3 (the unsubscribed webhook gets none)", hits.Load())
+	}
+}
+
+func TestDeliverer_GivesUpAndDisables(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var status, hits atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	srv := receiver(t, &status, &hits)
+
+	repo := repositories.NewWebhookRepository(db)
+	hook := &models.Webhook{URL: srv.URL, Events: []string{"link.broken"}, Secret: "whsec_test"}
+	repo.Create(hook)
+	dispatcher := NewDispatcher(repo)
+	dispatcher.Dispatch("link.broken", "org_1", nil)
+
+	policy := RetryPolicy{MaxAttempts: 2, Backoff: BackoffLinear, BaseDelay: time.Minute, DisableAfter: time.Hour}
+	deliverer := NewDeliverer(srv.Client(), policy, 1)
+	now := time.Now()
+
+	deliverer.DeliverDue(repo, now, 10)
+	deliverer.DeliverDue(repo, now.Add(time.Minute), 10)
+	if due, _ := repo.DueDeliveries(now.Add(24*time.Hour).Unix(), 10); len(due) != 0 {
+		t.Errorf("Delivery still pending after its last attempt: %+v", due[0])
+	}
+
+	// Later events keep failing until the endpoint has been down for an hour
+	dispatcher.Dispatch("link.broken", "org_1", nil)
+	dispatcher.Dispatch("link.broken", "org_1", nil)
+	deliverer.DeliverDue(repo, now.Add(time.Hour), 10)
+
+	hook, _ = repo.GetByID(hook.ID)
+	if hook.Status != "failed" || hook.RetryCount != 3 {
+		t.Errorf("Webhook = %s with %d failures, want failed with 3", hook.Status, hook.RetryCount)
+	}
+	var pending int
+	db.QueryRow("SELECT COUNT(*) FROM webhook_deliveries WHERE status = 'pending'").Scan(&pending)
+	if pending != 0 || hits.Load() != 3 {
+		t.Errorf("%d deliveries pending and %d requests after disabling, want 0 and 3", pending, hits.Load())
+	}
+}
+
+func TestDeliverer_LogRedeliverAndPing(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var status, hits atomic.Int32
+	status.Store(http.StatusBadGateway)
+	srv := receiver(t, &status, &hits)
+
+	repo := repositories.NewWebhookRepository(db)
+	hook := &models.Webhook{URL: srv.URL, Events: []string{"link.broken"}, Secret: "whsec_test"}
+	repo.Create(hook)
+	NewDispatcher(repo).Dispatch("link.broken", "org_1", map[string]string{"link_id": "l1"})
+
+	deliverer := NewDeliverer(srv.Client(), RetryPolicy{MaxAttempts: 1}, 1)
+	deliverer.DeliverDue(repo, time.Now(), 10)
+
+	failed, _ := repo.ListDeliveries(hook.ID, models.DeliveryStatusFailed, 10, 0)
+	if len(failed) != 1 {
+		t.Fatalf("ListDeliveries(failed) = %d, want 1", len(failed))
+	}
+	attempts, _ := repo.ListDeliveryAttempts(failed[0].ID)
+	if len(attempts) != 1 {
+		t.Fatalf("Logged %d attempts, want 1", len(attempts))
+	}
+	a := attempts[0]
+	if a.Attempt != 1 || a.ResponseStatus != 502 || a.Error != "HTTP 502" || len(a.ResponseBody) != maxLoggedResponseBody ||
+		a.RequestHeaders["X-Trackr-Delivery"] != failed[0].ID || a.RequestHeaders["X-Trackr-Event"] != "link.broken" {
+		t.Errorf("Logged attempt = %+v", a)
+	}
+
+	// A redelivery repeats the event under a new delivery ID
+	status.Store(http.StatusOK)
+	redelivery := Redelivery(failed[0], time.Now())
+	attempt, err := deliverer.DeliverNow(repo, hook, redelivery)
+	if err != nil || attempt.ResponseStatus != 200 || attempt.Error != "" {
+		t.Fatalf("DeliverNow = %+v, %v", attempt, err)
+	}
+	if redelivery.ID == failed[0].ID || redelivery.EventID != failed[0].EventID || redelivery.Payload != failed[0].Payload || redelivery.Status != models.DeliveryStatusDelivered {
+		t.Errorf("Redelivery = %+v", redelivery)
+	}
+
+	// Pings go out whatever the webhook subscribes to and fail without retries
+	status.Store(http.StatusNotFound)
+	ping, _ := Ping(hook, "org_1", time.Now())
+	if attempt, _ := deliverer.DeliverNow(repo, hook, ping); attempt.ResponseStatus != 404 || ping.Status != models.DeliveryStatusFailed {
+		t.Errorf("Ping = %+v, delivery %s", attempt, ping.Status)
+	}
+	if !strings.Contains(ping.Payload, `"event":"ping"`) {
+		t.Errorf("Ping payload = %s", ping.Payload)
+	}
+
+	all, _ := repo.ListDeliveries(hook.ID, "", 10, 0)
+	if len(all) != 3 {
+		t.Errorf("ListDeliveries = %d, want 3", len(all))
+	}
+	if pruned, err := repo.PruneDeliveries(time.Now().Add(time.Hour).Unix()); err != nil || pruned != 3 {
+		t.Errorf("PruneDeliveries = %d, %v; want 3", pruned, err)
+	}
+}
+
+func TestDeliverer_RefusesPrivateAddresses(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var status, hits atomic.Int32
+	status.Store(http.StatusOK)
+	srv := receiver(t, &status, &hits)
+
+	// A webhook saved before the URL check, or whose host now resolves to
+	// loopback, is still refused when the delivery dials
+	repo := repositories.NewWebhookRepository(db)
+	hook := &models.Webhook{URL: srv.URL, Events: []string{EventPing}, Secret: "whsec_test"}
+	repo.Create(hook)
+
+	deliverer := NewDeliverer(&http.Client{Timeout: time.Second}, RetryPolicy{MaxAttempts: 1}, 1)
+	ping, _ := Ping(hook, "org_1", time.Now())
+	attempt, _ := deliverer.DeliverNow(repo, hook, ping)
+	if hits.Load() != 0 || !strings.Contains(attempt.Error, "not public") {
+		t.Errorf("Delivery to %s = %+v after %d requests", srv.URL, attempt, hits.Load())
+	}
+}
@@ -1,19 +1,18 @@
 package webhooks
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
-	"fmt"
-	"net/http"
+	"log"
 	"time"
 
+	"github.com/google/uuid"
 	"trackr/internal/platform/models"
 	"trackr/internal/platform/repositories"
 )
 
+// Dispatcher turns events into queued deliveries, one per subscribed webhook.
+// Nothing is sent here: the worker's Deliverer picks the deliveries up, so an
+// event survives restarts and failing endpoints are retried.
 type Dispatcher struct {
 	repo *repositories.WebhookRepository
 }
@@ -22,90 +21,92 @@ func NewDispatcher(repo *repositories.WebhookRepository) *Dispatcher {
 	return &Dispatcher{repo: repo}
 }
 
-func (d *Dispatcher) Dispatch(eventType string, orgID string, data interface{}) {
+// Dispatch queues eventType for every active webhook subscribed to it.
+func (d *Dispatcher) Dispatch(eventType string, orgID string, data interface{}) error {
 	webhooks, err := d.repo.GetByEvent(eventType)
-	if err != nil {
-		// Log error
-		return
+	if err != nil || len(webhooks) == 0 {
+		return err
 	}
 
-	event := &models.WebhookEvent{
-		ID:        fmt.Sprintf("evt_%d", time.Now().UnixNano()),
-		Event:     eventType,
-		Timestamp: time.Now().Unix(),
-		OrgID:     orgID,
-		Data:      data,
+	now := time.Now()
+	payload, eventID, err := newEvent(eventType, orgID, data, now)
+	if err != nil {
+		return err
 	}
 
+	deliveries := make([]*models.WebhookDelivery, 0, len(webhooks))
 	for _, webhook := range webhooks {
-		go d.deliver(webhook, event)
+		deliveries = append(deliveries, newDelivery(webhook.ID, eventID, eventType, payload, now))
 	}
+	return d.repo.CreateDeliveries(deliveries)
 }
 
-func (d *Dispatcher) deliver(webhook *models.Webhook, event *models.WebhookEvent) {
-	payload, err := json.Marshal(event)
-	if err != nil {
-		return
-	}
-
-	signature := GenerateHMAC(webhook.Secret, payload)
-
-	req, err := http.NewRequest("POST", webhook.URL, bytes.NewBuffer(payload))
-	if err != nil {
-		return
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Trackr-Signature", signature)
-	req.Header.Set("X-Trackr-Event", event.Event)
-	req.Header.Set("X-Trackr-Delivery", event.ID)
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+// OrgEmitter queues events for one organization. Failures are logged rather
+// than returned: a change that has already been saved is not undone because
+// its webhook could not be queued.
+type OrgEmitter struct {
+	dispatcher *Dispatcher
+	orgID      string
+}
 
-	if err != nil || resp.StatusCode >= 400 {
-		var errStr string
-		if err != nil {
-			errStr = err.Error()
-		} else {
-			errStr = fmt.Sprintf("HTTP %d", resp.StatusCode)
-		}
+// ForOrg returns an emitter for engine services that raise events, e.g.
+// links.Service.WithEmitter.
+func (d *Dispatcher) ForOrg(orgID string) *OrgEmitter {
+	return &OrgEmitter{dispatcher: d, orgID: orgID}
+}
 
-		d.repo.UpdateLastError(webhook.ID, errStr)
-		d.repo.IncrementRetryCount(webhook.ID)
-		// Usually we would schedule a retry here or use a queue system.
-		// For now we just mark it as failed/increment retry count.
-	} else {
-		d.repo.UpdateLastTriggered(webhook.ID, time.Now().Unix())
-		d.repo.ResetRetryCount(webhook.ID)
+func (e *OrgEmitter) Emit(eventType string, data interface{}) {
+	if err := e.dispatcher.Dispatch(eventType, e.orgID, data); err != nil {
+		log.Printf("Webhooks: failed to queue %s for %s: %v", eventType, e.orgID, err)
 	}
+}
 
-	if resp != nil {
-		resp.Body.Close()
+// EventPing is sent by the "send test event" endpoint, whatever the webhook
+// subscribes to.
+const EventPing = "ping"
+
+// Ping builds a test delivery for webhook.
+func Ping(webhook *models.Webhook, orgID string, now time.Time) (*models.WebhookDelivery, error) {
+	payload, eventID, err := newEvent(EventPing, orgID, map[string]interface{}{
+		"webhook_id": webhook.ID,
+		"events":     webhook.Events,
+		"message":    "Test event from Trackr",
+	}, now)
+	if err != nil {
+		return nil, err
 	}
+	return newDelivery(webhook.ID, eventID, EventPing, payload, now), nil
 }
 
-// Synchronous delivery for retries
-func (d *Dispatcher) DeliverSync(webhook *models.Webhook) error {
-	// Reconstruct the event or pass it in?
-	// For retry logic, we might need to store the event payload in a queue or retry table.
-	// Since we don't have a persistent event queue in this plan, this is a placeholder.
-	// In a real system, we would have a job queue.
-	// The `webhook_retry.go` worker will use this.
-	// But since we don't store the failed event payload, we can't really retry the *same* event
-	// without a proper job queue.
-	// We will assume for this implementation that `DeliverSync` is just a signature,
-	// and the retry worker might need to be smarter or we admit we only retry if we had the payload.
-
-	// Given the scope, I will implement a dummy DeliverSync that pretends to delivery a "ping" event
-	// or we can just omit it if not strictly required by the current file structure.
-	// But `webhook_retry.go` in PLAN.md calls it.
+// Redelivery repeats a past delivery: the same event and payload under a new
+// delivery ID.
+func Redelivery(original *models.WebhookDelivery, now time.Time) *models.WebhookDelivery {
+	d := newDelivery(original.WebhookID, original.EventID, original.Event, original.Payload, now)
+	d.RedeliveryOf = original.ID
+	return d
+}
 
-	return nil
+func newEvent(eventType, orgID string, data interface{}, now time.Time) (payload, eventID string, err error) {
+	event := &models.WebhookEvent{
+		ID:        "evt_" + uuid.New().String(),
+		Event:     eventType,
+		Timestamp: now.Unix(),
+		OrgID:     orgID,
+		Data:      data,
+	}
+	b, err := json.Marshal(event)
+	return string(b), event.ID, err
 }
 
-func GenerateHMAC(secret string, payload []byte) string {
-	h := hmac.New(sha256.New, []byte(secret))
-	h.Write(payload)
-	return hex.EncodeToString(h.Sum(nil))
+func newDelivery(webhookID, eventID, eventType, payload string, now time.Time) *models.WebhookDelivery {
+	return &models.WebhookDelivery{
+		ID:            "whd_" + uuid.New().String(),
+		WebhookID:     webhookID,
+		EventID:       eventID,
+		Event:         eventType,
+		Payload:       payload,
+		Status:        models.DeliveryStatusPending,
+		NextAttemptAt: now.Unix(),
+		CreatedAt:     now.Unix(),
+	}
 }
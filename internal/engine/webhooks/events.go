@@ -0,0 +1,230 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Events webhooks can subscribe to. Every payload is a models.WebhookEvent
+// whose data matches the event's schema in Catalogue.
+const (
+	EventLinkCreated    = "link.created"
+	EventLinkUpdated    = "link.updated"
+	EventLinkArchived   = "link.archived"
+	EventLinkExpired    = "link.expired"
+	EventLinkBroken     = "link.broken"
+	EventLinkAnomaly    = "link.anomaly"
+	EventClickCreated   = "click.created"
+	EventMemberJoined   = "member.joined"
+	EventDomainVerified = "domain.verified"
+)
+
+// EventType documents one subscribable event.
+type EventType struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Schema      json.RawMessage `json:"schema"` // JSON Schema of the event's data
+}
+
+// linkSchema describes a link as sent in link.* events. password_hash is
+// never sent.
+const linkSchema = `{
+	"type": "object",
+	"required": ["id", "short_code", "destination_url", "status", "created_at", "updated_at"],
+	"properties": {
+		"id": {"type": "string"},
+		"short_code": {"type": "string"},
+		"destination_url": {"type": "string", "format": "uri"},
+		"title": {"type": "string"},
+		"created_by": {"type": "string"},
+		"redirect_type": {"enum": ["temporary", "permanent"]},
+		"rules": {"type": "object"},
+		"default_utm_params": {"type": "object"},
+		"status": {"enum": ["active", "paused", "archived"]},
+		"expires_at": {"type": "integer", "description": "Unix seconds"},
+		"click_count": {"type": "integer"},
+		"last_click_at": {"type": "integer", "description": "Unix seconds"},
+		"created_at": {"type": "integer", "description": "Unix seconds"},
+		"updated_at": {"type": "integer", "description": "Unix seconds"}
+	}
+}`
+
+func linkEventSchema(changes bool) json.RawMessage {
+	props := `"link": ` + linkSchema
+	required := `["link"]`
+	if changes {
+		props += `,
+	"changed_fields": {"type": "array", "items": {"type": "string"}},
+	"changed_by": {"type": "string", "description": "User ID, or system:screening / system:expiry"}`
+		required = `["link", "changed_fields", "changed_by"]`
+	}
+	return json.RawMessage(`{"type": "object", "required": ` + required + `, "properties": {` + props + `}}`)
+}
+
+// Catalogue lists every event webhooks can subscribe to, in the order the API
+// returns them.
+var Catalogue = []EventType{
+	{
+		Name:        EventLinkCreated,
+		Description: "A link was created.",
+		Schema:      linkEventSchema(false),
+	},
+	{
+		Name:        EventLinkUpdated,
+		Description: "A link's destination, rules, status or other tracked fields changed, by a user, a scheduled change, a rollback or screening.",
+		Schema:      linkEventSchema(true),
+	},
+	{
+		Name:        EventLinkArchived,
+		Description: "A link was archived and no longer redirects.",
+		Schema:      linkEventSchema(true),
+	},
+	{
+		Name:        EventLinkExpired,
+		Description: "A link passed its expires_at and was archived.",
+		Schema:      linkEventSchema(true),
+	},
+	{
+		Name:        EventLinkBroken,
+		Description: "A link's destination failed enough health checks in a row to be considered broken.",
+		Schema: json.RawMessage(`{
+	"type": "object",
+	"required": ["link_id", "short_code", "destination_url", "checked_at"],
+	"properties": {
+		"link_id": {"type": "string"},
+		"short_code": {"type": "string"},
+		"destination_url": {"type": "string"},
+		"status_code": {"type": "integer", "description": "0 when no response was received"},
+		"error": {"type": "string"},
+		"redirect_chain": {"type": "array", "items": {"type": "string"}},
+		"checked_at": {"type": "integer", "description": "Unix seconds"}
+	}
+}`),
+	},
+	{
+		Name:        EventLinkAnomaly,
+		Description: "A link's traffic in the last hour crossed one of the organization's anomaly thresholds.",
+		Schema: json.RawMessage(`{
+	"type": "object",
+	"required": ["id", "link_id", "short_code", "kind", "window_start", "window_end", "clicks", "value", "threshold"],
+	"properties": {
+		"id": {"type": "string"},
+		"link_id": {"type": "string"},
+		"short_code": {"type": "string"},
+		"kind": {"enum": ["spike", "drop", "ip_burst", "bot_traffic"]},
+		"window_start": {"type": "integer", "description": "Unix milliseconds"},
+		"window_end": {"type": "integer", "description": "Unix milliseconds"},
+		"clicks": {"type": "integer"},
+		"baseline": {"type": "number", "description": "Clicks per hour over the baseline days"},
+		"value": {"type": "number", "description": "Ratio to baseline, or share of clicks"},
+		"threshold": {"type": "number"},
+		"detail": {"type": "string"},
+		"created_at": {"type": "integer", "description": "Unix seconds"}
+	}
+}`),
+	},
+	{
+		Name:        EventClickCreated,
+		Description: "Links were clicked. Clicks are batched: one event carries up to webhooks.click_batch_size clicks, sent at least every webhooks.click_batch_interval.",
+		Schema: json.RawMessage(`{
+	"type": "object",
+	"required": ["count", "clicks"],
+	"properties": {
+		"count": {"type": "integer"},
+		"clicks": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"required": ["id", "link_id", "short_code", "timestamp", "destination_url"],
+				"properties": {
+					"id": {"type": "string"},
+					"link_id": {"type": "string"},
+					"short_code": {"type": "string"},
+					"timestamp": {"type": "integer", "description": "Unix milliseconds"},
+					"country_code": {"type": "string"},
+					"device_type": {"type": "string"},
+					"os": {"type": "string"},
+					"browser": {"type": "string"},
+					"referrer": {"type": "string"},
+					"destination_url": {"type": "string"},
+					"qr_variant": {"type": "string"},
+					"fraud_score": {"type": "integer", "minimum": 0, "maximum": 100}
+				}
+			}
+		}
+	}
+}`),
+	},
+	{
+		Name:        EventMemberJoined,
+		Description: "Someone accepted an invite and joined the organization.",
+		Schema: json.RawMessage(`{
+	"type": "object",
+	"required": ["user_id", "email", "role"],
+	"properties": {
+		"user_id": {"type": "string"},
+		"email": {"type": "string", "format": "email"},
+		"full_name": {"type": "string"},
+		"role": {"type": "string", "description": "The role the invite granted"},
+		"invite_id": {"type": "string"},
+		"joined_at": {"type": "integer", "description": "Unix seconds"}
+	}
+}`),
+	},
+	{
+		Name:        EventDomainVerified,
+		Description: "A custom domain passed DNS verification and can serve short links.",
+		Schema: json.RawMessage(`{
+	"type": "object",
+	"required": ["domain_id", "domain", "verified_at"],
+	"properties": {
+		"domain_id": {"type": "string"},
+		"domain": {"type": "string"},
+		"verified_at": {"type": "integer", "description": "Unix seconds"}
+	}
+}`),
+	},
+}
+
+var catalogueIndex = func() map[string]bool {
+	index := make(map[string]bool, len(Catalogue))
+	for _, e := range Catalogue {
+		index[e.Name] = true
+	}
+	return index
+}()
+
+// IsEvent reports whether name is an event webhooks can subscribe to.
+func IsEvent(name string) bool {
+	return catalogueIndex[name]
+}
+
+// UnknownEvents returns the names in events that are not in the catalogue,
+// sorted and without duplicates.
+func UnknownEvents(events []string) []string {
+	seen := map[string]bool{}
+	unknown := []string{}
+	for _, name := range events {
+		if !IsEvent(name) && !seen[name] {
+			seen[name] = true
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// ValidateEvents checks a webhook's subscriptions: at least one event, all in
+// the catalogue.
+func ValidateEvents(events []string) error {
+	if len(events) == 0 {
+		return errors.New("at least one event is required")
+	}
+	if unknown := UnknownEvents(events); len(unknown) > 0 {
+		return fmt.Errorf("unknown events: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
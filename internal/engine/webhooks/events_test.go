@@ -0,0 +1,121 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"trackr/internal/platform/models"
+	"trackr/internal/platform/repositories"
+)
+
+func TestCatalogue(t *testing.T) {
+	for _, e := range Catalogue {
+		var schema map[string]interface{}
+		if err := json.Unmarshal(e.Schema, &schema); err != nil {
+			t.Errorf("%s schema is not valid JSON: %v", e.Name, err)
+			continue
+		}
+		if schema["type"] != "object" || schema["properties"] == nil {
+			t.Errorf("%s schema does not describe an object: %s", e.Name, e.Schema)
+		}
+	}
+	if IsEvent(EventPing) {
+		t.Errorf("ping is sent on demand and cannot be subscribed to")
+	}
+}
+
+func TestValidateEvents(t *testing.T) {
+	if err := ValidateEvents([]string{EventLinkCreated, EventClickCreated}); err != nil {
+		t.Errorf("Known events rejected: %v", err)
+	}
+	if err := ValidateEvents(nil); err == nil {
+		t.Errorf("Subscribing to nothing accepted")
+	}
+	err := ValidateEvents([]string{"link.deleted", EventLinkCreated, "click.create", "link.deleted"})
+	if err == nil || err.Error() != "unknown events: click.create, link.deleted" {
+		t.Errorf("ValidateEvents = %v", err)
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	lookupIP = func(host string) ([]net.IP, error) {
+		switch host {
+		case "hooks.example.com":
+			return []net.IP{net.ParseIP("93.184.216.34")}, nil
+		case "rebind.example.com":
+			return []net.IP{net.ParseIP("93.184.216.34"), net.ParseIP("10.0.0.5")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	defer func() { lookupIP = net.LookupIP }()
+
+	tests := map[string]bool{
+		"https://hooks.example.com/trackr":        true,
+		"http://93.184.216.34:8080/hook":          true,
+		"https://rebind.example.com/hook":         false,
+		"http://127.0.0.1:9000/":                  false,
+		"http://0x7f.1/":                          false,
+		"http://[::1]/":                           false,
+		"http://169.254.169.254/latest/meta-data": false,
+		"http://192.168.1.10/hook":                false,
+		"http://localhost:8080/":                  false,
+		"https://missing.example.com/":            false,
+		"ftp://hooks.example.com/":                false,
+		"/relative":                               false,
+	}
+	for raw, ok := range tests {
+		if err := ValidateURL(raw); (err == nil) != ok {
+			t.Errorf("ValidateURL(%q) = %v, want ok=%v", raw, err, ok)
+		}
+	}
+}
+
+func TestClickBatcher(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repositories.NewWebhookRepository(db)
+	repo.Create(&models.Webhook{URL: "https://example.com/hook", Events: []string{EventClickCreated}, Secret: "whsec_test"})
+
+	batcher := NewClickBatcher(3, time.Minute)
+	for i := 0; i < 4; i++ {
+		batcher.Add("org_1", db, map[string]int{"n": i})
+	}
+
+	// Three clicks filled a batch; the fourth waits for the interval
+	due, _ := repo.DueDeliveries(time.Now().Unix(), 10)
+	if len(due) != 1 || !strings.Contains(due[0].Payload, `"count":3`) {
+		t.Fatalf("After 4 clicks: %+v", due)
+	}
+
+	batcher.Flush(time.Now(), false)
+	if due, _ := repo.DueDeliveries(time.Now().Unix(), 10); len(due) != 1 {
+		t.Errorf("Partial batch flushed before its interval")
+	}
+
+	batcher.Flush(time.Now().Add(time.Minute), false)
+	due, _ = repo.DueDeliveries(time.Now().Unix(), 10)
+	if len(due) != 2 {
+		t.Fatalf("Partial batch not flushed after its interval: %d deliveries", len(due))
+	}
+
+	counts := map[int]int{}
+	for _, d := range due {
+		var event struct {
+			Event string     `json:"event"`
+			Data  ClickBatch `json:"data"`
+		}
+		json.Unmarshal([]byte(d.Payload), &event)
+		if event.Event != EventClickCreated || event.Data.Count != len(event.Data.Clicks) {
+			t.Errorf("Batch = %s", d.Payload)
+		}
+		counts[event.Data.Count]++
+	}
+	if counts[3] != 1 || counts[1] != 1 {
+		t.Errorf("Batch sizes = %v, want one of 3 and one of 1", counts)
+	}
+}
@@ -1,16 +1,25 @@
 package webhooks
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	"time"
+
+	"trackr/internal/platform/models"
+	"trackr/pkg/webhooksig"
 )
 
-// Signer is responsible for generating HMAC signatures
-// We already have GenerateHMAC in dispatcher.go, but for separation of concerns as per plan:
+// Sign returns the X-Trackr-Signature value for payload sent at now: the
+// timestamp and a v1 signature per secret in SigningSecrets. Receivers check
+// it with pkg/webhooksig.
+func Sign(webhook *models.Webhook, payload []byte, now time.Time) string {
+	return webhooksig.SignHeader(now.Unix(), payload, SigningSecrets(webhook, now)...)
+}
 
-func Sign(secret string, payload []byte) string {
-	h := hmac.New(sha256.New, []byte(secret))
-	h.Write(payload)
-	return hex.EncodeToString(h.Sum(nil))
+// SigningSecrets are the secrets deliveries are signed with: the current one,
+// then the previous one while its rotation grace period lasts.
+func SigningSecrets(webhook *models.Webhook, now time.Time) []string {
+	secrets := []string{webhook.Secret}
+	if webhook.PreviousSecret != "" && now.Unix() < webhook.PreviousSecretExpiresAt {
+		secrets = append(secrets, webhook.PreviousSecret)
+	}
+	return secrets
 }
@@ -2,18 +2,76 @@ package webhooks
 
 import (
 	"testing"
+	"time"
+
+	"trackr/internal/platform/models"
+	"trackr/internal/platform/repositories"
+	"trackr/pkg/webhooksig"
 )
 
 func TestSign(t *testing.T) {
-	secret := "secret"
 	payload := []byte("payload")
+	now := time.Unix(1700000000, 0)
 
-	// Calculated using: echo -n "payload" | openssl dgst -sha256 -hmac "secret"
-	expected := "b82fcb791acec57859b989b430a826488ce2e479fdf92326bd0a2e8375a42ba4"
+	// Calculated using: echo -n "1700000000.payload" | openssl dgst -sha256 -hmac "secret"
+	expected := "t=1700000000,v1=5af4877ab3c93d3201223b2c43d689a4c1e849ddd9091e066f03be6168ae79e9"
 
-	got := Sign(secret, payload)
+	got := Sign(&models.Webhook{Secret: "secret"}, payload, now)
 
 	if got != expected {
 		t.Errorf("Sign() = %v, want %v", got, expected)
 	}
 }
+
+func TestSign_RotationGracePeriod(t *testing.T) {
+	payload := []byte(`{"event":"link.created"}`)
+	rotatedAt := time.Unix(1700000000, 0)
+	webhook := &models.Webhook{
+		Secret:                  "whsec_new",
+		PreviousSecret:          "whsec_old",
+		PreviousSecretExpiresAt: rotatedAt.Add(24 * time.Hour).Unix(),
+	}
+
+	// Receivers still on the old secret keep verifying during the grace period
+	during := rotatedAt.Add(time.Hour)
+	header := Sign(webhook, payload, during)
+	for _, secret := range []string{"whsec_new", "whsec_old"} {
+		if err := webhooksig.VerifyAt(payload, header, secret, 0, during); err != nil {
+			t.Errorf("Verify with %s during grace period: %v", secret, err)
+		}
+	}
+
+	after := rotatedAt.Add(25 * time.Hour)
+	header = Sign(webhook, payload, after)
+	if err := webhooksig.VerifyAt(payload, header, "whsec_old", 0, after); err != webhooksig.ErrSignatureMismatch {
+		t.Errorf("Old secret still verifies after the grace period: %v", err)
+	}
+	if err := webhooksig.VerifyAt(payload, header, "whsec_new", 0, after); err != nil {
+		t.Errorf("Verify with new secret after grace period: %v", err)
+	}
+}
+
+func TestRotateSecret_SignsWithBothSecrets(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repositories.NewWebhookRepository(db)
+	hook := &models.Webhook{URL: "https://example.com/hook", Events: []string{EventLinkCreated}, Secret: "whsec_old"}
+	repo.Create(hook)
+
+	now := time.Now()
+	if err := repo.RotateSecret(hook.ID, "whsec_new", now.Add(time.Hour).Unix()); err != nil {
+		t.Fatalf("RotateSecret failed: %v", err)
+	}
+	hook, _ = repo.GetByID(hook.ID)
+	if secrets := SigningSecrets(hook, now); len(secrets) != 2 || secrets[0] != "whsec_new" || secrets[1] != "whsec_old" {
+		t.Errorf("SigningSecrets during grace period = %v", secrets)
+	}
+
+	// A rotation without grace period drops the old secret straight away
+	repo.RotateSecret(hook.ID, "whsec_newer", 0)
+	hook, _ = repo.GetByID(hook.ID)
+	if secrets := SigningSecrets(hook, now); len(secrets) != 1 || secrets[0] != "whsec_newer" || hook.PreviousSecret != "" {
+		t.Errorf("SigningSecrets after immediate rotation = %v", secrets)
+	}
+}
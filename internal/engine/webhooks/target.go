@@ -0,0 +1,45 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+
+	"trackr/internal/pkg/netguard"
+)
+
+// lookupIP resolves webhook hosts when they are saved; tests replace it.
+var lookupIP = net.LookupIP
+
+// ValidateURL checks a webhook endpoint before it is saved: an absolute http(s)
+// URL whose host is, and resolves to, a public address. Deliveries are checked
+// again when they dial, since DNS can change after the webhook is saved.
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("url must not point to a private address")
+	}
+	if ip := netguard.ParseHost(host); ip != nil {
+		if !netguard.IsPublic(ip) {
+			return errors.New("url must not point to a private address")
+		}
+		return nil
+	}
+
+	ips, err := lookupIP(host)
+	if err != nil {
+		return errors.New("url host " + host + " does not resolve")
+	}
+	for _, ip := range ips {
+		if !netguard.IsPublic(ip) {
+			return errors.New("url must not point to a private address")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Package hll implements HyperLogLog cardinality sketches (Flajolet et al.,
+// 2007) with the small-range linear counting correction. Sketches of the same
+// precision merge losslessly, so per-day sketches can be unioned into counts
+// for any range.
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	MinPrecision     = 4
+	MaxPrecision     = 16
+	DefaultPrecision = 12 // 4096 registers, about 1.6% standard error
+
+	version      = 1
+	formatDense  = 0
+	formatSparse = 1
+)
+
+var (
+	ErrPrecision = errors.New("hll: precision must be between 4 and 16")
+	ErrMismatch  = errors.New("hll: cannot merge sketches of different precision")
+	ErrCorrupt   = errors.New("hll: corrupt sketch")
+)
+
+// Sketch estimates the number of distinct items added to it.
+type Sketch struct {
+	p         uint8
+	registers []uint8
+}
+
+func New(precision uint8) (*Sketch, error) {
+	if precision < MinPrecision || precision > MaxPrecision {
+		return nil, ErrPrecision
+	}
+	return &Sketch{p: precision, registers: make([]uint8, 1<<precision)}, nil
+}
+
+func (s *Sketch) Precision() uint8 {
+	return s.p
+}
+
+// Insert adds an item. Items are hashed with 64-bit FNV-1a plus a finalizer,
+// which is stable across processes so stored sketches stay mergeable.
+func (s *Sketch) Insert(item []byte) {
+	h := fnv.New64a()
+	h.Write(item)
+	s.InsertHash(mix64(h.Sum64()))
+}
+
+// InsertHash adds an item by its already well-mixed 64-bit hash.
+func (s *Sketch) InsertHash(x uint64) {
+	index := x >> (64 - s.p)
+	// Rank of the first set bit in the remaining bits, capped so an all-zero
+	// remainder still fits
+	w := x<<s.p | 1<<(s.p-1)
+	rank := uint8(bits.LeadingZeros64(w)) + 1
+	if rank > s.registers[index] {
+		s.registers[index] = rank
+	}
+}
+
+// Merge folds other into s, so s estimates the union of both.
+func (s *Sketch) Merge(other *Sketch) error {
+	if other.p != s.p {
+		return ErrMismatch
+	}
+	for i, r := range other.registers {
+		if r > s.registers[i] {
+			s.registers[i] = r
+		}
+	}
+	return nil
+}
+
+// Estimate returns the approximate number of distinct items inserted.
+func (s *Sketch) Estimate() uint64 {
+	m := float64(len(s.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range s.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha(len(s.registers)) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate while many registers are empty
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+func alpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+	return 0.7213 / (1 + 1.079/float64(m))
+}
+
+// MarshalBinary encodes the sketch: version, format, precision, then either
+// every register or, when shorter, (index, value) pairs of the set ones.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	set := 0
+	for _, r := range s.registers {
+		if r != 0 {
+			set++
+		}
+	}
+
+	if 3+set*3 >= 3+len(s.registers) {
+		out := append([]byte{version, formatDense, s.p}, s.registers...)
+		return out, nil
+	}
+
+	out := make([]byte, 3, 3+set*3)
+	out[0], out[1], out[2] = version, formatSparse, s.p
+	for i, r := range s.registers {
+		if r != 0 {
+			out = binary.BigEndian.AppendUint16(out, uint16(i))
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 || data[0] != version {
+		return ErrCorrupt
+	}
+	p := data[2]
+	if p < MinPrecision || p > MaxPrecision {
+		return ErrCorrupt
+	}
+	registers := make([]uint8, 1<<p)
+	body := data[3:]
+
+	switch data[1] {
+	case formatDense:
+		if len(body) != len(registers) {
+			return ErrCorrupt
+		}
+		copy(registers, body)
+	case formatSparse:
+		if len(body)%3 != 0 {
+			return ErrCorrupt
+		}
+		for i := 0; i < len(body); i += 3 {
+			index := int(binary.BigEndian.Uint16(body[i:]))
+			if index >= len(registers) {
+				return ErrCorrupt
+			}
+			registers[index] = body[i+2]
+		}
+	default:
+		return ErrCorrupt
+	}
+
+	for _, r := range registers {
+		if r > 64-p+1 {
+			return ErrCorrupt
+		}
+	}
+	s.p = p
+	s.registers = registers
+	return nil
+}
+
+// mix64 is the MurmurHash3 finalizer; it spreads FNV's weak low bits.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,94 @@
+package hll
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func fill(t *testing.T, from, to int) *Sketch {
+	s, err := New(DefaultPrecision)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	for i := from; i < to; i++ {
+		s.Insert([]byte(fmt.Sprintf("visitor-%d", i)))
+	}
+	return s
+}
+
+func assertClose(t *testing.T, got uint64, want int, tolerance float64) {
+	t.Helper()
+	if diff := math.Abs(float64(got)-float64(want)) / float64(want); diff > tolerance {
+		t.Errorf("Estimate = %d, want %d within %.0f%%", got, want, tolerance*100)
+	}
+}
+
+func TestSketch_Estimate(t *testing.T) {
+	for _, n := range []int{10, 1000, 100000} {
+		s := fill(t, 0, n)
+		assertClose(t, s.Estimate(), n, 0.05)
+	}
+
+	// Duplicates don't count twice
+	s := fill(t, 0, 500)
+	for i := 0; i < 500; i++ {
+		s.Insert([]byte(fmt.Sprintf("visitor-%d", i)))
+	}
+	assertClose(t, s.Estimate(), 500, 0.05)
+
+	empty, _ := New(DefaultPrecision)
+	if empty.Estimate() != 0 {
+		t.Errorf("Empty sketch estimate = %d", empty.Estimate())
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	a := fill(t, 0, 30000)
+	b := fill(t, 20000, 50000)
+	if err := a.Merge(b); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertClose(t, a.Estimate(), 50000, 0.05)
+
+	other, _ := New(10)
+	if err := a.Merge(other); err != ErrMismatch {
+		t.Errorf("Expected ErrMismatch, got %v", err)
+	}
+}
+
+func TestSketch_MarshalRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 5, 50000} {
+		s := fill(t, 0, n)
+		data, err := s.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+		if n == 5 && len(data) != 3+5*3 {
+			t.Errorf("Expected sparse encoding for 5 items, got %d bytes", len(data))
+		}
+
+		var decoded Sketch
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary failed: %v", err)
+		}
+		if decoded.Estimate() != s.Estimate() || decoded.Precision() != DefaultPrecision {
+			t.Errorf("Round trip changed the sketch: %d != %d", decoded.Estimate(), s.Estimate())
+		}
+	}
+
+	var s Sketch
+	for _, data := range [][]byte{nil, {9, 0, 12}, {version, formatDense, 12, 1}, {version, formatSparse, 12, 0xff, 0xff, 1}} {
+		if err := s.UnmarshalBinary(data); err != ErrCorrupt {
+			t.Errorf("UnmarshalBinary(%v) = %v, want ErrCorrupt", data, err)
+		}
+	}
+}
+
+func TestNew_RejectsPrecision(t *testing.T) {
+	for _, p := range []uint8{0, 3, 17} {
+		if _, err := New(p); err != ErrPrecision {
+			t.Errorf("New(%d) = %v, want ErrPrecision", p, err)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Package mailer builds MIME email messages and delivers them over SMTP.
+// HTML messages carry a plain-text alternative and may embed images that the
+// HTML references as cid:<content id>.
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is one email. HTML is optional; Text is always sent so clients that
+// cannot show HTML still get the content.
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+	Inline  []Inline // Images referenced from HTML as cid:<ContentID>
+}
+
+type Inline struct {
+	ContentID   string
+	ContentType string // e.g. image/png
+	Filename    string
+	Data        []byte
+}
+
+// Sender delivers messages. SMTPSender is the production implementation.
+type Sender interface {
+	Send(msg *Message) error
+}
+
+var ErrNoRecipients = errors.New("mailer: message has no recipients")
+
+// SMTPSender submits messages to an SMTP server, upgrading to TLS with
+// STARTTLS whenever the server offers it. Credentials are only sent over TLS
+// (or to localhost).
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     mail.Address
+	Timeout  time.Duration // Whole conversation; defaults to 30s
+
+	// TLSConfig overrides the STARTTLS configuration, e.g. in tests
+	TLSConfig *tls.Config
+}
+
+func NewSMTPSender(host string, port int, username, password, fromAddress, fromName string) *SMTPSender {
+	return &SMTPSender{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		Password: password,
+		From:     mail.Address{Name: fromName, Address: fromAddress},
+	}
+}
+
+func (s *SMTPSender) Send(msg *Message) error {
+	if len(msg.To) == 0 {
+		return ErrNoRecipients
+	}
+	data, err := msg.Bytes(s.From, time.Now())
+	if err != nil {
+		return err
+	}
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		cfg := s.TLSConfig
+		if cfg == nil {
+			cfg = &tls.Config{ServerName: s.Host}
+		}
+		if err := c.StartTLS(cfg); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(s.From.Address); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("mailer: recipient %s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Bytes renders the message as RFC 5322 text with CRLF line endings:
+// multipart/alternative of text and HTML, the HTML wrapped in
+// multipart/related when it has inline images.
+func (m *Message) Bytes(from mail.Address, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(k, v string) {
+		buf.WriteString(k + ": " + v + "\r\n")
+	}
+
+	to := make([]string, len(m.To))
+	for i, addr := range m.To {
+		to[i] = (&mail.Address{Address: addr}).String()
+	}
+	header("From", from.String())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", "<"+randomID()+"@"+domainOf(from.Address)+">")
+	header("MIME-Version", "1.0")
+
+	if m.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, m.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	alt := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/alternative; boundary="+alt.Boundary())
+	buf.WriteString("\r\n")
+
+	if err := writeTextPart(alt, "text/plain; charset=utf-8", m.Text); err != nil {
+		return nil, err
+	}
+
+	if len(m.Inline) == 0 {
+		if err := writeTextPart(alt, "text/html; charset=utf-8", m.HTML); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), alt.Close()
+	}
+
+	var related bytes.Buffer
+	rel := multipart.NewWriter(&related)
+	if err := writeTextPart(rel, "text/html; charset=utf-8", m.HTML); err != nil {
+		return nil, err
+	}
+	for _, img := range m.Inline {
+		part, err := rel.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {img.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-ID":                {"<" + img.ContentID + ">"},
+			"Content-Disposition":       {mime.FormatMediaType("inline", map[string]string{"filename": img.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(part, img.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := rel.Close(); err != nil {
+		return nil, err
+	}
+
+	part, err := alt.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {`multipart/related; type="text/html"; boundary=` + rel.Boundary()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(related.Bytes()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), alt.Close()
+}
+
+func writeTextPart(w *multipart.Writer, contentType, body string) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	return writeQuotedPrintable(part, body)
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64 writes data base64-encoded in 76-character lines.
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := 76
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+		if _, err := w.Write([]byte(encoded[:n] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func domainOf(address string) string {
+	if i := strings.LastIndex(address, "@"); i >= 0 && i < len(address)-1 {
+		return address[i+1:]
+	}
+	return "localhost"
+}
@@ -0,0 +1,181 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP is a minimal SMTP server that accepts one message per connection
+// and records the envelope and data.
+type fakeSMTP struct {
+	ln       net.Listener
+	from     string
+	rcpts    []string
+	data     []byte
+	rejectTo string
+	done     chan struct{}
+}
+
+func startFakeSMTP(t *testing.T, rejectTo string) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	s := &fakeSMTP{ln: ln, rejectTo: rejectTo, done: make(chan struct{})}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeSMTP) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTP) serve() {
+	defer close(s.done)
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimRight(line, "\r\n")
+		switch upper := strings.ToUpper(cmd); {
+		case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(upper, "MAIL FROM:"):
+			s.from, _, _ = strings.Cut(strings.TrimPrefix(cmd[len("MAIL FROM:"):], "<"), ">")
+			reply("250 OK")
+		case strings.HasPrefix(upper, "RCPT TO:"):
+			rcpt, _, _ := strings.Cut(strings.TrimPrefix(cmd[len("RCPT TO:"):], "<"), ">")
+			if rcpt == s.rejectTo {
+				reply("550 No such user")
+				continue
+			}
+			s.rcpts = append(s.rcpts, rcpt)
+			reply("250 OK")
+		case upper == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data bytes.Buffer
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			s.data = data.Bytes()
+			reply("250 OK")
+		case upper == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPSender_SendsHTMLWithInlineImage(t *testing.T) {
+	server := startFakeSMTP(t, "")
+	sender := NewSMTPSender("127.0.0.1", server.port(), "", "", "reports@trackr.io", "Trackr")
+
+	png := []byte("\x89PNG fake image bytes")
+	err := sender.Send(&Message{
+		To:      []string{"am@example.com", "team@example.com"},
+		Subject: "Weekly report – Acme",
+		Text:    "Clicks: 42",
+		HTML:    `<p>Clicks: 42</p><img src="cid:chart">`,
+		Inline:  []Inline{{ContentID: "chart", ContentType: "image/png", Filename: "chart.png", Data: png}},
+	})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	<-server.done
+
+	if server.from != "reports@trackr.io" || len(server.rcpts) != 2 || server.rcpts[1] != "team@example.com" {
+		t.Fatalf("Unexpected envelope: from %q to %v", server.from, server.rcpts)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(server.data))
+	if err != nil {
+		t.Fatalf("Invalid message: %v", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != "Weekly report – Acme" {
+		t.Errorf("Subject = %q", subject)
+	}
+	if from := msg.Header.Get("From"); from != `"Trackr" <reports@trackr.io>` {
+		t.Errorf("From = %q", from)
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q", mediaType)
+	}
+	alt := multipart.NewReader(msg.Body, params["boundary"])
+
+	text, _ := alt.NextPart()
+	if body, _ := io.ReadAll(text); string(body) != "Clicks: 42" {
+		t.Errorf("Text part = %q", body)
+	}
+
+	related, err := alt.NextPart()
+	if err != nil {
+		t.Fatalf("Missing HTML part: %v", err)
+	}
+	mediaType, params, _ = mime.ParseMediaType(related.Header.Get("Content-Type"))
+	if mediaType != "multipart/related" {
+		t.Fatalf("HTML part type = %q", mediaType)
+	}
+	rel := multipart.NewReader(related, params["boundary"])
+
+	html, _ := rel.NextPart()
+	if body, _ := io.ReadAll(html); !strings.Contains(string(body), `src="cid:chart"`) {
+		t.Errorf("HTML part = %q", body)
+	}
+	img, err := rel.NextPart()
+	if err != nil {
+		t.Fatalf("Missing inline image: %v", err)
+	}
+	if img.Header.Get("Content-ID") != "<chart>" || img.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("Unexpected image headers: %v", img.Header)
+	}
+	encoded, _ := io.ReadAll(img)
+	if decoded, _ := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", "")); !bytes.Equal(decoded, png) {
+		t.Errorf("Image data = %q", decoded)
+	}
+}
+
+func TestSMTPSender_RejectedRecipient(t *testing.T) {
+	server := startFakeSMTP(t, "gone@example.com")
+	sender := NewSMTPSender("127.0.0.1", server.port(), "", "", "reports@trackr.io", "Trackr")
+
+	err := sender.Send(&Message{To: []string{"gone@example.com"}, Subject: "Hi", Text: "Hi"})
+	if err == nil || !strings.Contains(err.Error(), "gone@example.com") {
+		t.Errorf("Expected a recipient error, got %v", err)
+	}
+
+	if err := sender.Send(&Message{Subject: "Hi"}); err != ErrNoRecipients {
+		t.Errorf("Expected ErrNoRecipients, got %v", err)
+	}
+}
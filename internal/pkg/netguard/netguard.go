@@ -0,0 +1,158 @@
+// Package netguard decides whether an address is on the public internet, for
+// everything that fetches user-supplied URLs: link screening, the link health
+// checker and webhook deliveries.
+package netguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrNotPublic = errors.New("address is not public")
+
+// reserved lists every special-purpose range (RFC 6890 and its successors).
+// IPv4-mapped IPv6 addresses are checked as IPv4.
+var reserved = mustParseCIDRs(
+	"0.0.0.0/8",       // "this" network
+	"10.0.0.0/8",      // private
+	"100.64.0.0/10",   // carrier-grade NAT
+	"127.0.0.0/8",     // loopback
+	"169.254.0.0/16",  // link-local, cloud metadata
+	"172.16.0.0/12",   // private
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // TEST-NET-1
+	"192.88.99.0/24",  // 6to4 relay anycast
+	"192.168.0.0/16",  // private
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // TEST-NET-2
+	"203.0.113.0/24",  // TEST-NET-3
+	"224.0.0.0/4",     // multicast
+	"240.0.0.0/4",     // reserved, broadcast
+	"::/128",          // unspecified
+	"::1/128",         // loopback
+	"64:ff9b::/96",    // NAT64, reaches IPv4 addresses including private ones
+	"64:ff9b:1::/48",  // local-use NAT64
+	"100::/64",        // discard
+	"2001::/23",       // IETF protocol assignments, Teredo
+	"2001:db8::/32",   // documentation
+	"2002::/16",       // 6to4, embeds an IPv4 address
+	"fc00::/7",        // unique local
+	"fe80::/10",       // link-local
+	"ff00::/8",        // multicast
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// IsPublic reports whether ip is a globally routable unicast address.
+func IsPublic(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, n := range reserved {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseHost returns the IP a URL host denotes, or nil for a hostname. Besides
+// the usual notations it accepts every IPv4 form browsers and inet_aton do:
+// integer (2130706433), hex and octal parts (0x7f.1, 0177.0.0.1) and shorthand
+// with fewer than four parts (127.1).
+func ParseHost(host string) net.IP {
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+	return parseIPv4Loose(host)
+}
+
+func parseIPv4Loose(host string) net.IP {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+	values := make([]uint64, len(parts))
+	for i, p := range parts {
+		v, ok := parseIPv4Part(p)
+		if !ok {
+			return nil
+		}
+		values[i] = v
+	}
+
+	// All but the last part are single bytes; the last fills the remaining ones
+	var n uint64
+	for _, v := range values[:len(values)-1] {
+		if v > 0xff {
+			return nil
+		}
+		n = n<<8 | v
+	}
+	last := values[len(values)-1]
+	rest := uint(5-len(values)) * 8
+	if last >= 1<<rest {
+		return nil
+	}
+	n = n<<rest | last
+	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func parseIPv4Part(p string) (uint64, bool) {
+	base := 10
+	switch {
+	case len(p) > 2 && (p[:2] == "0x" || p[:2] == "0X"):
+		base, p = 16, p[2:]
+	case len(p) > 1 && p[0] == '0':
+		base, p = 8, p[1:]
+	}
+	if p == "" || strings.ContainsAny(p, "+-_") {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(p, base, 32)
+	return v, err == nil
+}
+
+// Control is a net.Dialer Control hook refusing connections to non-public
+// addresses. It runs on the resolved address of every connection, so DNS
+// rebinding and redirects to internal hosts are caught as well.
+func Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !IsPublic(net.ParseIP(host)) {
+		return fmt.Errorf("%w: %s", ErrNotPublic, host)
+	}
+	return nil
+}
+
+// NewTransport returns an HTTP transport that only dials public addresses.
+// Proxies are not used: the proxy's address is all the guard would see.
+func NewTransport(dialTimeout time.Duration) *http.Transport {
+	dialer := &net.Dialer{Timeout: dialTimeout, Control: Control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
@@ -0,0 +1,81 @@
+package netguard
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestParseHost(t *testing.T) {
+	tests := map[string]string{
+		"127.0.0.1":       "127.0.0.1",
+		"2130706433":      "127.0.0.1",
+		"0x7f.1":          "127.0.0.1",
+		"0177.0.0.1":      "127.0.0.1",
+		"127.1":           "127.0.0.1",
+		"10.0x10.1":       "10.16.0.1",
+		"0x7f000001":      "127.0.0.1",
+		"0":               "0.0.0.0",
+		"::1":             "::1",
+		"[::ffff:7f00:1]": "127.0.0.1",
+		"example.com":     "",
+		"1.2.3.4.5":       "",
+		"256.1.1.1":       "",
+		"1.2.65536":       "",
+		"08.1.1.1":        "",
+		"1..1":            "",
+		"-1":              "",
+	}
+	for host, want := range tests {
+		ip := ParseHost(host)
+		if (ip == nil) != (want == "") || (ip != nil && !ip.Equal(net.ParseIP(want))) {
+			t.Errorf("ParseHost(%q) = %v, want %q", host, ip, want)
+		}
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":        true,
+		"2606:2800:220:1::248": true,
+		"8.8.8.8":              true,
+		"127.0.0.1":            false,
+		"10.1.2.3":             false,
+		"100.64.0.1":           false,
+		"0.0.0.0":              false,
+		"0.1.2.3":              false,
+		"169.254.169.254":      false,
+		"172.31.255.255":       false,
+		"192.0.0.8":            false,
+		"192.168.0.1":          false,
+		"198.18.0.1":           false,
+		"224.0.0.1":            false,
+		"255.255.255.255":      false,
+		"::":                   false,
+		"::1":                  false,
+		"::ffff:127.0.0.1":     false,
+		"::ffff:10.0.0.1":      false,
+		"64:ff9b::a00:1":       false,
+		"fd00::1":              false,
+		"fe80::1":              false,
+	}
+	for addr, want := range tests {
+		if got := IsPublic(net.ParseIP(addr)); got != want {
+			t.Errorf("IsPublic(%s) = %v, want %v", addr, got, want)
+		}
+	}
+	if IsPublic(nil) {
+		t.Errorf("IsPublic(nil) = true")
+	}
+}
+
+func TestControl(t *testing.T) {
+	if err := Control("tcp4", "93.184.216.34:443", nil); err != nil {
+		t.Errorf("Control(public) = %v", err)
+	}
+	for _, addr := range []string{"127.0.0.1:80", "[::1]:80", "169.254.169.254:80", "[::ffff:192.168.1.1]:443"} {
+		if err := Control("tcp", addr, nil); !errors.Is(err, ErrNotPublic) {
+			t.Errorf("Control(%s) = %v, want ErrNotPublic", addr, err)
+		}
+	}
+}
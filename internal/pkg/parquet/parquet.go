@@ -0,0 +1,322 @@
+// Package parquet writes flat Apache Parquet files: one row group per batch
+// of rows, one plain-encoded, uncompressed data page per column chunk. Only
+// the memory of one row group is held, so large exports stream to disk.
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Type is a column's logical type.
+type Type int
+
+const (
+	String    Type = iota // BYTE_ARRAY annotated UTF8
+	Int64                 // INT64
+	Timestamp             // INT64 annotated TIMESTAMP_MILLIS (unix ms, UTC)
+)
+
+// Column describes one field. Optional columns accept nil values.
+type Column struct {
+	Name     string
+	Type     Type
+	Optional bool
+}
+
+const (
+	magic = "PAR1"
+
+	DefaultRowGroupSize = 10000
+
+	// Parquet enum values (parquet.thrift)
+	physicalInt64     = 2
+	physicalByteArray = 6
+	convertedUTF8     = 0
+	convertedTSMillis = 9
+	repRequired       = 0
+	repOptional       = 1
+	encodingPlain     = 0
+	encodingRLE       = 3
+	codecUncompressed = 0
+	pageData          = 0
+)
+
+var ErrClosed = errors.New("parquet: writer is closed")
+
+// Writer buffers rows into row groups and writes the footer on Close.
+type Writer struct {
+	w            io.Writer
+	offset       int64
+	columns      []Column
+	rowGroupSize int
+
+	buffered  int
+	values    [][]byte // Plain-encoded non-null values per column
+	defLevels [][]bool // Present flags per column, for optional columns
+	rowGroups []rowGroupMeta
+	numRows   int64
+	closed    bool
+	err       error
+}
+
+type rowGroupMeta struct {
+	numRows int64
+	size    int64
+	chunks  []chunkMeta
+}
+
+type chunkMeta struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+func NewWriter(w io.Writer, columns []Column, rowGroupSize int) *Writer {
+	if rowGroupSize <= 0 {
+		rowGroupSize = DefaultRowGroupSize
+	}
+	return &Writer{
+		w:            w,
+		columns:      columns,
+		rowGroupSize: rowGroupSize,
+		values:       make([][]byte, len(columns)),
+		defLevels:    make([][]bool, len(columns)),
+	}
+}
+
+// Write appends one row. Values are string or int64 to match each column's
+// type (int is accepted for Int64 and Timestamp), or nil for optional columns.
+func (pw *Writer) Write(row []interface{}) error {
+	if pw.closed {
+		return ErrClosed
+	}
+	if pw.err != nil {
+		return pw.err
+	}
+	if len(row) != len(pw.columns) {
+		return fmt.Errorf("parquet: row has %d values, want %d", len(row), len(pw.columns))
+	}
+
+	// Check the whole row first so a bad value never leaves a partial row
+	for i, col := range pw.columns {
+		switch v := row[i].(type) {
+		case nil:
+			if !col.Optional {
+				return fmt.Errorf("parquet: column %q is required", col.Name)
+			}
+		case string:
+			if col.Type != String {
+				return fmt.Errorf("parquet: column %q wants an int64, got string", col.Name)
+			}
+		case int64, int:
+			if col.Type == String {
+				return fmt.Errorf("parquet: column %q wants a string, got %T", col.Name, v)
+			}
+		default:
+			return fmt.Errorf("parquet: column %q got unsupported %T", col.Name, v)
+		}
+	}
+
+	for i, col := range pw.columns {
+		switch v := row[i].(type) {
+		case nil:
+			pw.defLevels[i] = append(pw.defLevels[i], false)
+			continue
+		case string:
+			pw.values[i] = binary.LittleEndian.AppendUint32(pw.values[i], uint32(len(v)))
+			pw.values[i] = append(pw.values[i], v...)
+		case int64:
+			pw.values[i] = binary.LittleEndian.AppendUint64(pw.values[i], uint64(v))
+		case int:
+			pw.values[i] = binary.LittleEndian.AppendUint64(pw.values[i], uint64(v))
+		}
+		if col.Optional {
+			pw.defLevels[i] = append(pw.defLevels[i], true)
+		}
+	}
+
+	pw.buffered++
+	if pw.buffered >= pw.rowGroupSize {
+		return pw.flush()
+	}
+	return nil
+}
+
+// Close flushes the last row group and writes the footer. It does not close
+// the underlying writer.
+func (pw *Writer) Close() error {
+	if pw.closed {
+		return nil
+	}
+	if pw.err != nil {
+		return pw.err
+	}
+	if pw.offset == 0 {
+		if err := pw.write([]byte(magic)); err != nil {
+			return err
+		}
+	}
+	if pw.buffered > 0 {
+		if err := pw.flush(); err != nil {
+			return err
+		}
+	}
+	pw.closed = true
+
+	footer := pw.fileMetadata()
+	tail := binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	return pw.write(append(tail, magic...))
+}
+
+func (pw *Writer) write(p []byte) error {
+	n, err := pw.w.Write(p)
+	pw.offset += int64(n)
+	if err != nil {
+		pw.err = err
+	}
+	return err
+}
+
+// flush writes the buffered rows as one row group.
+func (pw *Writer) flush() error {
+	if pw.offset == 0 {
+		if err := pw.write([]byte(magic)); err != nil {
+			return err
+		}
+	}
+
+	rg := rowGroupMeta{numRows: int64(pw.buffered)}
+	for i, col := range pw.columns {
+		var page []byte
+		if col.Optional {
+			levels := encodeDefinitionLevels(pw.defLevels[i])
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(levels)))
+			page = append(page, levels...)
+		}
+		page = append(page, pw.values[i]...)
+
+		header := pageHeader(len(page), pw.buffered)
+		chunk := chunkMeta{offset: pw.offset, size: int64(len(header) + len(page)), numValues: int64(pw.buffered)}
+		if err := pw.write(header); err != nil {
+			return err
+		}
+		if err := pw.write(page); err != nil {
+			return err
+		}
+		rg.chunks = append(rg.chunks, chunk)
+		rg.size += chunk.size
+
+		pw.values[i] = pw.values[i][:0]
+		pw.defLevels[i] = pw.defLevels[i][:0]
+	}
+
+	pw.rowGroups = append(pw.rowGroups, rg)
+	pw.numRows += rg.numRows
+	pw.buffered = 0
+	return nil
+}
+
+// encodeDefinitionLevels writes 1-bit levels as a single bit-packed run of the
+// RLE/bit-packing hybrid encoding, padded to a multiple of eight values.
+func encodeDefinitionLevels(present []bool) []byte {
+	groups := (len(present) + 7) / 8
+	out := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	packed := make([]byte, groups)
+	for i, p := range present {
+		if p {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return append(out, packed...)
+}
+
+func pageHeader(size, numValues int) []byte {
+	w := &compactWriter{}
+	w.beginStruct()
+	w.i32(1, pageData)
+	w.i32(2, int32(size)) // uncompressed_page_size
+	w.i32(3, int32(size)) // compressed_page_size
+	w.structField(5)      // data_page_header
+	w.i32(1, int32(numValues))
+	w.i32(2, encodingPlain)
+	w.i32(3, encodingRLE) // definition levels
+	w.i32(4, encodingRLE) // repetition levels
+	w.endStruct()
+	w.endStruct()
+	return w.buf
+}
+
+func (pw *Writer) fileMetadata() []byte {
+	w := &compactWriter{}
+	w.beginStruct()
+	w.i32(1, 1) // version
+
+	w.list(2, tStruct, len(pw.columns)+1)
+	w.beginStruct()
+	w.binary(4, "schema")
+	w.i32(5, int32(len(pw.columns)))
+	w.endStruct()
+	for _, col := range pw.columns {
+		w.beginStruct()
+		physical, converted := int32(physicalInt64), int32(-1)
+		switch col.Type {
+		case String:
+			physical, converted = physicalByteArray, convertedUTF8
+		case Timestamp:
+			converted = convertedTSMillis
+		}
+		w.i32(1, physical)
+		if col.Optional {
+			w.i32(3, repOptional)
+		} else {
+			w.i32(3, repRequired)
+		}
+		w.binary(4, col.Name)
+		if converted >= 0 {
+			w.i32(6, converted)
+		}
+		w.endStruct()
+	}
+
+	w.i64(3, pw.numRows)
+
+	w.list(4, tStruct, len(pw.rowGroups))
+	for _, rg := range pw.rowGroups {
+		w.beginStruct()
+		w.list(1, tStruct, len(rg.chunks))
+		for i, chunk := range rg.chunks {
+			col := pw.columns[i]
+			physical := int32(physicalInt64)
+			if col.Type == String {
+				physical = physicalByteArray
+			}
+
+			w.beginStruct()
+			w.i64(2, chunk.offset) // file_offset
+			w.structField(3)       // meta_data
+			w.i32(1, physical)
+			w.list(2, tI32, 2)
+			w.varint(encodingPlain)
+			w.varint(encodingRLE)
+			w.list(3, tBinary, 1)
+			w.rawBinary(col.Name)
+			w.i32(4, codecUncompressed)
+			w.i64(5, chunk.numValues)
+			w.i64(6, chunk.size)
+			w.i64(7, chunk.size)
+			w.i64(9, chunk.offset) // data_page_offset
+			w.endStruct()
+			w.endStruct()
+		}
+		w.i64(2, rg.size)
+		w.i64(3, rg.numRows)
+		w.endStruct()
+	}
+
+	w.binary(6, "trackr")
+	w.endStruct()
+	return w.buf
+}
@@ -0,0 +1,150 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// thriftReader decodes compact-protocol structs into maps keyed by field ID,
+// enough to check what the writer produced.
+type thriftReader struct {
+	t   *testing.T
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		r.t.Fatalf("Bad varint at %d", r.pos)
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case tI32, tI64:
+		return r.zigzag()
+	case tBinary:
+		n := int(r.uvarint())
+		s := string(r.buf[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case tList:
+		header := r.buf[r.pos]
+		r.pos++
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case tStruct:
+		return r.structValue()
+	}
+	r.t.Fatalf("Unexpected thrift type %d", typ)
+	return nil
+}
+
+func (r *thriftReader) structValue() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var last int16
+	for {
+		header := r.buf[r.pos]
+		r.pos++
+		if header == 0 {
+			return fields
+		}
+		typ := header & 0x0f
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(typ)
+		last = id
+	}
+}
+
+func TestWriter_WritesReadableFile(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, []Column{
+		{Name: "id", Type: String},
+		{Name: "ts", Type: Timestamp},
+		{Name: "country", Type: String, Optional: true},
+	}, 2)
+	rows := [][]interface{}{
+		{"a", int64(1000), "US"},
+		{"b", int64(2000), nil},
+		{"c", 3000, "DE"},
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data := buf.Bytes()
+	if string(data[:4]) != magic || string(data[len(data)-4:]) != magic {
+		t.Fatal("Missing PAR1 magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &thriftReader{t: t, buf: data[len(data)-8-footerLen : len(data)-8]}
+	meta := footer.structValue()
+
+	if meta[3].(int64) != 3 {
+		t.Errorf("num_rows = %v, want 3", meta[3])
+	}
+	schema := meta[2].([]interface{})
+	if len(schema) != 4 || schema[3].(map[int16]interface{})[4] != "country" || schema[3].(map[int16]interface{})[3].(int64) != repOptional {
+		t.Errorf("Unexpected schema: %v", schema)
+	}
+	rowGroups := meta[4].([]interface{})
+	if len(rowGroups) != 2 || rowGroups[0].(map[int16]interface{})[3].(int64) != 2 {
+		t.Fatalf("Expected two row groups of 2 and 1 rows: %v", rowGroups)
+	}
+
+	// Read the country chunk of the first row group back
+	chunk := rowGroups[0].(map[int16]interface{})[1].([]interface{})[2].(map[int16]interface{})
+	offset := chunk[3].(map[int16]interface{})[9].(int64)
+	page := &thriftReader{t: t, buf: data[offset:]}
+	header := page.structValue()
+	if header[5].(map[int16]interface{})[1].(int64) != 2 {
+		t.Errorf("Unexpected page header: %v", header)
+	}
+	body := data[int(offset)+page.pos:]
+	levelsLen := int(binary.LittleEndian.Uint32(body))
+	levels := body[4 : 4+levelsLen]
+	if !bytes.Equal(levels, []byte{0x03, 0x01}) {
+		t.Errorf("Definition levels = %x, want one bit-packed group 0b01", levels)
+	}
+	values := body[4+levelsLen:]
+	if binary.LittleEndian.Uint32(values) != 2 || string(values[4:6]) != "US" {
+		t.Errorf("Unexpected values: %q", values[:6])
+	}
+}
+
+func TestWriter_RejectsBadRows(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{}, []Column{{Name: "n", Type: Int64}}, 0)
+	for _, row := range [][]interface{}{{nil}, {"x"}, {int64(1), int64(2)}} {
+		if err := w.Write(row); err == nil {
+			t.Errorf("Expected error for row %v", row)
+		}
+	}
+	w.Close()
+	if err := w.Write([]interface{}{int64(1)}); err != ErrClosed {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package parquet
+
+import "encoding/binary"
+
+// Thrift compact protocol type IDs, as used in Parquet's file metadata.
+const (
+	tI32    = 5
+	tI64    = 6
+	tBinary = 8
+	tList   = 9
+	tStruct = 12
+)
+
+// compactWriter encodes just the parts of the Thrift compact protocol the
+// Parquet footer and page headers need.
+type compactWriter struct {
+	buf    []byte
+	lastID []int16 // Last field ID per open struct
+}
+
+func (w *compactWriter) fieldHeader(id int16, typ byte) {
+	last := w.lastID[len(w.lastID)-1]
+	if delta := id - last; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.varint(int64(id))
+	}
+	w.lastID[len(w.lastID)-1] = id
+}
+
+func (w *compactWriter) varint(v int64) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(v<<1^v>>63))
+}
+
+func (w *compactWriter) beginStruct() {
+	w.lastID = append(w.lastID, 0)
+}
+
+func (w *compactWriter) endStruct() {
+	w.buf = append(w.buf, 0)
+	w.lastID = w.lastID[:len(w.lastID)-1]
+}
+
+func (w *compactWriter) i32(id int16, v int32) {
+	w.fieldHeader(id, tI32)
+	w.varint(int64(v))
+}
+
+func (w *compactWriter) i64(id int16, v int64) {
+	w.fieldHeader(id, tI64)
+	w.varint(v)
+}
+
+func (w *compactWriter) binary(id int16, v string) {
+	w.fieldHeader(id, tBinary)
+	w.rawBinary(v)
+}
+
+func (w *compactWriter) rawBinary(v string) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+// list writes a list field header; the caller then writes size elements.
+func (w *compactWriter) list(id int16, elemType byte, size int) {
+	w.fieldHeader(id, tList)
+	if size < 15 {
+		w.buf = append(w.buf, byte(size)<<4|elemType)
+	} else {
+		w.buf = append(w.buf, 0xf0|elemType)
+		w.buf = binary.AppendUvarint(w.buf, uint64(size))
+	}
+}
+
+// structField opens a nested struct field; close it with endStruct.
+func (w *compactWriter) structField(id int16) {
+	w.fieldHeader(id, tStruct)
+	w.beginStruct()
+}
@@ -35,3 +35,27 @@ func ParseUserAgent(ua string) (os, browser string) {
 
 	return os, browser
 }
+
+// botMarkers are substrings of crawler, monitoring and HTTP library user
+// agents. Real browsers never send them.
+var botMarkers = []string{
+	"bot", "crawl", "spider", "slurp", "scrape", "fetch", "monitor",
+	"headless", "phantomjs", "curl/", "wget/", "python-requests", "python-urllib",
+	"go-http-client", "java/", "okhttp", "axios/", "node-fetch", "libwww-perl",
+	"httpclient", "facebookexternalhit", "preview",
+}
+
+// IsBot reports whether ua looks automated. An empty user agent counts as a
+// bot; browsers always send one.
+func IsBot(ua string) bool {
+	uaLower := strings.ToLower(strings.TrimSpace(ua))
+	if uaLower == "" {
+		return true
+	}
+	for _, marker := range botMarkers {
+		if strings.Contains(uaLower, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package punycode
+
+import (
+	"errors"
+	"strings"
+)
+
+// Bootstring parameters for Punycode (RFC 3492 section 5)
+const (
+	base        = 36
+	tMin        = 1
+	tMax        = 26
+	skew        = 38
+	damp        = 700
+	initialBias = 72
+	initialN    = 128
+	maxInt      = 1<<31 - 1
+)
+
+var errInvalid = errors.New("invalid punycode")
+
+// ToUnicode decodes an IDNA label such as "xn--mnchen-3ya" to "münchen".
+// Labels without the ACE prefix are returned unchanged.
+func ToUnicode(label string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(label), "xn--") {
+		return label, nil
+	}
+	return Decode(label[4:])
+}
+
+// Decode implements the RFC 3492 decoding procedure for a single label
+// (without the "xn--" prefix).
+func Decode(input string) (string, error) {
+	output := []rune{}
+	pos := 0
+	if b := strings.LastIndexByte(input, '-'); b >= 0 {
+		for i := 0; i < b; i++ {
+			if input[i] >= 0x80 {
+				return "", errInvalid
+			}
+			output = append(output, rune(input[i]))
+		}
+		pos = b + 1
+	}
+
+	n, i, bias := initialN, 0, initialBias
+	for pos < len(input) {
+		oldi, w := i, 1
+		for k := base; ; k += base {
+			if pos >= len(input) {
+				return "", errInvalid
+			}
+			digit := decodeDigit(input[pos])
+			pos++
+			if digit < 0 || digit > (maxInt-i)/w {
+				return "", errInvalid
+			}
+			i += digit * w
+
+			t := k - bias
+			if t < tMin {
+				t = tMin
+			} else if t > tMax {
+				t = tMax
+			}
+			if digit < t {
+				break
+			}
+			if w > maxInt/(base-t) {
+				return "", errInvalid
+			}
+			w *= base - t
+		}
+
+		points := len(output) + 1
+		bias = adapt(i-oldi, points, oldi == 0)
+		if i/points > maxInt-n {
+			return "", errInvalid
+		}
+		n += i / points
+		i %= points
+
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = rune(n)
+		i++
+	}
+
+	return string(output), nil
+}
+
+func adapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= damp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+
+	k := 0
+	for delta > ((base-tMin)*tMax)/2 {
+		delta /= base - tMin
+		k += base
+	}
+	return k + (base-tMin+1)*delta/(delta+skew)
+}
+
+func decodeDigit(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 26
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A')
+	case c >= 'a' && c <= 'z':
+		return int(c - 'a')
+	}
+	return -1
+}
@@ -0,0 +1,29 @@
+package punycode
+
+import "testing"
+
+func TestToUnicode(t *testing.T) {
+	tests := []struct {
+		label    string
+		expected string
+		wantErr  bool
+	}{
+		{"xn--mnchen-3ya", "münchen", false},
+		{"xn--80ak6aa92e", "аррӏе", false}, // Cyrillic "apple" lookalike
+		{"xn--bcher-kva", "bücher", false},
+		{"example", "example", false},
+		{"xn--a-!", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			got, err := ToUnicode(tt.label)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ToUnicode(%q) error = %v, wantErr %v", tt.label, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.expected {
+				t.Errorf("ToUnicode(%q) = %q, want %q", tt.label, got, tt.expected)
+			}
+		})
+	}
+}
@@ -54,7 +54,67 @@ func (s *TokenService) GenerateRefreshToken(userID string) (string, error) {
 	return token.SignedString([]byte(s.config.Secret))
 }
 
+// StreamTokenTTL is how long a stream token can open a click stream. Browsers
+// can't set headers on EventSource or WebSocket requests, so the token travels
+// in the URL or a subprotocol; it is short-lived and good for nothing else.
+const StreamTokenTTL = time.Minute
+
+const streamAudience = "stream"
+
+// GenerateStreamToken issues a stream token acting as the holder of claims.
+func (s *TokenService) GenerateStreamToken(claims *Claims) (string, error) {
+	stream := Claims{
+		UserID:         claims.UserID,
+		OrganizationID: claims.OrganizationID,
+		Role:           claims.Role,
+		Email:          claims.Email,
+		Scopes:         claims.Scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{streamAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(StreamTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "trackr",
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, stream)
+	return token.SignedString([]byte(s.config.Secret))
+}
+
+// ValidateStreamToken accepts only stream tokens.
+func (s *TokenService) ValidateStreamToken(tokenString string) (*Claims, error) {
+	claims, err := s.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if !isStreamToken(claims) {
+		return nil, errors.New("not a stream token")
+	}
+	return claims, nil
+}
+
+// ValidateToken accepts access and refresh tokens, but not stream tokens.
 func (s *TokenService) ValidateToken(tokenString string) (*Claims, error) {
+	claims, err := s.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if isStreamToken(claims) {
+		return nil, errors.New("stream tokens only open click streams")
+	}
+	return claims, nil
+}
+
+func isStreamToken(claims *Claims) bool {
+	for _, aud := range claims.Audience {
+		if aud == streamAudience {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TokenService) parse(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
@@ -8,18 +8,29 @@ import (
 )
 
 type Config struct {
-	Server    ServerConfig    `mapstructure:"server"`
-	Database  DatabaseConfig  `mapstructure:"database"`
-	Cache     CacheConfig     `mapstructure:"cache"`
-	JWT       JWTConfig       `mapstructure:"jwt"`
-	CORS      CORSConfig      `mapstructure:"cors"`
-	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
-	GeoIP     GeoIPConfig     `mapstructure:"geoip"`
-	Webhooks  WebhooksConfig  `mapstructure:"webhooks"`
-	Logging   LoggingConfig   `mapstructure:"logging"`
-	SAML      SAMLConfig      `mapstructure:"saml"`
-	Email     EmailConfig     `mapstructure:"email"`
-	Domains   DomainsConfig   `mapstructure:"domains"`
+	Server      ServerConfig      `mapstructure:"server"`
+	Database    DatabaseConfig    `mapstructure:"database"`
+	Cache       CacheConfig       `mapstructure:"cache"`
+	JWT         JWTConfig         `mapstructure:"jwt"`
+	CORS        CORSConfig        `mapstructure:"cors"`
+	RateLimit   RateLimitConfig   `mapstructure:"rate_limit"`
+	GeoIP       GeoIPConfig       `mapstructure:"geoip"`
+	Webhooks    WebhooksConfig    `mapstructure:"webhooks"`
+	Logging     LoggingConfig     `mapstructure:"logging"`
+	SAML        SAMLConfig        `mapstructure:"saml"`
+	Email       EmailConfig       `mapstructure:"email"`
+	Domains     DomainsConfig     `mapstructure:"domains"`
+	LinkHealth  LinkHealthConfig  `mapstructure:"link_health"`
+	Screening   ScreeningConfig   `mapstructure:"screening"`
+	ShortCodes  ShortCodesConfig  `mapstructure:"shortcodes"`
+	QR          QRConfig          `mapstructure:"qr"`
+	Aggregation AggregationConfig `mapstructure:"aggregation"`
+	Analytics   AnalyticsConfig   `mapstructure:"analytics"`
+	Exports     ExportsConfig     `mapstructure:"exports"`
+	Reports     ReportsConfig     `mapstructure:"reports"`
+	Conversions ConversionsConfig `mapstructure:"conversions"`
+	Anomalies   AnomaliesConfig   `mapstructure:"anomalies"`
+	Fraud       FraudConfig       `mapstructure:"fraud"`
 }
 
 type ServerConfig struct {
@@ -28,6 +39,8 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
 	WriteTimeout time.Duration `mapstructure:"write_timeout"`
 	IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
+	// Proxies (IPs or CIDRs) whose X-Forwarded-For is believed for visitor IPs
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type DatabaseConfig struct {
@@ -47,8 +60,9 @@ type TenantDBConfig struct {
 }
 
 type CacheConfig struct {
-	LinkTTL    time.Duration `mapstructure:"link_ttl"`
-	MaxEntries int           `mapstructure:"max_entries"`
+	LinkTTL      time.Duration `mapstructure:"link_ttl"`
+	AnalyticsTTL time.Duration `mapstructure:"analytics_ttl"` // Org overview responses
+	MaxEntries   int           `mapstructure:"max_entries"`
 }
 
 type JWTConfig struct {
@@ -75,9 +89,18 @@ type GeoIPConfig struct {
 }
 
 type WebhooksConfig struct {
-	WorkerCount   int    `mapstructure:"worker_count"`
-	RetryAttempts int    `mapstructure:"retry_attempts"`
-	RetryBackoff  string `mapstructure:"retry_backoff"`
+	WorkerCount        int           `mapstructure:"worker_count"`   // Deliveries in flight at once, across tenants
+	RetryAttempts      int           `mapstructure:"retry_attempts"` // Retries after the first failed attempt
+	RetryBackoff       string        `mapstructure:"retry_backoff"`
+	RetryDelay         time.Duration `mapstructure:"retry_delay"`     // Wait after the first failed attempt
+	MaxRetryDelay      time.Duration `mapstructure:"max_retry_delay"` // Cap on the wait between attempts
+	DisableAfter       time.Duration `mapstructure:"disable_after"`   // Endpoints failing this long are disabled
+	PollInterval       time.Duration `mapstructure:"poll_interval"`   // How often the worker looks for due deliveries
+	Timeout            time.Duration `mapstructure:"timeout"`
+	LogRetention       time.Duration `mapstructure:"log_retention"`        // How long finished deliveries stay in the delivery log
+	ClickBatchSize     int           `mapstructure:"click_batch_size"`     // Clicks per click.created event
+	ClickBatchInterval time.Duration `mapstructure:"click_batch_interval"` // Longest a click waits for its batch to fill
+	SecretGracePeriod  time.Duration `mapstructure:"secret_grace_period"`  // How long a rotated-out secret keeps signing deliveries
 }
 
 type LoggingConfig struct {
@@ -114,6 +137,68 @@ type DomainsConfig struct {
 	APIDomain   string `mapstructure:"api_domain"`
 }
 
+type LinkHealthConfig struct {
+	Interval           time.Duration `mapstructure:"interval"`
+	Timeout            time.Duration `mapstructure:"timeout"`
+	Concurrency        int           `mapstructure:"concurrency"`
+	PerHostConcurrency int           `mapstructure:"per_host_concurrency"`
+	FailureThreshold   int           `mapstructure:"failure_threshold"`
+}
+
+type ScreeningConfig struct {
+	AllowDomains     []string      `mapstructure:"allow_domains"`
+	DenyDomains      []string      `mapstructure:"deny_domains"`
+	BlocklistPath    string        `mapstructure:"blocklist_path"`
+	ReloadInterval   time.Duration `mapstructure:"reload_interval"`
+	ResolveDNS       bool          `mapstructure:"resolve_dns"`
+	RescreenInterval time.Duration `mapstructure:"rescreen_interval"`
+}
+
+type ShortCodesConfig struct {
+	SynonymsPath string `mapstructure:"synonyms_path"`
+}
+
+type QRConfig struct {
+	LogoDir string `mapstructure:"logo_dir"`
+}
+
+type AggregationConfig struct {
+	LookbackDays int `mapstructure:"lookback_days"` // Recent days re-aggregated every run to pick up late clicks
+	BackfillDays int `mapstructure:"backfill_days"` // How far back a tenant without a checkpoint starts
+	Concurrency  int `mapstructure:"concurrency"`   // Tenants aggregated in parallel
+}
+
+type AnalyticsConfig struct {
+	VisitorSecret string `mapstructure:"visitor_secret"` // HMAC key for visitor IDs; changing it resets unique counts
+}
+
+type ExportsConfig struct {
+	Dir           string        `mapstructure:"dir"`
+	SigningSecret string        `mapstructure:"signing_secret"` // HMAC key for download URLs
+	TTL           time.Duration `mapstructure:"ttl"`            // How long finished exports can be downloaded
+	MaxSyncRows   int           `mapstructure:"max_sync_rows"`  // Larger exports must run as background jobs
+	Concurrency   int           `mapstructure:"concurrency"`    // Background exports running at once
+}
+
+type ConversionsConfig struct {
+	AttributionWindow time.Duration `mapstructure:"attribution_window"` // Oldest click a conversion can be reported against
+}
+
+type FraudConfig struct {
+	DatacenterRangesPath string        `mapstructure:"datacenter_ranges_path"` // Hosting/cloud CIDRs used to score clicks
+	ReloadInterval       time.Duration `mapstructure:"reload_interval"`
+}
+
+type AnomaliesConfig struct {
+	Interval    time.Duration `mapstructure:"interval"`    // How often the worker checks the last complete hour
+	Concurrency int           `mapstructure:"concurrency"` // Tenants processed in parallel
+}
+
+type ReportsConfig struct {
+	Interval    time.Duration `mapstructure:"interval"`    // How often the worker looks for due reports
+	Concurrency int           `mapstructure:"concurrency"` // Tenants processed in parallel
+}
+
 func Load(path string) (*Config, error) {
 	viper.SetConfigFile(path)
 	viper.AutomaticEnv()
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// RunMigrations applies every .sql file in dir that has not been applied yet,
+// in filename order, recording each in schema_migrations. Each file runs in its
+// own transaction, so a failed migration leaves no partial changes behind.
+//
+// The filename is the version, so released files must never be renamed or
+// edited; changes go in a new file.
+//
+// Databases created before tracking existed (tenant files up to 009, global up
+// to 007) have no schema_migrations rows. Their first tracked run replays those
+// files, which only use CREATE ... IF NOT EXISTS, records them, and applies the
+// rest once. Nothing needs to be done by hand to roll this out, but the early
+// files must stay repeatable; TestRunMigrations_UntrackedDatabases checks it.
+func RunMigrations(db *sql.DB, dir string) error {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version TEXT PRIMARY KEY,
+			applied_at INTEGER NOT NULL
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	applied := map[string]bool{}
+	rows, err := db.Query("SELECT version FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = true
+	}
+	rows.Close()
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read migration directory: %w", err)
+	}
+
+	var names []string
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".sql" && !applied[file.Name()] {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to read migration file %s: %w", name, err)
+		}
+
+		log.Printf("Applying migration: %s", name)
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(string(content)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to execute migration %s: %w", name, err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", name, time.Now().Unix()); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func writeMigrations(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func appliedVersions(t *testing.T, db *sql.DB) []string {
+	rows, err := db.Query("SELECT version FROM schema_migrations ORDER BY version")
+	if err != nil {
+		t.Fatalf("Failed to read schema_migrations: %v", err)
+	}
+	defer rows.Close()
+	var versions []string
+	for rows.Next() {
+		var v string
+		rows.Scan(&v)
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+func TestRunMigrations(t *testing.T) {
+	db := openTestDB(t)
+	dir := writeMigrations(t, map[string]string{
+		"001_create_items.sql":   "CREATE TABLE items (id TEXT PRIMARY KEY);",
+		"002_add_items_name.sql": "ALTER TABLE items ADD COLUMN name TEXT;",
+		"README.txt":             "not a migration",
+	})
+
+	if err := RunMigrations(db, dir); err != nil {
+		t.Fatalf("RunMigrations failed: %v", err)
+	}
+	if got := appliedVersions(t, db); !reflect.DeepEqual(got, []string{"001_create_items.sql", "002_add_items_name.sql"}) {
+		t.Errorf("Applied = %v", got)
+	}
+
+	// Applied files are skipped, so the ALTER does not run twice
+	if err := RunMigrations(db, dir); err != nil {
+		t.Fatalf("Second run failed: %v", err)
+	}
+
+	// A failing file rolls back on its own and stops the run; later files wait
+	os.WriteFile(filepath.Join(dir, "003_add_items_price.sql"), []byte("ALTER TABLE items ADD COLUMN price INTEGER; ALTER TABLE missing ADD COLUMN x;"), 0o644)
+	os.WriteFile(filepath.Join(dir, "004_create_tags.sql"), []byte("CREATE TABLE tags (id TEXT);"), 0o644)
+	if err := RunMigrations(db, dir); err == nil {
+		t.Fatal("Expected the failing migration to be reported")
+	}
+	if got := appliedVersions(t, db); len(got) != 2 {
+		t.Errorf("Applied after failure = %v", got)
+	}
+	if _, err := db.Exec("SELECT price FROM items"); err == nil {
+		t.Error("Failed migration left a partial change behind")
+	}
+	if _, err := db.Exec("SELECT id FROM tags"); err == nil {
+		t.Error("Migration after the failing one was applied")
+	}
+}
+
+// Databases migrated before schema_migrations existed have the schema but no
+// rows; the pre-tracking files must be safe to run over them once.
+func TestRunMigrations_UntrackedDatabases(t *testing.T) {
+	for _, tt := range []struct {
+		dir         string
+		preTracking int // Files that existed before tracking
+	}{
+		{"../../../migrations/tenant", 9},
+		{"../../../migrations/global", 7},
+	} {
+		t.Run(filepath.Base(tt.dir), func(t *testing.T) {
+			db := openTestDB(t)
+			if err := RunMigrations(db, tt.dir); err != nil {
+				t.Fatalf("Fresh database: %v", err)
+			}
+			applied := appliedVersions(t, db)
+			if len(applied) < tt.preTracking {
+				t.Fatalf("Applied only %v", applied)
+			}
+
+			for _, version := range applied[:tt.preTracking] {
+				db.Exec("DELETE FROM schema_migrations WHERE version = ?", version)
+			}
+			if err := RunMigrations(db, tt.dir); err != nil {
+				t.Fatalf("Re-running pre-tracking files: %v", err)
+			}
+			if got := appliedVersions(t, db); !reflect.DeepEqual(got, applied) {
+				t.Errorf("Applied = %v, want %v", got, applied)
+			}
+		})
+	}
+}
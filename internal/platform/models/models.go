@@ -48,6 +48,18 @@ type Invite struct {
 	UpdatedAt      int64  `json:"updated_at"`
 }
 
+// Domain is a custom domain an organization serves short links from once
+// verified.
+type Domain struct {
+	ID                string `json:"id"`
+	OrganizationID    string `json:"organization_id"`
+	Domain            string `json:"domain"`
+	Verified          bool   `json:"verified"`
+	VerificationToken string `json:"verification_token"` // Expected as a DNS TXT record on the domain
+	VerifiedAt        int64  `json:"verified_at,omitempty"`
+	CreatedAt         int64  `json:"created_at"`
+}
+
 type SAMLConfig struct {
 	ID             string `json:"id"`
 	OrganizationID string `json:"organization_id"`
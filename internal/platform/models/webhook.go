@@ -1,17 +1,20 @@
 package models
 
 type Webhook struct {
-	ID              string   `json:"id"`
-	OrganizationID  string   `json:"organization_id"`
-	URL             string   `json:"url"`
-	Events          []string `json:"events"` // JSON array in DB
-	Secret          string   `json:"secret"`
-	Status          string   `json:"status"` // active, paused, failed
-	RetryCount      int      `json:"retry_count"`
-	LastTriggeredAt int64    `json:"last_triggered_at,omitempty"`
-	LastError       string   `json:"last_error,omitempty"`
-	CreatedAt       int64    `json:"created_at"`
-	UpdatedAt       int64    `json:"updated_at"`
+	ID                      string   `json:"id"`
+	OrganizationID          string   `json:"organization_id"`
+	URL                     string   `json:"url"`
+	Events                  []string `json:"events"` // JSON array in DB
+	Secret                  string   `json:"secret"`
+	Status                  string   `json:"status"`      // active, paused, failed
+	RetryCount              int      `json:"retry_count"` // Consecutive failed delivery attempts
+	LastTriggeredAt         int64    `json:"last_triggered_at,omitempty"`
+	LastError               string   `json:"last_error,omitempty"`
+	FailingSince            int64    `json:"failing_since,omitempty"`              // First failure of the current run, 0 when healthy
+	PreviousSecret          string   `json:"-"`                                    // Signs deliveries alongside Secret until PreviousSecretExpiresAt
+	PreviousSecretExpiresAt int64    `json:"previous_secret_expires_at,omitempty"` // End of the last rotation's grace period
+	CreatedAt               int64    `json:"created_at"`
+	UpdatedAt               int64    `json:"updated_at"`
 }
 
 type WebhookEvent struct {
@@ -21,3 +24,42 @@ type WebhookEvent struct {
 	OrgID     string      `json:"org_id"`
 	Data      interface{} `json:"data"`
 }
+
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusFailed    = "failed" // Out of attempts, or the webhook was disabled
+)
+
+// WebhookDelivery is one event queued for one webhook, with the outcome of its
+// latest attempt.
+type WebhookDelivery struct {
+	ID             string `json:"id"`
+	WebhookID      string `json:"webhook_id"`
+	EventID        string `json:"event_id"`
+	Event          string `json:"event"`
+	Payload        string `json:"payload"`
+	Status         string `json:"status"` // pending, delivered, failed
+	Attempts       int    `json:"attempts"`
+	NextAttemptAt  int64  `json:"next_attempt_at"`
+	ResponseStatus int    `json:"response_status,omitempty"`
+	LastError      string `json:"last_error,omitempty"`
+	CreatedAt      int64  `json:"created_at"`
+	DeliveredAt    int64  `json:"delivered_at,omitempty"`
+	RedeliveryOf   string `json:"redelivery_of,omitempty"` // Delivery this one repeats, for manual redeliveries
+}
+
+// WebhookDeliveryAttempt is one HTTP request made for a delivery.
+type WebhookDeliveryAttempt struct {
+	ID             string            `json:"id"`
+	DeliveryID     string            `json:"delivery_id"`
+	WebhookID      string            `json:"webhook_id"`
+	Attempt        int               `json:"attempt"`
+	RequestURL     string            `json:"request_url"`
+	RequestHeaders map[string]string `json:"request_headers"`
+	ResponseStatus int               `json:"response_status,omitempty"`
+	ResponseBody   string            `json:"response_body,omitempty"` // Truncated
+	Error          string            `json:"error,omitempty"`
+	LatencyMs      int64             `json:"latency_ms"`
+	CreatedAt      int64             `json:"created_at"`
+}
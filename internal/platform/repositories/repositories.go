@@ -65,6 +65,29 @@ func (r *OrganizationRepository) GetByDomain(domain string) (*models.Organizatio
 	return org, nil
 }
 
+// ListActive returns every organization that has not been soft-deleted.
+// Used by background workers that fan out across tenant databases.
+func (r *OrganizationRepository) ListActive() ([]*models.Organization, error) {
+	rows, err := r.db.Query(`
+		SELECT id, slug, name, domain, db_file_path, plan_tier, link_quota, member_quota, saml_enabled, webhook_secret, created_at, updated_at, deleted_at
+		FROM organizations WHERE deleted_at IS NULL ORDER BY created_at ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []*models.Organization
+	for rows.Next() {
+		org := &models.Organization{}
+		if err := rows.Scan(&org.ID, &org.Slug, &org.Name, &org.Domain, &org.DBFilePath, &org.PlanTier, &org.LinkQuota, &org.MemberQuota, &org.SAMLEnabled, &org.WebhookSecret, &org.CreatedAt, &org.UpdatedAt, &org.DeletedAt); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
 
 type UserRepository struct {
 	db *sql.DB
@@ -165,3 +188,105 @@ func (r *InviteRepository) Create(invite *models.Invite) error {
     `, invite.ID, invite.OrganizationID, invite.Code, invite.Email, invite.Role, invite.InvitedBy, invite.Status, invite.MaxUses, invite.CurrentUses, invite.ExpiresAt, invite.CreatedAt, invite.UpdatedAt)
     return err
 }
+
+type DomainRepository struct {
+	db *sql.DB
+}
+
+func NewDomainRepository(db *sql.DB) *DomainRepository {
+	return &DomainRepository{db: db}
+}
+
+func (r *DomainRepository) Create(d *models.Domain) error {
+	_, err := r.db.Exec(`
+		INSERT INTO domains (id, organization_id, domain, verified, verification_token, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, d.ID, d.OrganizationID, d.Domain, d.Verified, d.VerificationToken, d.CreatedAt)
+	return err
+}
+
+// GetByID returns one of the organization's domains, or nil if it has none
+// with that ID.
+func (r *DomainRepository) GetByID(orgID, id string) (*models.Domain, error) {
+	d, err := scanDomain(r.db.QueryRow(`
+		SELECT id, organization_id, domain, verified, verification_token, verified_at, created_at
+		FROM domains WHERE organization_id = ? AND id = ?
+	`, orgID, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+// Taken reports whether orgID can't add domain: it has already added it, or
+// another organization has verified it. Unverified claims elsewhere don't
+// count; whoever verifies first wins.
+func (r *DomainRepository) Taken(orgID, domain string) (bool, error) {
+	var n int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) FROM domains WHERE domain = ? AND (organization_id = ? OR verified = TRUE)
+	`, domain, orgID).Scan(&n)
+	return n > 0, err
+}
+
+func (r *DomainRepository) ListByOrg(orgID string) ([]*models.Domain, error) {
+	rows, err := r.db.Query(`
+		SELECT id, organization_id, domain, verified, verification_token, verified_at, created_at
+		FROM domains WHERE organization_id = ? ORDER BY created_at ASC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := []*models.Domain{}
+	for rows.Next() {
+		d, err := scanDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, d)
+	}
+	return domains, rows.Err()
+}
+
+// MarkVerified verifies d and drops other organizations' unverified claims on
+// the same domain. It returns false, changing nothing, if another
+// organization verified the domain first.
+func (r *DomainRepository) MarkVerified(d *models.Domain, verifiedAt int64) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var others int
+	if err := tx.QueryRow(`
+		SELECT COUNT(*) FROM domains WHERE domain = ? AND verified = TRUE AND id != ?
+	`, d.Domain, d.ID).Scan(&others); err != nil {
+		return false, err
+	}
+	if others > 0 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(`UPDATE domains SET verified = TRUE, verified_at = ? WHERE id = ?`, verifiedAt, d.ID); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`DELETE FROM domains WHERE domain = ? AND id != ? AND verified = FALSE`, d.Domain, d.ID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func scanDomain(row rowScanner) (*models.Domain, error) {
+	d := &models.Domain{}
+	var token sql.NullString
+	var verifiedAt sql.NullInt64
+	if err := row.Scan(&d.ID, &d.OrganizationID, &d.Domain, &d.Verified, &token, &verifiedAt, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	d.VerificationToken = token.String
+	d.VerifiedAt = verifiedAt.Int64
+	return d, nil
+}
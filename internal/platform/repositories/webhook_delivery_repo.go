@@ -0,0 +1,199 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"trackr/internal/platform/models"
+)
+
+const webhookDeliveryColumns = `id, webhook_id, event_id, event, payload, status, attempts, next_attempt_at, response_status, last_error, created_at, delivered_at, redelivery_of`
+
+// CreateDeliveries queues deliveries in one transaction.
+func (r *WebhookRepository) CreateDeliveries(deliveries []*models.WebhookDelivery) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, d := range deliveries {
+		_, err := tx.Exec(`
+			INSERT INTO webhook_deliveries (id, webhook_id, event_id, event, payload, status, attempts, next_attempt_at, created_at, redelivery_of)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, d.ID, d.WebhookID, d.EventID, d.Event, d.Payload, d.Status, d.Attempts, d.NextAttemptAt, d.CreatedAt, nullString(d.RedeliveryOf))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DueDeliveries returns up to limit pending deliveries whose next attempt is
+// at or before now, oldest first. Deliveries of paused or disabled webhooks
+// wait.
+func (r *WebhookRepository) DueDeliveries(now int64, limit int) ([]*models.WebhookDelivery, error) {
+	rows, err := r.db.Query(`
+		SELECT d.id, d.webhook_id, d.event_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at,
+			d.response_status, d.last_error, d.created_at, d.delivered_at, d.redelivery_of
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = ? AND d.next_attempt_at <= ? AND w.status = 'active'
+		ORDER BY d.next_attempt_at, d.created_at
+		LIMIT ?
+	`, models.DeliveryStatusPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetDelivery returns one of the webhook's deliveries.
+func (r *WebhookRepository) GetDelivery(webhookID, id string) (*models.WebhookDelivery, error) {
+	return scanWebhookDelivery(r.db.QueryRow(`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE webhook_id = ? AND id = ?`, webhookID, id))
+}
+
+// ListDeliveries returns the webhook's deliveries newest first, optionally only
+// those with status.
+func (r *WebhookRepository) ListDeliveries(webhookID, status string, limit, offset int) ([]*models.WebhookDelivery, error) {
+	rows, err := r.db.Query(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE webhook_id = ? AND (? = '' OR status = ?)
+		ORDER BY created_at DESC, id
+		LIMIT ? OFFSET ?
+	`, webhookID, status, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*models.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// UpdateDelivery saves the outcome of an attempt.
+func (r *WebhookRepository) UpdateDelivery(d *models.WebhookDelivery) error {
+	_, err := r.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, response_status = ?, last_error = ?, delivered_at = ?
+		WHERE id = ?
+	`, d.Status, d.Attempts, d.NextAttemptAt, nullInt(int64(d.ResponseStatus)), nullString(d.LastError), nullInt(d.DeliveredAt), d.ID)
+	return err
+}
+
+// FailPendingDeliveries gives up on every pending delivery of a webhook.
+func (r *WebhookRepository) FailPendingDeliveries(webhookID, reason string) error {
+	_, err := r.db.Exec(`
+		UPDATE webhook_deliveries SET status = ?, last_error = ? WHERE webhook_id = ? AND status = ?
+	`, models.DeliveryStatusFailed, reason, webhookID, models.DeliveryStatusPending)
+	return err
+}
+
+func (r *WebhookRepository) InsertDeliveryAttempt(a *models.WebhookDeliveryAttempt) error {
+	headers, err := json.Marshal(a.RequestHeaders)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`
+		INSERT INTO webhook_delivery_attempts (id, delivery_id, webhook_id, attempt, request_url, request_headers, response_status, response_body, error, latency_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, a.ID, a.DeliveryID, a.WebhookID, a.Attempt, a.RequestURL, string(headers), nullInt(int64(a.ResponseStatus)),
+		nullString(a.ResponseBody), nullString(a.Error), a.LatencyMs, a.CreatedAt)
+	return err
+}
+
+// ListDeliveryAttempts returns a delivery's attempts, first attempt first.
+func (r *WebhookRepository) ListDeliveryAttempts(deliveryID string) ([]*models.WebhookDeliveryAttempt, error) {
+	rows, err := r.db.Query(`
+		SELECT id, delivery_id, webhook_id, attempt, request_url, request_headers, response_status, response_body, error, latency_ms, created_at
+		FROM webhook_delivery_attempts
+		WHERE delivery_id = ?
+		ORDER BY attempt
+	`, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []*models.WebhookDeliveryAttempt{}
+	for rows.Next() {
+		var a models.WebhookDeliveryAttempt
+		var headers string
+		var responseStatus sql.NullInt64
+		var responseBody, errStr sql.NullString
+		if err := rows.Scan(&a.ID, &a.DeliveryID, &a.WebhookID, &a.Attempt, &a.RequestURL, &headers, &responseStatus,
+			&responseBody, &errStr, &a.LatencyMs, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(headers), &a.RequestHeaders)
+		a.ResponseStatus = int(responseStatus.Int64)
+		a.ResponseBody = responseBody.String
+		a.Error = errStr.String
+		attempts = append(attempts, &a)
+	}
+	return attempts, rows.Err()
+}
+
+// PruneDeliveries deletes finished deliveries created before the given time,
+// with their attempts, and returns how many deliveries went.
+func (r *WebhookRepository) PruneDeliveries(before int64) (int64, error) {
+	_, err := r.db.Exec(`
+		DELETE FROM webhook_delivery_attempts WHERE delivery_id IN (
+			SELECT id FROM webhook_deliveries WHERE created_at < ? AND status != ?
+		)
+	`, before, models.DeliveryStatusPending)
+	if err != nil {
+		return 0, err
+	}
+	res, err := r.db.Exec(`DELETE FROM webhook_deliveries WHERE created_at < ? AND status != ?`, before, models.DeliveryStatusPending)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebhookDelivery(row rowScanner) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var responseStatus, deliveredAt sql.NullInt64
+	var lastError, redeliveryOf sql.NullString
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&responseStatus, &lastError, &d.CreatedAt, &deliveredAt, &redeliveryOf)
+	if err != nil {
+		return nil, err
+	}
+	d.ResponseStatus = int(responseStatus.Int64)
+	d.LastError = lastError.String
+	d.DeliveredAt = deliveredAt.Int64
+	d.RedeliveryOf = redeliveryOf.String
+	return &d, nil
+}
+
+func nullInt(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
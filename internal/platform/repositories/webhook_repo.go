@@ -37,18 +37,24 @@ func (r *WebhookRepository) Create(webhook *models.Webhook) error {
 }
 
 func (r *WebhookRepository) GetByID(id string) (*models.Webhook, error) {
-	query := `SELECT id, url, events, secret, status, retry_count, last_triggered_at, last_error, created_at, updated_at FROM webhooks WHERE id = ?`
+	query := `SELECT id, url, events, secret, status, retry_count, last_triggered_at, last_error, failing_since, previous_secret, previous_secret_expires_at, created_at, updated_at FROM webhooks WHERE id = ?`
 	row := r.db.QueryRow(query, id)
 
 	var w models.Webhook
 	var eventsStr string
 	var lastTriggeredAt sql.NullInt64
 	var lastError sql.NullString
+	var failingSince, previousExpiresAt sql.NullInt64
+	var previousSecret sql.NullString
 
-	err := row.Scan(&w.ID, &w.URL, &eventsStr, &w.Secret, &w.Status, &w.RetryCount, &lastTriggeredAt, &lastError, &w.CreatedAt, &w.UpdatedAt)
+	err := row.Scan(&w.ID, &w.URL, &eventsStr, &w.Secret, &w.Status, &w.RetryCount, &lastTriggeredAt, &lastError, &failingSince,
+		&previousSecret, &previousExpiresAt, &w.CreatedAt, &w.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
+	w.FailingSince = failingSince.Int64
+	w.PreviousSecret = previousSecret.String
+	w.PreviousSecretExpiresAt = previousExpiresAt.Int64
 
 	if lastTriggeredAt.Valid {
 		w.LastTriggeredAt = lastTriggeredAt.Int64
@@ -63,7 +69,7 @@ func (r *WebhookRepository) GetByID(id string) (*models.Webhook, error) {
 }
 
 func (r *WebhookRepository) List() ([]*models.Webhook, error) {
-	query := `SELECT id, url, events, secret, status, retry_count, last_triggered_at, last_error, created_at, updated_at FROM webhooks ORDER BY created_at DESC`
+	query := `SELECT id, url, events, secret, status, retry_count, last_triggered_at, last_error, failing_since, previous_secret, previous_secret_expires_at, created_at, updated_at FROM webhooks ORDER BY created_at DESC`
 	rows, err := r.db.Query(query)
 	if err != nil {
 		return nil, err
@@ -76,10 +82,16 @@ func (r *WebhookRepository) List() ([]*models.Webhook, error) {
 		var eventsStr string
 		var lastTriggeredAt sql.NullInt64
 		var lastError sql.NullString
+		var failingSince, previousExpiresAt sql.NullInt64
+		var previousSecret sql.NullString
 
-		if err := rows.Scan(&w.ID, &w.URL, &eventsStr, &w.Secret, &w.Status, &w.RetryCount, &lastTriggeredAt, &lastError, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		if err := rows.Scan(&w.ID, &w.URL, &eventsStr, &w.Secret, &w.Status, &w.RetryCount, &lastTriggeredAt, &lastError, &failingSince,
+			&previousSecret, &previousExpiresAt, &w.CreatedAt, &w.UpdatedAt); err != nil {
 			return nil, err
 		}
+		w.FailingSince = failingSince.Int64
+		w.PreviousSecret = previousSecret.String
+		w.PreviousSecretExpiresAt = previousExpiresAt.Int64
 
 		if lastTriggeredAt.Valid {
 			w.LastTriggeredAt = lastTriggeredAt.Int64
@@ -109,7 +121,26 @@ func (r *WebhookRepository) Update(webhook *models.Webhook) error {
 	return err
 }
 
+// RotateSecret replaces the webhook's secret. The old secret keeps signing
+// deliveries until previousExpiresAt; pass 0 to drop it at once.
+func (r *WebhookRepository) RotateSecret(id, secret string, previousExpiresAt int64) error {
+	_, err := r.db.Exec(`
+		UPDATE webhooks
+		SET previous_secret = CASE WHEN ? > 0 THEN secret END,
+			previous_secret_expires_at = CASE WHEN ? > 0 THEN ? END,
+			secret = ?, updated_at = ?
+		WHERE id = ?
+	`, previousExpiresAt, previousExpiresAt, previousExpiresAt, secret, time.Now().Unix(), id)
+	return err
+}
+
 func (r *WebhookRepository) Delete(id string) error {
+	if _, err := r.db.Exec(`DELETE FROM webhook_delivery_attempts WHERE webhook_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := r.db.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id); err != nil {
+		return err
+	}
 	_, err := r.db.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
 	return err
 }
@@ -119,23 +150,32 @@ func (r *WebhookRepository) UpdateStatus(id, status string) error {
 	return err
 }
 
-func (r *WebhookRepository) UpdateLastTriggered(id string, timestamp int64) error {
-	_, err := r.db.Exec(`UPDATE webhooks SET last_triggered_at = ? WHERE id = ?`, timestamp, id)
+// RecordSuccess marks a delivery to the webhook as successful, ending any run
+// of failures.
+func (r *WebhookRepository) RecordSuccess(id string, timestamp int64) error {
+	_, err := r.db.Exec(`UPDATE webhooks SET last_triggered_at = ?, retry_count = 0, failing_since = NULL WHERE id = ?`, timestamp, id)
 	return err
 }
 
-func (r *WebhookRepository) IncrementRetryCount(id string) error {
-	_, err := r.db.Exec(`UPDATE webhooks SET retry_count = retry_count + 1 WHERE id = ?`, id)
-	return err
+// RecordFailure counts a failed delivery attempt and returns when the current
+// run of failures started.
+func (r *WebhookRepository) RecordFailure(id, lastError string, timestamp int64) (int64, error) {
+	_, err := r.db.Exec(`
+		UPDATE webhooks
+		SET retry_count = retry_count + 1, last_error = ?, failing_since = COALESCE(failing_since, ?)
+		WHERE id = ?
+	`, lastError, timestamp, id)
+	if err != nil {
+		return 0, err
+	}
+	var failingSince int64
+	err = r.db.QueryRow(`SELECT failing_since FROM webhooks WHERE id = ?`, id).Scan(&failingSince)
+	return failingSince, err
 }
 
+// ResetRetryCount clears the webhook's failure run, e.g. when it is re-enabled.
 func (r *WebhookRepository) ResetRetryCount(id string) error {
-	_, err := r.db.Exec(`UPDATE webhooks SET retry_count = 0 WHERE id = ?`, id)
-	return err
-}
-
-func (r *WebhookRepository) UpdateLastError(id, lastError string) error {
-	_, err := r.db.Exec(`UPDATE webhooks SET last_error = ? WHERE id = ?`, lastError, id)
+	_, err := r.db.Exec(`UPDATE webhooks SET retry_count = 0, failing_since = NULL WHERE id = ?`, id)
 	return err
 }
 
@@ -173,28 +213,3 @@ func (r *WebhookRepository) GetByEvent(eventType string) ([]*models.Webhook, err
 	}
 	return matched, nil
 }
-
-func (r *WebhookRepository) GetFailed(since int64) ([]*models.Webhook, error) {
-	query := `SELECT id, url, events, secret, status, retry_count, last_triggered_at FROM webhooks WHERE status = 'active' AND last_triggered_at < ? AND retry_count > 0`
-	rows, err := r.db.Query(query, since)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var webhooks []*models.Webhook
-	for rows.Next() {
-		var w models.Webhook
-		var eventsStr string
-		var lastTriggeredAt sql.NullInt64
-		if err := rows.Scan(&w.ID, &w.URL, &eventsStr, &w.Secret, &w.Status, &w.RetryCount, &lastTriggeredAt); err != nil {
-			return nil, err
-		}
-		if lastTriggeredAt.Valid {
-			w.LastTriggeredAt = lastTriggeredAt.Int64
-		}
-		json.Unmarshal([]byte(eventsStr), &w.Events)
-		webhooks = append(webhooks, &w)
-	}
-	return webhooks, nil
-}
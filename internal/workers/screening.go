@@ -0,0 +1,31 @@
+package workers
+
+import (
+	"log"
+	"net"
+
+	"trackr/internal/engine/links"
+	"trackr/internal/platform/config"
+)
+
+// NewPlatformScreener builds the platform-wide screening pipeline shared by the
+// server and the worker, and keeps its blocklist hot-reloaded until stop is
+// closed.
+func NewPlatformScreener(cfg *config.Config, stop <-chan struct{}) links.Screener {
+	blocklist, err := links.NewBlocklist(cfg.Screening.BlocklistPath)
+	if err != nil {
+		log.Printf("Screening blocklist not loaded: %v", err)
+	}
+	go blocklist.Watch(cfg.Screening.ReloadInterval, stop)
+
+	opts := links.PlatformScreeningOptions{
+		AllowDomains: cfg.Screening.AllowDomains,
+		DenyDomains:  cfg.Screening.DenyDomains,
+		ShortDomains: []string{cfg.Domains.ShortDomain, cfg.Domains.AppDomain, cfg.Domains.APIDomain},
+		Blocklist:    blocklist,
+	}
+	if cfg.Screening.ResolveDNS {
+		opts.LookupIP = net.LookupIP
+	}
+	return links.NewPlatformScreener(opts)
+}
@@ -0,0 +1,53 @@
+package workers
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+
+	"trackr/internal/platform/database"
+	"trackr/internal/platform/models"
+	"trackr/internal/platform/repositories"
+)
+
+// forEachTenant runs fn against every active organization's tenant database.
+// A failure in one tenant is logged and does not stop the others.
+func forEachTenant(globalDB *sql.DB, pool *database.TenantDBPool, fn func(org *models.Organization, db *sql.DB) error) error {
+	return forEachTenantConcurrently(globalDB, pool, 1, fn)
+}
+
+// forEachTenantConcurrently is forEachTenant with up to concurrency tenants
+// processed at once. It returns when every tenant is done.
+func forEachTenantConcurrently(globalDB *sql.DB, pool *database.TenantDBPool, concurrency int, fn func(org *models.Organization, db *sql.DB) error) error {
+	orgs, err := repositories.NewOrganizationRepository(globalDB).ListActive()
+	if err != nil {
+		return err
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, org := range orgs {
+		db, err := pool.Get(org.ID, org.DBFilePath)
+		if err != nil {
+			log.Printf("Worker: failed to open tenant DB for %s: %v", org.ID, err)
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(org *models.Organization, db *sql.DB) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := fn(org, db); err != nil {
+				log.Printf("Worker: tenant %s: %v", org.ID, err)
+			}
+		}(org, db)
+	}
+	wg.Wait()
+	return nil
+}
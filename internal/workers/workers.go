@@ -1,44 +1,241 @@
 package workers
 
 import (
+	"context"
+	"database/sql"
 	"log"
 	"time"
+
+	"trackr/internal/engine/analytics"
+	"trackr/internal/engine/anomalies"
+	"trackr/internal/engine/linkhealth"
+	"trackr/internal/engine/links"
+	"trackr/internal/engine/reports"
+	"trackr/internal/engine/webhooks"
+	"trackr/internal/pkg/mailer"
+	"trackr/internal/platform/config"
+	"trackr/internal/platform/database"
+	"trackr/internal/platform/models"
+	"trackr/internal/platform/repositories"
 )
 
-// Simplified logic for daily stats aggregation
-func AggregateDailyStats() error {
-	// In a real implementation:
-	// 1. Fetch all organizations from global DB
-	// 2. Iterate through each organization
-	// 3. Connect to their tenant DB
-	// 4. Run aggregation queries on `clicks` table
-	// 5. Upsert results into `daily_stats` table
+// AggregateDailyStats brings daily_stats, hourly_stats and dimension_stats up
+// to date in every tenant, up to cfg.Concurrency tenants at a time. Each tenant
+// resumes from its own checkpoint and re-aggregates the last cfg.LookbackDays
+// for late clicks.
+func AggregateDailyStats(globalDB *sql.DB, pool *database.TenantDBPool, cfg config.AggregationConfig) error {
+	lookback := cfg.LookbackDays
+	if lookback < 1 {
+		lookback = 3
+	}
+	backfill := cfg.BackfillDays
+	if backfill < lookback {
+		backfill = 400
+	}
+	now := time.Now()
+
+	return forEachTenantConcurrently(globalDB, pool, cfg.Concurrency, func(org *models.Organization, db *sql.DB) error {
+		run, err := analytics.NewService(analytics.NewRepository(db)).RefreshRollups(now, lookback, backfill)
+		if run != nil && run.Days > 0 {
+			log.Printf("Worker: aggregated %d days (%s to %s, %d rows) for %s", run.Days, run.FromDate, run.ToDate, run.Rows, org.ID)
+		}
+		return err
+	})
+}
+
+// SendScheduledReports emails every report whose period has closed in every
+// tenant and schedules the next one. appURL is linked from each report.
+func SendScheduledReports(globalDB *sql.DB, pool *database.TenantDBPool, sender mailer.Sender, appURL string, cfg config.ReportsConfig) error {
+	now := time.Now()
 
-	log.Println("Worker: Aggregating daily stats (Simulated)")
+	return forEachTenantConcurrently(globalDB, pool, cfg.Concurrency, func(org *models.Organization, db *sql.DB) error {
+		sent, err := reports.NewService(db).SendDue(sender, org.Name, appURL, now)
+		if sent > 0 {
+			log.Printf("Worker: sent %d scheduled reports for %s", sent, org.ID)
+		}
+		return err
+	})
+}
+
+// DetectAnomalies checks every tenant's last complete hour of traffic, emits
+// link.anomaly for each new alert and emails the org's alert recipients.
+// sender may be nil, in which case only webhooks are sent.
+func DetectAnomalies(globalDB *sql.DB, pool *database.TenantDBPool, sender mailer.Sender, appURL string, cfg config.AnomaliesConfig) error {
+	now := time.Now()
 
-	// Simulation delay
-	time.Sleep(100 * time.Millisecond)
+	return forEachTenantConcurrently(globalDB, pool, cfg.Concurrency, func(org *models.Organization, db *sql.DB) error {
+		alerts, settings, err := anomalies.NewService(anomalies.NewRepository(db)).Run(now)
+		if len(alerts) == 0 {
+			return err
+		}
 
-	return nil
+		dispatcher := webhooks.NewDispatcher(repositories.NewWebhookRepository(db))
+		for _, alert := range alerts {
+			log.Printf("Worker: anomaly for %s: %s", org.ID, alert.Describe())
+			if err := dispatcher.Dispatch(webhooks.EventLinkAnomaly, org.ID, alert); err != nil {
+				log.Printf("Worker: failed to queue link.anomaly for %s: %v", org.ID, err)
+			}
+		}
+
+		if sender != nil && len(settings.Recipients) > 0 {
+			if sendErr := sender.Send(anomalies.Message(alerts, settings.Recipients, org.Name, appURL)); sendErr != nil {
+				log.Printf("Worker: failed to email anomaly alerts for %s: %v", org.ID, sendErr)
+			}
+		}
+		return err
+	})
 }
 
-// Simplified logic for webhook retries
-func RetryFailedWebhooks() {
-	// In a real implementation:
-	// 1. Fetch all organizations
-	// 2. Iterate each tenant DB
-	// 3. Select webhooks where status='active' AND retry_count > 0 AND last_triggered_at < (now - backoff)
-	// 4. Dispatch them again (need payload persistence which is currently missing in schema)
+// webhookBatchSize caps the deliveries one tenant sends per run, so a backlog
+// in one tenant does not starve the others.
+const webhookBatchSize = 500
+
+// DeliverWebhooks sends due webhook deliveries in every tenant. The deliverer
+// bounds concurrent requests across tenants and reschedules failures.
+func DeliverWebhooks(globalDB *sql.DB, pool *database.TenantDBPool, deliverer *webhooks.Deliverer, cfg config.WebhooksConfig) error {
+	now := time.Now()
+
+	return forEachTenantConcurrently(globalDB, pool, cfg.WorkerCount, func(org *models.Organization, db *sql.DB) error {
+		delivered, failed, err := deliverer.DeliverDue(repositories.NewWebhookRepository(db), now, webhookBatchSize)
+		if delivered+failed > 0 {
+			log.Printf("Worker: webhook deliveries for %s: %d delivered, %d failed", org.ID, delivered, failed)
+		}
+		return err
+	})
+}
+
+// PruneWebhookDeliveries drops finished deliveries older than retention from
+// every tenant's delivery log.
+func PruneWebhookDeliveries(globalDB *sql.DB, pool *database.TenantDBPool, retention time.Duration) error {
+	before := time.Now().Add(-retention).Unix()
+
+	return forEachTenant(globalDB, pool, func(org *models.Organization, db *sql.DB) error {
+		pruned, err := repositories.NewWebhookRepository(db).PruneDeliveries(before)
+		if pruned > 0 {
+			log.Printf("Worker: pruned %d webhook deliveries for %s", pruned, org.ID)
+		}
+		return err
+	})
+}
+
+// ExpireLinks archives every link in every tenant whose expires_at has passed
+// and emits link.expired for each. Like scheduled changes, an expired link
+// keeps redirecting for up to one cache.link_ttl.
+func ExpireLinks(globalDB *sql.DB, pool *database.TenantDBPool) error {
+	now := time.Now().Unix()
+
+	return forEachTenant(globalDB, pool, func(org *models.Organization, db *sql.DB) error {
+		service := links.NewService(links.NewRepository(db)).WithEmitter(linkEvents(org, db))
+
+		expired, err := service.ExpireLinks(now)
+		if len(expired) > 0 {
+			log.Printf("Worker: expired %d links for %s", len(expired), org.ID)
+		}
+		return err
+	})
+}
+
+// linkEvents raises link.* webhook events in org.
+func linkEvents(org *models.Organization, db *sql.DB) *webhooks.OrgEmitter {
+	return webhooks.NewDispatcher(repositories.NewWebhookRepository(db)).ForOrg(org.ID)
+}
+
+// ApplyScheduledChanges applies due scheduled link changes in every tenant.
+// The redirect server caches links for cache.link_ttl, so an applied change is
+// visible to visitors within one TTL of run_at.
+func ApplyScheduledChanges(globalDB *sql.DB, pool *database.TenantDBPool, platform links.Screener) error {
+	now := time.Now().Unix()
+
+	return forEachTenant(globalDB, pool, func(org *models.Organization, db *sql.DB) error {
+		repo := links.NewRepository(db)
+		screener, err := links.ScreenerForOrg(repo, platform)
+		if err != nil {
+			return err
+		}
+		service := links.NewService(repo).WithScreener(screener).WithEmitter(linkEvents(org, db))
+
+		applied, err := service.ApplyDueChanges(now)
+		for _, change := range applied {
+			if change.State == links.ScheduleStateFailed {
+				log.Printf("Worker: scheduled change %s on link %s failed: %s", change.ID, change.LinkID, change.LastError)
+			}
+		}
+		if len(applied) > 0 {
+			log.Printf("Worker: processed %d scheduled link changes for %s", len(applied), org.ID)
+		}
+		return err
+	})
+}
+
+// CheckLinkHealth probes the destination of every active link in every tenant,
+// records the results, and emits link.broken when a link newly crosses the
+// failure threshold.
+func CheckLinkHealth(globalDB *sql.DB, pool *database.TenantDBPool, checker *linkhealth.Checker, cfg config.LinkHealthConfig) error {
+	return forEachTenant(globalDB, pool, func(org *models.Organization, db *sql.DB) error {
+		active, err := links.NewRepository(db).ListActive()
+		if err != nil {
+			return err
+		}
+
+		targets := make([]linkhealth.Target, 0, len(active))
+		byID := make(map[string]*links.Link, len(active))
+		for _, link := range active {
+			targets = append(targets, linkhealth.Target{LinkID: link.ID, ShortCode: link.ShortCode, URL: link.DestinationURL})
+			byID[link.ID] = link
+		}
+
+		results := checker.CheckAll(context.Background(), targets, cfg.Concurrency)
+
+		healthRepo := linkhealth.NewRepository(db)
+		dispatcher := webhooks.NewDispatcher(repositories.NewWebhookRepository(db))
+		broken := 0
+
+		for _, result := range results {
+			becameBroken, err := healthRepo.Record(result, cfg.FailureThreshold)
+			if err != nil {
+				log.Printf("Worker: failed to record health for link %s: %v", result.LinkID, err)
+				continue
+			}
+			if !becameBroken {
+				continue
+			}
+
+			broken++
+			link := byID[result.LinkID]
+			err = dispatcher.Dispatch(webhooks.EventLinkBroken, org.ID, map[string]interface{}{
+				"link_id":         link.ID,
+				"short_code":      link.ShortCode,
+				"destination_url": link.DestinationURL,
+				"status_code":     result.StatusCode,
+				"error":           result.Error,
+				"redirect_chain":  result.RedirectChain,
+				"checked_at":      result.CheckedAt,
+			})
+			if err != nil {
+				log.Printf("Worker: failed to queue link.broken for %s: %v", org.ID, err)
+			}
+		}
 
-	log.Println("Worker: Retrying failed webhooks (Simulated)")
+		log.Printf("Worker: checked %d link destinations for %s (%d newly broken)", len(results), org.ID, broken)
+		return nil
+	})
 }
 
-// Simplified logic for link expiry
-func ExpireLinks() {
-	// In a real implementation:
-	// 1. Fetch all organizations
-	// 2. Iterate each tenant DB
-	// 3. UPDATE links SET status='archived' WHERE expires_at < ? AND status='active'
+// RescreenLinks runs every active link through screening again and pauses those
+// whose destination has become blocked since they were created, e.g. after a
+// blocklist update or a new org deny rule.
+func RescreenLinks(globalDB *sql.DB, pool *database.TenantDBPool, platform links.Screener) error {
+	return forEachTenant(globalDB, pool, func(org *models.Organization, db *sql.DB) error {
+		repo := links.NewRepository(db)
+		screener, err := links.ScreenerForOrg(repo, platform)
+		if err != nil {
+			return err
+		}
 
-	log.Println("Worker: Checking for expired links (Simulated)")
+		flags, err := links.NewService(repo).WithScreener(screener).WithEmitter(linkEvents(org, db)).FlagBlockedLinks()
+		for _, flag := range flags {
+			log.Printf("Worker: paused link %s for %s: %s", flag.LinkID, org.ID, flag.Reason)
+		}
+		return err
+	})
 }
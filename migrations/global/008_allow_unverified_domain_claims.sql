@@ -0,0 +1,22 @@
+-- Several organizations may claim a domain while it is unverified; only one
+-- verified claim may exist, and verifying a domain drops the others.
+CREATE TABLE IF NOT EXISTS domains_new (
+    id TEXT PRIMARY KEY, -- UUID v7
+    organization_id TEXT NOT NULL,
+    domain TEXT NOT NULL, -- acme.com
+    verified BOOLEAN DEFAULT FALSE,
+    verification_token TEXT, -- DNS TXT record value
+    verified_at INTEGER,
+    created_at INTEGER NOT NULL,
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE
+);
+
+INSERT INTO domains_new (id, organization_id, domain, verified, verification_token, verified_at, created_at)
+SELECT id, organization_id, domain, verified, verification_token, verified_at, created_at FROM domains;
+
+DROP TABLE domains;
+ALTER TABLE domains_new RENAME TO domains;
+
+CREATE INDEX IF NOT EXISTS idx_domains_org ON domains(organization_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_domains_org_domain ON domains(organization_id, domain);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_domains_lookup ON domains(domain) WHERE verified = TRUE;
@@ -0,0 +1,15 @@
+-- Every change to a link is stored as a full snapshot so it can be diffed or restored
+CREATE TABLE IF NOT EXISTS link_revisions (
+    id TEXT PRIMARY KEY, -- UUID v7
+    link_id TEXT NOT NULL,
+    revision INTEGER NOT NULL, -- 1 = state at creation, increments per update
+    changed_by TEXT NOT NULL, -- user_id from global DB (or system actor)
+    changed_fields TEXT NOT NULL, -- JSON array: ["destination_url", "rules"]
+    snapshot TEXT NOT NULL, -- JSON: full link state after this revision
+    restored_from INTEGER, -- Set when the revision was produced by a rollback
+    created_at INTEGER NOT NULL,
+    FOREIGN KEY (link_id) REFERENCES links(id) ON DELETE CASCADE,
+    UNIQUE(link_id, revision)
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_revisions_link ON link_revisions(link_id, revision DESC);
@@ -0,0 +1,21 @@
+-- Pending link changes applied by the worker at run_at
+CREATE TABLE IF NOT EXISTS scheduled_changes (
+    id TEXT PRIMARY KEY, -- UUID v7
+    link_id TEXT NOT NULL,
+
+    -- Fields to apply (NULL = leave unchanged)
+    destination_url TEXT,
+    rules TEXT, -- JSON, same shape as links.rules
+    status TEXT, -- active, paused
+
+    run_at INTEGER NOT NULL, -- Unix timestamp
+    state TEXT DEFAULT 'pending', -- pending, applied, cancelled, failed
+    created_by TEXT NOT NULL, -- user_id from global DB
+    last_error TEXT,
+    applied_at INTEGER,
+    created_at INTEGER NOT NULL,
+    FOREIGN KEY (link_id) REFERENCES links(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_changes_due ON scheduled_changes(state, run_at);
+CREATE INDEX IF NOT EXISTS idx_scheduled_changes_link ON scheduled_changes(link_id, run_at);
@@ -0,0 +1,16 @@
+-- Latest destination health check per link
+CREATE TABLE IF NOT EXISTS link_health (
+    link_id TEXT PRIMARY KEY,
+    url TEXT NOT NULL, -- Destination URL that was checked
+    status_code INTEGER, -- Final status after redirects (NULL on transport error)
+    latency_ms INTEGER,
+    redirect_chain TEXT, -- JSON array of hop URLs
+    error TEXT,
+    broken BOOLEAN DEFAULT FALSE, -- Set after consecutive_failures reaches the threshold
+    consecutive_failures INTEGER DEFAULT 0,
+    broken_since INTEGER,
+    checked_at INTEGER NOT NULL,
+    FOREIGN KEY (link_id) REFERENCES links(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_health_broken ON link_health(broken, checked_at DESC);
@@ -0,0 +1,21 @@
+-- Organization-level destination allow/deny lists
+CREATE TABLE IF NOT EXISTS screening_rules (
+    id TEXT PRIMARY KEY, -- UUID v7
+    list TEXT NOT NULL, -- allow, deny
+    domain TEXT NOT NULL, -- Matches the domain and its subdomains
+    created_by TEXT NOT NULL, -- user_id from global DB
+    created_at INTEGER NOT NULL,
+    UNIQUE(list, domain)
+);
+
+-- Links paused because their destination started failing screening
+CREATE TABLE IF NOT EXISTS link_screening_flags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    link_id TEXT NOT NULL,
+    screener TEXT NOT NULL, -- blocklist, platform_deny_list, homograph, ...
+    reason TEXT NOT NULL,
+    flagged_at INTEGER NOT NULL,
+    FOREIGN KEY (link_id) REFERENCES links(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_screening_flags_time ON link_screening_flags(flagged_at DESC);
@@ -0,0 +1,12 @@
+-- Per-organization short-code policy (single row)
+CREATE TABLE IF NOT EXISTS shortcode_policy (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    length INTEGER NOT NULL,
+    alphabet TEXT NOT NULL,
+    case_insensitive INTEGER DEFAULT 0, -- Boolean
+    prefix TEXT,
+    reserved_words TEXT, -- JSON array, exact matches
+    blocked_words TEXT, -- JSON array, substring matches (profanity)
+    updated_by TEXT NOT NULL, -- user_id from global DB
+    updated_at INTEGER NOT NULL
+);
@@ -0,0 +1,14 @@
+-- Named QR codes per link (poster, flyer, packaging); scans carry the name as ?qr=<name>
+CREATE TABLE IF NOT EXISTS qr_variants (
+    id TEXT PRIMARY KEY, -- UUID v7
+    link_id TEXT NOT NULL,
+    name TEXT NOT NULL, -- Lowercase slug, encoded in the QR URL
+    description TEXT,
+    created_by TEXT NOT NULL, -- user_id from global DB
+    created_at INTEGER NOT NULL,
+
+    FOREIGN KEY (link_id) REFERENCES links(id) ON DELETE CASCADE,
+    UNIQUE(link_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_qr_variants_link ON qr_variants(link_id);
@@ -0,0 +1,4 @@
+-- QR variant the click came through; NULL for regular (non-QR) clicks
+ALTER TABLE clicks ADD COLUMN qr_variant TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_clicks_qr_variant ON clicks(link_id, qr_variant, timestamp DESC);
@@ -0,0 +1,6 @@
+-- Progress of background aggregation jobs, so reruns resume instead of rescanning all clicks
+CREATE TABLE IF NOT EXISTS aggregation_checkpoints (
+    job TEXT PRIMARY KEY, -- e.g. daily_stats
+    last_date TEXT NOT NULL, -- Last fully aggregated UTC day (YYYY-MM-DD)
+    updated_at INTEGER NOT NULL
+);
@@ -0,0 +1,24 @@
+-- Hourly click counts per link (UTC hours)
+CREATE TABLE IF NOT EXISTS hourly_stats (
+    link_id TEXT NOT NULL,
+    hour INTEGER NOT NULL, -- Start of the hour, unix ms
+    clicks INTEGER DEFAULT 0,
+    unique_ips INTEGER DEFAULT 0,
+    PRIMARY KEY (link_id, hour),
+    FOREIGN KEY (link_id) REFERENCES links(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_hourly_stats_hour ON hourly_stats(hour);
+
+-- Daily click counts per link and dimension value, for breakdown charts
+CREATE TABLE IF NOT EXISTS dimension_stats (
+    link_id TEXT NOT NULL,
+    date TEXT NOT NULL, -- YYYY-MM-DD (UTC)
+    dimension TEXT NOT NULL, -- country, device, browser, os, referrer_domain, utm_campaign
+    value TEXT NOT NULL, -- '' for clicks without a value
+    clicks INTEGER DEFAULT 0,
+    PRIMARY KEY (link_id, date, dimension, value),
+    FOREIGN KEY (link_id) REFERENCES links(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_dimension_stats_lookup ON dimension_stats(dimension, date, value);
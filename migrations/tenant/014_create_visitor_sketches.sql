@@ -0,0 +1,20 @@
+-- Keyed hash of the visitor (IP and user agent); NULL for clicks logged before it existed
+ALTER TABLE clicks ADD COLUMN visitor_id TEXT;
+
+-- HyperLogLog sketch of each link's visitors per UTC day (see internal/pkg/hll)
+CREATE TABLE IF NOT EXISTS daily_sketches (
+    link_id TEXT NOT NULL,
+    date TEXT NOT NULL, -- YYYY-MM-DD (UTC)
+    sketch BLOB NOT NULL,
+    PRIMARY KEY (link_id, date),
+    FOREIGN KEY (link_id) REFERENCES links(id) ON DELETE CASCADE
+);
+
+-- The same for the whole organization, so org uniques are not summed per link
+CREATE TABLE IF NOT EXISTS org_daily_sketches (
+    date TEXT PRIMARY KEY, -- YYYY-MM-DD (UTC)
+    sketch BLOB NOT NULL
+);
+
+-- Re-run the rollup backfill so past days get sketches too
+DELETE FROM aggregation_checkpoints WHERE job = 'rollups';
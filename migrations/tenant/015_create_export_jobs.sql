@@ -0,0 +1,19 @@
+-- Background analytics exports; files live in the server's export directory
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id TEXT PRIMARY KEY,
+    dataset TEXT NOT NULL, -- clicks, daily_stats
+    format TEXT NOT NULL, -- csv, ndjson, parquet
+    link_id TEXT, -- NULL exports the whole organization
+    start_date TEXT NOT NULL, -- YYYY-MM-DD (UTC, inclusive)
+    end_date TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, running, completed, failed
+    rows INTEGER DEFAULT 0,
+    size_bytes INTEGER DEFAULT 0,
+    error TEXT,
+    created_by TEXT,
+    created_at INTEGER NOT NULL,
+    completed_at INTEGER,
+    expires_at INTEGER -- Download no longer available after this (unix seconds)
+);
+
+CREATE INDEX IF NOT EXISTS idx_export_jobs_created ON export_jobs(created_at DESC);
@@ -0,0 +1,18 @@
+-- Scheduled analytics email reports
+CREATE TABLE IF NOT EXISTS report_subscriptions (
+    id TEXT PRIMARY KEY,
+    name TEXT,
+    frequency TEXT NOT NULL, -- daily, weekly, monthly
+    scope TEXT NOT NULL DEFAULT 'org', -- org, links, campaign
+    link_ids TEXT, -- JSON array, for scope links
+    campaign TEXT, -- utm_campaign, for scope campaign
+    recipients TEXT NOT NULL, -- JSON array of email addresses
+    timezone TEXT NOT NULL DEFAULT 'UTC', -- Periods follow local midnight
+    created_by TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    last_sent_at INTEGER,
+    last_error TEXT,
+    next_run_at INTEGER NOT NULL -- Unix seconds; the worker sends once this has passed
+);
+
+CREATE INDEX IF NOT EXISTS idx_report_subscriptions_next_run ON report_subscriptions(next_run_at);
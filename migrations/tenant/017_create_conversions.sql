@@ -0,0 +1,26 @@
+-- Downstream conversions reported by destination sites against a click ID
+CREATE TABLE IF NOT EXISTS conversions (
+    id TEXT PRIMARY KEY,
+    click_id TEXT NOT NULL, -- clicks.id, appended to the destination URL on redirect
+    link_id TEXT NOT NULL, -- Copied from the click so breakdowns need no join
+    utm_campaign TEXT,
+    qr_variant TEXT,
+    event TEXT NOT NULL, -- e.g. signup, purchase
+    value REAL NOT NULL DEFAULT 0,
+    currency TEXT, -- ISO 4217, required when value is set
+    external_id TEXT, -- Caller's ID (e.g. order number); repeats are ignored
+    clicked_at INTEGER NOT NULL, -- Unix ms of the click; conversions are attributed to the click's time
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversions_click ON conversions(click_id);
+CREATE INDEX IF NOT EXISTS idx_conversions_clicked_at ON conversions(clicked_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversions_external ON conversions(click_id, event, external_id) WHERE external_id IS NOT NULL;
+
+-- Singleton row; whether redirects append a click ID to destinations
+CREATE TABLE IF NOT EXISTS conversion_settings (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    append_click_id INTEGER NOT NULL DEFAULT 0,
+    click_id_param TEXT NOT NULL DEFAULT 'trk_click_id',
+    updated_at INTEGER NOT NULL
+);
@@ -0,0 +1,34 @@
+-- Singleton row; per-org thresholds for traffic anomaly alerts
+CREATE TABLE IF NOT EXISTS anomaly_settings (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    enabled INTEGER NOT NULL DEFAULT 1,
+    spike_ratio REAL NOT NULL, -- Hourly clicks vs baseline rate; 0 disables
+    drop_ratio REAL NOT NULL, -- Hourly clicks as a fraction of baseline rate; 0 disables
+    min_clicks INTEGER NOT NULL, -- Smallest hour (or baseline) worth alerting on
+    ip_burst_share REAL NOT NULL, -- Share of an hour's clicks from one IP; 0 disables
+    bot_share REAL NOT NULL, -- Share of an hour's clicks from bots; 0 disables
+    cooldown_minutes INTEGER NOT NULL, -- Quiet period per link and kind after an alert
+    recipients TEXT NOT NULL, -- JSON array of email addresses
+    updated_by TEXT,
+    updated_at INTEGER NOT NULL
+);
+
+-- Anomalies found in one hour of a link's traffic
+CREATE TABLE IF NOT EXISTS anomaly_alerts (
+    id TEXT PRIMARY KEY,
+    link_id TEXT NOT NULL,
+    short_code TEXT NOT NULL,
+    kind TEXT NOT NULL, -- spike, drop, ip_burst, bot_traffic
+    window_start INTEGER NOT NULL, -- Unix ms, start of the hour
+    window_end INTEGER NOT NULL,
+    clicks INTEGER NOT NULL,
+    baseline REAL NOT NULL, -- Clicks per hour over the baseline period
+    value REAL NOT NULL, -- Ratio or share that crossed the threshold
+    threshold REAL NOT NULL,
+    detail TEXT, -- e.g. the bursting IP
+    created_at INTEGER NOT NULL,
+    FOREIGN KEY (link_id) REFERENCES links(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_anomaly_alerts_window ON anomaly_alerts(link_id, kind, window_start);
+CREATE INDEX IF NOT EXISTS idx_anomaly_alerts_created ON anomaly_alerts(created_at DESC);
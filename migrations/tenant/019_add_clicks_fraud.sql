@@ -0,0 +1,7 @@
+-- Fraud likelihood scored at redirect time; clicks scoring 50 or more are
+-- invalid and left out of "valid clicks only" analytics
+ALTER TABLE clicks ADD COLUMN fraud_score INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE clicks ADD COLUMN fraud_reasons TEXT; -- Comma-separated, e.g. "datacenter_ip,script_headers"
+
+-- Valid clicks per link and day, next to the raw count
+ALTER TABLE daily_stats ADD COLUMN valid_clicks INTEGER DEFAULT 0;
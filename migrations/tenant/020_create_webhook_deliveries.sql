@@ -0,0 +1,24 @@
+-- One row per event per subscribed webhook; the worker delivers pending rows
+-- once next_attempt_at has passed and retries failures with backoff
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id TEXT PRIMARY KEY, -- Sent as X-Trackr-Delivery; the same on every attempt
+    webhook_id TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event TEXT NOT NULL,
+    payload TEXT NOT NULL, -- JSON body, fixed when the event is emitted
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, delivered, failed (out of attempts)
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at INTEGER NOT NULL, -- Unix seconds
+    response_status INTEGER, -- HTTP status of the last attempt, if any
+    last_error TEXT,
+    created_at INTEGER NOT NULL,
+    delivered_at INTEGER,
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at DESC);
+
+-- Start of the current run of failed attempts; endpoints failing for too long
+-- are disabled (status 'failed')
+ALTER TABLE webhooks ADD COLUMN failing_since INTEGER;
@@ -0,0 +1,20 @@
+-- Every HTTP request made for a delivery, kept for the delivery log
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    id TEXT PRIMARY KEY,
+    delivery_id TEXT NOT NULL,
+    webhook_id TEXT NOT NULL,
+    attempt INTEGER NOT NULL, -- 1 for the first attempt of the delivery
+    request_url TEXT NOT NULL,
+    request_headers TEXT NOT NULL, -- JSON object
+    response_status INTEGER, -- NULL when no response arrived
+    response_body TEXT, -- First 4 KB
+    error TEXT,
+    latency_ms INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    FOREIGN KEY (delivery_id) REFERENCES webhook_deliveries(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_attempts_delivery ON webhook_delivery_attempts(delivery_id, attempt);
+
+-- Manual redeliveries point at the delivery they repeat
+ALTER TABLE webhook_deliveries ADD COLUMN redelivery_of TEXT;
@@ -0,0 +1,4 @@
+-- After a secret rotation the previous secret keeps signing deliveries, next
+-- to the new one, until previous_secret_expires_at
+ALTER TABLE webhooks ADD COLUMN previous_secret TEXT;
+ALTER TABLE webhooks ADD COLUMN previous_secret_expires_at INTEGER;
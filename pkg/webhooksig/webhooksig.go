@@ -0,0 +1,134 @@
+// Package webhooksig signs and verifies Trackr webhook deliveries. It lives
+// outside internal/ and uses only the standard library so that receivers can
+// import it to check the X-Trackr-Signature header.
+//
+// The header carries the time the delivery was signed and one or more
+// signatures:
+//
+//	X-Trackr-Signature: t=1700000000,v1=5257a869...,v1=9d1e0f3b...
+//
+// A v1 signature is the hex HMAC-SHA256 of "<t>.<raw request body>" under the
+// webhook's secret. While a rotated secret is in its grace period each
+// delivery carries a signature per secret, so receivers holding either secret
+// accept it. Rejecting timestamps outside a tolerance stops a captured
+// delivery from being replayed later.
+package webhooksig
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Header is the HTTP header deliveries are signed in.
+	Header = "X-Trackr-Signature"
+
+	// DefaultTolerance is how far a delivery's timestamp may be from the
+	// receiver's clock. Retries are signed afresh, so it only needs to cover
+	// clock skew and transit time.
+	DefaultTolerance = 5 * time.Minute
+
+	scheme = "v1"
+)
+
+var (
+	ErrInvalidHeader     = errors.New("webhooksig: malformed signature header")
+	ErrNoSignature       = errors.New("webhooksig: no v1 signature in header")
+	ErrSignatureMismatch = errors.New("webhooksig: no signature matches the secret")
+	ErrTooOld            = errors.New("webhooksig: timestamp outside the tolerance")
+)
+
+// ComputeSignature returns the v1 signature of payload signed at timestamp
+// (Unix seconds).
+func ComputeSignature(secret string, timestamp int64, payload []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	h.Write([]byte("."))
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SignHeader builds the header value for payload signed at timestamp with
+// each of secrets.
+func SignHeader(timestamp int64, payload []byte, secrets ...string) string {
+	parts := make([]string, 0, len(secrets)+1)
+	parts = append(parts, "t="+strconv.FormatInt(timestamp, 10))
+	for _, secret := range secrets {
+		parts = append(parts, scheme+"="+ComputeSignature(secret, timestamp, payload))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Verify checks header against the raw request body and secret using the
+// current time. A tolerance of 0 uses DefaultTolerance.
+func Verify(payload []byte, header, secret string, tolerance time.Duration) error {
+	return VerifyAt(payload, header, secret, tolerance, time.Now())
+}
+
+// VerifyAt is Verify against the given clock.
+func VerifyAt(payload []byte, header, secret string, tolerance time.Duration, now time.Time) error {
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+
+	timestamp, signatures, err := parseHeader(header)
+	if err != nil {
+		return err
+	}
+
+	expected := []byte(ComputeSignature(secret, timestamp, payload))
+	matched := false
+	for _, sig := range signatures {
+		if hmac.Equal(expected, []byte(sig)) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return ErrSignatureMismatch
+	}
+
+	// Checked after the signature so a forged timestamp is reported as a mismatch
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrTooOld
+	}
+	return nil
+}
+
+func parseHeader(header string) (int64, []string, error) {
+	var timestamp int64
+	haveTimestamp := false
+	var signatures []string
+
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return 0, nil, ErrInvalidHeader
+		}
+		switch key {
+		case "t":
+			t, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return 0, nil, ErrInvalidHeader
+			}
+			timestamp, haveTimestamp = t, true
+		case scheme:
+			signatures = append(signatures, value)
+		}
+		// Unknown schemes are skipped so newer ones can be added alongside v1
+	}
+
+	if !haveTimestamp {
+		return 0, nil, ErrInvalidHeader
+	}
+	if len(signatures) == 0 {
+		return 0, nil, ErrNoSignature
+	}
+	return timestamp, signatures, nil
+}
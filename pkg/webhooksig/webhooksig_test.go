@@ -0,0 +1,49 @@
+package webhooksig
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeSignature(t *testing.T) {
+	// Calculated using: echo -n "1700000000.payload" | openssl dgst -sha256 -hmac "secret"
+	expected := "5af4877ab3c93d3201223b2c43d689a4c1e849ddd9091e066f03be6168ae79e9"
+
+	if got := ComputeSignature("secret", 1700000000, []byte("payload")); got != expected {
+		t.Errorf("ComputeSignature() = %v, want %v", got, expected)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	payload := []byte(`{"event":"link.created"}`)
+	signedAt := time.Unix(1700000000, 0)
+	header := SignHeader(signedAt.Unix(), payload, "whsec_new", "whsec_old")
+
+	tests := []struct {
+		name    string
+		payload []byte
+		header  string
+		secret  string
+		now     time.Time
+		want    error
+	}{
+		{"new secret", payload, header, "whsec_new", signedAt, nil},
+		{"old secret during rotation", payload, header, "whsec_old", signedAt.Add(time.Minute), nil},
+		{"unknown secret", payload, header, "whsec_other", signedAt, ErrSignatureMismatch},
+		{"tampered body", []byte(`{"event":"link.updated"}`), header, "whsec_new", signedAt, ErrSignatureMismatch},
+		{"replayed later", payload, header, "whsec_new", signedAt.Add(time.Hour), ErrTooOld},
+		{"from the future", payload, header, "whsec_new", signedAt.Add(-time.Hour), ErrTooOld},
+		{"timestamp swapped", payload, "t=1700003600," + header[len("t=1700000000,"):], "whsec_new", signedAt.Add(time.Hour), ErrSignatureMismatch},
+		{"future scheme only", payload, "t=1700000000,v2=abc", "whsec_new", signedAt, ErrNoSignature},
+		{"no timestamp", payload, "v1=abc", "whsec_new", signedAt, ErrInvalidHeader},
+		{"bare body signature", payload, "5af4877ab3c93d32", "whsec_new", signedAt, ErrInvalidHeader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyAt(tt.payload, tt.header, tt.secret, 0, tt.now); err != tt.want {
+				t.Errorf("VerifyAt() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}